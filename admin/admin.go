@@ -0,0 +1,467 @@
+package admin
+
+import (
+	"crypto/subtle"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log"
+	"net"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/michivip/mcstatusserver/bans"
+	"github.com/michivip/mcstatusserver/commands"
+	"github.com/michivip/mcstatusserver/configuration"
+	"github.com/michivip/mcstatusserver/server"
+)
+
+// this package contains the HTTP API which reads and changes the state of a running server
+// the changed values are kept until the server is restarted or the configuration is reloaded
+
+// the source which is written into ban entries created with the API
+const banSource = commands.AdminApiSource
+
+// the maximum size of a request body
+const maximumBodySize = 1 << 20
+
+// the prefix of the favicons which can be set with the API
+const faviconPrefix = "data:image/png;base64,"
+
+// serves the admin API of a server, every request has to send the token as bearer token
+type Handler struct {
+	// executes the commands of POST /commands (nil if the commands are not available)
+	Commands *commands.Registry
+
+	server *server.Server
+	token  string
+	// reads the configuration file and the ban lists again (nil if the configuration can not be reloaded)
+	reload func() error
+	routes []route
+}
+
+type route struct {
+	method string
+	// the path of the route, a trailing slash matches all paths which start with it (the rest is passed as argument)
+	path    string
+	handler func(writer http.ResponseWriter, request *http.Request, argument string) error
+}
+
+// this method creates the handler of the admin API of the given server
+// returns an error if the token is empty because the API must not be used without authentication
+func NewHandler(server *server.Server, token string, reload func() error) (*Handler, error) {
+	if token == "" {
+		return nil, fmt.Errorf("the admin API needs a token")
+	}
+	handler := &Handler{server: server, token: token, reload: reload}
+	handler.routes = []route{
+		{http.MethodGet, "/motd", handler.getMotd},
+		{http.MethodPut, "/motd", handler.putMotd},
+		{http.MethodPut, "/motd/profile", handler.putMotdProfile},
+		{http.MethodGet, "/players", handler.getPlayers},
+		{http.MethodPut, "/players", handler.putPlayers},
+		{http.MethodGet, "/maintenance", handler.getMaintenance},
+		{http.MethodPut, "/maintenance", handler.putMaintenance},
+		{http.MethodGet, "/connections", handler.getConnections},
+		{http.MethodPost, "/connections/", handler.kickConnection},
+		{http.MethodGet, "/bans", handler.getBans},
+		{http.MethodPost, "/bans/players", handler.banPlayer},
+		{http.MethodDelete, "/bans/players/", handler.pardonPlayer},
+		{http.MethodPost, "/bans/ips", handler.banIp},
+		{http.MethodDelete, "/bans/ips/", handler.pardonIp},
+		{http.MethodPost, "/reload", handler.reloadConfiguration},
+		{http.MethodGet, "/access-events", handler.getAccessEvents},
+		{http.MethodGet, "/commands", handler.getCommands},
+		{http.MethodPost, "/commands", handler.executeCommand},
+		{http.MethodGet, "/commands/completions", handler.getCompletions},
+	}
+	return handler, nil
+}
+
+// this method serves the admin API on the given listener until it is closed
+func Serve(listener net.Listener, handler *Handler) error {
+	httpServer := &http.Server{Handler: handler, ReadHeaderTimeout: 10 * time.Second}
+	return httpServer.Serve(listener)
+}
+
+// an error which is answered with the given status code
+type errStatus struct {
+	Status  int
+	Message string
+}
+
+func (errStatus errStatus) Error() string {
+	return errStatus.Message
+}
+
+func (handler *Handler) ServeHTTP(writer http.ResponseWriter, request *http.Request) {
+	authorization := request.Header.Get("Authorization")
+	if !strings.HasPrefix(authorization, "Bearer ") || subtle.ConstantTimeCompare([]byte(authorization[len("Bearer "):]), []byte(handler.token)) != 1 {
+		writer.Header().Set("WWW-Authenticate", "Bearer")
+		writeError(writer, errStatus{http.StatusUnauthorized, "invalid token"})
+		return
+	}
+	pathFound := false
+	for _, route := range handler.routes {
+		argument := ""
+		if strings.HasSuffix(route.path, "/") {
+			if !strings.HasPrefix(request.URL.Path, route.path) || len(request.URL.Path) == len(route.path) {
+				continue
+			}
+			argument = request.URL.Path[len(route.path):]
+		} else if request.URL.Path != route.path {
+			continue
+		}
+		pathFound = true
+		if route.method != request.Method {
+			continue
+		}
+		request.Body = http.MaxBytesReader(writer, request.Body, maximumBodySize)
+		if err := route.handler(writer, request, argument); err != nil {
+			writeError(writer, err)
+		} else if request.Method != http.MethodGet {
+			log.Printf("[%v] Admin API request: %v %v\n", request.RemoteAddr, request.Method, request.URL.Path)
+		}
+		return
+	}
+	if pathFound {
+		writeError(writer, errStatus{http.StatusMethodNotAllowed, "method not allowed"})
+	} else {
+		writeError(writer, errStatus{http.StatusNotFound, "not found"})
+	}
+}
+
+func writeJson(writer http.ResponseWriter, status int, value interface{}) {
+	writer.Header().Set("Content-Type", "application/json")
+	writer.WriteHeader(status)
+	encoder := json.NewEncoder(writer)
+	encoder.SetIndent("", "  ")
+	encoder.Encode(value)
+}
+
+// errors which are not an errStatus are internal server errors
+func writeError(writer http.ResponseWriter, err error) {
+	status := http.StatusInternalServerError
+	if statusError, ok := err.(errStatus); ok {
+		status = statusError.Status
+	}
+	writeJson(writer, status, map[string]string{"error": err.Error()})
+}
+
+// this method decodes the request body onto the given target
+// the target should contain a copy of the current values, fields which are not in the body keep their values
+func decodeBody(request *http.Request, target interface{}) error {
+	decoder := json.NewDecoder(request.Body)
+	decoder.DisallowUnknownFields()
+	if err := decoder.Decode(target); err != nil && err != io.EOF {
+		return errStatus{http.StatusBadRequest, fmt.Sprintf("invalid request body: %v", err)}
+	}
+	return nil
+}
+
+// this method copies the given value into the target (including its slices which are shared with the configuration otherwise)
+func deepCopy(value interface{}, target interface{}) {
+	encoded, err := json.Marshal(value)
+	if err != nil {
+		panic(err)
+	}
+	if err = json.Unmarshal(encoded, target); err != nil {
+		panic(err)
+	}
+}
+
+func (handler *Handler) getMotd(writer http.ResponseWriter, request *http.Request, _ string) error {
+	config := handler.server.Configuration()
+	profiles := []string{}
+	for name := range config.MotdProfiles {
+		profiles = append(profiles, name)
+	}
+	sort.Strings(profiles)
+	writeJson(writer, http.StatusOK, map[string]interface{}{"motd": config.Motd, "profiles": profiles})
+	return nil
+}
+
+// the MOTD is replaced by the body, fields which are left out keep their values
+// the favicon has to be a data URL, files of the server are not read because the favicon is visible to everyone
+func (handler *Handler) putMotd(writer http.ResponseWriter, request *http.Request, _ string) error {
+	var motd configuration.MessageOfTheDayValues
+	deepCopy(handler.server.Configuration().Motd, &motd)
+	if err := decodeBody(request, &motd); err != nil {
+		return err
+	}
+	if motd.FaviconPath != "" && !strings.HasPrefix(motd.FaviconPath, faviconPrefix) {
+		return errStatus{http.StatusBadRequest, "the favicon has to be a data URL (" + faviconPrefix + "...)"}
+	}
+	handler.server.UpdateConfiguration(func(config *configuration.ServerConfiguration) {
+		config.Motd = motd
+	})
+	writeJson(writer, http.StatusOK, motd)
+	return nil
+}
+
+// the MOTD is replaced by the profile with the name of the body ({"name": "..."})
+func (handler *Handler) putMotdProfile(writer http.ResponseWriter, request *http.Request, _ string) error {
+	var body struct {
+		Name string `json:"name"`
+	}
+	if err := decodeBody(request, &body); err != nil {
+		return err
+	}
+	var motd configuration.MessageOfTheDayValues
+	found := false
+	handler.server.UpdateConfiguration(func(config *configuration.ServerConfiguration) {
+		if motd, found = config.MotdProfiles[body.Name]; found {
+			config.Motd = motd
+		}
+	})
+	if !found {
+		return errStatus{http.StatusNotFound, fmt.Sprintf("there is no MOTD profile %q", body.Name)}
+	}
+	writeJson(writer, http.StatusOK, motd)
+	return nil
+}
+
+func (handler *Handler) getPlayers(writer http.ResponseWriter, request *http.Request, _ string) error {
+	writeJson(writer, http.StatusOK, handler.server.Configuration().Motd.Players)
+	return nil
+}
+
+// the player counts and the sample are replaced by the body, fields which are left out keep their values
+func (handler *Handler) putPlayers(writer http.ResponseWriter, request *http.Request, _ string) error {
+	players := handler.server.Configuration().Motd.Players
+	players.Sample = append(players.Sample[:0:0], players.Sample...)
+	if err := decodeBody(request, &players); err != nil {
+		return err
+	}
+	handler.server.UpdateConfiguration(func(config *configuration.ServerConfiguration) {
+		config.Motd.Players = players
+	})
+	writeJson(writer, http.StatusOK, players)
+	return nil
+}
+
+func (handler *Handler) getMaintenance(writer http.ResponseWriter, request *http.Request, _ string) error {
+	writeJson(writer, http.StatusOK, handler.server.Configuration().Maintenance)
+	return nil
+}
+
+// the maintenance values are replaced by the body, fields which are left out keep their values
+// (e.g. {"enabled": true} enables the maintenance mode with the configured texts)
+func (handler *Handler) putMaintenance(writer http.ResponseWriter, request *http.Request, _ string) error {
+	var maintenance configuration.MaintenanceValues
+	deepCopy(handler.server.Configuration().Maintenance, &maintenance)
+	if err := decodeBody(request, &maintenance); err != nil {
+		return err
+	}
+	handler.server.UpdateConfiguration(func(config *configuration.ServerConfiguration) {
+		config.Maintenance = maintenance
+	})
+	log.Printf("The maintenance mode was set by the admin API. [enabled=%v]\n", maintenance.Enabled)
+	writeJson(writer, http.StatusOK, maintenance)
+	return nil
+}
+
+// the info of a connection and the time since it was accepted
+type connectionResponse struct {
+	server.ConnectionInfo
+	AgeMilliseconds int64 `json:"age-ms"`
+}
+
+func (handler *Handler) getConnections(writer http.ResponseWriter, request *http.Request, _ string) error {
+	connections := []connectionResponse{}
+	for _, info := range handler.server.Connections() {
+		connections = append(connections, connectionResponse{info, int64(time.Since(info.ConnectedAt) / time.Millisecond)})
+	}
+	writeJson(writer, http.StatusOK, connections)
+	return nil
+}
+
+// POST /connections/<id>/kick with an optional body {"text": DisconnectText}
+func (handler *Handler) kickConnection(writer http.ResponseWriter, request *http.Request, argument string) error {
+	if !strings.HasSuffix(argument, "/kick") {
+		return errStatus{http.StatusNotFound, "not found"}
+	}
+	id, err := strconv.ParseUint(strings.TrimSuffix(argument, "/kick"), 10, 64)
+	if err != nil {
+		return errStatus{http.StatusBadRequest, "invalid connection id"}
+	}
+	body := struct {
+		Text configuration.ChatValue `json:"text"`
+	}{server.DefaultKickText}
+	if err := decodeBody(request, &body); err != nil {
+		return err
+	}
+	if !handler.server.Kick(id, body.Text) {
+		return errStatus{http.StatusNotFound, fmt.Sprintf("there is no open connection with the id %v", id)}
+	}
+	writer.WriteHeader(http.StatusNoContent)
+	return nil
+}
+
+func (handler *Handler) getBans(writer http.ResponseWriter, request *http.Request, _ string) error {
+	banLists := handler.server.BanLists
+	writeJson(writer, http.StatusOK, map[string]interface{}{
+		"ips":     nonNil(banLists.IpBans()),
+		"players": nonNil(banLists.PlayerBans()),
+	})
+	return nil
+}
+
+// empty lists are encoded as [] instead of null
+func nonNil(list interface{}) interface{} {
+	switch list := list.(type) {
+	case []bans.IpBan:
+		if list == nil {
+			return []bans.IpBan{}
+		}
+	case []bans.PlayerBan:
+		if list == nil {
+			return []bans.PlayerBan{}
+		}
+	}
+	return list
+}
+
+// the body of a ban request, the expiration is optional (RFC 3339)
+type banRequest struct {
+	Name    string    `json:"name"`
+	Ip      string    `json:"ip"`
+	Reason  string    `json:"reason"`
+	Expires time.Time `json:"expires"`
+}
+
+func (handler *Handler) banPlayer(writer http.ResponseWriter, request *http.Request, _ string) error {
+	body := banRequest{}
+	if err := decodeBody(request, &body); err != nil {
+		return err
+	} else if body.Name == "" {
+		return errStatus{http.StatusBadRequest, "the name of the player is missing"}
+	}
+	if err := handler.server.BanLists.BanPlayer(body.Name, banSource, body.Reason, body.Expires); err != nil {
+		if _, unknown := err.(bans.ErrUnknownPlayer); unknown {
+			return errStatus{http.StatusNotFound, err.Error()}
+		}
+		return err
+	}
+	writer.WriteHeader(http.StatusNoContent)
+	return nil
+}
+
+func (handler *Handler) pardonPlayer(writer http.ResponseWriter, request *http.Request, name string) error {
+	if removed, err := handler.server.BanLists.PardonPlayer(name); err != nil {
+		return err
+	} else if !removed {
+		return errStatus{http.StatusNotFound, fmt.Sprintf("the player %v is not banned", name)}
+	}
+	writer.WriteHeader(http.StatusNoContent)
+	return nil
+}
+
+func (handler *Handler) banIp(writer http.ResponseWriter, request *http.Request, _ string) error {
+	body := banRequest{}
+	if err := decodeBody(request, &body); err != nil {
+		return err
+	} else if body.Ip == "" {
+		return errStatus{http.StatusBadRequest, "the ip is missing"}
+	}
+	if err := handler.server.BanLists.BanIp(body.Ip, banSource, body.Reason, body.Expires); err != nil {
+		if _, invalid := err.(bans.ErrInvalidIpValue); invalid {
+			return errStatus{http.StatusBadRequest, err.Error()}
+		}
+		return err
+	}
+	writer.WriteHeader(http.StatusNoContent)
+	return nil
+}
+
+// DELETE /bans/ips/<address|network> (e.g. /bans/ips/10.0.0.0/8)
+func (handler *Handler) pardonIp(writer http.ResponseWriter, request *http.Request, ip string) error {
+	if removed, err := handler.server.BanLists.PardonIp(ip); err != nil {
+		return err
+	} else if !removed {
+		return errStatus{http.StatusNotFound, fmt.Sprintf("the address %v is not banned", ip)}
+	}
+	writer.WriteHeader(http.StatusNoContent)
+	return nil
+}
+
+func (handler *Handler) reloadConfiguration(writer http.ResponseWriter, request *http.Request, _ string) error {
+	if handler.reload == nil {
+		return errStatus{http.StatusNotImplemented, "the configuration can not be reloaded"}
+	}
+	if err := handler.reload(); err != nil {
+		return err
+	}
+	writer.WriteHeader(http.StatusNoContent)
+	return nil
+}
+
+// GET /access-events?limit=<n> returns the last access events, the newest event comes first
+func (handler *Handler) getAccessEvents(writer http.ResponseWriter, request *http.Request, _ string) error {
+	limit := 0
+	if value := request.URL.Query().Get("limit"); value != "" {
+		var err error
+		if limit, err = strconv.Atoi(value); err != nil || limit < 0 {
+			return errStatus{http.StatusBadRequest, "invalid limit"}
+		}
+	}
+	writeJson(writer, http.StatusOK, handler.server.RecentAccessEvents(limit))
+	return nil
+}
+
+func (handler *Handler) commandRegistry() (*commands.Registry, error) {
+	if handler.Commands == nil {
+		return nil, errStatus{http.StatusNotImplemented, "the commands are not available"}
+	}
+	return handler.Commands, nil
+}
+
+// GET /commands returns the commands with their arguments and subcommands
+func (handler *Handler) getCommands(writer http.ResponseWriter, request *http.Request, _ string) error {
+	registry, err := handler.commandRegistry()
+	if err != nil {
+		return err
+	}
+	writeJson(writer, http.StatusOK, registry.Commands())
+	return nil
+}
+
+// POST /commands with the body {"command": "..."} executes a console command and returns its output ({"output": "..."})
+func (handler *Handler) executeCommand(writer http.ResponseWriter, request *http.Request, _ string) error {
+	registry, err := handler.commandRegistry()
+	if err != nil {
+		return err
+	}
+	var body struct {
+		Command string `json:"command"`
+	}
+	if err := decodeBody(request, &body); err != nil {
+		return err
+	}
+	output := &strings.Builder{}
+	switch err := registry.Execute(body.Command, commands.AdminApiSource, output).(type) {
+	case nil:
+	case commands.ErrUnknownCommand:
+		return errStatus{http.StatusNotFound, err.Error()}
+	case commands.ErrUsage:
+		return errStatus{http.StatusBadRequest, err.Error()}
+	default:
+		return errStatus{http.StatusUnprocessableEntity, err.Error()}
+	}
+	log.Printf("[%v] Admin API command: %v\n", request.RemoteAddr, body.Command)
+	writeJson(writer, http.StatusOK, map[string]string{"output": output.String()})
+	return nil
+}
+
+// GET /commands/completions?line=<line> returns the values which complete the last word of the command line
+func (handler *Handler) getCompletions(writer http.ResponseWriter, request *http.Request, _ string) error {
+	registry, err := handler.commandRegistry()
+	if err != nil {
+		return err
+	}
+	writeJson(writer, http.StatusOK, registry.Complete(request.URL.Query().Get("line")))
+	return nil
+}
@@ -0,0 +1,217 @@
+package admin
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/michivip/mcstatusserver/bans"
+	"github.com/michivip/mcstatusserver/commands"
+	"github.com/michivip/mcstatusserver/configuration"
+	"github.com/michivip/mcstatusserver/server"
+)
+
+const testToken = "secret"
+
+// this method starts the admin API of a server which is not listening (its connections are not needed by the tests)
+func startTestApi(t *testing.T, reload func() error) (*server.Server, *httptest.Server) {
+	config := configuration.DefaultConfiguration()
+	config.Motd.FaviconPath = ""
+	eventMotd := config.Motd
+	eventMotd.Description.Text = "event"
+	config.MotdProfiles = map[string]configuration.MessageOfTheDayValues{"event": eventMotd}
+	banLists, err := bans.LoadLists("", "", "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	mcServer := server.NewServer(config, banLists)
+	handler, err := NewHandler(mcServer, testToken, reload)
+	if err != nil {
+		t.Fatal(err)
+	}
+	httpServer := httptest.NewServer(handler)
+	t.Cleanup(httpServer.Close)
+	return mcServer, httpServer
+}
+
+// this method sends a request with the token and decodes the JSON response into the given value (if it is not nil)
+func request(t *testing.T, httpServer *httptest.Server, method, path, body string, expectedStatus int, response interface{}) {
+	t.Helper()
+	httpRequest, err := http.NewRequest(method, httpServer.URL+path, strings.NewReader(body))
+	if err != nil {
+		t.Fatal(err)
+	}
+	httpRequest.Header.Set("Authorization", "Bearer "+testToken)
+	httpResponse, err := http.DefaultClient.Do(httpRequest)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer httpResponse.Body.Close()
+	if httpResponse.StatusCode != expectedStatus {
+		t.Fatalf("%v %v was answered with %v instead of %v", method, path, httpResponse.Status, expectedStatus)
+	}
+	if response != nil {
+		if err := json.NewDecoder(httpResponse.Body).Decode(response); err != nil {
+			t.Fatalf("%v %v was answered with invalid JSON: %v", method, path, err)
+		}
+	}
+}
+
+func TestAuthentication(t *testing.T) {
+	if _, err := NewHandler(nil, "", nil); err == nil {
+		t.Error("a handler without a token was created")
+	}
+	_, httpServer := startTestApi(t, nil)
+	for _, authorization := range []string{"", "Bearer wrong", testToken} {
+		httpRequest, _ := http.NewRequest(http.MethodGet, httpServer.URL+"/motd", nil)
+		httpRequest.Header.Set("Authorization", authorization)
+		httpResponse, err := http.DefaultClient.Do(httpRequest)
+		if err != nil {
+			t.Fatal(err)
+		}
+		httpResponse.Body.Close()
+		if httpResponse.StatusCode != http.StatusUnauthorized {
+			t.Errorf("the authorization %q was answered with %v", authorization, httpResponse.Status)
+		}
+	}
+	request(t, httpServer, http.MethodGet, "/unknown", "", http.StatusNotFound, nil)
+	request(t, httpServer, http.MethodDelete, "/motd", "", http.StatusMethodNotAllowed, nil)
+}
+
+func TestMotdAndPlayers(t *testing.T) {
+	mcServer, httpServer := startTestApi(t, nil)
+	original := mcServer.Configuration()
+	var motd struct {
+		Motd     configuration.MessageOfTheDayValues `json:"motd"`
+		Profiles []string                            `json:"profiles"`
+	}
+	request(t, httpServer, http.MethodGet, "/motd", "", http.StatusOK, &motd)
+	if motd.Motd.Description.Text != original.Motd.Description.Text || len(motd.Profiles) != 1 || motd.Profiles[0] != "event" {
+		t.Errorf("received an unexpected MOTD: %+v", motd)
+	}
+	request(t, httpServer, http.MethodPut, "/motd", `{"description": {"text": "changed"}}`, http.StatusOK, nil)
+	if config := mcServer.Configuration(); config.Motd.Description.Text != "changed" || config.Motd.Players.Max != original.Motd.Players.Max {
+		t.Errorf("the MOTD was changed to %+v", config.Motd)
+	}
+	request(t, httpServer, http.MethodPut, "/motd", `{"favicon-path": "/etc/passwd"}`, http.StatusBadRequest, nil)
+	request(t, httpServer, http.MethodPut, "/motd/profile", `{"name": "event"}`, http.StatusOK, nil)
+	if text := mcServer.Configuration().Motd.Description.Text; text != "event" {
+		t.Errorf("the MOTD profile was not selected: %v", text)
+	}
+	request(t, httpServer, http.MethodPut, "/motd/profile", `{"name": "unknown"}`, http.StatusNotFound, nil)
+	request(t, httpServer, http.MethodPut, "/players", `{"online": 7, "sample": [{"name": "Notch", "id": "069a79f4-44e9-4726-a5be-fca90e38aaf5"}]}`, http.StatusOK, nil)
+	players := mcServer.Configuration().Motd.Players
+	if players.Online != 7 || players.Max != original.Motd.Players.Max || len(players.Sample) != 1 || players.Sample[0].Name != "Notch" {
+		t.Errorf("the players were changed to %+v", players)
+	}
+	if original.Motd.Description.Text == "changed" || len(original.Motd.Players.Sample) != 2 {
+		t.Errorf("the previous configuration was modified: %+v", original.Motd)
+	}
+	request(t, httpServer, http.MethodPut, "/players", `{"unknown": 1}`, http.StatusBadRequest, nil)
+}
+
+func TestMaintenance(t *testing.T) {
+	mcServer, httpServer := startTestApi(t, nil)
+	var maintenance configuration.MaintenanceValues
+	request(t, httpServer, http.MethodPut, "/maintenance", `{"enabled": true}`, http.StatusOK, &maintenance)
+	if !maintenance.Enabled || maintenance.DisconnectText.Text != configuration.DefaultConfiguration().Maintenance.DisconnectText.Text {
+		t.Errorf("the maintenance mode was changed to %+v", maintenance)
+	}
+	request(t, httpServer, http.MethodPut, "/maintenance", `{"disconnect-text": {"text": "back at 8pm"}}`, http.StatusOK, nil)
+	if maintenance := mcServer.Configuration().Maintenance; !maintenance.Enabled || maintenance.DisconnectText.Text != "back at 8pm" {
+		t.Errorf("the maintenance text was changed to %+v", maintenance)
+	}
+	request(t, httpServer, http.MethodPut, "/maintenance", `{"enabled": false}`, http.StatusOK, nil)
+	request(t, httpServer, http.MethodGet, "/maintenance", "", http.StatusOK, &maintenance)
+	if maintenance.Enabled {
+		t.Error("the maintenance mode was not disabled")
+	}
+}
+
+func TestBans(t *testing.T) {
+	mcServer, httpServer := startTestApi(t, nil)
+	request(t, httpServer, http.MethodPost, "/bans/players", `{"name": "Notch", "reason": "test"}`, http.StatusNoContent, nil)
+	request(t, httpServer, http.MethodPost, "/bans/ips", `{"ip": "10.0.0.0/8"}`, http.StatusNoContent, nil)
+	request(t, httpServer, http.MethodPost, "/bans/ips", `{"ip": "invalid"}`, http.StatusBadRequest, nil)
+	var banList struct {
+		Ips     []bans.IpBan     `json:"ips"`
+		Players []bans.PlayerBan `json:"players"`
+	}
+	request(t, httpServer, http.MethodGet, "/bans", "", http.StatusOK, &banList)
+	if len(banList.Ips) != 1 || len(banList.Players) != 1 || banList.Players[0].Source != banSource || banList.Players[0].Reason != "test" {
+		t.Errorf("received unexpected bans: %+v", banList)
+	}
+	request(t, httpServer, http.MethodDelete, "/bans/ips/10.0.0.0/8", "", http.StatusNoContent, nil)
+	request(t, httpServer, http.MethodDelete, "/bans/players/Notch", "", http.StatusNoContent, nil)
+	request(t, httpServer, http.MethodDelete, "/bans/players/Notch", "", http.StatusNotFound, nil)
+	if len(mcServer.BanLists.IpBans()) != 0 || len(mcServer.BanLists.PlayerBans()) != 0 {
+		t.Error("the bans were not removed")
+	}
+	// a ban which could not be saved is an internal error and is not added
+	mcServer.BanLists.BannedIpsFile = filepath.Join(t.TempDir(), "missing", "banned-ips.json")
+	request(t, httpServer, http.MethodPost, "/bans/ips", `{"ip": "10.0.0.1"}`, http.StatusInternalServerError, nil)
+	if len(mcServer.BanLists.IpBans()) != 0 {
+		t.Error("the ban was added although it was not saved")
+	}
+}
+
+func TestConnectionsAndReload(t *testing.T) {
+	reloaded := 0
+	_, httpServer := startTestApi(t, func() error {
+		if reloaded++; reloaded > 1 {
+			return errors.New("invalid configuration")
+		}
+		return nil
+	})
+	var connections []interface{}
+	request(t, httpServer, http.MethodGet, "/connections", "", http.StatusOK, &connections)
+	if len(connections) != 0 {
+		t.Errorf("received unexpected connections: %v", connections)
+	}
+	request(t, httpServer, http.MethodPost, "/connections/1/kick", "", http.StatusNotFound, nil)
+	request(t, httpServer, http.MethodPost, "/connections/first/kick", "", http.StatusBadRequest, nil)
+	var events []interface{}
+	request(t, httpServer, http.MethodGet, "/access-events?limit=10", "", http.StatusOK, &events)
+	request(t, httpServer, http.MethodGet, "/access-events?limit=-1", "", http.StatusBadRequest, nil)
+	request(t, httpServer, http.MethodPost, "/reload", "", http.StatusNoContent, nil)
+	request(t, httpServer, http.MethodPost, "/reload", "", http.StatusInternalServerError, nil)
+}
+
+func TestCommands(t *testing.T) {
+	mcServer, httpServer := startTestApi(t, nil)
+	request(t, httpServer, http.MethodPost, "/commands", `{"command": "help"}`, http.StatusNotImplemented, nil)
+	handler := httpServer.Config.Handler.(*Handler)
+	handler.Commands = commands.NewRegistry()
+	handler.Commands.Register(&commands.Command{
+		Name:      "ban",
+		Arguments: []commands.Argument{{Name: "player"}},
+		Execute: func(context *commands.Context, arguments []string) error {
+			context.Printf("Banned player %v.", arguments[0])
+			return mcServer.BanLists.BanPlayer(arguments[0], context.Source, "", time.Time{})
+		},
+	})
+	var response struct {
+		Output string `json:"output"`
+	}
+	request(t, httpServer, http.MethodPost, "/commands", `{"command": "ban Notch"}`, http.StatusOK, &response)
+	if playerBans := mcServer.BanLists.PlayerBans(); response.Output != "Banned player Notch.\n" || len(playerBans) != 1 || playerBans[0].Source != banSource {
+		t.Errorf("the command was answered with %q and created the bans %+v", response.Output, playerBans)
+	}
+	request(t, httpServer, http.MethodPost, "/commands", `{"command": "ban"}`, http.StatusBadRequest, nil)
+	request(t, httpServer, http.MethodPost, "/commands", `{"command": "unknown"}`, http.StatusNotFound, nil)
+	var registered []commands.Command
+	request(t, httpServer, http.MethodGet, "/commands", "", http.StatusOK, &registered)
+	if len(registered) != 2 || registered[0].Name != "ban" || registered[0].Arguments[0].Name != "player" {
+		t.Errorf("received unexpected commands: %+v", registered)
+	}
+	var completions []string
+	request(t, httpServer, http.MethodGet, "/commands/completions?line=he", "", http.StatusOK, &completions)
+	if len(completions) != 1 || completions[0] != "help" {
+		t.Errorf("received unexpected completions: %v", completions)
+	}
+}
@@ -0,0 +1,161 @@
+package main
+
+import (
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/michivip/mcstatusserver/bans"
+	"github.com/michivip/mcstatusserver/commands"
+)
+
+// returns the commands which edit the ban lists and the whitelist, bans are created with the source of the command
+func banCommands(banLists *bans.Lists) []*commands.Command {
+	bannedPlayers := func() []string {
+		names := []string{}
+		for _, playerBan := range banLists.PlayerBans() {
+			names = append(names, playerBan.Name)
+		}
+		return names
+	}
+	bannedIps := func() []string {
+		ips := []string{}
+		for _, ipBan := range banLists.IpBans() {
+			ips = append(ips, ipBan.Ip)
+		}
+		return ips
+	}
+	whitelistedPlayers := func() []string {
+		names := []string{}
+		for _, entry := range banLists.Whitelisted() {
+			names = append(names, entry.Name)
+		}
+		return names
+	}
+	return []*commands.Command{
+		{
+			Name:        "ban",
+			Description: "Bans a player.",
+			Arguments:   []commands.Argument{{Name: "player"}, {Name: "reason", Optional: true, Rest: true}},
+			Execute: func(context *commands.Context, arguments []string) error {
+				if err := banLists.BanPlayer(arguments[0], context.Source, banReason(arguments[1:]), time.Time{}); err != nil {
+					return fmt.Errorf("Could not ban player %v: %v", arguments[0], err)
+				}
+				context.Printf("Banned player %v.", arguments[0])
+				return nil
+			},
+		},
+		{
+			Name:        "ban-ip",
+			Description: "Bans an ip address or a CIDR network.",
+			Arguments:   []commands.Argument{{Name: "address|network"}, {Name: "reason", Optional: true, Rest: true}},
+			Execute: func(context *commands.Context, arguments []string) error {
+				if err := banLists.BanIp(arguments[0], context.Source, banReason(arguments[1:]), time.Time{}); err != nil {
+					return fmt.Errorf("Could not ban address %v: %v", arguments[0], err)
+				}
+				context.Printf("Banned address %v.", arguments[0])
+				return nil
+			},
+		},
+		{
+			Name:        "pardon",
+			Description: "Removes the ban of a player.",
+			Arguments:   []commands.Argument{{Name: "player", Suggestions: bannedPlayers}},
+			Execute: func(context *commands.Context, arguments []string) error {
+				if removed, err := banLists.PardonPlayer(arguments[0]); err != nil {
+					return fmt.Errorf("Could not pardon player %v: %v", arguments[0], err)
+				} else if !removed {
+					return fmt.Errorf("Player %v is not banned.", arguments[0])
+				}
+				context.Printf("Unbanned player %v.", arguments[0])
+				return nil
+			},
+		},
+		{
+			Name:        "pardon-ip",
+			Description: "Removes the ban of an ip address or a CIDR network.",
+			Arguments:   []commands.Argument{{Name: "address|network", Suggestions: bannedIps}},
+			Execute: func(context *commands.Context, arguments []string) error {
+				if removed, err := banLists.PardonIp(arguments[0]); err != nil {
+					return fmt.Errorf("Could not pardon address %v: %v", arguments[0], err)
+				} else if !removed {
+					return fmt.Errorf("Address %v is not banned.", arguments[0])
+				}
+				context.Printf("Unbanned address %v.", arguments[0])
+				return nil
+			},
+		},
+		{
+			Name:        "banlist",
+			Description: "Lists all bans.",
+			Execute: func(context *commands.Context, _ []string) error {
+				for _, ipBan := range banLists.IpBans() {
+					context.Printf("Address %v is banned by %v: %v (expires: %v)", ipBan.Ip, ipBan.Source, ipBan.Reason, ipBan.Expires)
+				}
+				for _, playerBan := range banLists.PlayerBans() {
+					context.Printf("Player %v is banned by %v: %v (expires: %v)", playerBan.Name, playerBan.Source, playerBan.Reason, playerBan.Expires)
+				}
+				return nil
+			},
+		},
+		{
+			Name:        "whitelist",
+			Description: "Edits the whitelist.",
+			Subcommands: []*commands.Command{
+				{
+					Name:        "add",
+					Description: "Adds a player to the whitelist.",
+					Arguments:   []commands.Argument{{Name: "player"}},
+					Execute: func(context *commands.Context, arguments []string) error {
+						return changeWhitelist(context, "add", arguments[0], banLists.AddToWhitelist)
+					},
+				},
+				{
+					Name:        "remove",
+					Description: "Removes a player from the whitelist.",
+					Arguments:   []commands.Argument{{Name: "player", Suggestions: whitelistedPlayers}},
+					Execute: func(context *commands.Context, arguments []string) error {
+						return changeWhitelist(context, "remove", arguments[0], banLists.RemoveFromWhitelist)
+					},
+				},
+				{
+					Name:        "list",
+					Description: "Lists the whitelisted players.",
+					Execute: func(context *commands.Context, _ []string) error {
+						names := whitelistedPlayers()
+						context.Printf("There are %v whitelisted players: %v", len(names), strings.Join(names, ", "))
+						return nil
+					},
+				},
+				{
+					Name:        "reload",
+					Description: "Reloads all ban list files.",
+					Execute: func(context *commands.Context, _ []string) error {
+						if err := banLists.Reload(); err != nil {
+							return fmt.Errorf("Could not reload the ban lists: %v", err)
+						}
+						context.Printf("Reloaded the ban lists and the whitelist.")
+						return nil
+					},
+				},
+			},
+		},
+	}
+}
+
+func changeWhitelist(context *commands.Context, action, name string, change func(name string) (bool, error)) error {
+	if changed, err := change(name); err != nil {
+		return fmt.Errorf("Could not update the whitelist: %v", err)
+	} else if !changed {
+		return fmt.Errorf("The whitelist was not changed by %v %v.", action, name)
+	}
+	context.Printf("Whitelist: %v %v.", action, name)
+	return nil
+}
+
+func banReason(arguments []string) string {
+	if len(arguments) == 0 {
+		return "Banned by an operator."
+	}
+	return strings.Join(arguments, " ")
+}
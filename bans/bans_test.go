@@ -0,0 +1,303 @@
+package bans
+
+import (
+	"bytes"
+	"io/ioutil"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestParseIpNetwork(t *testing.T) {
+	for _, test := range []struct {
+		value    string
+		network  string
+		contains []string
+		excludes []string
+	}{
+		{"192.168.178.21", "192.168.178.21/32", []string{"192.168.178.21", "::ffff:192.168.178.21"}, []string{"192.168.178.22"}},
+		{"2001:db8::1", "2001:db8::1/128", []string{"2001:db8::1"}, []string{"2001:db8::2"}},
+		{"10.0.0.0/8", "10.0.0.0/8", []string{"10.0.0.1", "10.255.255.255"}, []string{"11.0.0.0"}},
+		{"10.1.2.3/8", "10.0.0.0/8", []string{"10.0.0.1"}, nil},
+		{"2001:db8::/32", "2001:db8::/32", []string{"2001:db8:ffff::1"}, []string{"2001:db9::1", "10.0.0.1"}},
+	} {
+		network, err := ParseIpNetwork(test.value)
+		if err != nil {
+			t.Errorf("%v could not be parsed: %v", test.value, err)
+			continue
+		} else if network.String() != test.network {
+			t.Errorf("%v was parsed as %v instead of %v", test.value, network, test.network)
+		}
+		for _, ip := range test.contains {
+			if !network.Contains(net.ParseIP(ip)) {
+				t.Errorf("%v does not contain %v", test.value, ip)
+			}
+		}
+		for _, ip := range test.excludes {
+			if network.Contains(net.ParseIP(ip)) {
+				t.Errorf("%v contains %v", test.value, ip)
+			}
+		}
+	}
+	for _, value := range []string{"", "localhost", "256.0.0.1", "10.0.0.0/33", "10.0.0.0/"} {
+		if _, err := ParseIpNetwork(value); err == nil {
+			t.Errorf("the invalid value %q was parsed", value)
+		} else if _, invalid := err.(ErrInvalidIpValue); !invalid {
+			t.Errorf("%q returned the error %T", value, err)
+		}
+	}
+}
+
+func TestExpiration(t *testing.T) {
+	now := time.Date(2023, 6, 8, 12, 0, 0, 0, time.UTC)
+	for _, test := range []struct {
+		expires string
+		expired bool
+	}{
+		{Forever, false},
+		{"", false},
+		{"not a date", false},
+		{"2023-06-08 11:59:59 +0000", true},
+		{"2023-06-08 12:00:00 +0000", true},
+		{"2023-06-08 12:00:01 +0000", false},
+		// the offset of the date is respected
+		{"2023-06-08 13:30:00 +0200", true},
+		{"2023-06-08 14:30:00 +0200", false},
+	} {
+		if expired := (BanDetails{Expires: test.expires}).IsExpired(now); expired != test.expired {
+			t.Errorf("the expiration %q returned expired=%v", test.expires, expired)
+		}
+	}
+	if _, expires := (BanDetails{Expires: Forever}).ExpirationTime(); expires {
+		t.Error("a permanent ban expires")
+	}
+	expires := now.Add(time.Hour)
+	if details := newBanDetails("test", "reason", expires); details.Expires != expires.Format(DateFormat) {
+		t.Errorf("a temporary ban expires %q", details.Expires)
+	} else if details = newBanDetails("test", "reason", time.Time{}); details.Expires != Forever {
+		t.Errorf("a permanent ban expires %q", details.Expires)
+	}
+}
+
+func TestPlayerMatching(t *testing.T) {
+	lists, err := LoadLists("", "", "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	lists.playerBans = []PlayerBan{
+		{Uuid: "069a79f4-44e9-4726-a5be-fca90e38aaf5", Name: "Notch", BanDetails: BanDetails{Expires: Forever}},
+		{Uuid: "853c80ef-3c37-49fd-aa49-938b674adae6", Name: "jeb_", BanDetails: BanDetails{Expires: "2000-01-01 00:00:00 +0000"}},
+	}
+	lists.whitelisted = []WhitelistEntry{{Uuid: "61699b2e-d327-4a01-9f1e-0ea8c3f06bc6", Name: "Dinnerbone"}}
+	for _, test := range []struct {
+		name   string
+		uuid   string
+		banned bool
+	}{
+		{"Notch", "", true},
+		{"nOTCH", "", true},
+		// a renamed player is matched by the uuid with or without dashes
+		{"Renamed", "069a79f4-44e9-4726-a5be-fca90e38aaf5", true},
+		{"Renamed", "069A79F444E94726A5BEFCA90E38AAF5", true},
+		{"Renamed", "", false},
+		{"", "", false},
+		// the ban has expired
+		{"jeb_", "853c80ef-3c37-49fd-aa49-938b674adae6", false},
+	} {
+		if _, banned := lists.FindPlayerBan(test.name, test.uuid); banned != test.banned {
+			t.Errorf("the player %q (%q) returned banned=%v", test.name, test.uuid, banned)
+		}
+	}
+	if !lists.IsWhitelisted("dinnerbone", "") || !lists.IsWhitelisted("Renamed", "61699b2ed3274a019f1e0ea8c3f06bc6") || lists.IsWhitelisted("Notch", "") {
+		t.Error("the whitelist was not matched by name and uuid")
+	}
+	if uuid := OfflinePlayerUuid("Notch"); uuid != "b50ad385-829d-3141-a216-7e7d7539ba7f" {
+		t.Errorf("the offline uuid of Notch is %v", uuid)
+	}
+}
+
+// this method copies the vanilla files of the testdata directory into a temporary directory and loads them
+func loadTestLists(t *testing.T) (*Lists, string) {
+	directory := t.TempDir()
+	for _, name := range []string{"banned-ips.json", "banned-players.json", "whitelist.json"} {
+		data, err := ioutil.ReadFile(filepath.Join("testdata", name))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if err = ioutil.WriteFile(filepath.Join(directory, name), data, 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	lists, err := LoadLists(filepath.Join(directory, "banned-ips.json"), filepath.Join(directory, "banned-players.json"), filepath.Join(directory, "whitelist.json"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	return lists, directory
+}
+
+func TestLoadAndSave(t *testing.T) {
+	lists, directory := loadTestLists(t)
+	if ipBan, banned := lists.FindIpBan(net.ParseIP("192.168.178.21")); !banned || ipBan.Source != "Server" || ipBan.Reason != "Banned by an operator." {
+		t.Errorf("the ip ban was not loaded: %+v", ipBan)
+	}
+	if _, banned := lists.FindIpBan(net.ParseIP("2001:db8::1")); banned {
+		t.Error("the expired ip ban is active")
+	}
+	if playerBan, banned := lists.FindPlayerBan("Notch", ""); !banned || playerBan.Uuid != "069a79f4-44e9-4726-a5be-fca90e38aaf5" {
+		t.Errorf("the player ban was not loaded: %+v", playerBan)
+	}
+	if !lists.IsWhitelisted("Dinnerbone", "") {
+		t.Error("the whitelist was not loaded")
+	}
+	// the entries are written in the layout of the vanilla server
+	if err := lists.BanIp("10.0.0.0/8", "test", "", time.Time{}); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := lists.PardonIp("10.0.0.0/8"); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := lists.AddToWhitelist("jeb_"); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := lists.RemoveFromWhitelist("jeb_"); err != nil {
+		t.Fatal(err)
+	}
+	for _, name := range []string{"banned-ips.json", "whitelist.json"} {
+		expected, _ := ioutil.ReadFile(filepath.Join("testdata", name))
+		saved, _ := ioutil.ReadFile(filepath.Join(directory, name))
+		if !bytes.Equal(bytes.TrimSpace(saved), bytes.TrimSpace(expected)) {
+			t.Errorf("%v was saved as\n%s", name, saved)
+		}
+	}
+	if err := lists.BanPlayer("Griefer", "test", "griefing", time.Time{}); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := lists.PardonPlayer("notch"); err != nil {
+		t.Fatal(err)
+	}
+	// the changed files are read by a reload
+	reloaded, err := LoadLists(lists.BannedIpsFile, lists.BannedPlayersFile, lists.WhitelistFile)
+	if err != nil {
+		t.Fatal(err)
+	}
+	playerBans := reloaded.PlayerBans()
+	if len(playerBans) != 1 || playerBans[0].Name != "Griefer" || playerBans[0].Uuid != OfflinePlayerUuid("Griefer") || playerBans[0].Reason != "griefing" || playerBans[0].Expires != Forever {
+		t.Errorf("the player bans were saved as %+v", playerBans)
+	}
+	if err = ioutil.WriteFile(lists.WhitelistFile, []byte("[]"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if err = lists.Reload(); err != nil {
+		t.Fatal(err)
+	} else if len(lists.Whitelisted()) != 0 {
+		t.Error("the whitelist was not reloaded")
+	}
+	// invalid files keep the current entries
+	if err = ioutil.WriteFile(lists.BannedIpsFile, []byte(`[{"ip": "invalid"}]`), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if err = lists.Reload(); err == nil {
+		t.Error("an invalid ip was loaded")
+	} else if len(lists.IpBans()) != 2 {
+		t.Error("the ip bans were changed by a failed reload")
+	}
+}
+
+func TestWriteListFileKeepsTheFileOnFailure(t *testing.T) {
+	directory := t.TempDir()
+	fileName := filepath.Join(directory, "banned-ips.json")
+	if err := writeListFile(fileName, []IpBan{}); err != nil {
+		t.Fatal(err)
+	}
+	saved, _ := ioutil.ReadFile(fileName)
+	// a channel can not be encoded, the write fails after the file was created
+	if err := writeListFile(fileName, make(chan int)); err == nil {
+		t.Fatal("the invalid entries were written")
+	}
+	if content, _ := ioutil.ReadFile(fileName); !bytes.Equal(content, saved) {
+		t.Errorf("the list file was changed by a failed write: %q", content)
+	}
+	if files, _ := ioutil.ReadDir(directory); len(files) != 1 {
+		t.Errorf("the temporary file was not removed: %v files", len(files))
+	}
+}
+
+func TestFailedSave(t *testing.T) {
+	lists, directory := loadTestLists(t)
+	// the files can not be created in a directory which does not exist
+	lists.BannedIpsFile = filepath.Join(directory, "missing", "banned-ips.json")
+	lists.BannedPlayersFile = filepath.Join(directory, "missing", "banned-players.json")
+	lists.WhitelistFile = filepath.Join(directory, "missing", "whitelist.json")
+	if err := lists.BanIp("10.0.0.1", "test", "", time.Time{}); err == nil {
+		t.Error("the ip ban could be saved")
+	} else if _, banned := lists.FindIpBan(net.ParseIP("10.0.0.1")); banned {
+		t.Error("the ip ban is active although it was not saved")
+	}
+	if removed, err := lists.PardonIp("192.168.178.21"); err == nil || removed {
+		t.Error("the ip ban could be removed")
+	} else if _, banned := lists.FindIpBan(net.ParseIP("192.168.178.21")); !banned {
+		t.Error("the ip ban was removed although the file was not saved")
+	}
+	if err := lists.BanPlayer("Griefer", "test", "", time.Time{}); err == nil {
+		t.Error("the player ban could be saved")
+	} else if _, banned := lists.FindPlayerBan("Griefer", ""); banned {
+		t.Error("the player ban is active although it was not saved")
+	}
+	if removed, err := lists.PardonPlayer("Notch"); err == nil || removed {
+		t.Error("the player ban could be removed")
+	} else if _, banned := lists.FindPlayerBan("Notch", ""); !banned {
+		t.Error("the player ban was removed although the file was not saved")
+	}
+	if added, err := lists.AddToWhitelist("jeb_"); err == nil || added || lists.IsWhitelisted("jeb_", "") {
+		t.Error("the player was whitelisted although the file was not saved")
+	}
+	if removed, err := lists.RemoveFromWhitelist("Dinnerbone"); err == nil || removed || !lists.IsWhitelisted("Dinnerbone", "") {
+		t.Error("the player was removed from the whitelist although the file was not saved")
+	}
+	if _, err := os.Stat(filepath.Join(directory, "missing")); !os.IsNotExist(err) {
+		t.Error("the directory was created")
+	}
+}
+
+func TestProfileServerResolver(t *testing.T) {
+	profileServer := httptest.NewServer(http.HandlerFunc(func(writer http.ResponseWriter, request *http.Request) {
+		switch strings.ToLower(strings.TrimPrefix(request.URL.Path, "/users/profiles/minecraft/")) {
+		case "notch":
+			writer.Write([]byte(`{"id": "069a79f444e94726a5befca90e38aaf5", "name": "Notch"}`))
+		case "unknown":
+			writer.WriteHeader(http.StatusNoContent)
+		default:
+			writer.WriteHeader(http.StatusInternalServerError)
+		}
+	}))
+	defer profileServer.Close()
+	lists, _ := loadTestLists(t)
+	lists.ResolvePlayer = ProfileServerResolver(profileServer.URL + "/")
+	if _, err := lists.PardonPlayer("Notch"); err != nil {
+		t.Fatal(err)
+	}
+	// the entry receives the uuid of the account and the name with its case
+	if err := lists.BanPlayer("NOTCH", "test", "", time.Time{}); err != nil {
+		t.Fatal(err)
+	}
+	if playerBans := lists.PlayerBans(); len(playerBans) != 1 || playerBans[0].Uuid != "069a79f4-44e9-4726-a5be-fca90e38aaf5" || playerBans[0].Name != "Notch" {
+		t.Errorf("the player was banned as %+v", playerBans)
+	}
+	if err := lists.BanPlayer("unknown", "test", "", time.Time{}); err == nil {
+		t.Error("an unknown player was banned")
+	} else if _, unknown := err.(ErrUnknownPlayer); !unknown {
+		t.Errorf("an unknown player returned the error %v", err)
+	}
+	if added, err := lists.AddToWhitelist("broken"); err == nil || added {
+		t.Error("a player was whitelisted although the profile server failed")
+	}
+	// players which are whitelisted already are not resolved (the profile server fails for them)
+	if added, err := lists.AddToWhitelist("Dinnerbone"); err != nil || added {
+		t.Errorf("the whitelisted player was added=%v (%v)", added, err)
+	}
+}
@@ -0,0 +1,107 @@
+package bans
+
+import (
+	"crypto/md5"
+	"fmt"
+	"net"
+	"strings"
+	"time"
+)
+
+// this file contains the entry types of the vanilla compatible banned-ips.json, banned-players.json and whitelist.json files
+
+// the date format which is used by the vanilla server for the created and expires fields
+const DateFormat = "2006-01-02 15:04:05 -0700"
+
+// the value of the expires field if a ban never expires
+const Forever = "forever"
+
+// the values every ban entry has in common
+type BanDetails struct {
+	Created string `json:"created"`
+	Source  string `json:"source"`
+	Expires string `json:"expires"`
+	Reason  string `json:"reason"`
+}
+
+// this method returns the time when the ban expires
+// returns false if the ban never expires (or the expires value could not be parsed)
+func (banDetails BanDetails) ExpirationTime() (time.Time, bool) {
+	if banDetails.Expires == "" || banDetails.Expires == Forever {
+		return time.Time{}, false
+	}
+	expirationTime, err := time.Parse(DateFormat, banDetails.Expires)
+	if err != nil {
+		return time.Time{}, false
+	}
+	return expirationTime, true
+}
+
+// this method checks whether the ban has already expired at the given time
+func (banDetails BanDetails) IsExpired(now time.Time) bool {
+	expirationTime, expires := banDetails.ExpirationTime()
+	return expires && !now.Before(expirationTime)
+}
+
+// an entry of the banned-ips.json file
+// in addition to the vanilla format the ip may be written in CIDR notation (e.g. 10.0.0.0/8) to ban a whole network
+type IpBan struct {
+	Ip string `json:"ip"`
+	BanDetails
+}
+
+// an entry of the banned-players.json file
+type PlayerBan struct {
+	Uuid string `json:"uuid"`
+	Name string `json:"name"`
+	BanDetails
+}
+
+// an entry of the whitelist.json file
+type WhitelistEntry struct {
+	Uuid string `json:"uuid"`
+	Name string `json:"name"`
+}
+
+// the error which is thrown if a banned ip value is neither an ip address nor a CIDR network
+type ErrInvalidIpValue struct {
+	Value string
+}
+
+func (errInvalidIpValue ErrInvalidIpValue) Error() string {
+	return fmt.Sprintf("the value \"%v\" is neither an ip address nor a CIDR network", errInvalidIpValue.Value)
+}
+
+// this method parses an ip address or a CIDR network into a network
+// single ip addresses are returned as a network with a full mask
+func ParseIpNetwork(value string) (*net.IPNet, error) {
+	if strings.Contains(value, "/") {
+		_, network, err := net.ParseCIDR(value)
+		if err != nil {
+			return nil, ErrInvalidIpValue{value}
+		}
+		return network, nil
+	}
+	ip := net.ParseIP(value)
+	if ip == nil {
+		return nil, ErrInvalidIpValue{value}
+	}
+	if ipv4 := ip.To4(); ipv4 != nil {
+		return &net.IPNet{IP: ipv4, Mask: net.CIDRMask(32, 32)}, nil
+	}
+	return &net.IPNet{IP: ip, Mask: net.CIDRMask(128, 128)}, nil
+}
+
+// this method returns the uuid a player with the given name has on an offline mode server
+// it is a name based uuid (version 3) of the string "OfflinePlayer:<name>"
+func OfflinePlayerUuid(name string) string {
+	hash := md5.Sum([]byte("OfflinePlayer:" + name))
+	hash[6] = hash[6]&0x0f | 0x30
+	hash[8] = hash[8]&0x3f | 0x80
+	return fmt.Sprintf("%x-%x-%x-%x-%x", hash[0:4], hash[4:6], hash[6:8], hash[8:10], hash[10:16])
+}
+
+// this method returns the current time formatted for the created field of a new entry
+func currentDate() string {
+	return time.Now().Format(DateFormat)
+}
@@ -0,0 +1,345 @@
+package bans
+
+import (
+	"encoding/json"
+	"io"
+	"net"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Holds the ip bans, player bans and the whitelist and keeps them in sync with their files.
+// All methods are safe for concurrent use.
+type Lists struct {
+	BannedIpsFile     string
+	BannedPlayersFile string
+	WhitelistFile     string
+	// resolves the uuids of new player bans and whitelist entries (e.g. ProfileServerResolver), the offline uuid is written if it is nil
+	ResolvePlayer PlayerResolver
+
+	mutex       sync.RWMutex
+	ipBans      []IpBan
+	ipNetworks  []*net.IPNet
+	playerBans  []PlayerBan
+	whitelisted []WhitelistEntry
+}
+
+// this method loads the lists from the given files
+// a file which does not exist is treated as an empty list, an empty file name disables saving the list
+// returns the loaded lists or an error if something went wrong
+func LoadLists(bannedIpsFile, bannedPlayersFile, whitelistFile string) (*Lists, error) {
+	lists := &Lists{BannedIpsFile: bannedIpsFile, BannedPlayersFile: bannedPlayersFile, WhitelistFile: whitelistFile}
+	if err := lists.Reload(); err != nil {
+		return nil, err
+	}
+	return lists, nil
+}
+
+// this method reads all files again and replaces the current entries
+// returns an error if something went wrong (the current entries are kept in this case)
+func (lists *Lists) Reload() error {
+	var ipBans []IpBan
+	var playerBans []PlayerBan
+	var whitelisted []WhitelistEntry
+	if err := readListFile(lists.BannedIpsFile, &ipBans); err != nil {
+		return err
+	}
+	ipNetworks := make([]*net.IPNet, len(ipBans))
+	for index, ipBan := range ipBans {
+		network, err := ParseIpNetwork(ipBan.Ip)
+		if err != nil {
+			return err
+		}
+		ipNetworks[index] = network
+	}
+	if err := readListFile(lists.BannedPlayersFile, &playerBans); err != nil {
+		return err
+	}
+	if err := readListFile(lists.WhitelistFile, &whitelisted); err != nil {
+		return err
+	}
+	lists.mutex.Lock()
+	defer lists.mutex.Unlock()
+	lists.ipBans, lists.ipNetworks = ipBans, ipNetworks
+	lists.playerBans = playerBans
+	lists.whitelisted = whitelisted
+	return nil
+}
+
+// this method searches an active ban which matches the given ip address
+// returns the ban and true if the address is banned
+func (lists *Lists) FindIpBan(ip net.IP) (IpBan, bool) {
+	lists.mutex.RLock()
+	defer lists.mutex.RUnlock()
+	now := time.Now()
+	for index, network := range lists.ipNetworks {
+		if network.Contains(ip) && !lists.ipBans[index].IsExpired(now) {
+			return lists.ipBans[index], true
+		}
+	}
+	return IpBan{}, false
+}
+
+// this method searches an active ban which matches the given player name (case insensitive) or uuid
+// the uuid may be empty if it is not known
+// returns the ban and true if the player is banned
+func (lists *Lists) FindPlayerBan(name, uuid string) (PlayerBan, bool) {
+	lists.mutex.RLock()
+	defer lists.mutex.RUnlock()
+	now := time.Now()
+	for _, playerBan := range lists.playerBans {
+		if matchesPlayer(playerBan.Name, playerBan.Uuid, name, uuid) && !playerBan.IsExpired(now) {
+			return playerBan, true
+		}
+	}
+	return PlayerBan{}, false
+}
+
+// this method checks whether the given player name (case insensitive) or uuid is on the whitelist
+func (lists *Lists) IsWhitelisted(name, uuid string) bool {
+	lists.mutex.RLock()
+	defer lists.mutex.RUnlock()
+	for _, entry := range lists.whitelisted {
+		if matchesPlayer(entry.Name, entry.Uuid, name, uuid) {
+			return true
+		}
+	}
+	return false
+}
+
+// returns a copy of all ip bans
+func (lists *Lists) IpBans() []IpBan {
+	lists.mutex.RLock()
+	defer lists.mutex.RUnlock()
+	return append([]IpBan(nil), lists.ipBans...)
+}
+
+// returns a copy of all player bans
+func (lists *Lists) PlayerBans() []PlayerBan {
+	lists.mutex.RLock()
+	defer lists.mutex.RUnlock()
+	return append([]PlayerBan(nil), lists.playerBans...)
+}
+
+// returns a copy of all whitelist entries
+func (lists *Lists) Whitelisted() []WhitelistEntry {
+	lists.mutex.RLock()
+	defer lists.mutex.RUnlock()
+	return append([]WhitelistEntry(nil), lists.whitelisted...)
+}
+
+// this method bans an ip address or CIDR network (an existing ban of the same value is replaced)
+// expires may be the zero time for a permanent ban
+// returns an error if the value is invalid or the file could not be saved (the ban is not added in this case)
+func (lists *Lists) BanIp(value, source, reason string, expires time.Time) error {
+	network, err := ParseIpNetwork(value)
+	if err != nil {
+		return err
+	}
+	lists.mutex.Lock()
+	defer lists.mutex.Unlock()
+	ipBans, ipNetworks, _ := lists.ipBansWithout(value)
+	ipBans = append(ipBans, IpBan{Ip: value, BanDetails: newBanDetails(source, reason, expires)})
+	if err = writeListFile(lists.BannedIpsFile, ipBans); err != nil {
+		return err
+	}
+	lists.ipBans, lists.ipNetworks = ipBans, append(ipNetworks, network)
+	return nil
+}
+
+// this method removes the ban of the given ip address or CIDR network
+// returns whether a ban was removed or an error if the file could not be saved (the ban is kept in this case)
+func (lists *Lists) PardonIp(value string) (bool, error) {
+	lists.mutex.Lock()
+	defer lists.mutex.Unlock()
+	ipBans, ipNetworks, removed := lists.ipBansWithout(value)
+	if !removed {
+		return false, nil
+	}
+	if err := writeListFile(lists.BannedIpsFile, ipBans); err != nil {
+		return false, err
+	}
+	lists.ipBans, lists.ipNetworks = ipBans, ipNetworks
+	return true, nil
+}
+
+// this method bans the player with the given name (an existing ban of the same player is replaced)
+// the uuid of the entry is resolved by ResolvePlayer, expires may be the zero time for a permanent ban
+// returns an error if the player could not be resolved or the file could not be saved (the ban is not added in this case)
+func (lists *Lists) BanPlayer(name, source, reason string, expires time.Time) error {
+	uuid, name, err := lists.resolvePlayer(name)
+	if err != nil {
+		return err
+	}
+	lists.mutex.Lock()
+	defer lists.mutex.Unlock()
+	playerBans, _ := lists.playerBansWithout(name)
+	playerBans = append(playerBans, PlayerBan{Uuid: uuid, Name: name, BanDetails: newBanDetails(source, reason, expires)})
+	if err = writeListFile(lists.BannedPlayersFile, playerBans); err != nil {
+		return err
+	}
+	lists.playerBans = playerBans
+	return nil
+}
+
+// this method removes the ban of the player with the given name
+// returns whether a ban was removed or an error if the file could not be saved (the ban is kept in this case)
+func (lists *Lists) PardonPlayer(name string) (bool, error) {
+	lists.mutex.Lock()
+	defer lists.mutex.Unlock()
+	playerBans, removed := lists.playerBansWithout(name)
+	if !removed {
+		return false, nil
+	}
+	if err := writeListFile(lists.BannedPlayersFile, playerBans); err != nil {
+		return false, err
+	}
+	lists.playerBans = playerBans
+	return true, nil
+}
+
+// this method adds the player with the given name to the whitelist, the uuid of the entry is resolved by ResolvePlayer
+// returns whether the player was added or an error if the player could not be resolved or the file could not be saved
+func (lists *Lists) AddToWhitelist(name string) (bool, error) {
+	if lists.IsWhitelisted(name, "") {
+		return false, nil
+	}
+	uuid, name, err := lists.resolvePlayer(name)
+	if err != nil {
+		return false, err
+	}
+	lists.mutex.Lock()
+	defer lists.mutex.Unlock()
+	for _, entry := range lists.whitelisted {
+		if matchesPlayer(entry.Name, entry.Uuid, name, uuid) {
+			return false, nil
+		}
+	}
+	whitelisted := append(append([]WhitelistEntry(nil), lists.whitelisted...), WhitelistEntry{Uuid: uuid, Name: name})
+	if err = writeListFile(lists.WhitelistFile, whitelisted); err != nil {
+		return false, err
+	}
+	lists.whitelisted = whitelisted
+	return true, nil
+}
+
+// this method removes the player with the given name from the whitelist
+// returns whether the player was removed or an error if the file could not be saved (the player is kept in this case)
+func (lists *Lists) RemoveFromWhitelist(name string) (bool, error) {
+	lists.mutex.Lock()
+	defer lists.mutex.Unlock()
+	for index, entry := range lists.whitelisted {
+		if strings.EqualFold(entry.Name, name) {
+			whitelisted := append(append([]WhitelistEntry(nil), lists.whitelisted[:index]...), lists.whitelisted[index+1:]...)
+			if err := writeListFile(lists.WhitelistFile, whitelisted); err != nil {
+				return false, err
+			}
+			lists.whitelisted = whitelisted
+			return true, nil
+		}
+	}
+	return false, nil
+}
+
+// returns copies of the ip bans and networks without the ban of the given value and whether it was banned
+// the copies are changed and saved before they replace the current lists, so a failed save does not change the lists
+// the caller has to hold the lock
+func (lists *Lists) ipBansWithout(value string) ([]IpBan, []*net.IPNet, bool) {
+	ipBans := make([]IpBan, 0, len(lists.ipBans)+1)
+	ipNetworks := make([]*net.IPNet, 0, len(lists.ipNetworks)+1)
+	removed := false
+	for index, ipBan := range lists.ipBans {
+		if ipBan.Ip == value {
+			removed = true
+		} else {
+			ipBans = append(ipBans, ipBan)
+			ipNetworks = append(ipNetworks, lists.ipNetworks[index])
+		}
+	}
+	return ipBans, ipNetworks, removed
+}
+
+// returns a copy of the player bans without the ban of the given player and whether the player was banned
+// the caller has to hold the lock
+func (lists *Lists) playerBansWithout(name string) ([]PlayerBan, bool) {
+	playerBans := make([]PlayerBan, 0, len(lists.playerBans)+1)
+	removed := false
+	for _, playerBan := range lists.playerBans {
+		if strings.EqualFold(playerBan.Name, name) {
+			removed = true
+		} else {
+			playerBans = append(playerBans, playerBan)
+		}
+	}
+	return playerBans, removed
+}
+
+func newBanDetails(source, reason string, expires time.Time) BanDetails {
+	banDetails := BanDetails{Created: currentDate(), Source: source, Expires: Forever, Reason: reason}
+	if !expires.IsZero() {
+		banDetails.Expires = expires.Format(DateFormat)
+	}
+	return banDetails
+}
+
+func matchesPlayer(entryName, entryUuid, name, uuid string) bool {
+	if uuid != "" && entryUuid != "" && strings.EqualFold(strings.Replace(entryUuid, "-", "", -1), strings.Replace(uuid, "-", "", -1)) {
+		return true
+	}
+	return name != "" && strings.EqualFold(entryName, name)
+}
+
+func readListFile(fileName string, entries interface{}) error {
+	if fileName == "" {
+		return nil
+	}
+	file, err := os.Open(fileName)
+	if os.IsNotExist(err) {
+		return nil
+	} else if err != nil {
+		return err
+	}
+	defer file.Close()
+	if err = json.NewDecoder(file).Decode(entries); err == io.EOF {
+		// an empty file is treated like an empty list
+		return nil
+	}
+	return err
+}
+
+// this method writes the entries into a temporary file next to the list file and replaces the list file afterwards
+// a failed write (e.g. a full disk) keeps the previous list file
+func writeListFile(fileName string, entries interface{}) error {
+	if fileName == "" {
+		return nil
+	}
+	mode := os.FileMode(0644)
+	if info, err := os.Stat(fileName); err == nil {
+		mode = info.Mode().Perm()
+	}
+	file, err := os.CreateTemp(filepath.Dir(fileName), "."+filepath.Base(fileName)+".*.tmp")
+	if err != nil {
+		return err
+	}
+	jsonEncoder := json.NewEncoder(file)
+	jsonEncoder.SetIndent("", "  ")
+	if err = jsonEncoder.Encode(entries); err == nil {
+		err = file.Chmod(mode)
+	}
+	if err == nil {
+		err = file.Sync()
+	}
+	if closeErr := file.Close(); err == nil {
+		err = closeErr
+	}
+	if err == nil {
+		err = os.Rename(file.Name(), fileName)
+	}
+	if err != nil {
+		os.Remove(file.Name())
+	}
+	return err
+}
@@ -0,0 +1,65 @@
+package bans
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+)
+
+// this file contains the resolution of the uuids which are written into new entries
+// an online mode server matches the entries by the uuid of the account, the offline uuid of a name does not match there
+
+// the profile API of Mojang which is used by the vanilla server to resolve the names of new entries
+const DefaultProfileServer = "https://api.mojang.com"
+
+// resolves the uuid and the name (with the case of the account) of the player with the given name
+type PlayerResolver func(name string) (uuid, resolvedName string, err error)
+
+// the error which is thrown if a player name does not belong to an account
+type ErrUnknownPlayer struct {
+	Name string
+}
+
+func (errUnknownPlayer ErrUnknownPlayer) Error() string {
+	return fmt.Sprintf("the player %v does not exist", errUnknownPlayer.Name)
+}
+
+var profileServerClient = &http.Client{Timeout: 10 * time.Second}
+
+// returns a resolver which looks up the players at the given profile API (GET /users/profiles/minecraft/<name>)
+func ProfileServerResolver(profileServer string) PlayerResolver {
+	return func(name string) (string, string, error) {
+		response, err := profileServerClient.Get(strings.TrimRight(profileServer, "/") + "/users/profiles/minecraft/" + url.PathEscape(name))
+		if err != nil {
+			return "", "", err
+		}
+		defer response.Body.Close()
+		if response.StatusCode == http.StatusNoContent || response.StatusCode == http.StatusNotFound {
+			return "", "", ErrUnknownPlayer{name}
+		} else if response.StatusCode != http.StatusOK {
+			return "", "", fmt.Errorf("the profile server responded with status %v", response.Status)
+		}
+		profile := struct {
+			Id   string `json:"id"`
+			Name string `json:"name"`
+		}{}
+		if err = json.NewDecoder(response.Body).Decode(&profile); err != nil {
+			return "", "", err
+		} else if len(profile.Id) != 32 || profile.Name == "" {
+			return "", "", fmt.Errorf("the profile server sent an invalid profile")
+		}
+		return profile.Id[0:8] + "-" + profile.Id[8:12] + "-" + profile.Id[12:16] + "-" + profile.Id[16:20] + "-" + profile.Id[20:32], profile.Name, nil
+	}
+}
+
+// this method returns the uuid and the name of a new entry for the given player name
+// the offline uuid is used if the lists have no resolver
+func (lists *Lists) resolvePlayer(name string) (string, string, error) {
+	if lists.ResolvePlayer == nil {
+		return OfflinePlayerUuid(name), name, nil
+	}
+	return lists.ResolvePlayer(name)
+}
@@ -0,0 +1,240 @@
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"log"
+	"net"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/michivip/mcstatusserver/commands"
+	"github.com/michivip/mcstatusserver/configuration"
+	"github.com/michivip/mcstatusserver/server"
+)
+
+// this method creates the registry of the commands which are executed by the console, the RCON clients and the admin API
+func newCommandRegistry(mcServer *server.Server, reload func() error, stop func()) (*commands.Registry, error) {
+	registry := commands.NewRegistry()
+	serverCommands := []*commands.Command{
+		{
+			Name:        "stop",
+			Aliases:     []string{"close"},
+			Description: "Shuts the server down.",
+			Execute: func(context *commands.Context, _ []string) error {
+				context.Printf("Stopping the server")
+				stop()
+				return nil
+			},
+		},
+		{
+			Name:        "reload",
+			Description: "Reads the configuration file and the ban lists again.",
+			Execute: func(context *commands.Context, _ []string) error {
+				if err := reload(); err != nil {
+					return fmt.Errorf("Could not reload the configuration: %v", err)
+				}
+				context.Printf("Reloaded the configuration.")
+				return nil
+			},
+		},
+		{
+			Name:        "motd",
+			Description: "Changes the MOTD until the configuration is reloaded.",
+			Subcommands: []*commands.Command{
+				{
+					Name:        "set",
+					Description: "Changes the text of the MOTD (\\n starts the second line).",
+					Arguments:   []commands.Argument{{Name: "text", Rest: true}},
+					Execute: func(context *commands.Context, arguments []string) error {
+						text := strings.Replace(arguments[0], `\n`, "\n", -1)
+						mcServer.UpdateConfiguration(func(config *configuration.ServerConfiguration) {
+							config.Motd.Description.Text = text
+						})
+						context.Printf("Changed the MOTD.")
+						return nil
+					},
+				},
+				{
+					Name:        "profile",
+					Description: "Replaces the MOTD by a MOTD profile.",
+					Arguments: []commands.Argument{{Name: "name", Suggestions: func() []string {
+						names := []string{}
+						for name := range mcServer.Configuration().MotdProfiles {
+							names = append(names, name)
+						}
+						return names
+					}}},
+					Execute: func(context *commands.Context, arguments []string) error {
+						found := false
+						mcServer.UpdateConfiguration(func(config *configuration.ServerConfiguration) {
+							var motd configuration.MessageOfTheDayValues
+							if motd, found = config.MotdProfiles[arguments[0]]; found {
+								config.Motd = motd
+							}
+						})
+						if !found {
+							return fmt.Errorf("There is no MOTD profile %v.", arguments[0])
+						}
+						context.Printf("Selected the MOTD profile %v.", arguments[0])
+						return nil
+					},
+				},
+			},
+		},
+		{
+			Name:        "players",
+			Description: "Changes the player counts of the status until the configuration is reloaded.",
+			Subcommands: []*commands.Command{
+				{
+					Name:        "set",
+					Description: "Changes the online and maximum player count.",
+					Arguments:   []commands.Argument{{Name: "online"}, {Name: "max", Optional: true}},
+					Execute: func(context *commands.Context, arguments []string) error {
+						counts := make([]int, len(arguments))
+						for index, argument := range arguments {
+							var err error
+							if counts[index], err = strconv.Atoi(argument); err != nil || counts[index] < 0 {
+								return fmt.Errorf("Invalid player count: %v", argument)
+							}
+						}
+						maximum := 0
+						mcServer.UpdateConfiguration(func(config *configuration.ServerConfiguration) {
+							config.Motd.Players.Online = counts[0]
+							if len(counts) == 2 {
+								config.Motd.Players.Max = counts[1]
+							}
+							maximum = config.Motd.Players.Max
+						})
+						context.Printf("Changed the players to %v/%v.", counts[0], maximum)
+						return nil
+					},
+				},
+			},
+		},
+		{
+			Name:        "maintenance",
+			Description: "Enables or disables the maintenance mode until the configuration is reloaded.",
+			Subcommands: []*commands.Command{
+				maintenanceCommand(mcServer, "on", true),
+				maintenanceCommand(mcServer, "off", false),
+			},
+		},
+		{
+			Name:        "list",
+			Description: "Lists the open connections.",
+			Execute: func(context *commands.Context, _ []string) error {
+				connections := mcServer.Connections()
+				context.Printf("There are %v open connections.", len(connections))
+				for _, info := range connections {
+					context.Printf("#%v %v %v %v %v %v", info.Id, info.RemoteAddress, info.State, info.Version, info.Hostname, info.PlayerName)
+				}
+				return nil
+			},
+		},
+		{
+			Name:        "kick",
+			Description: "Disconnects a connection by its id (see list) or all connections of a player.",
+			Arguments: []commands.Argument{
+				{Name: "id|player", Suggestions: func() []string {
+					return connectedPlayers(mcServer)
+				}},
+				{Name: "reason", Optional: true, Rest: true},
+			},
+			Execute: func(context *commands.Context, arguments []string) error {
+				text := server.DefaultKickText
+				if len(arguments) == 2 {
+					text = configuration.ChatValue{Text: arguments[1]}
+				}
+				kicked := 0
+				if id, err := strconv.ParseUint(arguments[0], 10, 64); err == nil {
+					if mcServer.Kick(id, text) {
+						kicked++
+					}
+				} else {
+					for _, info := range mcServer.Connections() {
+						if strings.EqualFold(info.PlayerName, arguments[0]) && mcServer.Kick(info.Id, text) {
+							kicked++
+						}
+					}
+				}
+				if kicked == 0 {
+					return fmt.Errorf("There is no open connection of %v.", arguments[0])
+				}
+				context.Printf("Kicked %v connections of %v.", kicked, arguments[0])
+				return nil
+			},
+		},
+		{
+			Name:        "stats",
+			Description: "Shows the uptime and the counters of the server.",
+			Execute: func(context *commands.Context, _ []string) error {
+				stats := mcServer.Stats()
+				context.Printf("Uptime: %v", stats.Uptime.Round(time.Second))
+				context.Printf("Connections: %v open, %v accepted", stats.ConnectionsActive, stats.ConnectionsAccepted)
+				context.Printf("Status requests: %v, pings: %v, login attempts: %v", stats.StatusRequests, stats.Pings, stats.LoginAttempts)
+				return nil
+			},
+		},
+	}
+	for _, command := range append(serverCommands, banCommands(mcServer.BanLists)...) {
+		if err := registry.Register(command); err != nil {
+			return nil, err
+		}
+	}
+	return registry, nil
+}
+
+func maintenanceCommand(mcServer *server.Server, name string, enabled bool) *commands.Command {
+	return &commands.Command{
+		Name:        name,
+		Description: fmt.Sprintf("Sets the maintenance mode %v.", name),
+		Execute: func(context *commands.Context, _ []string) error {
+			mcServer.UpdateConfiguration(func(config *configuration.ServerConfiguration) {
+				config.Maintenance.Enabled = enabled
+			})
+			context.Printf("The maintenance mode is %v.", name)
+			return nil
+		},
+	}
+}
+
+// returns the names of the players which are logging in or in the limbo
+func connectedPlayers(mcServer *server.Server) []string {
+	names := []string{}
+	for _, info := range mcServer.Connections() {
+		if info.PlayerName != "" {
+			names = append(names, info.PlayerName)
+		}
+	}
+	sort.Strings(names)
+	return names
+}
+
+// this method executes the command line and writes the error of the command to its output
+func executeCommand(registry *commands.Registry, line, source string, output io.Writer) {
+	if err := registry.Execute(line, source, output); err != nil {
+		fmt.Fprintln(output, err)
+	}
+}
+
+// returns the executor of the RCON clients, the commands are logged with the address of the client
+func rconExecutor(registry *commands.Registry) func(command string, remoteAddress net.Addr) string {
+	return func(command string, remoteAddress net.Addr) string {
+		log.Printf("[%v] RCON command: %v\n", remoteAddress, command)
+		output := bytes.NewBuffer(nil)
+		executeCommand(registry, command, commands.RconSource, output)
+		return output.String()
+	}
+}
+
+// writes the output of console commands to the log
+type logWriter struct{}
+
+func (logWriter) Write(p []byte) (int, error) {
+	log.Print(string(p))
+	return len(p), nil
+}
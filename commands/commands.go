@@ -0,0 +1,279 @@
+package commands
+
+import (
+	"fmt"
+	"io"
+	"sort"
+	"strings"
+)
+
+// this package contains the registry of the commands which are executed by the console, the RCON clients and the admin API
+
+// the sources of the commands which are written into the bans they create (the console and RCON sources are the same as in the vanilla server)
+const (
+	ConsoleSource  = "Server"
+	RconSource     = "Rcon"
+	AdminApiSource = "Admin API"
+)
+
+// a command which is executed with the arguments following its name
+// a command with subcommands selects the subcommand by its first argument (e.g. "maintenance on")
+// the values of a command are encoded as JSON for the clients which complete the commands (e.g. of the admin API)
+type Command struct {
+	Name        string   `json:"name"`
+	Aliases     []string `json:"aliases,omitempty"`
+	Description string   `json:"description"`
+	// the arguments are checked before the command is executed and used for the usage and the completions
+	Arguments   []Argument                                       `json:"arguments,omitempty"`
+	Subcommands []*Command                                       `json:"subcommands,omitempty"`
+	Execute     func(context *Context, arguments []string) error `json:"-"`
+}
+
+// an argument of a command
+type Argument struct {
+	Name     string `json:"name"`
+	Optional bool   `json:"optional,omitempty"`
+	// the argument takes the rest of the line (e.g. a reason), it has to be the last argument
+	Rest bool `json:"rest,omitempty"`
+	// returns the values which are suggested for the argument (nil if any value can be entered)
+	Suggestions func() []string `json:"-"`
+}
+
+// the execution of a command
+type Context struct {
+	// the output of the command which is sent back to its sender
+	Output io.Writer
+	// the sender of the command (e.g. ConsoleSource)
+	Source string
+}
+
+// this method writes a line to the output of the command
+func (context *Context) Printf(format string, arguments ...interface{}) {
+	fmt.Fprintf(context.Output, format+"\n", arguments...)
+}
+
+// the error which is returned if no command has the given name
+type ErrUnknownCommand struct {
+	Name string
+}
+
+func (errUnknownCommand ErrUnknownCommand) Error() string {
+	return fmt.Sprintf("Unknown command: %v", errUnknownCommand.Name)
+}
+
+// the error which is returned if a command was executed with invalid arguments
+type ErrUsage struct {
+	Usage string
+}
+
+func (errUsage ErrUsage) Error() string {
+	return fmt.Sprintf("Usage: %v", errUsage.Usage)
+}
+
+// returns the usage of the command, its name is prefixed by the given names of its parent commands
+func (command *Command) usage(path string) string {
+	usage := strings.TrimSpace(path + " " + command.Name)
+	if len(command.Subcommands) > 0 {
+		names := make([]string, len(command.Subcommands))
+		for index, subcommand := range command.Subcommands {
+			names[index] = subcommand.Name
+		}
+		return usage + " <" + strings.Join(names, "|") + ">"
+	}
+	for _, argument := range command.Arguments {
+		name := argument.Name
+		if argument.Rest {
+			name += "..."
+		}
+		if argument.Optional {
+			usage += " [" + name + "]"
+		} else {
+			usage += " <" + name + ">"
+		}
+	}
+	return usage
+}
+
+// returns the subcommand with the given name or alias (nil if there is none)
+func (command *Command) subcommand(name string) *Command {
+	for _, subcommand := range command.Subcommands {
+		if subcommand.matches(name) {
+			return subcommand
+		}
+	}
+	return nil
+}
+
+func (command *Command) matches(name string) bool {
+	if strings.EqualFold(command.Name, name) {
+		return true
+	}
+	for _, alias := range command.Aliases {
+		if strings.EqualFold(alias, name) {
+			return true
+		}
+	}
+	return false
+}
+
+// returns the arguments which are passed to the execute function, the rest argument is joined again
+// returns false if there are too few or too many arguments
+func (command *Command) parseArguments(arguments []string) ([]string, bool) {
+	parsed := make([]string, 0, len(command.Arguments))
+	for index, argument := range command.Arguments {
+		if index >= len(arguments) {
+			return parsed, argument.Optional
+		}
+		if argument.Rest {
+			return append(parsed, strings.Join(arguments[index:], " ")), true
+		}
+		parsed = append(parsed, arguments[index])
+	}
+	return parsed, len(arguments) == len(command.Arguments)
+}
+
+// the registered commands, a new registry contains the help command
+type Registry struct {
+	commands []*Command
+}
+
+// this method creates a registry which contains the help command
+func NewRegistry() *Registry {
+	registry := &Registry{}
+	registry.Register(&Command{
+		Name:        "help",
+		Description: "Lists the commands or shows the usage of a command.",
+		Arguments:   []Argument{{Name: "command", Optional: true, Suggestions: registry.names}},
+		Execute:     registry.help,
+	})
+	return registry
+}
+
+// this method adds the given command, its name and aliases must not be used by another command
+// the commands have to be registered before the registry is used by other goroutines
+func (registry *Registry) Register(command *Command) error {
+	for _, name := range append([]string{command.Name}, command.Aliases...) {
+		if registry.command(name) != nil {
+			return fmt.Errorf("the command %v is already registered", name)
+		}
+	}
+	registry.commands = append(registry.commands, command)
+	sort.Slice(registry.commands, func(i, j int) bool {
+		return registry.commands[i].Name < registry.commands[j].Name
+	})
+	return nil
+}
+
+// returns the registered commands ordered by their names
+func (registry *Registry) Commands() []*Command {
+	return append([]*Command{}, registry.commands...)
+}
+
+func (registry *Registry) command(name string) *Command {
+	for _, command := range registry.commands {
+		if command.matches(name) {
+			return command
+		}
+	}
+	return nil
+}
+
+func (registry *Registry) names() []string {
+	names := make([]string, len(registry.commands))
+	for index, command := range registry.commands {
+		names[index] = command.Name
+	}
+	return names
+}
+
+// this method executes the given command line, the output of the command is written to the given writer
+// returns ErrUnknownCommand, ErrUsage or the error of the command (nil for an empty line)
+func (registry *Registry) Execute(line, source string, output io.Writer) error {
+	arguments := strings.Fields(line)
+	if len(arguments) == 0 {
+		return nil
+	}
+	command := registry.command(arguments[0])
+	if command == nil {
+		return ErrUnknownCommand{arguments[0]}
+	}
+	path := ""
+	for arguments = arguments[1:]; len(command.Subcommands) > 0; arguments = arguments[1:] {
+		if len(arguments) == 0 || command.subcommand(arguments[0]) == nil {
+			return ErrUsage{command.usage(path)}
+		}
+		path = strings.TrimSpace(path + " " + command.Name)
+		command = command.subcommand(arguments[0])
+	}
+	parsed, valid := command.parseArguments(arguments)
+	if !valid {
+		return ErrUsage{command.usage(path)}
+	}
+	return command.Execute(&Context{Output: output, Source: source}, parsed)
+}
+
+// returns the values which complete the last word of the given line (e.g. "maintenance o" is completed with "off" and "on")
+// the words are completed with the command names, the subcommand names and the suggestions of the arguments (the result is never nil)
+func (registry *Registry) Complete(line string) []string {
+	words := strings.Fields(line)
+	if len(words) == 0 || strings.HasSuffix(line, " ") {
+		words = append(words, "")
+	}
+	prefix := words[len(words)-1]
+	if len(words) == 1 {
+		return filterPrefix(registry.names(), prefix)
+	}
+	command := registry.command(words[0])
+	index := 1
+	for ; command != nil && len(command.Subcommands) > 0; index++ {
+		if index == len(words)-1 {
+			names := make([]string, len(command.Subcommands))
+			for subcommandIndex, subcommand := range command.Subcommands {
+				names[subcommandIndex] = subcommand.Name
+			}
+			return filterPrefix(names, prefix)
+		}
+		command = command.subcommand(words[index])
+	}
+	if command == nil {
+		return []string{}
+	}
+	argumentIndex := len(words) - 1 - index
+	if argumentIndex >= len(command.Arguments) {
+		return []string{}
+	}
+	argument := command.Arguments[argumentIndex]
+	if argument.Suggestions == nil {
+		return []string{}
+	}
+	return filterPrefix(argument.Suggestions(), prefix)
+}
+
+func filterPrefix(values []string, prefix string) []string {
+	filtered := []string{}
+	for _, value := range values {
+		if strings.HasPrefix(strings.ToLower(value), strings.ToLower(prefix)) {
+			filtered = append(filtered, value)
+		}
+	}
+	sort.Strings(filtered)
+	return filtered
+}
+
+func (registry *Registry) help(context *Context, arguments []string) error {
+	if len(arguments) == 1 {
+		command := registry.command(arguments[0])
+		if command == nil {
+			return ErrUnknownCommand{arguments[0]}
+		}
+		context.Printf("%v: %v", command.usage(""), command.Description)
+		for _, subcommand := range command.Subcommands {
+			context.Printf("  %v: %v", subcommand.usage(command.Name), subcommand.Description)
+		}
+		return nil
+	}
+	for _, command := range registry.commands {
+		context.Printf("%v: %v", command.usage(""), command.Description)
+	}
+	return nil
+}
@@ -0,0 +1,108 @@
+package commands
+
+import (
+	"bytes"
+	"errors"
+	"reflect"
+	"testing"
+)
+
+// this method creates a registry with a ban command and a maintenance command with subcommands
+func testRegistry(t *testing.T) (*Registry, *[]string) {
+	executed := &[]string{}
+	record := func(name string) func(*Context, []string) error {
+		return func(context *Context, arguments []string) error {
+			*executed = append(append(*executed, name, context.Source), arguments...)
+			context.Printf("executed %v", name)
+			return nil
+		}
+	}
+	registry := NewRegistry()
+	for _, command := range []*Command{
+		{
+			Name:      "ban",
+			Arguments: []Argument{{Name: "player", Suggestions: func() []string { return []string{"Notch", "jeb_"} }}, {Name: "reason", Optional: true, Rest: true}},
+			Execute:   record("ban"),
+		},
+		{
+			Name:    "maintenance",
+			Aliases: []string{"mt"},
+			Subcommands: []*Command{
+				{Name: "on", Execute: record("on")},
+				{Name: "off", Execute: record("off")},
+			},
+		},
+		{
+			Name: "fail",
+			Execute: func(context *Context, arguments []string) error {
+				return errors.New("failed")
+			},
+		},
+	} {
+		if err := registry.Register(command); err != nil {
+			t.Fatal(err)
+		}
+	}
+	return registry, executed
+}
+
+func TestExecute(t *testing.T) {
+	registry, executed := testRegistry(t)
+	output := &bytes.Buffer{}
+	for _, line := range []string{"", "ban Notch", "BAN jeb_ for  griefing", "mt on", "maintenance off"} {
+		if err := registry.Execute(line, ConsoleSource, output); err != nil {
+			t.Errorf("%q returned %v", line, err)
+		}
+	}
+	expected := []string{"ban", ConsoleSource, "Notch", "ban", ConsoleSource, "jeb_", "for griefing", "on", ConsoleSource, "off", ConsoleSource}
+	if !reflect.DeepEqual(*executed, expected) {
+		t.Errorf("executed %q instead of %q", *executed, expected)
+	}
+	if output.String() != "executed ban\nexecuted ban\nexecuted on\nexecuted off\n" {
+		t.Errorf("unexpected output: %q", output.String())
+	}
+	if err := registry.Execute("unknown", ConsoleSource, output); err != (ErrUnknownCommand{"unknown"}) {
+		t.Errorf("an unknown command returned %v", err)
+	}
+	if err := registry.Execute("ban", ConsoleSource, output); err != (ErrUsage{"ban <player> [reason...]"}) {
+		t.Errorf("a command without arguments returned %v", err)
+	}
+	if err := registry.Execute("maintenance toggle", ConsoleSource, output); err != (ErrUsage{"maintenance <on|off>"}) {
+		t.Errorf("an unknown subcommand returned %v", err)
+	}
+	if err := registry.Execute("fail", ConsoleSource, output); err == nil || err.Error() != "failed" {
+		t.Errorf("the error of the command was not returned: %v", err)
+	}
+	if err := registry.Register(&Command{Name: "mt"}); err == nil {
+		t.Error("a command with the alias of another command was registered")
+	}
+}
+
+func TestComplete(t *testing.T) {
+	registry, _ := testRegistry(t)
+	for line, expected := range map[string][]string{
+		"":                 {"ban", "fail", "help", "maintenance"},
+		"ma":               {"maintenance"},
+		"maintenance ":     {"off", "on"},
+		"maintenance of":   {"off"},
+		"ban n":            {"Notch"},
+		"ban Notch ":       {},
+		"help b":           {"ban"},
+		"unknown argument": {},
+	} {
+		if completions := registry.Complete(line); !reflect.DeepEqual(completions, expected) {
+			t.Errorf("%q was completed with %q instead of %q", line, completions, expected)
+		}
+	}
+}
+
+func TestHelp(t *testing.T) {
+	registry, _ := testRegistry(t)
+	output := &bytes.Buffer{}
+	if err := registry.Execute("help maintenance", ConsoleSource, output); err != nil {
+		t.Fatal(err)
+	}
+	if expected := "maintenance <on|off>: \n  maintenance on: \n  maintenance off: \n"; output.String() != expected {
+		t.Errorf("unexpected help: %q", output.String())
+	}
+}
@@ -4,51 +4,131 @@ import (
 	"os"
 	"encoding/json"
 	"log"
+	"regexp"
+	"fmt"
+	"github.com/michivip/mcstatusserver/bans"
+	"io/ioutil"
+	"strings"
+	"encoding/base64"
 )
 
+// the prefix of an encoded favicon
+const faviconPrefix = "data:image/png;base64,"
+
 func LoadConfiguration(fileName string) (*ServerConfiguration) {
-	config := &ServerConfiguration{}
-	file, err := os.Open(fileName)
-	if err != nil {
+	if _, err := os.Stat(fileName); err != nil {
 		if os.IsNotExist(err) {
 			log.Printf("Creating new configuration file: \"%v\"\n", fileName)
-			file, err = os.Create(fileName)
+			file, err := os.Create(fileName)
 			if err != nil {
 				panic(err)
 			}
 			jsonEncoder := json.NewEncoder(file)
 			jsonEncoder.SetIndent("", "  ")
-			if err = jsonEncoder.Encode(getDefaultConfiguration()); err != nil {
+			if err = jsonEncoder.Encode(DefaultConfiguration()); err != nil {
 				panic(err)
 			}
 			if err = file.Close(); err != nil {
 				panic(err)
 			}
-			file, err = os.Open(fileName)
-			if err != nil {
-				panic(err)
-			}
 			log.Println("New config file created! Please adjust your values and restart the application.")
 			os.Exit(0)
 		} else {
 			panic(err)
 		}
 	}
-	err = json.NewDecoder(file).Decode(config)
+	config, err := ReadConfiguration(fileName)
 	if err != nil {
 		panic(err)
 	}
-	if err = file.Close(); err != nil {
-		panic(err)
-	}
 	return config
 }
 
-func getDefaultConfiguration() *ServerConfiguration {
+// this method reads the given configuration file and checks its values (e.g. to reload it at runtime)
+// returns an error if the file could not be read or contains invalid values
+func ReadConfiguration(fileName string) (*ServerConfiguration, error) {
+	file, err := os.Open(fileName)
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+	config := &ServerConfiguration{}
+	if err = json.NewDecoder(file).Decode(config); err != nil {
+		return nil, fmt.Errorf("could not decode %v: %v", fileName, err)
+	}
+	if err = CompileDisconnectRules(config.LoginAttempt.Rules); err != nil {
+		return nil, err
+	}
+	return config, nil
+}
+
+// this method replaces the favicon paths of the MOTD and the MOTD profiles by the encoded favicons
+// returns an error if a favicon could not be read
+func LoadFavicons(config *ServerConfiguration) error {
+	favicon, err := EncodeFavicon(config.Motd.FaviconPath)
+	if err != nil {
+		return err
+	}
+	config.Motd.FaviconPath = favicon
+	for name, profile := range config.MotdProfiles {
+		if profile.FaviconPath, err = EncodeFavicon(profile.FaviconPath); err != nil {
+			return err
+		}
+		config.MotdProfiles[name] = profile
+	}
+	return nil
+}
+
+// returns the png file at the given path as data URL which is sent in the status response
+// empty paths and favicons which are encoded already are returned unchanged
+func EncodeFavicon(path string) (string, error) {
+	if path == "" || strings.HasPrefix(path, faviconPrefix) {
+		return path, nil
+	}
+	faviconBytes, err := ioutil.ReadFile(path)
+	if err != nil {
+		return "", fmt.Errorf("could not read the favicon: %v", err)
+	}
+	return faviconPrefix + base64.RawStdEncoding.EncodeToString(faviconBytes), nil
+}
+
+// this method checks the patterns and ip values of the given disconnect rules and stores the compiled patterns in the rules
+// returns an error if a rule contains an invalid value
+func CompileDisconnectRules(rules []DisconnectRuleValues) error {
+	for index, rule := range rules {
+		namePattern, err := regexp.Compile(rule.NamePattern)
+		if err != nil {
+			return fmt.Errorf("invalid name-pattern of disconnect rule %v: %v", index, err)
+		}
+		rules[index].namePattern = namePattern
+		for _, ip := range rule.Ips {
+			if _, err := bans.ParseIpNetwork(ip); err != nil {
+				return fmt.Errorf("invalid ip of disconnect rule %v: %v", index, err)
+			}
+		}
+	}
+	return nil
+}
+
+// returns a new configuration with the default values which are written to new configuration files
+// it can be used to run a server without a configuration file (e.g. in tests)
+func DefaultConfiguration() *ServerConfiguration {
 	return &ServerConfiguration{
 		Address:           "localhost:25565",
 		ConnectionTimeout: 10000,
 		LogFile:           "access.log",
+		LogLevel:          "debug",
+		AccessLog: AccessLogValues{
+			Enabled: false,
+			File:    "access.jsonl",
+			Format:  "json",
+		},
+		LogRotation: LogRotationValues{
+			MaximumSize:    10,
+			Interval:       24 * 60 * 60 * 1000,
+			MaximumBackups: 7,
+			Compress:       true,
+		},
 		LoginAttempt: LoginAttemptValues{
 			DisconnectText: ChatValue{
 				Text:       "You are not ",
@@ -70,6 +150,98 @@ func getDefaultConfiguration() *ServerConfiguration {
 				},
 			},
 		},
+		Bans: BanValues{
+			BannedIpsFile:     "banned-ips.json",
+			BannedPlayersFile: "banned-players.json",
+			WhitelistFile:     "whitelist.json",
+			ProfileServer:     bans.DefaultProfileServer,
+			EnforceWhitelist:  false,
+			BanMessage: ChatValue{
+				Text:  "You are banned from this server.\nReason: {reason}\nExpires: {expires}",
+				Color: "red",
+			},
+			WhitelistMessage: ChatValue{
+				Text:  "You are not white-listed on this server!",
+				Color: "red",
+			},
+		},
+		OnlineMode: OnlineModeValues{
+			Enabled:                 false,
+			SessionServer:           "https://sessionserver.mojang.com",
+			PreventProxyConnections: false,
+			FailureMessage: ChatValue{
+				Text: "Failed to verify username!",
+			},
+		},
+		Limbo: LimboValues{
+			Enabled:          false,
+			ProtocolVersions: []int{47, 340, 766, 767},
+			Title: ChatValue{
+				Text:  "Maintenance",
+				Color: "red",
+			},
+			Subtitle: ChatValue{
+				Text:  "Please wait until the server is back.",
+				Color: "gray",
+			},
+			ActionBar: ChatValue{
+				Text:  "The server is starting...",
+				Color: "yellow",
+			},
+			ChatMessage: ChatValue{
+				Text:  "You will be disconnected when the server is back.",
+				Color: "gray",
+			},
+			ActionBarInterval: 2000,
+			MaximumDuration:   300000,
+		},
+		MaximumPacketLength: PacketLengthValues{
+			Handshaking:   1024,
+			Status:        64,
+			Login:         8192,
+			Configuration: 0,
+			Play:          0,
+		},
+		Metrics: MetricsValues{
+			Enabled: false,
+			Address: "localhost:9225",
+			Path:    "/metrics",
+		},
+		Maintenance: MaintenanceValues{
+			Enabled:     false,
+			Description: "The server is in maintenance.",
+			VersionName: "Maintenance",
+			DisconnectText: ChatValue{
+				Text:  "The server is in maintenance, please come back later.",
+				Color: "red",
+			},
+		},
+		Admin: AdminValues{
+			Enabled: false,
+			Address: "localhost:9226",
+			Token:   "",
+		},
+		Rcon: RconValues{
+			Enabled:  false,
+			Address:  "localhost:25575",
+			Password: "",
+		},
+		Queue: QueueValues{
+			Enabled:           false,
+			BackendAddress:    "localhost:25566",
+			CheckInterval:     5000,
+			TransferHost:      "localhost",
+			TransferPort:      25566,
+			TransfersPerCheck: 10,
+			PositionMessage: ChatValue{
+				Text:  "Position in queue: {position}/{size}",
+				Color: "yellow",
+			},
+			ReadyMessage: ChatValue{
+				Text:  "The server is up, reconnect now!",
+				Color: "green",
+			},
+		},
 		Motd: MessageOfTheDayValues{
 			Version: struct {
 				Name     string `json:"name"`
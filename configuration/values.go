@@ -1,11 +1,35 @@
 package configuration
 
+import "regexp"
+
 type ServerConfiguration struct {
 	Address           string                `json:"address"`
 	ConnectionTimeout int                   `json:"connection-timeout"`
 	LogFile           string                `json:"log-file"`
 	Motd              MessageOfTheDayValues `json:"motd"`
 	LoginAttempt      LoginAttemptValues    `json:"login-attempt"`
+	Bans              BanValues             `json:"bans"`
+	OnlineMode        OnlineModeValues      `json:"online-mode"`
+	Limbo             LimboValues           `json:"limbo"`
+	Queue             QueueValues           `json:"queue"`
+	// trust the ip of the client which BungeeCord appends to the handshake (only if the server is not reachable without the proxy)
+	IpForwarding bool `json:"ip-forwarding"`
+	// JSON file with protocol versions which add or override the known versions (empty if not used)
+	ProtocolVersionsFile string             `json:"protocol-versions-file"`
+	MaximumPacketLength  PacketLengthValues `json:"maximum-packet-length"`
+	Metrics              MetricsValues      `json:"metrics"`
+	// debug (every connection is logged) or info (only errors and the actions of players)
+	LogLevel  string          `json:"log-level"`
+	AccessLog AccessLogValues `json:"access-log"`
+	// rotation of the log file and the access log file
+	LogRotation LogRotationValues `json:"log-rotation"`
+	// MOTDs which replace the MOTD when they are selected by their names (e.g. with the admin API)
+	MotdProfiles map[string]MessageOfTheDayValues `json:"motd-profiles,omitempty"`
+	Maintenance  MaintenanceValues                `json:"maintenance"`
+	Admin        AdminValues                      `json:"admin"`
+	Rcon         RconValues                       `json:"rcon"`
+	// the URLs which receive the events of the server (e.g. login attempts)
+	Webhooks []WebhookValues `json:"webhooks,omitempty"`
 }
 
 // clickEvent or hoverEvent is not needed
@@ -56,4 +80,167 @@ type MessageOfTheDayValues struct {
 // if a user tries to login
 type LoginAttemptValues struct {
 	DisconnectText ChatValue
+	Rules          []DisconnectRuleValues `json:"rules,omitempty"`
+}
+
+// a rule which chooses a different disconnect text for specific players
+// every criterion which is set has to match, within a list one matching value is enough
+type DisconnectRuleValues struct {
+	Names          []string  `json:"names,omitempty"`
+	Uuids          []string  `json:"uuids,omitempty"`
+	NamePattern    string    `json:"name-pattern,omitempty"`
+	Ips            []string  `json:"ips,omitempty"`
+	Whitelisted    *bool     `json:"whitelisted,omitempty"`
+	DisconnectText ChatValue `json:"disconnect-text"`
+
+	// the compiled NamePattern (see CompileDisconnectRules)
+	namePattern *regexp.Regexp
+}
+
+// this method checks whether the name matches the name pattern of the rule (every name matches a rule without pattern)
+// the pattern is compiled by CompileDisconnectRules when the configuration is read, rules which were not compiled compile it on every call
+func (rule DisconnectRuleValues) MatchesNamePattern(name string) bool {
+	if rule.NamePattern == "" {
+		return true
+	}
+	namePattern := rule.namePattern
+	if namePattern == nil {
+		var err error
+		if namePattern, err = regexp.Compile(rule.NamePattern); err != nil {
+			return false
+		}
+	}
+	return namePattern.MatchString(name)
+}
+
+// ban lists and whitelist (vanilla compatible files)
+type BanValues struct {
+	BannedIpsFile     string    `json:"banned-ips-file"`
+	BannedPlayersFile string    `json:"banned-players-file"`
+	WhitelistFile     string    `json:"whitelist-file"`
+	ProfileServer     string    `json:"profile-server"`
+	EnforceWhitelist  bool      `json:"enforce-whitelist"`
+	BanMessage        ChatValue `json:"ban-message"`
+	WhitelistMessage  ChatValue `json:"whitelist-message"`
+}
+
+// authentication of players with a session server before they receive their disconnect text
+type OnlineModeValues struct {
+	Enabled                 bool      `json:"enabled"`
+	SessionServer           string    `json:"session-server"`
+	PreventProxyConnections bool      `json:"prevent-proxy-connections"`
+	FailureMessage          ChatValue `json:"failure-message"`
+}
+
+// players of the given protocol versions are admitted into an empty world instead of being disconnected
+type LimboValues struct {
+	Enabled          bool      `json:"enabled"`
+	ProtocolVersions []int     `json:"protocol-versions"`
+	Title            ChatValue `json:"title"`
+	Subtitle         ChatValue `json:"subtitle"`
+	ActionBar        ChatValue `json:"action-bar"`
+	ChatMessage      ChatValue `json:"chat-message"`
+	// interval (in milliseconds) in which the action bar is sent again
+	ActionBarInterval int `json:"action-bar-interval"`
+	// time (in milliseconds) after which players receive their disconnect text (0 keeps them forever)
+	MaximumDuration int `json:"maximum-duration"`
+}
+
+// the maximum length (in bytes) of received packets per state, 0 allows the maximum length of the protocol
+// connections which send longer packets are closed
+type PacketLengthValues struct {
+	Handshaking   int `json:"handshaking"`
+	Status        int `json:"status"`
+	Login         int `json:"login"`
+	Configuration int `json:"configuration"`
+	Play          int `json:"play"`
+}
+
+// players wait in a queue until the backend server is available
+type QueueValues struct {
+	Enabled bool `json:"enabled"`
+	// address of the backend server which is checked with status requests
+	BackendAddress string `json:"backend-address"`
+	// interval (in milliseconds) in which the backend server is checked
+	CheckInterval int `json:"check-interval"`
+	// address which is sent to clients which support the Transfer packet (1.20.5+)
+	TransferHost string `json:"transfer-host"`
+	TransferPort int    `json:"transfer-port"`
+	// maximum amount of players which are released per check (0 releases all of them)
+	TransfersPerCheck int       `json:"transfers-per-check"`
+	PositionMessage   ChatValue `json:"position-message"`
+	ReadyMessage      ChatValue `json:"ready-message"`
+}
+
+// HTTP listener which exposes the metrics of the server in the Prometheus text format
+type MetricsValues struct {
+	Enabled bool   `json:"enabled"`
+	Address string `json:"address"`
+	Path    string `json:"path"`
+}
+
+// a structured event per connection which is written as JSON line or logfmt
+type AccessLogValues struct {
+	Enabled bool `json:"enabled"`
+	// path of the access log file (the standard output if empty)
+	File string `json:"file"`
+	// json or logfmt
+	Format string `json:"format"`
+	// the written fields in their order (all fields if empty)
+	Fields []string `json:"fields,omitempty"`
+}
+
+// the log files are appended to and rotated when they exceed their size or a new interval starts
+type LogRotationValues struct {
+	// in megabytes (0 disables the rotation by size)
+	MaximumSize int `json:"maximum-size"`
+	// in milliseconds (0 disables the rotation by time)
+	Interval int `json:"interval"`
+	// amount of rotated files which are kept (0 keeps all of them)
+	MaximumBackups int  `json:"maximum-backups"`
+	Compress       bool `json:"compress"`
+}
+
+// while the maintenance mode is enabled, the status and the disconnect text of the players show the maintenance texts
+type MaintenanceValues struct {
+	Enabled bool `json:"enabled"`
+	// MOTD text and version name of the status (the values of the MOTD are kept if they are empty)
+	Description string `json:"description"`
+	VersionName string `json:"version-name"`
+	// text which is displayed instead of the disconnect text of the login attempts and rules
+	DisconnectText ChatValue `json:"disconnect-text"`
+}
+
+// HTTP API which reads and changes the state of the running server
+type AdminValues struct {
+	Enabled bool `json:"enabled"`
+	// it should not be reachable from the internet
+	Address string `json:"address"`
+	// the clients authenticate with this token (Authorization: Bearer <token>), it must not be empty
+	Token string `json:"token"`
+}
+
+// remote console (Source RCON protocol) which executes the console commands
+type RconValues struct {
+	Enabled bool `json:"enabled"`
+	// it should not be reachable from the internet because the password is sent in plain text
+	Address string `json:"address"`
+	// it must not be empty
+	Password string `json:"password"`
+}
+
+// a webhook which receives the events of the server in batches
+type WebhookValues struct {
+	Url string `json:"url"`
+	// json (the events) or discord (a message with a line per event)
+	Format string `json:"format"`
+	// custom JSON body in which {text} and {events} are replaced (empty to use the body of the format)
+	Payload string `json:"payload,omitempty"`
+	// the types of the events which are sent (empty to send all events)
+	Events          []string `json:"events,omitempty"`
+	MaintenanceOnly bool     `json:"maintenance-only"`
+	// in milliseconds, the values which are 0 are replaced by defaults
+	BatchInterval    int `json:"batch-interval"`
+	MaximumBatchSize int `json:"maximum-batch-size"`
+	Retries          int `json:"retries"`
 }
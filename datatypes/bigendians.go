@@ -30,3 +30,55 @@ func ReadLong(reader io.Reader) (value int64, err error) {
 func WriteLong(writer io.Writer, value int64) (error) {
 	return binary.Write(writer, binary.BigEndian, &value)
 }
+
+// this method reads a short (signed 16-bit integer) from the given io.Reader
+// returns the read short or an error if something went wrong
+func ReadShort(reader io.Reader) (value int16, err error) {
+	err = binary.Read(reader, binary.BigEndian, &value)
+	return
+}
+
+// this method writes a short (signed 16-bit integer) to the given io.Writer
+// returns an error if something went wrong
+func WriteShort(writer io.Writer, value int16) (error) {
+	return binary.Write(writer, binary.BigEndian, &value)
+}
+
+// this method reads an int (signed 32-bit integer) from the given io.Reader
+// returns the read int or an error if something went wrong
+func ReadInt(reader io.Reader) (value int32, err error) {
+	err = binary.Read(reader, binary.BigEndian, &value)
+	return
+}
+
+// this method writes an int (signed 32-bit integer) to the given io.Writer
+// returns an error if something went wrong
+func WriteInt(writer io.Writer, value int32) (error) {
+	return binary.Write(writer, binary.BigEndian, &value)
+}
+
+// this method reads a float (IEEE 754 single-precision) from the given io.Reader
+// returns the read float or an error if something went wrong
+func ReadFloat(reader io.Reader) (value float32, err error) {
+	err = binary.Read(reader, binary.BigEndian, &value)
+	return
+}
+
+// this method writes a float (IEEE 754 single-precision) to the given io.Writer
+// returns an error if something went wrong
+func WriteFloat(writer io.Writer, value float32) (error) {
+	return binary.Write(writer, binary.BigEndian, &value)
+}
+
+// this method reads a double (IEEE 754 double-precision) from the given io.Reader
+// returns the read double or an error if something went wrong
+func ReadDouble(reader io.Reader) (value float64, err error) {
+	err = binary.Read(reader, binary.BigEndian, &value)
+	return
+}
+
+// this method writes a double (IEEE 754 double-precision) to the given io.Writer
+// returns an error if something went wrong
+func WriteDouble(writer io.Writer, value float64) (error) {
+	return binary.Write(writer, binary.BigEndian, &value)
+}
@@ -73,6 +73,15 @@ func WriteVarInt(writer io.Writer, value int) (err error, totalBytesWritten int)
 	return err, totalBytesWritten
 }
 
+// this method returns the amount of bytes which are needed to write the given VarInt
+func VarIntSize(value int) int {
+	size := 1
+	for unsigned := uint32(value) >> 7; unsigned != 0; unsigned >>= 7 {
+		size++
+	}
+	return size
+}
+
 // this method reads a VarLong from the given io.Reader
 // returns the read VarLong and the amount of bytes read or an error if something went wrong
 func ReadVarLong(reader io.Reader) (value int64, err error, totalBytesRead int) {
@@ -157,13 +166,11 @@ func ReadString(reader io.Reader) (value string, err error, totalBytesRead int)
 		return value, err, totalBytesRead
 	}
 	buffer := make([]byte, length)
-	bytesRead, err := reader.Read(buffer)
-	if err != nil {
-		// an unknown error occurred while reading the next byte
-		return value, err, totalBytesRead
-	} else if bytesRead < len(buffer) {
-		// the VarInt has not ended yet but there is no more byte available
-		err = io.ErrUnexpectedEOF
+	if _, err = io.ReadFull(reader, buffer); err == io.EOF {
+		// the string has not ended yet but there is no more byte available
+		return value, io.ErrUnexpectedEOF, totalBytesRead
+	} else if err != nil {
+		// an unknown error occurred while reading the string
 		return value, err, totalBytesRead
 	}
 	value = string(buffer)
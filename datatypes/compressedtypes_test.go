@@ -0,0 +1,241 @@
+package datatypes
+
+import (
+	"bytes"
+	"encoding/hex"
+	"io"
+	"math"
+	"strings"
+	"testing"
+)
+
+// the examples of http://wiki.vg/Protocol#VarInt_and_VarLong
+var varIntGolden = []struct {
+	value   int
+	encoded string
+}{
+	{0, "00"},
+	{1, "01"},
+	{2, "02"},
+	{127, "7f"},
+	{128, "8001"},
+	{255, "ff01"},
+	{25565, "ddc701"},
+	{2097151, "ffff7f"},
+	{2147483647, "ffffffff07"},
+	{-1, "ffffffff0f"},
+	{-2147483648, "8080808008"},
+}
+
+var varLongGolden = []struct {
+	value   int64
+	encoded string
+}{
+	{0, "00"},
+	{1, "01"},
+	{2, "02"},
+	{127, "7f"},
+	{128, "8001"},
+	{255, "ff01"},
+	{2147483647, "ffffffff07"},
+	{9223372036854775807, "ffffffffffffffff7f"},
+	{-1, "ffffffffffffffffff01"},
+	{-2147483648, "80808080f8ffffffff01"},
+	{-9223372036854775808, "80808080808080808001"},
+}
+
+func TestVarIntGolden(t *testing.T) {
+	for _, golden := range varIntGolden {
+		buffer := bytes.NewBuffer([]byte{})
+		if err, bytesWritten := WriteVarInt(buffer, golden.value); err != nil {
+			t.Fatalf("could not write %v: %v", golden.value, err)
+		} else if bytesWritten != len(golden.encoded)/2 || bytesWritten != VarIntSize(golden.value) {
+			t.Errorf("%v: reported %v bytes written, size %v", golden.value, bytesWritten, VarIntSize(golden.value))
+		}
+		if encoded := hex.EncodeToString(buffer.Bytes()); encoded != golden.encoded {
+			t.Errorf("%v was written as %v instead of %v", golden.value, encoded, golden.encoded)
+		}
+		value, err, bytesRead := ReadVarInt(buffer)
+		if err != nil || value != golden.value || bytesRead != len(golden.encoded)/2 {
+			t.Errorf("%v was read as %v (%v bytes, error: %v)", golden.encoded, value, bytesRead, err)
+		}
+	}
+}
+
+func TestVarLongGolden(t *testing.T) {
+	for _, golden := range varLongGolden {
+		buffer := bytes.NewBuffer([]byte{})
+		if err, _ := WriteVarLong(buffer, golden.value); err != nil {
+			t.Fatalf("could not write %v: %v", golden.value, err)
+		}
+		if encoded := hex.EncodeToString(buffer.Bytes()); encoded != golden.encoded {
+			t.Errorf("%v was written as %v instead of %v", golden.value, encoded, golden.encoded)
+		}
+		value, err, bytesRead := ReadVarLong(buffer)
+		if err != nil || value != golden.value || bytesRead != len(golden.encoded)/2 {
+			t.Errorf("%v was read as %v (%v bytes, error: %v)", golden.encoded, value, bytesRead, err)
+		}
+	}
+}
+
+func TestVarIntRoundTrip(t *testing.T) {
+	values := []int{math.MinInt32, math.MinInt32 + 1, -128, -1, 0, 1, 127, 128, 16383, 16384, 2097151, 2097152, 268435455, 268435456, math.MaxInt32 - 1, math.MaxInt32}
+	for shift := uint(0); shift < 32; shift++ {
+		power := int32(1) << shift
+		values = append(values, int(power), int(power-1), int(-power))
+	}
+	for _, value := range values {
+		buffer := bytes.NewBuffer([]byte{})
+		WriteVarInt(buffer, value)
+		if read, err, _ := ReadVarInt(buffer); err != nil || read != value {
+			t.Errorf("%v was read as %v (error: %v)", value, read, err)
+		} else if buffer.Len() != 0 {
+			t.Errorf("%v left %v bytes unread", value, buffer.Len())
+		}
+	}
+}
+
+func TestVarLongRoundTrip(t *testing.T) {
+	values := []int64{math.MinInt64, math.MinInt64 + 1, math.MinInt32, -1, 0, 1, math.MaxInt32, math.MaxInt64 - 1, math.MaxInt64}
+	for shift := uint(0); shift < 64; shift++ {
+		values = append(values, int64(1)<<shift, int64(1)<<shift-1, -(int64(1) << shift))
+	}
+	for _, value := range values {
+		buffer := bytes.NewBuffer([]byte{})
+		WriteVarLong(buffer, value)
+		if read, err, _ := ReadVarLong(buffer); err != nil || read != value {
+			t.Errorf("%v was read as %v (error: %v)", value, read, err)
+		} else if buffer.Len() != 0 {
+			t.Errorf("%v left %v bytes unread", value, buffer.Len())
+		}
+	}
+}
+
+func TestVarIntTooLong(t *testing.T) {
+	if _, err, _ := ReadVarInt(bytes.NewReader([]byte{0x80, 0x80, 0x80, 0x80, 0x80, 0x01})); err != InvalidTypeSize {
+		t.Errorf("a VarInt with 6 bytes returned %v", err)
+	}
+	if _, err, _ := ReadVarLong(bytes.NewReader(bytes.Repeat([]byte{0x80}, 11))); err != InvalidTypeSize {
+		t.Errorf("a VarLong with 11 bytes returned %v", err)
+	}
+	if _, err, _ := ReadVarInt(bytes.NewReader([]byte{0x80, 0x80})); err != io.EOF && err != io.ErrUnexpectedEOF {
+		t.Errorf("a truncated VarInt returned %v", err)
+	}
+}
+
+func TestStringRoundTrip(t *testing.T) {
+	values := []string{
+		"a",
+		"localhost",
+		"§cThis server runs with §aGo",
+		"日本語",
+		"\U0001F600",
+		strings.Repeat("x", 255),
+		strings.Repeat("x", maximumBytes),
+		strings.Repeat("\U0001F600", maximumBytes/4),
+	}
+	for _, value := range values {
+		buffer := bytes.NewBuffer([]byte{})
+		if err, bytesWritten := WriteString(buffer, value); err != nil {
+			t.Errorf("could not write a string with %v bytes: %v", len(value), err)
+			continue
+		} else if bytesWritten != buffer.Len() {
+			t.Errorf("reported %v bytes written instead of %v", bytesWritten, buffer.Len())
+		}
+		if read, err, _ := ReadString(buffer); err != nil || read != value {
+			t.Errorf("a string with %v bytes was read with %v bytes (error: %v)", len(value), len(read), err)
+		}
+	}
+}
+
+func TestStringInvalidLength(t *testing.T) {
+	// this implementation rejects empty strings
+	for _, value := range []string{"", strings.Repeat("x", maximumBytes+1)} {
+		if err, _ := WriteString(bytes.NewBuffer([]byte{}), value); err == nil {
+			t.Errorf("a string with %v bytes was written", len(value))
+		}
+	}
+	for _, length := range []int{0, -1, maximumBytes + 1} {
+		buffer := bytes.NewBuffer([]byte{})
+		WriteVarInt(buffer, length)
+		buffer.WriteString("data")
+		if _, err, _ := ReadString(buffer); err == nil {
+			t.Errorf("a string with the length %v was read", length)
+		}
+	}
+	// the content is shorter than the prepended length
+	if _, err, _ := ReadString(bytes.NewReader([]byte{0x05, 'a', 'b'})); err != io.ErrUnexpectedEOF {
+		t.Errorf("a truncated string returned %v", err)
+	}
+}
+
+func FuzzReadVarInt(f *testing.F) {
+	for _, golden := range varIntGolden {
+		encoded, _ := hex.DecodeString(golden.encoded)
+		f.Add(encoded)
+	}
+	f.Add([]byte{0xff, 0xff, 0xff, 0xff, 0xff, 0x01})
+	f.Fuzz(func(t *testing.T, data []byte) {
+		value, err, bytesRead := ReadVarInt(bytes.NewReader(data))
+		if bytesRead > 6 {
+			t.Fatalf("read %v bytes", bytesRead)
+		}
+		if err != nil {
+			return
+		}
+		if value < math.MinInt32 || value > math.MaxInt32 {
+			t.Fatalf("the value %v is out of the VarInt range", value)
+		}
+		buffer := bytes.NewBuffer([]byte{})
+		WriteVarInt(buffer, value)
+		if read, err, _ := ReadVarInt(buffer); err != nil || read != value {
+			t.Fatalf("%v was read as %v (error: %v)", value, read, err)
+		}
+	})
+}
+
+func FuzzReadVarLong(f *testing.F) {
+	for _, golden := range varLongGolden {
+		encoded, _ := hex.DecodeString(golden.encoded)
+		f.Add(encoded)
+	}
+	f.Fuzz(func(t *testing.T, data []byte) {
+		value, err, bytesRead := ReadVarLong(bytes.NewReader(data))
+		if bytesRead > 11 {
+			t.Fatalf("read %v bytes", bytesRead)
+		}
+		if err != nil {
+			return
+		}
+		buffer := bytes.NewBuffer([]byte{})
+		WriteVarLong(buffer, value)
+		if read, err, _ := ReadVarLong(buffer); err != nil || read != value {
+			t.Fatalf("%v was read as %v (error: %v)", value, read, err)
+		}
+	})
+}
+
+func FuzzReadString(f *testing.F) {
+	f.Add([]byte{0x09, 'l', 'o', 'c', 'a', 'l', 'h', 'o', 's', 't'})
+	f.Add([]byte{0x00})
+	f.Add([]byte{0xff, 0xff, 0xff, 0xff, 0x07})
+	f.Add([]byte{0x05, 'a'})
+	f.Fuzz(func(t *testing.T, data []byte) {
+		reader := bytes.NewReader(data)
+		value, err, _ := ReadString(reader)
+		if err != nil {
+			return
+		}
+		consumed := len(data) - reader.Len()
+		if len(value) < 1 || len(value) > maximumBytes || value != string(data[consumed-len(value):consumed]) {
+			t.Fatalf("read a string with %v bytes which does not match the data %x", len(value), data)
+		}
+		buffer := bytes.NewBuffer([]byte{})
+		if err, _ := WriteString(buffer, value); err != nil {
+			t.Fatalf("could not write the read string: %v", err)
+		}
+		if read, err, _ := ReadString(buffer); err != nil || read != value {
+			t.Fatalf("the written string was read as %q (error: %v)", read, err)
+		}
+	})
+}
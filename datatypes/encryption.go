@@ -0,0 +1,130 @@
+package datatypes
+
+import (
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/sha1"
+	"encoding/hex"
+	"io"
+	"strings"
+)
+
+// this file contains the encryption which is used by the protocol after the Encryption Response: http://wiki.vg/Protocol_Encryption
+
+// AES/CFB8 stream cipher (the standard library only implements CFB with a segment size of the block size)
+type cfb8 struct {
+	block         cipher.Block
+	shiftRegister []byte
+	encryptedIv   []byte
+	decrypt       bool
+}
+
+// this method creates a new AES/CFB8 stream which encrypts data
+// the shared secret is used as key and as initial vector (like the protocol does)
+// returns the stream or an error if the shared secret is no valid AES key
+func NewCfb8Encrypter(sharedSecret []byte) (cipher.Stream, error) {
+	return newCfb8(sharedSecret, sharedSecret, false)
+}
+
+// this method creates a new AES/CFB8 stream which decrypts data
+// the shared secret is used as key and as initial vector (like the protocol does)
+// returns the stream or an error if the shared secret is no valid AES key
+func NewCfb8Decrypter(sharedSecret []byte) (cipher.Stream, error) {
+	return newCfb8(sharedSecret, sharedSecret, true)
+}
+
+// the initial vector must have the block size
+func newCfb8(key, iv []byte, decrypt bool) (cipher.Stream, error) {
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, err
+	}
+	shiftRegister := make([]byte, block.BlockSize())
+	copy(shiftRegister, iv)
+	return &cfb8{block: block, shiftRegister: shiftRegister, encryptedIv: make([]byte, block.BlockSize()), decrypt: decrypt}, nil
+}
+
+func (stream *cfb8) XORKeyStream(dst, src []byte) {
+	for index, value := range src {
+		stream.block.Encrypt(stream.encryptedIv, stream.shiftRegister)
+		result := value ^ stream.encryptedIv[0]
+		// the cipher text byte is shifted into the register
+		cipherText := result
+		if stream.decrypt {
+			cipherText = value
+		}
+		copy(stream.shiftRegister, stream.shiftRegister[1:])
+		stream.shiftRegister[len(stream.shiftRegister)-1] = cipherText
+		dst[index] = result
+	}
+}
+
+// this method wraps the given io.Reader so that everything which is read gets decrypted with the shared secret
+// returns the wrapped reader or an error if the shared secret is no valid AES key
+func NewDecryptingReader(reader io.Reader, sharedSecret []byte) (io.Reader, error) {
+	decrypter, err := NewCfb8Decrypter(sharedSecret)
+	if err != nil {
+		return nil, err
+	}
+	return cipher.StreamReader{S: decrypter, R: reader}, nil
+}
+
+// this method wraps the given io.Writer so that everything which is written gets encrypted with the shared secret
+// returns the wrapped writer or an error if the shared secret is no valid AES key
+func NewEncryptingWriter(writer io.Writer, sharedSecret []byte) (io.Writer, error) {
+	encrypter, err := NewCfb8Encrypter(sharedSecret)
+	if err != nil {
+		return nil, err
+	}
+	return cipher.StreamWriter{S: encrypter, W: writer}, nil
+}
+
+// Encrypted stream of a connection which can be passed to ReadPacket and WritePacket like the connection itself
+type EncryptedReadWriter struct {
+	io.Reader
+	io.Writer
+}
+
+// this method wraps the given io.ReadWriter (e.g. a connection) with the encryption of the shared secret
+// returns the encrypted stream or an error if the shared secret is no valid AES key
+func NewEncryptedReadWriter(readWriter io.ReadWriter, sharedSecret []byte) (*EncryptedReadWriter, error) {
+	reader, err := NewDecryptingReader(readWriter, sharedSecret)
+	if err != nil {
+		return nil, err
+	}
+	writer, err := NewEncryptingWriter(readWriter, sharedSecret)
+	if err != nil {
+		return nil, err
+	}
+	return &EncryptedReadWriter{Reader: reader, Writer: writer}, nil
+}
+
+// this method computes the SHA-1 digest of the given values in Minecraft`s notation
+// (signed hexadecimal number without leading zeros, e.g. the server hash which is sent to the session server)
+func MinecraftDigest(values ...[]byte) string {
+	hash := sha1.New()
+	for _, value := range values {
+		hash.Write(value)
+	}
+	digest := hash.Sum(nil)
+	negative := digest[0]&0x80 != 0
+	if negative {
+		// two's complement
+		carry := true
+		for index := len(digest) - 1; index >= 0; index-- {
+			digest[index] = ^digest[index]
+			if carry {
+				digest[index]++
+				carry = digest[index] == 0
+			}
+		}
+	}
+	digestString := strings.TrimLeft(hex.EncodeToString(digest), "0")
+	if digestString == "" {
+		digestString = "0"
+	}
+	if negative {
+		return "-" + digestString
+	}
+	return digestString
+}
@@ -0,0 +1,93 @@
+package datatypes
+
+import (
+	"bytes"
+	"encoding/hex"
+	"io"
+	"io/ioutil"
+	"testing"
+)
+
+// the examples of http://wiki.vg/Protocol_Encryption#Client
+func TestMinecraftDigestGolden(t *testing.T) {
+	golden := map[string]string{
+		"Notch": "4ed1f46bbe04bc756bcb17c0c7ce3e4632f06a48",
+		"jeb_":  "-7c9d5b0044c130109a5d7b5fb5c317c02b4e28c1",
+		"simon": "88e16a1019277b15d58faf0541e11910eb756f6",
+	}
+	for value, digest := range golden {
+		if computed := MinecraftDigest([]byte(value)); computed != digest {
+			t.Errorf("the digest of %v is %v instead of %v", value, computed, digest)
+		}
+	}
+	// the values are hashed like a single value
+	if MinecraftDigest([]byte("No"), []byte("tch")) != golden["Notch"] {
+		t.Error("the digest of multiple values differs from the digest of the joined value")
+	}
+}
+
+// the CFB8-AES128 example of NIST SP 800-38A (F.3.7 and F.3.8)
+func TestCfb8KnownAnswer(t *testing.T) {
+	key, _ := hex.DecodeString("2b7e151628aed2a6abf7158809cf4f3c")
+	iv, _ := hex.DecodeString("000102030405060708090a0b0c0d0e0f")
+	plain, _ := hex.DecodeString("6bc1bee22e409f96e93d7e117393172aae2d")
+	cipherText, _ := hex.DecodeString("3b79424c9c0dd436bace9e0ed4586a4f32b9")
+	for _, test := range []struct {
+		decrypt  bool
+		input    []byte
+		expected []byte
+	}{
+		{false, plain, cipherText},
+		{true, cipherText, plain},
+	} {
+		stream, err := newCfb8(key, iv, test.decrypt)
+		if err != nil {
+			t.Fatal(err)
+		}
+		// the stream keeps its state between the calls
+		output := make([]byte, len(test.input))
+		stream.XORKeyStream(output[:5], test.input[:5])
+		stream.XORKeyStream(output[5:], test.input[5:])
+		if !bytes.Equal(output, test.expected) {
+			t.Errorf("decrypt=%v: the stream returned %x instead of %x", test.decrypt, output, test.expected)
+		}
+	}
+}
+
+func TestCfb8RoundTrip(t *testing.T) {
+	sharedSecret := []byte("0123456789abcdef")
+	plain := make([]byte, 1000)
+	for index := range plain {
+		plain[index] = byte(index * 7)
+	}
+	encrypted := bytes.NewBuffer([]byte{})
+	writer, err := NewEncryptingWriter(encrypted, sharedSecret)
+	if err != nil {
+		t.Fatal(err)
+	}
+	// the stream is written in chunks of different sizes
+	for offset, size := 0, 1; offset < len(plain); offset, size = offset+size, size*2 {
+		end := offset + size
+		if end > len(plain) {
+			end = len(plain)
+		}
+		writer.Write(plain[offset:end])
+	}
+	if bytes.Equal(encrypted.Bytes(), plain) {
+		t.Fatal("the data was not encrypted")
+	}
+	reader, err := NewDecryptingReader(singleByteReader{encrypted}, sharedSecret)
+	if err != nil {
+		t.Fatal(err)
+	}
+	decrypted, err := ioutil.ReadAll(reader)
+	if err != nil && err != io.EOF {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(decrypted, plain) {
+		t.Error("the decrypted data differs from the plain data")
+	}
+	if _, err = NewEncryptingWriter(encrypted, []byte("short")); err == nil {
+		t.Error("a shared secret with 5 bytes was accepted")
+	}
+}
@@ -0,0 +1,630 @@
+package datatypes
+
+import (
+	"bufio"
+	"bytes"
+	"compress/gzip"
+	"compress/zlib"
+	"encoding/binary"
+	"fmt"
+	"io"
+	"math"
+	"unicode/utf16"
+)
+
+// this file contains the reading and writing of NBT (named binary tags) as described here: http://wiki.vg/NBT
+// the tags are represented by the following values:
+// int8 (Byte), int16 (Short), int32 (Int), int64 (Long), float32 (Float), float64 (Double), []byte (Byte Array),
+// string (String), NbtList (List), NbtCompound (Compound), []int32 (Int Array) and []int64 (Long Array)
+
+// the type id of a tag
+type NbtTagType byte
+
+const (
+	NbtTagEnd NbtTagType = iota
+	NbtTagByte
+	NbtTagShort
+	NbtTagInt
+	NbtTagLong
+	NbtTagFloat
+	NbtTagDouble
+	NbtTagByteArray
+	NbtTagString
+	NbtTagList
+	NbtTagCompound
+	NbtTagIntArray
+	NbtTagLongArray
+)
+
+var nbtTagNames = []string{"End", "Byte", "Short", "Int", "Long", "Float", "Double", "Byte_Array", "String", "List", "Compound", "Int_Array", "Long_Array"}
+
+func (tagType NbtTagType) String() string {
+	if int(tagType) < len(nbtTagNames) {
+		return "TAG_" + nbtTagNames[tagType]
+	}
+	return fmt.Sprintf("TAG_Unknown(%d)", byte(tagType))
+}
+
+// limits of the NBT reader (the same limits which are used by vanilla servers for NBT of the network)
+const (
+	// the maximum nesting depth of lists and compounds
+	MaximumNbtDepth = 512
+	// the maximum amount of bytes which is accounted for the read tags
+	MaximumNbtSize = 2097152
+)
+
+// the maximum amount of list elements which are allocated before they are read
+const maximumNbtListCapacity = 1024
+
+// 1.20.2 removed the name of the root tag from the NBT which is sent over the network
+const NetworkNbtVersion = 764
+
+// a named tag of a compound
+type NbtField struct {
+	Name  string
+	Value interface{}
+}
+
+// a compound tag, the fields are kept in their order so the encoding is deterministic
+type NbtCompound []NbtField
+
+// returns the value of the field with the given name and whether the field exists
+func (compound NbtCompound) Get(name string) (interface{}, bool) {
+	for _, field := range compound {
+		if field.Name == name {
+			return field.Value, true
+		}
+	}
+	return nil, false
+}
+
+// this method replaces the value of the field with the given name or appends a new field
+func (compound *NbtCompound) Set(name string, value interface{}) {
+	for index := range *compound {
+		if (*compound)[index].Name == name {
+			(*compound)[index].Value = value
+			return
+		}
+	}
+	*compound = append(*compound, NbtField{name, value})
+}
+
+// a compound which is being read, a repeated name replaces the value of the earlier field like vanilla servers do
+type nbtCompoundBuilder struct {
+	compound NbtCompound
+	indices  map[string]int
+}
+
+func newNbtCompoundBuilder() *nbtCompoundBuilder {
+	return &nbtCompoundBuilder{NbtCompound{}, make(map[string]int)}
+}
+
+func (builder *nbtCompoundBuilder) set(name string, value interface{}) {
+	if index, found := builder.indices[name]; found {
+		builder.compound[index].Value = value
+	} else {
+		builder.indices[name] = len(builder.compound)
+		builder.compound = append(builder.compound, NbtField{name, value})
+	}
+}
+
+// a list tag, all elements have the same type (an empty list has the type TAG_End in general)
+type NbtList struct {
+	ElementType NbtTagType
+	Elements    []interface{}
+}
+
+// the error which is thrown if NBT data or a value can not be read or written
+type ErrInvalidNbt struct {
+	Reason string
+}
+
+func (errInvalidNbt ErrInvalidNbt) Error() string {
+	return "invalid NBT: " + errInvalidNbt.Reason
+}
+
+// returns the tag type of the given value and whether the value is a tag value
+func NbtTypeOf(value interface{}) (NbtTagType, bool) {
+	switch value.(type) {
+	case int8:
+		return NbtTagByte, true
+	case int16:
+		return NbtTagShort, true
+	case int32:
+		return NbtTagInt, true
+	case int64:
+		return NbtTagLong, true
+	case float32:
+		return NbtTagFloat, true
+	case float64:
+		return NbtTagDouble, true
+	case []byte:
+		return NbtTagByteArray, true
+	case string:
+		return NbtTagString, true
+	case NbtList:
+		return NbtTagList, true
+	case NbtCompound:
+		return NbtTagCompound, true
+	case []int32:
+		return NbtTagIntArray, true
+	case []int64:
+		return NbtTagLongArray, true
+	}
+	return NbtTagEnd, false
+}
+
+// this method writes the given value as root tag with the given name (the layout of files and of the network before 1.20.2)
+// values which are not tag values (e.g. structs) are converted with MarshalNbt
+// returns an error if something went wrong
+func WriteNbt(writer io.Writer, name string, value interface{}) error {
+	return writeNbtRoot(writer, &name, value)
+}
+
+// this method writes the given value as nameless root tag (the layout of the network since 1.20.2)
+// a nil value is written as TAG_End which stands for an absent value
+// returns an error if something went wrong
+func WriteNetworkNbt(writer io.Writer, value interface{}) error {
+	return writeNbtRoot(writer, nil, value)
+}
+
+// this method writes the given value as root tag in the layout of the given protocol version
+func WriteProtocolNbt(writer io.Writer, value interface{}, protocolVersion int) error {
+	if protocolVersion >= NetworkNbtVersion {
+		return WriteNetworkNbt(writer, value)
+	}
+	return WriteNbt(writer, "", value)
+}
+
+func writeNbtRoot(writer io.Writer, name *string, value interface{}) error {
+	data := bytes.NewBuffer([]byte{})
+	if value == nil && name == nil {
+		data.WriteByte(byte(NbtTagEnd))
+	} else {
+		value, err := MarshalNbt(value)
+		if err != nil {
+			return err
+		}
+		tagType, _ := NbtTypeOf(value)
+		data.WriteByte(byte(tagType))
+		if name != nil {
+			if err = writeNbtString(data, *name); err != nil {
+				return err
+			}
+		}
+		if err = writeNbtPayload(data, value, 0); err != nil {
+			return err
+		}
+	}
+	_, err := writer.Write(data.Bytes())
+	return err
+}
+
+func writeNbtPayload(data *bytes.Buffer, value interface{}, depth int) error {
+	if depth > MaximumNbtDepth {
+		return ErrInvalidNbt{"the tags are nested deeper than allowed"}
+	}
+	switch value := value.(type) {
+	case int8:
+		data.WriteByte(byte(value))
+	case int16, int32, int64, float32, float64:
+		binary.Write(data, binary.BigEndian, value)
+	case []byte:
+		binary.Write(data, binary.BigEndian, int32(len(value)))
+		data.Write(value)
+	case string:
+		return writeNbtString(data, value)
+	case NbtList:
+		// the type of a list without element type is taken from its first element
+		elementType := value.ElementType
+		if elementType == NbtTagEnd && len(value.Elements) > 0 {
+			elementType, _ = NbtTypeOf(value.Elements[0])
+		}
+		data.WriteByte(byte(elementType))
+		binary.Write(data, binary.BigEndian, int32(len(value.Elements)))
+		for _, element := range value.Elements {
+			if tagType, _ := NbtTypeOf(element); tagType != elementType {
+				return ErrInvalidNbt{fmt.Sprintf("the list of %v contains a %v", elementType, tagType)}
+			}
+			if err := writeNbtPayload(data, element, depth+1); err != nil {
+				return err
+			}
+		}
+	case NbtCompound:
+		for _, field := range value {
+			tagType, _ := NbtTypeOf(field.Value)
+			data.WriteByte(byte(tagType))
+			if err := writeNbtString(data, field.Name); err != nil {
+				return err
+			}
+			if err := writeNbtPayload(data, field.Value, depth+1); err != nil {
+				return err
+			}
+		}
+		data.WriteByte(byte(NbtTagEnd))
+	case []int32:
+		binary.Write(data, binary.BigEndian, int32(len(value)))
+		binary.Write(data, binary.BigEndian, value)
+	case []int64:
+		binary.Write(data, binary.BigEndian, int32(len(value)))
+		binary.Write(data, binary.BigEndian, value)
+	default:
+		return ErrInvalidNbt{fmt.Sprintf("the type %T is not a tag value", value)}
+	}
+	return nil
+}
+
+// NBT strings are prefixed with their length as unsigned short and encoded in Java`s modified UTF-8
+func writeNbtString(data *bytes.Buffer, value string) error {
+	encoded := make([]byte, 0, len(value))
+	for _, character := range value {
+		switch {
+		case character == 0:
+			encoded = append(encoded, 0xC0, 0x80)
+		case character >= 0x10000:
+			// characters outside of the basic multilingual plane are written as two encoded surrogates
+			high, low := utf16.EncodeRune(character)
+			encoded = appendModifiedUtf8(encoded, high)
+			encoded = appendModifiedUtf8(encoded, low)
+		default:
+			encoded = appendModifiedUtf8(encoded, character)
+		}
+	}
+	if len(encoded) > math.MaxUint16 {
+		return ErrInvalidNbt{fmt.Sprintf("the string with %v encoded bytes is too long", len(encoded))}
+	}
+	binary.Write(data, binary.BigEndian, uint16(len(encoded)))
+	data.Write(encoded)
+	return nil
+}
+
+func appendModifiedUtf8(encoded []byte, character rune) []byte {
+	switch {
+	case character < 0x80:
+		return append(encoded, byte(character))
+	case character < 0x800:
+		return append(encoded, byte(0xC0|character>>6), byte(0x80|character&0x3F))
+	default:
+		return append(encoded, byte(0xE0|character>>12), byte(0x80|character>>6&0x3F), byte(0x80|character&0x3F))
+	}
+}
+
+// this method reads a root tag with its name (the layout of files and of the network before 1.20.2)
+// returns the name and the value of the root tag or an error if something went wrong
+func ReadNbt(reader io.Reader) (name string, value interface{}, err error) {
+	decoder := &nbtDecoder{reader: reader, remaining: MaximumNbtSize}
+	tagType, err := decoder.readTagType()
+	if err != nil {
+		return "", nil, err
+	} else if tagType == NbtTagEnd {
+		return "", nil, ErrInvalidNbt{"the root tag is TAG_End"}
+	}
+	if name, err = decoder.readString(); err != nil {
+		return "", nil, err
+	}
+	value, err = decoder.readPayload(tagType, 0)
+	return name, value, err
+}
+
+// this method reads a nameless root tag (the layout of the network since 1.20.2)
+// returns the value of the root tag (nil for TAG_End) or an error if something went wrong
+func ReadNetworkNbt(reader io.Reader) (value interface{}, err error) {
+	decoder := &nbtDecoder{reader: reader, remaining: MaximumNbtSize}
+	tagType, err := decoder.readTagType()
+	if err != nil || tagType == NbtTagEnd {
+		return nil, err
+	}
+	return decoder.readPayload(tagType, 0)
+}
+
+// this method reads a root tag in the layout of the given protocol version (the name of a named root tag is dropped)
+func ReadProtocolNbt(reader io.Reader, protocolVersion int) (value interface{}, err error) {
+	if protocolVersion >= NetworkNbtVersion {
+		return ReadNetworkNbt(reader)
+	}
+	_, value, err = ReadNbt(reader)
+	return value, err
+}
+
+// reads the tags and accounts their size so that a small input can not allocate large arrays
+type nbtDecoder struct {
+	reader    io.Reader
+	remaining int
+	buffer    [8]byte
+}
+
+func (decoder *nbtDecoder) account(size int64) error {
+	if size < 0 || size > int64(decoder.remaining) {
+		return ErrInvalidNbt{"the tags exceed the maximum size"}
+	}
+	decoder.remaining -= int(size)
+	return nil
+}
+
+// reads a value with up to 8 bytes into the buffer of the decoder
+func (decoder *nbtDecoder) read(size int) ([]byte, error) {
+	data := decoder.buffer[:size]
+	return data, decoder.readFull(data)
+}
+
+func (decoder *nbtDecoder) readFull(data []byte) error {
+	if err := decoder.account(int64(len(data))); err != nil {
+		return err
+	}
+	if _, err := io.ReadFull(decoder.reader, data); err != nil {
+		if err == io.EOF {
+			err = io.ErrUnexpectedEOF
+		}
+		return err
+	}
+	return nil
+}
+
+func (decoder *nbtDecoder) readTagType() (NbtTagType, error) {
+	data, err := decoder.read(1)
+	if err != nil {
+		return NbtTagEnd, err
+	} else if NbtTagType(data[0]) > NbtTagLongArray {
+		return NbtTagEnd, ErrInvalidNbt{fmt.Sprintf("unknown tag type %v", data[0])}
+	}
+	return NbtTagType(data[0]), nil
+}
+
+func (decoder *nbtDecoder) readLength(elementSize int) (int, error) {
+	data, err := decoder.read(4)
+	if err != nil {
+		return 0, err
+	}
+	length := int32(binary.BigEndian.Uint32(data))
+	if length < 0 {
+		return 0, ErrInvalidNbt{fmt.Sprintf("negative length %v", length)}
+	}
+	// the elements are checked against the remaining size before they are allocated
+	if int64(length)*int64(elementSize) > int64(decoder.remaining) {
+		return 0, ErrInvalidNbt{"the tags exceed the maximum size"}
+	}
+	return int(length), nil
+}
+
+func (decoder *nbtDecoder) readString() (string, error) {
+	data, err := decoder.read(2)
+	if err != nil {
+		return "", err
+	}
+	encoded := make([]byte, binary.BigEndian.Uint16(data))
+	if err = decoder.readFull(encoded); err != nil {
+		return "", err
+	}
+	return decodeModifiedUtf8(encoded)
+}
+
+func (decoder *nbtDecoder) readPayload(tagType NbtTagType, depth int) (interface{}, error) {
+	if depth > MaximumNbtDepth {
+		return nil, ErrInvalidNbt{"the tags are nested deeper than allowed"}
+	}
+	switch tagType {
+	case NbtTagByte:
+		data, err := decoder.read(1)
+		if err != nil {
+			return nil, err
+		}
+		return int8(data[0]), nil
+	case NbtTagShort:
+		data, err := decoder.read(2)
+		if err != nil {
+			return nil, err
+		}
+		return int16(binary.BigEndian.Uint16(data)), nil
+	case NbtTagInt:
+		data, err := decoder.read(4)
+		if err != nil {
+			return nil, err
+		}
+		return int32(binary.BigEndian.Uint32(data)), nil
+	case NbtTagLong:
+		data, err := decoder.read(8)
+		if err != nil {
+			return nil, err
+		}
+		return int64(binary.BigEndian.Uint64(data)), nil
+	case NbtTagFloat:
+		data, err := decoder.read(4)
+		if err != nil {
+			return nil, err
+		}
+		return math.Float32frombits(binary.BigEndian.Uint32(data)), nil
+	case NbtTagDouble:
+		data, err := decoder.read(8)
+		if err != nil {
+			return nil, err
+		}
+		return math.Float64frombits(binary.BigEndian.Uint64(data)), nil
+	case NbtTagByteArray:
+		length, err := decoder.readLength(1)
+		if err != nil {
+			return nil, err
+		}
+		values := make([]byte, length)
+		if err = decoder.readFull(values); err != nil {
+			return nil, err
+		}
+		return values, nil
+	case NbtTagString:
+		return decoder.readString()
+	case NbtTagList:
+		elementType, err := decoder.readTagType()
+		if err != nil {
+			return nil, err
+		}
+		// every element is accounted with at least one byte (an element of an empty compound)
+		length, err := decoder.readLength(1)
+		if err != nil {
+			return nil, err
+		}
+		if elementType == NbtTagEnd && length > 0 {
+			return nil, ErrInvalidNbt{"a list of TAG_End contains elements"}
+		}
+		// the capacity is limited because nested lists could reserve a lot of memory without sending their elements
+		capacity := length
+		if capacity > maximumNbtListCapacity {
+			capacity = maximumNbtListCapacity
+		}
+		list := NbtList{ElementType: elementType, Elements: make([]interface{}, 0, capacity)}
+		for index := 0; index < length; index++ {
+			element, err := decoder.readPayload(elementType, depth+1)
+			if err != nil {
+				return nil, err
+			}
+			list.Elements = append(list.Elements, element)
+		}
+		return list, nil
+	case NbtTagCompound:
+		compound := newNbtCompoundBuilder()
+		for {
+			fieldType, err := decoder.readTagType()
+			if err != nil {
+				return nil, err
+			} else if fieldType == NbtTagEnd {
+				return compound.compound, nil
+			}
+			name, err := decoder.readString()
+			if err != nil {
+				return nil, err
+			}
+			value, err := decoder.readPayload(fieldType, depth+1)
+			if err != nil {
+				return nil, err
+			}
+			compound.set(name, value)
+		}
+	case NbtTagIntArray:
+		length, err := decoder.readLength(4)
+		if err != nil {
+			return nil, err
+		}
+		data := make([]byte, length*4)
+		if err = decoder.readFull(data); err != nil {
+			return nil, err
+		}
+		values := make([]int32, length)
+		for index := range values {
+			values[index] = int32(binary.BigEndian.Uint32(data[index*4:]))
+		}
+		return values, nil
+	case NbtTagLongArray:
+		length, err := decoder.readLength(8)
+		if err != nil {
+			return nil, err
+		}
+		data := make([]byte, length*8)
+		if err = decoder.readFull(data); err != nil {
+			return nil, err
+		}
+		values := make([]int64, length)
+		for index := range values {
+			values[index] = int64(binary.BigEndian.Uint64(data[index*8:]))
+		}
+		return values, nil
+	}
+	return nil, ErrInvalidNbt{fmt.Sprintf("unexpected %v", tagType)}
+}
+
+// decodes Java`s modified UTF-8 (the null character has two bytes and other characters are encoded as UTF-16 surrogates)
+func decodeModifiedUtf8(data []byte) (string, error) {
+	ascii := true
+	for _, character := range data {
+		if character == 0 || character >= 0x80 {
+			ascii = false
+			break
+		}
+	}
+	if ascii {
+		return string(data), nil
+	}
+	units := make([]uint16, 0, len(data))
+	for index := 0; index < len(data); {
+		first := data[index]
+		switch {
+		case first != 0 && first < 0x80:
+			units = append(units, uint16(first))
+			index++
+		case first&0xE0 == 0xC0 && index+1 < len(data) && data[index+1]&0xC0 == 0x80:
+			units = append(units, uint16(first&0x1F)<<6|uint16(data[index+1]&0x3F))
+			index += 2
+		case first&0xF0 == 0xE0 && index+2 < len(data) && data[index+1]&0xC0 == 0x80 && data[index+2]&0xC0 == 0x80:
+			units = append(units, uint16(first&0x0F)<<12|uint16(data[index+1]&0x3F)<<6|uint16(data[index+2]&0x3F))
+			index += 3
+		default:
+			return "", ErrInvalidNbt{"the string is not valid modified UTF-8"}
+		}
+	}
+	return string(utf16.Decode(units)), nil
+}
+
+// the compression of an NBT file
+type NbtCompression uint8
+
+const (
+	NbtUncompressed NbtCompression = iota
+	NbtGzip
+	NbtZlib
+)
+
+// this method reads the root tag of an NBT file which is compressed with gzip or zlib or not compressed at all
+// returns the name and the value of the root tag or an error if something went wrong
+func ReadNbtFile(reader io.Reader) (name string, value interface{}, err error) {
+	buffered := bufio.NewReader(reader)
+	header, err := buffered.Peek(2)
+	if err != nil {
+		return "", nil, err
+	}
+	var decompressed io.Reader = buffered
+	if header[0] == 0x1F && header[1] == 0x8B {
+		gzipReader, err := gzip.NewReader(buffered)
+		if err != nil {
+			return "", nil, err
+		}
+		defer gzipReader.Close()
+		decompressed = gzipReader
+	} else if header[0] == 0x78 && (uint16(header[0])<<8|uint16(header[1]))%31 == 0 {
+		zlibReader, err := zlib.NewReader(buffered)
+		if err != nil {
+			return "", nil, err
+		}
+		defer zlibReader.Close()
+		decompressed = zlibReader
+	}
+	decoder := &nbtDecoder{reader: decompressed, remaining: math.MaxInt32}
+	tagType, err := decoder.readTagType()
+	if err != nil {
+		return "", nil, err
+	} else if tagType == NbtTagEnd {
+		return "", nil, ErrInvalidNbt{"the root tag is TAG_End"}
+	}
+	if name, err = decoder.readString(); err != nil {
+		return "", nil, err
+	}
+	value, err = decoder.readPayload(tagType, 0)
+	return name, value, err
+}
+
+// this method writes the given value as root tag of an NBT file with the given compression
+// returns an error if something went wrong
+func WriteNbtFile(writer io.Writer, name string, value interface{}, compression NbtCompression) error {
+	switch compression {
+	case NbtGzip:
+		gzipWriter := gzip.NewWriter(writer)
+		if err := WriteNbt(gzipWriter, name, value); err != nil {
+			return err
+		}
+		return gzipWriter.Close()
+	case NbtZlib:
+		zlibWriter := zlib.NewWriter(writer)
+		if err := WriteNbt(zlibWriter, name, value); err != nil {
+			return err
+		}
+		return zlibWriter.Close()
+	default:
+		return WriteNbt(writer, name, value)
+	}
+}
@@ -0,0 +1,260 @@
+package datatypes
+
+import (
+	"bytes"
+	"encoding/hex"
+	"errors"
+	"reflect"
+	"testing"
+)
+
+// the hello_world.nbt example of the NBT specification
+const helloWorldNbt = "0a000b68656c6c6f20776f726c640800046e616d65000942616e616e72616d6100"
+
+func TestNbtGolden(t *testing.T) {
+	buffer := bytes.NewBuffer([]byte{})
+	if err := WriteNbt(buffer, "hello world", NbtCompound{{"name", "Bananrama"}}); err != nil {
+		t.Fatalf("could not write the compound: %v", err)
+	}
+	if encoded := hex.EncodeToString(buffer.Bytes()); encoded != helloWorldNbt {
+		t.Fatalf("the compound was written as %v instead of %v", encoded, helloWorldNbt)
+	}
+	name, value, err := ReadNbt(buffer)
+	if err != nil {
+		t.Fatalf("could not read the compound: %v", err)
+	}
+	if name != "hello world" || !reflect.DeepEqual(value, NbtCompound{{"name", "Bananrama"}}) {
+		t.Errorf("read the tag %q: %#v", name, value)
+	}
+}
+
+func TestNetworkNbtGolden(t *testing.T) {
+	for _, test := range []struct {
+		value           interface{}
+		protocolVersion int
+		golden          string
+	}{
+		{NbtCompound{{"text", "hi"}}, NetworkNbtVersion, "0a080004746578740002686900"},
+		{NbtCompound{{"text", "hi"}}, NetworkNbtVersion - 1, "0a0000080004746578740002686900"},
+		{"hi", NetworkNbtVersion, "0800026869"},
+		// the null character and characters outside of the basic multilingual plane use the modified UTF-8
+		{"\x00\U0001F600", NetworkNbtVersion, "080008c080eda0bdedb880"},
+	} {
+		buffer := bytes.NewBuffer([]byte{})
+		if err := WriteProtocolNbt(buffer, test.value, test.protocolVersion); err != nil {
+			t.Fatalf("could not write %#v: %v", test.value, err)
+		}
+		if encoded := hex.EncodeToString(buffer.Bytes()); encoded != test.golden {
+			t.Errorf("%#v was written as %v instead of %v", test.value, encoded, test.golden)
+		}
+		value, err := ReadProtocolNbt(buffer, test.protocolVersion)
+		if err != nil || !reflect.DeepEqual(value, test.value) {
+			t.Errorf("read %#v instead of %#v (error: %v)", value, test.value, err)
+		}
+	}
+	buffer := bytes.NewBuffer([]byte{})
+	if err := WriteNetworkNbt(buffer, nil); err != nil || !bytes.Equal(buffer.Bytes(), []byte{0}) {
+		t.Errorf("an absent value was written as %x (error: %v)", buffer.Bytes(), err)
+	}
+	if value, err := ReadNetworkNbt(buffer); err != nil || value != nil {
+		t.Errorf("read the absent value %#v (error: %v)", value, err)
+	}
+}
+
+// a compound which contains every tag type
+func allNbtTags() NbtCompound {
+	return NbtCompound{
+		{"byte", int8(-1)},
+		{"short", int16(-300)},
+		{"int", int32(70000)},
+		{"long", int64(-1) << 40},
+		{"float", float32(0.5)},
+		{"double", -2.25},
+		{"bytes", []byte{0, 1, 0xFF}},
+		{"string", "Bananrama"},
+		{"list", NbtList{NbtTagShort, []interface{}{int16(1), int16(2)}}},
+		{"empty list", NbtList{NbtTagEnd, []interface{}{}}},
+		{"compound", NbtCompound{{"nested", NbtCompound{}}}},
+		{"ints", []int32{1, -1}},
+		{"longs", []int64{1 << 60}},
+	}
+}
+
+func TestNbtRoundTrip(t *testing.T) {
+	for _, compression := range []NbtCompression{NbtUncompressed, NbtGzip, NbtZlib} {
+		buffer := bytes.NewBuffer([]byte{})
+		if err := WriteNbtFile(buffer, "root", allNbtTags(), compression); err != nil {
+			t.Fatalf("could not write the file with the compression %v: %v", compression, err)
+		}
+		name, value, err := ReadNbtFile(buffer)
+		if err != nil {
+			t.Fatalf("could not read the file with the compression %v: %v", compression, err)
+		}
+		if name != "root" || !reflect.DeepEqual(value, allNbtTags()) {
+			t.Errorf("read the tag %q with the compression %v: %#v", name, compression, value)
+		}
+	}
+}
+
+func TestNbtInvalid(t *testing.T) {
+	for _, test := range []struct {
+		name    string
+		encoded string
+	}{
+		{"truncated", helloWorldNbt[:len(helloWorldNbt)-4]},
+		{"unknown tag", "0d0000"},
+		{"negative length", "070000ffffffff"},
+		{"length beyond the limit", "0b00007fffffff"},
+		{"list of end tags", "09000000000001"},
+		{"invalid modified UTF-8", "08000001ff"},
+	} {
+		data, _ := hex.DecodeString(test.encoded)
+		if _, _, err := ReadNbt(bytes.NewReader(data)); err == nil {
+			t.Errorf("the %v tag was read without error", test.name)
+		}
+	}
+	// the nesting depth is limited
+	data := bytes.Repeat([]byte{byte(NbtTagList), 0, 0, byte(NbtTagList), 0, 0, 0, 1}, MaximumNbtDepth+1)
+	if _, _, err := ReadNbt(bytes.NewReader(data)); err == nil {
+		t.Error("the nested lists were read without error")
+	}
+	if err := WriteNbt(bytes.NewBuffer([]byte{}), "", NbtList{NbtTagInt, []interface{}{int8(1)}}); err == nil {
+		t.Error("a list with a wrong element was written without error")
+	}
+}
+
+type nbtTestItem struct {
+	Id      string `nbt:"id"`
+	Count   int8   `nbt:"count"`
+	Damaged bool   `nbt:"damaged,omitempty"`
+	Ignored string `nbt:"-"`
+}
+
+type nbtTestInventory struct {
+	Owner    string
+	Items    []nbtTestItem      `nbt:"items"`
+	Position []float64          `nbt:"position"`
+	Seeds    []int64            `nbt:"seeds"`
+	Scores   map[string]int32   `nbt:"scores"`
+	Extra    map[string]float32 `nbt:"extra,omitempty"`
+}
+
+func TestMarshalNbt(t *testing.T) {
+	inventory := nbtTestInventory{
+		Owner:    "Dinnerbone",
+		Items:    []nbtTestItem{{"minecraft:stone", 64, false, "not written"}, {"minecraft:bow", 1, true, ""}},
+		Position: []float64{1.5, 64, -2.25},
+		Seeds:    []int64{42},
+		Scores:   map[string]int32{"b": 2, "a": 1},
+	}
+	value, err := MarshalNbt(inventory)
+	if err != nil {
+		t.Fatalf("could not marshal the inventory: %v", err)
+	}
+	expected := NbtCompound{
+		{"Owner", "Dinnerbone"},
+		{"items", NbtList{NbtTagCompound, []interface{}{
+			NbtCompound{{"id", "minecraft:stone"}, {"count", int8(64)}},
+			NbtCompound{{"id", "minecraft:bow"}, {"count", int8(1)}, {"damaged", int8(1)}},
+		}}},
+		{"position", NbtList{NbtTagDouble, []interface{}{1.5, 64.0, -2.25}}},
+		{"seeds", []int64{42}},
+		{"scores", NbtCompound{{"a", int32(1)}, {"b", int32(2)}}},
+	}
+	if !reflect.DeepEqual(value, expected) {
+		t.Fatalf("the inventory was marshalled to %#v", value)
+	}
+	var unmarshalled nbtTestInventory
+	if err = UnmarshalNbt(value, &unmarshalled); err != nil {
+		t.Fatalf("could not unmarshal the inventory: %v", err)
+	}
+	inventory.Items[0].Ignored = ""
+	if !reflect.DeepEqual(unmarshalled, inventory) {
+		t.Errorf("the inventory was unmarshalled to %#v", unmarshalled)
+	}
+	var count int8
+	if err = UnmarshalNbt(int32(300), &count); err == nil {
+		t.Errorf("an int which exceeds a byte was unmarshalled to %v", count)
+	}
+	if _, err = MarshalNbt([]interface{}{int8(1), "mixed"}); err == nil {
+		t.Error("a list with mixed types was marshalled without error")
+	}
+	var invalidNbt ErrInvalidNbt
+	if _, err = MarshalNbt(map[int]string{}); !errors.As(err, &invalidNbt) {
+		t.Errorf("a map without string keys returned %v", err)
+	}
+}
+
+func TestSnbt(t *testing.T) {
+	formatted, err := FormatSnbt(allNbtTags())
+	if err != nil {
+		t.Fatalf("could not format the tags: %v", err)
+	}
+	const golden = `{byte:-1b,short:-300s,int:70000,long:-1099511627776L,float:0.5f,double:-2.25d,bytes:[B;0B,1B,-1B],` +
+		`string:"Bananrama",list:[1s,2s],"empty list":[],compound:{nested:{}},ints:[I;1,-1],longs:[L;1152921504606846976L]}`
+	if formatted != golden {
+		t.Fatalf("the tags were formatted as %v instead of %v", formatted, golden)
+	}
+	value, err := ParseSnbt(formatted)
+	if err != nil || !reflect.DeepEqual(value, allNbtTags()) {
+		t.Errorf("parsed %#v (error: %v)", value, err)
+	}
+	for text, expected := range map[string]interface{}{
+		` { 'quoted key' : "it's \"quoted\"" , plain: stone }`: NbtCompound{{"quoted key", `it's "quoted"`}, {"plain", "stone"}},
+		`true`:          int8(1),
+		`3`:             int32(3),
+		`3.`:            3.0,
+		`1e3f`:          float32(1000),
+		`3000000000`:    "3000000000",
+		`128b`:          "128b",
+		`Bananrama`:     "Bananrama",
+		`"\\"`:          `\`,
+		`[I;]`:          []int32{},
+		`[{}, {a: 1b}]`: NbtList{NbtTagCompound, []interface{}{NbtCompound{}, NbtCompound{{"a", int8(1)}}}},
+	} {
+		if value, err := ParseSnbt(text); err != nil || !reflect.DeepEqual(value, expected) {
+			t.Errorf("%v was parsed to %#v (error: %v)", text, value, err)
+		}
+	}
+	for _, text := range []string{``, `{`, `{a:1,}`, `[1, 2b]`, `[B;1]`, `"unterminated`, `1 2`, `minecraft:stone`} {
+		if value, err := ParseSnbt(text); err == nil {
+			t.Errorf("%q was parsed without error: %#v", text, value)
+		}
+	}
+}
+
+func FuzzReadNbt(f *testing.F) {
+	golden, _ := hex.DecodeString(helloWorldNbt)
+	f.Add(golden)
+	buffer := bytes.NewBuffer([]byte{})
+	WriteNbt(buffer, "", allNbtTags())
+	f.Add(buffer.Bytes())
+	f.Fuzz(func(t *testing.T, data []byte) {
+		name, value, err := ReadNbt(bytes.NewReader(data))
+		if err != nil {
+			return
+		}
+		// every read tag is written and read again without changes (the encodings are compared because of NaN)
+		buffer := bytes.NewBuffer([]byte{})
+		if err = WriteNbt(buffer, name, value); err != nil {
+			t.Fatalf("could not write the read tag %#v: %v", value, err)
+		}
+		encoded := append([]byte{}, buffer.Bytes()...)
+		readName, readValue, err := ReadNbt(buffer)
+		if err != nil {
+			t.Fatalf("could not read the written tag %x: %v", encoded, err)
+		}
+		buffer.Reset()
+		if err = WriteNbt(buffer, readName, readValue); err != nil || !bytes.Equal(buffer.Bytes(), encoded) {
+			t.Fatalf("the tag %x was written again as %x (error: %v)", encoded, buffer.Bytes(), err)
+		}
+		// the same applies to the SNBT form of numbers which are not NaN
+		if formatted, err := FormatSnbt(value); err == nil {
+			if parsed, err := ParseSnbt(formatted); err != nil {
+				t.Fatalf("could not parse the formatted tag %v: %v", formatted, err)
+			} else if formattedAgain, _ := FormatSnbt(parsed); formattedAgain != formatted {
+				t.Fatalf("the tag %v was formatted again as %v", formatted, formattedAgain)
+			}
+		}
+	})
+}
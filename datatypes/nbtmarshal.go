@@ -0,0 +1,380 @@
+package datatypes
+
+import (
+	"fmt"
+	"math"
+	"reflect"
+	"sort"
+	"strings"
+)
+
+// this file contains the conversion between Go values and tag values
+// struct fields are converted to the fields of a compound, their names are set by the struct tag `nbt:"name,omitempty"`
+// (a field without tag keeps its name, "-" skips the field and omitempty skips zero values)
+
+// this method converts the given value into a tag value
+// booleans become bytes, structs and maps with string keys become compounds and slices become lists or arrays
+// returns the tag value or an error if the value can not be represented as tag
+func MarshalNbt(value interface{}) (interface{}, error) {
+	return marshalNbtValue(reflect.ValueOf(value), 0)
+}
+
+var (
+	nbtCompoundType = reflect.TypeOf(NbtCompound{})
+	nbtListType     = reflect.TypeOf(NbtList{})
+)
+
+func marshalNbtValue(value reflect.Value, depth int) (interface{}, error) {
+	if depth > MaximumNbtDepth {
+		return nil, ErrInvalidNbt{"the value is nested deeper than allowed"}
+	}
+	if !value.IsValid() {
+		return nil, ErrInvalidNbt{"nil can not be converted to a tag"}
+	}
+	switch value.Type() {
+	case nbtCompoundType:
+		compound := make(NbtCompound, 0, value.Len())
+		for _, field := range value.Interface().(NbtCompound) {
+			converted, err := marshalNbtValue(reflect.ValueOf(field.Value), depth+1)
+			if err != nil {
+				return nil, err
+			}
+			compound = append(compound, NbtField{field.Name, converted})
+		}
+		return compound, nil
+	case nbtListType:
+		list := value.Interface().(NbtList)
+		converted := NbtList{ElementType: list.ElementType, Elements: make([]interface{}, 0, len(list.Elements))}
+		for _, element := range list.Elements {
+			convertedElement, err := marshalNbtValue(reflect.ValueOf(element), depth+1)
+			if err != nil {
+				return nil, err
+			}
+			converted.Elements = append(converted.Elements, convertedElement)
+		}
+		return converted, nil
+	}
+	switch value.Kind() {
+	case reflect.Ptr, reflect.Interface:
+		if value.IsNil() {
+			return nil, ErrInvalidNbt{"nil can not be converted to a tag"}
+		}
+		return marshalNbtValue(value.Elem(), depth)
+	case reflect.Bool:
+		if value.Bool() {
+			return int8(1), nil
+		}
+		return int8(0), nil
+	case reflect.Int8:
+		return int8(value.Int()), nil
+	case reflect.Uint8:
+		return int8(value.Uint()), nil
+	case reflect.Int16:
+		return int16(value.Int()), nil
+	case reflect.Int32, reflect.Int, reflect.Uint16:
+		if value.Kind() == reflect.Uint16 {
+			return int32(value.Uint()), nil
+		} else if value.Int() < math.MinInt32 || value.Int() > math.MaxInt32 {
+			return nil, ErrInvalidNbt{fmt.Sprintf("the int %v exceeds 32 bits", value.Int())}
+		}
+		return int32(value.Int()), nil
+	case reflect.Int64:
+		return value.Int(), nil
+	case reflect.Uint32:
+		return int64(value.Uint()), nil
+	case reflect.Float32:
+		return float32(value.Float()), nil
+	case reflect.Float64:
+		return value.Float(), nil
+	case reflect.String:
+		return value.String(), nil
+	case reflect.Slice, reflect.Array:
+		switch value.Type().Elem().Kind() {
+		case reflect.Uint8, reflect.Int8:
+			values := make([]byte, value.Len())
+			for index := range values {
+				if value.Index(index).Kind() == reflect.Int8 {
+					values[index] = byte(value.Index(index).Int())
+				} else {
+					values[index] = byte(value.Index(index).Uint())
+				}
+			}
+			return values, nil
+		case reflect.Int32:
+			values := make([]int32, value.Len())
+			for index := range values {
+				values[index] = int32(value.Index(index).Int())
+			}
+			return values, nil
+		case reflect.Int64:
+			values := make([]int64, value.Len())
+			for index := range values {
+				values[index] = value.Index(index).Int()
+			}
+			return values, nil
+		}
+		list := NbtList{Elements: make([]interface{}, 0, value.Len())}
+		for index := 0; index < value.Len(); index++ {
+			element, err := marshalNbtValue(value.Index(index), depth+1)
+			if err != nil {
+				return nil, err
+			}
+			if index == 0 {
+				list.ElementType, _ = NbtTypeOf(element)
+			} else if tagType, _ := NbtTypeOf(element); tagType != list.ElementType {
+				return nil, ErrInvalidNbt{fmt.Sprintf("the list of %v contains a %v", list.ElementType, tagType)}
+			}
+			list.Elements = append(list.Elements, element)
+		}
+		return list, nil
+	case reflect.Map:
+		if value.Type().Key().Kind() != reflect.String {
+			return nil, ErrInvalidNbt{fmt.Sprintf("the map %v has no string keys", value.Type())}
+		}
+		// the keys are sorted so the encoding is deterministic
+		keys := make([]string, 0, value.Len())
+		for _, key := range value.MapKeys() {
+			keys = append(keys, key.String())
+		}
+		sort.Strings(keys)
+		compound := make(NbtCompound, 0, len(keys))
+		for _, key := range keys {
+			field := value.MapIndex(reflect.ValueOf(key).Convert(value.Type().Key()))
+			if (field.Kind() == reflect.Ptr || field.Kind() == reflect.Interface) && field.IsNil() {
+				continue
+			}
+			converted, err := marshalNbtValue(field, depth+1)
+			if err != nil {
+				return nil, err
+			}
+			compound = append(compound, NbtField{key, converted})
+		}
+		return compound, nil
+	case reflect.Struct:
+		compound := NbtCompound{}
+		for _, field := range nbtStructFields(value.Type()) {
+			fieldValue := value.Field(field.index)
+			if field.omitEmpty && isEmptyNbtValue(fieldValue) {
+				continue
+			}
+			if (fieldValue.Kind() == reflect.Ptr || fieldValue.Kind() == reflect.Interface) && fieldValue.IsNil() {
+				// an absent value can not be written, a compound leaves out the field
+				continue
+			}
+			converted, err := marshalNbtValue(fieldValue, depth+1)
+			if err != nil {
+				return nil, err
+			}
+			compound = append(compound, NbtField{field.name, converted})
+		}
+		return compound, nil
+	}
+	return nil, ErrInvalidNbt{fmt.Sprintf("the type %v can not be converted to a tag", value.Type())}
+}
+
+// a struct field which is converted to a compound field
+type nbtStructField struct {
+	index     int
+	name      string
+	omitEmpty bool
+}
+
+func nbtStructFields(structType reflect.Type) []nbtStructField {
+	fields := make([]nbtStructField, 0, structType.NumField())
+	for index := 0; index < structType.NumField(); index++ {
+		field := structType.Field(index)
+		if field.PkgPath != "" {
+			// the field is not exported
+			continue
+		}
+		tag := field.Tag.Get("nbt")
+		if tag == "-" {
+			continue
+		}
+		options := strings.Split(tag, ",")
+		name := strings.TrimSpace(options[0])
+		if name == "" {
+			name = field.Name
+		}
+		omitEmpty := false
+		for _, option := range options[1:] {
+			omitEmpty = omitEmpty || strings.TrimSpace(option) == "omitempty"
+		}
+		fields = append(fields, nbtStructField{index, name, omitEmpty})
+	}
+	return fields
+}
+
+func isEmptyNbtValue(value reflect.Value) bool {
+	switch value.Kind() {
+	case reflect.Slice, reflect.Map, reflect.String, reflect.Array:
+		return value.Len() == 0
+	case reflect.Ptr, reflect.Interface:
+		return value.IsNil()
+	case reflect.Bool:
+		return !value.Bool()
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		return value.Int() == 0
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		return value.Uint() == 0
+	case reflect.Float32, reflect.Float64:
+		return value.Float() == 0
+	}
+	return false
+}
+
+// this method stores the given tag value in the value the target points to
+// numbers are converted into every numeric type they fit in, bytes into booleans, compounds into structs and maps
+// and lists or arrays into slices, fields of a struct which are missing in the compound are left unchanged
+// returns an error if the tag value does not fit the target
+func UnmarshalNbt(tag interface{}, target interface{}) error {
+	value := reflect.ValueOf(target)
+	if value.Kind() != reflect.Ptr || value.IsNil() {
+		return ErrInvalidNbt{fmt.Sprintf("the target %T is not a pointer", target)}
+	}
+	return unmarshalNbtValue(tag, value.Elem())
+}
+
+func unmarshalNbtValue(tag interface{}, target reflect.Value) error {
+	if target.Kind() == reflect.Interface && target.NumMethod() == 0 {
+		target.Set(reflect.ValueOf(tag))
+		return nil
+	}
+	switch target.Type() {
+	case nbtCompoundType, nbtListType:
+		if reflect.TypeOf(tag) != target.Type() {
+			return errNbtMismatch(tag, target)
+		}
+		target.Set(reflect.ValueOf(tag))
+		return nil
+	}
+	switch target.Kind() {
+	case reflect.Ptr:
+		if target.IsNil() {
+			target.Set(reflect.New(target.Type().Elem()))
+		}
+		return unmarshalNbtValue(tag, target.Elem())
+	case reflect.Bool:
+		if number, isByte := tag.(int8); isByte {
+			target.SetBool(number != 0)
+			return nil
+		}
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		if number, isInteger := nbtInteger(tag); isInteger && !target.OverflowInt(number) {
+			target.SetInt(number)
+			return nil
+		}
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		if number, isInteger := nbtInteger(tag); isInteger && number >= 0 && !target.OverflowUint(uint64(number)) {
+			target.SetUint(uint64(number))
+			return nil
+		}
+	case reflect.Float32, reflect.Float64:
+		switch number := tag.(type) {
+		case float32:
+			target.SetFloat(float64(number))
+			return nil
+		case float64:
+			target.SetFloat(number)
+			return nil
+		}
+		if number, isInteger := nbtInteger(tag); isInteger {
+			target.SetFloat(float64(number))
+			return nil
+		}
+	case reflect.String:
+		if text, isString := tag.(string); isString {
+			target.SetString(text)
+			return nil
+		}
+	case reflect.Slice:
+		elements, isSequence := nbtElements(tag)
+		if !isSequence {
+			break
+		}
+		slice := reflect.MakeSlice(target.Type(), len(elements), len(elements))
+		for index, element := range elements {
+			if err := unmarshalNbtValue(element, slice.Index(index)); err != nil {
+				return err
+			}
+		}
+		target.Set(slice)
+		return nil
+	case reflect.Map:
+		compound, isCompound := tag.(NbtCompound)
+		if !isCompound || target.Type().Key().Kind() != reflect.String {
+			break
+		}
+		if target.IsNil() {
+			target.Set(reflect.MakeMap(target.Type()))
+		}
+		for _, field := range compound {
+			element := reflect.New(target.Type().Elem()).Elem()
+			if err := unmarshalNbtValue(field.Value, element); err != nil {
+				return err
+			}
+			target.SetMapIndex(reflect.ValueOf(field.Name).Convert(target.Type().Key()), element)
+		}
+		return nil
+	case reflect.Struct:
+		compound, isCompound := tag.(NbtCompound)
+		if !isCompound {
+			break
+		}
+		for _, field := range nbtStructFields(target.Type()) {
+			if fieldTag, found := compound.Get(field.name); found {
+				if err := unmarshalNbtValue(fieldTag, target.Field(field.index)); err != nil {
+					return err
+				}
+			}
+		}
+		return nil
+	}
+	return errNbtMismatch(tag, target)
+}
+
+func errNbtMismatch(tag interface{}, target reflect.Value) error {
+	tagType, _ := NbtTypeOf(tag)
+	return ErrInvalidNbt{fmt.Sprintf("a %v can not be stored in %v", tagType, target.Type())}
+}
+
+func nbtInteger(tag interface{}) (int64, bool) {
+	switch number := tag.(type) {
+	case int8:
+		return int64(number), true
+	case int16:
+		return int64(number), true
+	case int32:
+		return int64(number), true
+	case int64:
+		return number, true
+	}
+	return 0, false
+}
+
+// returns the elements of a list or an array
+func nbtElements(tag interface{}) ([]interface{}, bool) {
+	switch values := tag.(type) {
+	case NbtList:
+		return values.Elements, true
+	case []byte:
+		elements := make([]interface{}, len(values))
+		for index, value := range values {
+			elements[index] = int8(value)
+		}
+		return elements, true
+	case []int32:
+		elements := make([]interface{}, len(values))
+		for index, value := range values {
+			elements[index] = value
+		}
+		return elements, true
+	case []int64:
+		elements := make([]interface{}, len(values))
+		for index, value := range values {
+			elements[index] = value
+		}
+		return elements, true
+	}
+	return nil, false
+}
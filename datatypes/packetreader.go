@@ -0,0 +1,125 @@
+package datatypes
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"sync"
+)
+
+// this file contains the framing reader which reads the packets of a connection without allocating a buffer per packet
+
+// the maximum length of a packet (the length is prepended as VarInt with at most 3 bytes)
+const MaximumPacketLength = 1<<21 - 1
+
+// buffers which are bigger are not put back into the pool (e.g. a single huge plugin message)
+const maximumPooledBufferSize = 64 * 1024
+
+var packetBufferPool = sync.Pool{
+	New: func() interface{} {
+		buffer := make([]byte, 0, 512)
+		return &buffer
+	},
+}
+
+// the error which is thrown if the prepended length of a packet is not valid (lower than 1 or higher than the maximum length)
+type ErrInvalidPacketLength struct {
+	Length        int
+	MaximumLength int
+}
+
+func (errInvalidPacketLength ErrInvalidPacketLength) Error() string {
+	return fmt.Sprintf("the prepended packet length (%v) is not valid (maximum: %v)", errInvalidPacketLength.Length, errInvalidPacketLength.MaximumLength)
+}
+
+// reads packets from a buffered source and reuses a pooled buffer for their content
+// the content of a read packet is only valid until the next packet is read or the reader is released
+type PacketReader struct {
+	// the maximum length of the next packets, it can be changed between two packets (e.g. when the state changes)
+	MaximumLength int
+	buffer        *[]byte
+	content       bytes.Buffer
+	singleByte    [1]byte
+}
+
+func NewPacketReader(maximumLength int) *PacketReader {
+	return &PacketReader{MaximumLength: maximumLength}
+}
+
+// this method reads the next packet from the given io.Reader which should be buffered (e.g. a bufio.Reader)
+// returns the read Packet or an error if something went wrong
+func (packetReader *PacketReader) ReadPacket(reader io.Reader) (packet Packet, err error) {
+	length, err := packetReader.readVarInt(reader)
+	if err != nil {
+		return packet, err
+	}
+	maximumLength := packetReader.MaximumLength
+	if maximumLength <= 0 || maximumLength > MaximumPacketLength {
+		maximumLength = MaximumPacketLength
+	}
+	if length < 1 || length > maximumLength {
+		return packet, ErrInvalidPacketLength{length, maximumLength}
+	}
+	data := packetReader.grow(length)
+	if _, err = io.ReadFull(reader, data); err != nil {
+		if err == io.EOF {
+			// the connection was closed in the middle of the packet
+			err = io.ErrUnexpectedEOF
+		}
+		return packet, err
+	}
+	packetReader.content = *bytes.NewBuffer(data)
+	if packet.Id, err = packetReader.readVarInt(&packetReader.content); err != nil {
+		if err == io.EOF {
+			err = io.ErrUnexpectedEOF
+		}
+		return packet, err
+	}
+	packet.Content = &packetReader.content
+	return packet, nil
+}
+
+// this method returns the buffer of the reader to the pool
+// it must not be called while a packet is read, the next packet gets a new buffer from the pool
+func (packetReader *PacketReader) Release() {
+	if packetReader.buffer != nil {
+		if cap(*packetReader.buffer) <= maximumPooledBufferSize {
+			packetBufferPool.Put(packetReader.buffer)
+		}
+		packetReader.buffer = nil
+	}
+	packetReader.content = bytes.Buffer{}
+}
+
+func (packetReader *PacketReader) grow(length int) []byte {
+	if packetReader.buffer == nil {
+		packetReader.buffer = packetBufferPool.Get().(*[]byte)
+	}
+	if cap(*packetReader.buffer) < length {
+		packetReader.Release()
+		buffer := make([]byte, 0, length)
+		packetReader.buffer = &buffer
+	}
+	return (*packetReader.buffer)[:length]
+}
+
+// the same like ReadVarInt but without allocating the byte which is read
+func (packetReader *PacketReader) readVarInt(reader io.Reader) (value int, err error) {
+	for bytesRead := 0; ; bytesRead++ {
+		if bytesRead == 5 {
+			// the type is bigger than allowed per definition
+			return value, InvalidTypeSize
+		}
+		if _, err = io.ReadFull(reader, packetReader.singleByte[:]); err != nil {
+			if err == io.EOF && bytesRead > 0 {
+				err = io.ErrUnexpectedEOF
+			}
+			return value, err
+		}
+		read := packetReader.singleByte[0]
+		value |= int(int32(read&mask) << uint(7*bytesRead))
+		if read&checkMask == 0 {
+			return int(int32(value)), nil
+		}
+	}
+}
@@ -14,56 +14,58 @@ type Packet struct {
 // this method writes a Packet to the given io.Writer
 // returns an error if something went wrong
 func WritePacket(writer io.Writer, packet Packet) (err error, totalBytesWritten int) {
-	totalBuffer := bytes.NewBuffer([]byte{})
-	dataBuffer := bytes.NewBuffer([]byte{})
-	if err, _ := WriteVarInt(dataBuffer, packet.Id); err != nil {
-		return err, totalBytesWritten
-	}
-	if bytesWritten, err := dataBuffer.Write(packet.Content.Bytes()); err != nil {
+	encoded, err := EncodePacket(packet)
+	if err != nil {
 		return err, totalBytesWritten
-	} else if bytesWritten < packet.Content.Len() {
-		return io.ErrUnexpectedEOF, totalBytesWritten
 	}
-	if err, bytesWritten := WriteVarInt(totalBuffer, dataBuffer.Len()); err != nil {
+	if bytesWritten, err := writer.Write(encoded); err != nil {
 		return err, totalBytesWritten
+	} else if bytesWritten < len(encoded) {
+		return io.ErrUnexpectedEOF, bytesWritten
 	} else {
 		totalBytesWritten += bytesWritten
 	}
-	totalBuffer.Write(dataBuffer.Bytes())
-	if bytesWritten, err := writer.Write(totalBuffer.Bytes()); err != nil {
-		return err, totalBytesWritten
-	} else if int(bytesWritten) < totalBuffer.Len() {
-		return io.ErrUnexpectedEOF, totalBytesWritten
-	} else {
-		totalBytesWritten += int(bytesWritten)
-	}
 	return nil, totalBytesWritten
 }
 
+// this method encodes a Packet with its prepended length and id
+// the returned bytes can be written to multiple connections (e.g. cached packets)
+func EncodePacket(packet Packet) ([]byte, error) {
+	length := VarIntSize(packet.Id) + packet.Content.Len()
+	encoded := bytes.NewBuffer(make([]byte, 0, VarIntSize(length)+length))
+	if err, _ := WriteVarInt(encoded, length); err != nil {
+		return nil, err
+	}
+	if err, _ := WriteVarInt(encoded, packet.Id); err != nil {
+		return nil, err
+	}
+	encoded.Write(packet.Content.Bytes())
+	return encoded.Bytes(), nil
+}
+
 // this method reads a Packet from the given io.Reader
 // returns the read Packet or an error if something went wrong
+// connections should use a PacketReader which reuses its buffer and limits the packet length per state
 func ReadPacket(reader io.Reader) (packet Packet, err error, totalBytesRead int) {
 	length, err, prependedLengthBytesRead := ReadVarInt(reader)
 	if err != nil {
 		return packet, err, totalBytesRead
 	}
 	totalBytesRead += prependedLengthBytesRead
-	packetId, err, idBytesRead := ReadVarInt(reader)
-	packet.Id = packetId
-	if err != nil {
-		return packet, err, totalBytesRead
+	if length < 1 || length > MaximumPacketLength {
+		return packet, ErrInvalidPacketLength{length, MaximumPacketLength}, totalBytesRead
 	}
-	totalBytesRead += length
-	byteArray := make([]byte, length-idBytesRead)
-	if len(byteArray) > 0 {
-		bytesRead, err := reader.Read(byteArray)
-		if err != nil {
-			return packet, err, totalBytesRead
-		} else if bytesRead < len(byteArray) {
-			err = io.ErrUnexpectedEOF
-			return packet, err, totalBytesRead
-		}
+	byteArray := make([]byte, length)
+	bytesRead, err := io.ReadFull(reader, byteArray)
+	totalBytesRead += bytesRead
+	if err == io.EOF {
+		return packet, io.ErrUnexpectedEOF, totalBytesRead
+	} else if err != nil {
+		return packet, err, totalBytesRead
 	}
 	packet.Content = bytes.NewBuffer(byteArray)
+	if packet.Id, err, _ = ReadVarInt(packet.Content); err == io.EOF {
+		err = io.ErrUnexpectedEOF
+	}
 	return packet, err, totalBytesRead
 }
@@ -0,0 +1,225 @@
+package datatypes
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/hex"
+	"io"
+	"testing"
+)
+
+// packets in the layout which is sent by vanilla clients
+var packetGolden = []struct {
+	name    string
+	encoded string
+	id      int
+	content string
+}{
+	// 1.8.9 client pinging localhost:25565
+	{"handshake 1.8.9 status", "0f002f096c6f63616c686f737463dd01", 0x00, "2f096c6f63616c686f737463dd01"},
+	// 1.20.1 client joining localhost:25565
+	{"handshake 1.20.1 login", "10 00fb05096c6f63616c686f737463dd02", 0x00, "fb05096c6f63616c686f737463dd02"},
+	{"status request", "0100", 0x00, ""},
+	{"ping request", "0901000000000000002a", 0x01, "000000000000002a"},
+	// 1.20.2 client logging in as Notch
+	{"login start 1.20.2", "1700054e6f746368069a79f444e94726a5befca90e38aaf5", 0x00, "054e6f746368069a79f444e94726a5befca90e38aaf5"},
+	{"login acknowledged", "0103", 0x03, ""},
+}
+
+func decodeGolden(t testing.TB, encoded string) []byte {
+	data, err := hex.DecodeString(string(bytes.Replace([]byte(encoded), []byte(" "), nil, -1)))
+	if err != nil {
+		t.Fatal(err)
+	}
+	return data
+}
+
+func TestPacketGolden(t *testing.T) {
+	for _, golden := range packetGolden {
+		encoded, content := decodeGolden(t, golden.encoded), decodeGolden(t, golden.content)
+		packet, err, bytesRead := ReadPacket(bytes.NewReader(encoded))
+		if err != nil || bytesRead != len(encoded) {
+			t.Errorf("%v: read %v of %v bytes (error: %v)", golden.name, bytesRead, len(encoded), err)
+			continue
+		}
+		if packet.Id != golden.id || !bytes.Equal(packet.Content.Bytes(), content) {
+			t.Errorf("%v: read packet %v with %x", golden.name, packet.Id, packet.Content.Bytes())
+		}
+		buffer := bytes.NewBuffer([]byte{})
+		if err, bytesWritten := WritePacket(buffer, Packet{Id: golden.id, Content: bytes.NewBuffer(content)}); err != nil || bytesWritten != len(encoded) {
+			t.Errorf("%v: wrote %v bytes (error: %v)", golden.name, bytesWritten, err)
+		}
+		if !bytes.Equal(buffer.Bytes(), encoded) {
+			t.Errorf("%v: wrote %x instead of %x", golden.name, buffer.Bytes(), encoded)
+		}
+	}
+}
+
+func TestPacketReaderGolden(t *testing.T) {
+	stream := bytes.NewBuffer([]byte{})
+	for _, golden := range packetGolden {
+		stream.Write(decodeGolden(t, golden.encoded))
+	}
+	reader := bufio.NewReader(stream)
+	packetReader := NewPacketReader(256)
+	defer packetReader.Release()
+	for _, golden := range packetGolden {
+		packet, err := packetReader.ReadPacket(reader)
+		if err != nil {
+			t.Fatalf("%v: %v", golden.name, err)
+		}
+		if packet.Id != golden.id || !bytes.Equal(packet.Content.Bytes(), decodeGolden(t, golden.content)) {
+			t.Errorf("%v: read packet %v with %x", golden.name, packet.Id, packet.Content.Bytes())
+		}
+	}
+	if _, err := packetReader.ReadPacket(reader); err != io.EOF {
+		t.Errorf("the end of the stream returned %v", err)
+	}
+}
+
+func TestPacketRoundTrip(t *testing.T) {
+	packetReader := NewPacketReader(0)
+	defer packetReader.Release()
+	for _, length := range []int{0, 1, 126, 127, 128, 16383, 16384, 70000, MaximumPacketLength - 3} {
+		for _, id := range []int{0x00, 0x7f, 0x80, 0x3fff} {
+			if VarIntSize(id)+length > MaximumPacketLength {
+				continue
+			}
+			content := make([]byte, length)
+			for index := range content {
+				content[index] = byte(index * 31)
+			}
+			buffer := bytes.NewBuffer([]byte{})
+			if err, _ := WritePacket(buffer, Packet{Id: id, Content: bytes.NewBuffer(content)}); err != nil {
+				t.Fatalf("could not write a packet with %v bytes: %v", length, err)
+			}
+			encoded := buffer.Bytes()
+			packet, err, _ := ReadPacket(bytes.NewReader(encoded))
+			if err != nil || packet.Id != id || !bytes.Equal(packet.Content.Bytes(), content) {
+				t.Errorf("a packet %v with %v bytes was read as packet %v with %v bytes (error: %v)", id, length, packet.Id, packet.Content.Len(), err)
+			}
+			packet, err = packetReader.ReadPacket(bytes.NewReader(encoded))
+			if err != nil || packet.Id != id || !bytes.Equal(packet.Content.Bytes(), content) {
+				t.Errorf("the packet reader read the packet %v with %v bytes as packet %v (error: %v)", id, length, packet.Id, err)
+			}
+		}
+	}
+}
+
+func TestPacketInvalidLength(t *testing.T) {
+	inputs := map[string][]byte{
+		"zero length":     {0x00},
+		"negative length": {0xff, 0xff, 0xff, 0xff, 0x0f},
+		"too long":        {0x80, 0x80, 0x80, 0x01},
+		"huge length":     {0xff, 0xff, 0xff, 0x07},
+	}
+	for name, input := range inputs {
+		if _, err, _ := ReadPacket(bytes.NewReader(input)); err == nil {
+			t.Errorf("%v: ReadPacket did not return an error", name)
+		} else if _, invalidLength := err.(ErrInvalidPacketLength); !invalidLength {
+			t.Errorf("%v: ReadPacket returned %v", name, err)
+		}
+		if _, err := NewPacketReader(0).ReadPacket(bytes.NewReader(input)); err == nil {
+			t.Errorf("%v: the packet reader did not return an error", name)
+		} else if _, invalidLength := err.(ErrInvalidPacketLength); !invalidLength {
+			t.Errorf("%v: the packet reader returned %v", name, err)
+		}
+	}
+	// the maximum length of the packet reader is lower than the packet
+	if _, err := NewPacketReader(8).ReadPacket(bytes.NewReader(decodeGolden(t, packetGolden[0].encoded))); err != (ErrInvalidPacketLength{15, 8}) {
+		t.Errorf("a packet which exceeds the maximum length returned %v", err)
+	}
+	// the content is shorter than the prepended length
+	for _, input := range [][]byte{{0x05, 0x00, 0x01}, {0x02, 0x80}} {
+		if _, err, _ := ReadPacket(bytes.NewReader(input)); err != io.ErrUnexpectedEOF {
+			t.Errorf("%x: ReadPacket returned %v", input, err)
+		}
+		if _, err := NewPacketReader(0).ReadPacket(bytes.NewReader(input)); err != io.ErrUnexpectedEOF {
+			t.Errorf("%x: the packet reader returned %v", input, err)
+		}
+	}
+}
+
+// a reader which returns a single byte per call like a slow connection
+type singleByteReader struct {
+	reader io.Reader
+}
+
+func (singleByteReader singleByteReader) Read(data []byte) (int, error) {
+	if len(data) == 0 {
+		return 0, nil
+	}
+	return singleByteReader.reader.Read(data[:1])
+}
+
+func TestPacketSplitReads(t *testing.T) {
+	encoded := decodeGolden(t, packetGolden[0].encoded)
+	packet, err, _ := ReadPacket(singleByteReader{bytes.NewReader(encoded)})
+	if err != nil || packet.Content.Len() != len(encoded)-2 {
+		t.Errorf("ReadPacket could not read a split packet: %v", err)
+	}
+	packet, err = NewPacketReader(0).ReadPacket(singleByteReader{bytes.NewReader(encoded)})
+	if err != nil || packet.Content.Len() != len(encoded)-2 {
+		t.Errorf("the packet reader could not read a split packet: %v", err)
+	}
+}
+
+func FuzzReadPacket(f *testing.F) {
+	for _, golden := range packetGolden {
+		f.Add(decodeGolden(f, golden.encoded))
+	}
+	f.Add([]byte{0xff, 0xff, 0xff, 0xff, 0x0f})
+	f.Add([]byte{0x05, 0x80, 0x80, 0x80, 0x80, 0x80})
+	f.Fuzz(func(t *testing.T, data []byte) {
+		packet, err, _ := ReadPacket(bytes.NewReader(data))
+		packetReader := NewPacketReader(0)
+		defer packetReader.Release()
+		bufferedPacket, bufferedErr := packetReader.ReadPacket(bufio.NewReader(bytes.NewReader(data)))
+		if (err == nil) != (bufferedErr == nil) {
+			t.Fatalf("ReadPacket returned %v but the packet reader returned %v", err, bufferedErr)
+		}
+		if err != nil {
+			return
+		}
+		if packet.Id != bufferedPacket.Id || !bytes.Equal(packet.Content.Bytes(), bufferedPacket.Content.Bytes()) {
+			t.Fatalf("ReadPacket and the packet reader read different packets")
+		}
+		if packet.Content.Len() > len(data) {
+			t.Fatalf("read %v bytes of content from %v bytes", packet.Content.Len(), len(data))
+		}
+		buffer := bytes.NewBuffer([]byte{})
+		if err, _ := WritePacket(buffer, packet); err != nil {
+			t.Fatalf("could not write the read packet: %v", err)
+		}
+		read, err, _ := ReadPacket(buffer)
+		if err != nil || read.Id != packet.Id || !bytes.Equal(read.Content.Bytes(), bufferedPacket.Content.Bytes()) {
+			t.Fatalf("the written packet was read as packet %v (error: %v)", read.Id, err)
+		}
+	})
+}
+
+func FuzzReadBigEndians(f *testing.F) {
+	f.Add([]byte{0x63, 0xdd, 0x00, 0x00, 0x00, 0x00, 0x00, 0x00, 0x00, 0x2a})
+	f.Add([]byte{0xff})
+	f.Fuzz(func(t *testing.T, data []byte) {
+		reader := bytes.NewReader(data)
+		if value, err := ReadUnsignedShort(reader); err == nil {
+			buffer := bytes.NewBuffer([]byte{})
+			WriteUnsignedShort(buffer, value)
+			if !bytes.Equal(buffer.Bytes(), data[:2]) {
+				t.Fatalf("the unsigned short %v was written as %x instead of %x", value, buffer.Bytes(), data[:2])
+			}
+		} else if len(data) >= 2 {
+			t.Fatalf("could not read an unsigned short from %v bytes: %v", len(data), err)
+		}
+		if value, err := ReadLong(reader); err == nil {
+			buffer := bytes.NewBuffer([]byte{})
+			WriteLong(buffer, value)
+			if !bytes.Equal(buffer.Bytes(), data[2:10]) {
+				t.Fatalf("the long %v was written as %x instead of %x", value, buffer.Bytes(), data[2:10])
+			}
+		} else if len(data) >= 10 {
+			t.Fatalf("could not read a long from %v bytes: %v", len(data), err)
+		}
+	})
+}
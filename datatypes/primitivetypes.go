@@ -0,0 +1,86 @@
+package datatypes
+
+import (
+	"io"
+	"math"
+)
+
+// this file contains utility methods for reading and writing the single byte data types as described here: http://wiki.vg/Protocol#Data_types
+
+// this method reads a boolean (a single byte, every value except 0x00 is true) from the given io.Reader
+// returns the read boolean or an error if something went wrong
+func ReadBoolean(reader io.Reader) (value bool, err error) {
+	read, err := ReadUnsignedByte(reader)
+	return read != 0, err
+}
+
+// this method writes a boolean (0x01 for true and 0x00 for false) to the given io.Writer
+// returns an error if something went wrong
+func WriteBoolean(writer io.Writer, value bool) error {
+	if value {
+		return WriteUnsignedByte(writer, 1)
+	}
+	return WriteUnsignedByte(writer, 0)
+}
+
+// this method reads a byte (signed 8-bit integer) from the given io.Reader
+// returns the read byte or an error if something went wrong
+func ReadByte(reader io.Reader) (value int8, err error) {
+	read, err := ReadUnsignedByte(reader)
+	return int8(read), err
+}
+
+// this method writes a byte (signed 8-bit integer) to the given io.Writer
+// returns an error if something went wrong
+func WriteByte(writer io.Writer, value int8) error {
+	return WriteUnsignedByte(writer, uint8(value))
+}
+
+// this method reads an unsigned byte (unsigned 8-bit integer) from the given io.Reader
+// returns the read unsigned byte or an error if something went wrong
+func ReadUnsignedByte(reader io.Reader) (value uint8, err error) {
+	if byteReader, isByteReader := reader.(io.ByteReader); isByteReader {
+		return byteReader.ReadByte()
+	}
+	singleByte := make([]byte, 1)
+	if _, err = io.ReadFull(reader, singleByte); err != nil {
+		return value, err
+	}
+	return singleByte[0], nil
+}
+
+// this method writes an unsigned byte (unsigned 8-bit integer) to the given io.Writer
+// returns an error if something went wrong
+func WriteUnsignedByte(writer io.Writer, value uint8) error {
+	if byteWriter, isByteWriter := writer.(io.ByteWriter); isByteWriter {
+		return byteWriter.WriteByte(value)
+	}
+	_, err := writer.Write([]byte{value})
+	return err
+}
+
+// a rotation angle in steps of 1/256 of a full turn
+type Angle uint8
+
+// returns the angle which is the closest to the given degrees (values outside of 0 to 360 degrees are wrapped)
+func NewAngle(degrees float64) Angle {
+	return Angle(int64(math.Floor(degrees*256/360+0.5)) & 0xFF)
+}
+
+// returns the angle in degrees (0 to 360)
+func (angle Angle) Degrees() float64 {
+	return float64(angle) * 360 / 256
+}
+
+// this method reads an angle from the given io.Reader
+// returns the read angle or an error if something went wrong
+func ReadAngle(reader io.Reader) (value Angle, err error) {
+	read, err := ReadUnsignedByte(reader)
+	return Angle(read), err
+}
+
+// this method writes an angle to the given io.Writer
+// returns an error if something went wrong
+func WriteAngle(writer io.Writer, value Angle) error {
+	return WriteUnsignedByte(writer, uint8(value))
+}
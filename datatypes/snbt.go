@@ -0,0 +1,421 @@
+package datatypes
+
+import (
+	"bytes"
+	"fmt"
+	"math"
+	"regexp"
+	"strconv"
+	"strings"
+)
+
+// this file contains the stringified form of NBT (SNBT) as it is used by commands: http://minecraft.wiki/w/NBT_format#SNBT_format
+// e.g. {name:"Bananrama",count:3b,values:[I;1,2,3],position:[1.5d,64.0d,-2.25d]}
+
+var (
+	// the patterns of the numbers which are written without quotes (the same as the ones of vanilla servers)
+	snbtIntegerPattern = regexp.MustCompile(`^[-+]?(?:0|[1-9][0-9]*)$`)
+	snbtDecimalPattern = regexp.MustCompile(`^[-+]?(?:[0-9]+[.]?|[0-9]*[.][0-9]+)(?:[eE][-+]?[0-9]+)?$`)
+	snbtDoublePattern  = regexp.MustCompile(`^[-+]?(?:[0-9]+[.]|[0-9]*[.][0-9]+)(?:[eE][-+]?[0-9]+)?$`)
+)
+
+// this method formats the given value as SNBT
+// values which are not tag values (e.g. structs) are converted with MarshalNbt
+// returns the formatted value or an error if the value can not be represented as tag
+func FormatSnbt(value interface{}) (string, error) {
+	value, err := MarshalNbt(value)
+	if err != nil {
+		return "", err
+	}
+	data := bytes.NewBuffer([]byte{})
+	if err = formatSnbtValue(data, value); err != nil {
+		return "", err
+	}
+	return data.String(), nil
+}
+
+func formatSnbtValue(data *bytes.Buffer, value interface{}) error {
+	switch value := value.(type) {
+	case int8:
+		data.WriteString(strconv.FormatInt(int64(value), 10) + "b")
+	case int16:
+		data.WriteString(strconv.FormatInt(int64(value), 10) + "s")
+	case int32:
+		data.WriteString(strconv.FormatInt(int64(value), 10))
+	case int64:
+		data.WriteString(strconv.FormatInt(value, 10) + "L")
+	case float32:
+		return formatSnbtDecimal(data, float64(value), 32, "f")
+	case float64:
+		return formatSnbtDecimal(data, value, 64, "d")
+	case string:
+		data.WriteString(quoteSnbt(value))
+	case []byte:
+		data.WriteString("[B;")
+		for index, element := range value {
+			if index > 0 {
+				data.WriteByte(',')
+			}
+			data.WriteString(strconv.Itoa(int(int8(element))) + "B")
+		}
+		data.WriteByte(']')
+	case []int32:
+		data.WriteString("[I;")
+		for index, element := range value {
+			if index > 0 {
+				data.WriteByte(',')
+			}
+			data.WriteString(strconv.FormatInt(int64(element), 10))
+		}
+		data.WriteByte(']')
+	case []int64:
+		data.WriteString("[L;")
+		for index, element := range value {
+			if index > 0 {
+				data.WriteByte(',')
+			}
+			data.WriteString(strconv.FormatInt(element, 10) + "L")
+		}
+		data.WriteByte(']')
+	case NbtList:
+		data.WriteByte('[')
+		for index, element := range value.Elements {
+			if index > 0 {
+				data.WriteByte(',')
+			}
+			if err := formatSnbtValue(data, element); err != nil {
+				return err
+			}
+		}
+		data.WriteByte(']')
+	case NbtCompound:
+		data.WriteByte('{')
+		for index, field := range value {
+			if index > 0 {
+				data.WriteByte(',')
+			}
+			if isUnquotedSnbt(field.Name) {
+				data.WriteString(field.Name)
+			} else {
+				data.WriteString(quoteSnbt(field.Name))
+			}
+			data.WriteByte(':')
+			if err := formatSnbtValue(data, field.Value); err != nil {
+				return err
+			}
+		}
+		data.WriteByte('}')
+	default:
+		return ErrInvalidNbt{fmt.Sprintf("the type %T is not a tag value", value)}
+	}
+	return nil
+}
+
+func formatSnbtDecimal(data *bytes.Buffer, value float64, bitSize int, suffix string) error {
+	if math.IsNaN(value) || math.IsInf(value, 0) {
+		return ErrInvalidNbt{fmt.Sprintf("the number %v can not be written as SNBT", value)}
+	}
+	formatted := strconv.FormatFloat(value, 'g', -1, bitSize)
+	if !strings.ContainsAny(formatted, ".e") {
+		formatted += ".0"
+	}
+	data.WriteString(formatted + suffix)
+	return nil
+}
+
+func quoteSnbt(value string) string {
+	return `"` + strings.NewReplacer(`\`, `\\`, `"`, `\"`).Replace(value) + `"`
+}
+
+func isUnquotedSnbtCharacter(character byte) bool {
+	return character >= 'a' && character <= 'z' || character >= 'A' && character <= 'Z' || character >= '0' && character <= '9' ||
+		character == '_' || character == '-' || character == '.' || character == '+'
+}
+
+func isUnquotedSnbt(value string) bool {
+	if len(value) == 0 {
+		return false
+	}
+	for _, character := range []byte(value) {
+		if !isUnquotedSnbtCharacter(character) {
+			return false
+		}
+	}
+	return true
+}
+
+// this method parses the given SNBT
+// numbers without a suffix are ints or doubles (if they contain a dot or exponent) and true/false are bytes,
+// other text without quotes is a string
+// returns the parsed tag value or an error if the text is not valid SNBT
+func ParseSnbt(text string) (interface{}, error) {
+	parser := &snbtParser{text: text}
+	value, err := parser.parseValue(0)
+	if err != nil {
+		return nil, err
+	}
+	parser.skipWhitespace()
+	if parser.position < len(parser.text) {
+		return nil, parser.errorf("trailing data")
+	}
+	return value, nil
+}
+
+type snbtParser struct {
+	text     string
+	position int
+}
+
+func (parser *snbtParser) errorf(format string, arguments ...interface{}) error {
+	return ErrInvalidNbt{fmt.Sprintf("%v at position %v of the SNBT", fmt.Sprintf(format, arguments...), parser.position)}
+}
+
+func (parser *snbtParser) skipWhitespace() {
+	for parser.position < len(parser.text) && strings.IndexByte(" \t\r\n", parser.text[parser.position]) >= 0 {
+		parser.position++
+	}
+}
+
+// skips the whitespace and returns whether the next character is the given one (it is consumed in that case)
+func (parser *snbtParser) accept(character byte) bool {
+	parser.skipWhitespace()
+	if parser.position < len(parser.text) && parser.text[parser.position] == character {
+		parser.position++
+		return true
+	}
+	return false
+}
+
+func (parser *snbtParser) expect(character byte) error {
+	if !parser.accept(character) {
+		return parser.errorf("expected %q", character)
+	}
+	return nil
+}
+
+func (parser *snbtParser) parseValue(depth int) (interface{}, error) {
+	if depth > MaximumNbtDepth {
+		return nil, parser.errorf("the tags are nested deeper than allowed")
+	}
+	parser.skipWhitespace()
+	if parser.position >= len(parser.text) {
+		return nil, parser.errorf("expected a value")
+	}
+	switch parser.text[parser.position] {
+	case '{':
+		return parser.parseCompound(depth)
+	case '[':
+		return parser.parseList(depth)
+	case '"', '\'':
+		return parser.parseQuoted()
+	}
+	token := parser.parseUnquoted()
+	if token == "" {
+		return nil, parser.errorf("expected a value")
+	}
+	return parseSnbtToken(token), nil
+}
+
+// returns the tag value of an unquoted token, a token which is not a number is a string
+func parseSnbtToken(token string) interface{} {
+	switch token {
+	case "true":
+		return int8(1)
+	case "false":
+		return int8(0)
+	}
+	number, suffix := token[:len(token)-1], token[len(token)-1]
+	switch suffix {
+	case 'b', 'B':
+		if snbtIntegerPattern.MatchString(number) {
+			if value, err := strconv.ParseInt(number, 10, 8); err == nil {
+				return int8(value)
+			}
+		}
+	case 's', 'S':
+		if snbtIntegerPattern.MatchString(number) {
+			if value, err := strconv.ParseInt(number, 10, 16); err == nil {
+				return int16(value)
+			}
+		}
+	case 'l', 'L':
+		if snbtIntegerPattern.MatchString(number) {
+			if value, err := strconv.ParseInt(number, 10, 64); err == nil {
+				return value
+			}
+		}
+	case 'f', 'F':
+		if snbtDecimalPattern.MatchString(number) {
+			if value, err := strconv.ParseFloat(number, 32); err == nil {
+				return float32(value)
+			}
+		}
+	case 'd', 'D':
+		if snbtDecimalPattern.MatchString(number) {
+			if value, err := strconv.ParseFloat(number, 64); err == nil {
+				return value
+			}
+		}
+	}
+	if snbtIntegerPattern.MatchString(token) {
+		if value, err := strconv.ParseInt(token, 10, 32); err == nil {
+			return int32(value)
+		}
+	} else if snbtDoublePattern.MatchString(token) {
+		if value, err := strconv.ParseFloat(token, 64); err == nil {
+			return value
+		}
+	}
+	return token
+}
+
+func (parser *snbtParser) parseUnquoted() string {
+	start := parser.position
+	for parser.position < len(parser.text) && isUnquotedSnbtCharacter(parser.text[parser.position]) {
+		parser.position++
+	}
+	return parser.text[start:parser.position]
+}
+
+func (parser *snbtParser) parseQuoted() (string, error) {
+	quote := parser.text[parser.position]
+	parser.position++
+	value := bytes.NewBuffer([]byte{})
+	for parser.position < len(parser.text) {
+		character := parser.text[parser.position]
+		parser.position++
+		switch character {
+		case quote:
+			return value.String(), nil
+		case '\\':
+			if parser.position >= len(parser.text) {
+				return "", parser.errorf("unterminated escape sequence")
+			}
+			escaped := parser.text[parser.position]
+			if escaped != '\\' && escaped != '"' && escaped != '\'' {
+				return "", parser.errorf("invalid escape sequence \\%c", escaped)
+			}
+			value.WriteByte(escaped)
+			parser.position++
+		default:
+			value.WriteByte(character)
+		}
+	}
+	return "", parser.errorf("unterminated string")
+}
+
+func (parser *snbtParser) parseKey() (string, error) {
+	parser.skipWhitespace()
+	if parser.position < len(parser.text) && (parser.text[parser.position] == '"' || parser.text[parser.position] == '\'') {
+		return parser.parseQuoted()
+	}
+	if key := parser.parseUnquoted(); key != "" {
+		return key, nil
+	}
+	return "", parser.errorf("expected a key")
+}
+
+func (parser *snbtParser) parseCompound(depth int) (interface{}, error) {
+	parser.position++
+	compound := newNbtCompoundBuilder()
+	if parser.accept('}') {
+		return compound.compound, nil
+	}
+	for {
+		name, err := parser.parseKey()
+		if err != nil {
+			return nil, err
+		}
+		if err = parser.expect(':'); err != nil {
+			return nil, err
+		}
+		value, err := parser.parseValue(depth + 1)
+		if err != nil {
+			return nil, err
+		}
+		compound.set(name, value)
+		if parser.accept('}') {
+			return compound.compound, nil
+		} else if err = parser.expect(','); err != nil {
+			return nil, err
+		}
+	}
+}
+
+func (parser *snbtParser) parseList(depth int) (interface{}, error) {
+	parser.position++
+	// arrays are prefixed by the type of their elements
+	if parser.position+1 < len(parser.text) && parser.text[parser.position+1] == ';' {
+		arrayType := parser.text[parser.position]
+		if arrayType == 'B' || arrayType == 'I' || arrayType == 'L' {
+			parser.position += 2
+			return parser.parseArray(arrayType)
+		}
+	}
+	list := NbtList{Elements: []interface{}{}}
+	if parser.accept(']') {
+		return list, nil
+	}
+	for {
+		element, err := parser.parseValue(depth + 1)
+		if err != nil {
+			return nil, err
+		}
+		elementType, _ := NbtTypeOf(element)
+		if len(list.Elements) == 0 {
+			list.ElementType = elementType
+		} else if elementType != list.ElementType {
+			return nil, parser.errorf("the list of %v contains a %v", list.ElementType, elementType)
+		}
+		list.Elements = append(list.Elements, element)
+		if parser.accept(']') {
+			return list, nil
+		} else if err = parser.expect(','); err != nil {
+			return nil, err
+		}
+	}
+}
+
+func (parser *snbtParser) parseArray(arrayType byte) (interface{}, error) {
+	bytesValue, intsValue, longsValue := []byte{}, []int32{}, []int64{}
+	if !parser.accept(']') {
+		for {
+			parser.skipWhitespace()
+			token := parser.parseUnquoted()
+			if token == "" {
+				return nil, parser.errorf("expected an array element")
+			}
+			switch element := parseSnbtToken(token).(type) {
+			case int8:
+				if arrayType != 'B' {
+					return nil, parser.errorf("the array of %c contains a byte", arrayType)
+				}
+				bytesValue = append(bytesValue, byte(element))
+			case int32:
+				if arrayType != 'I' {
+					return nil, parser.errorf("the array of %c contains an int", arrayType)
+				}
+				intsValue = append(intsValue, element)
+			case int64:
+				if arrayType != 'L' {
+					return nil, parser.errorf("the array of %c contains a long", arrayType)
+				}
+				longsValue = append(longsValue, element)
+			default:
+				return nil, parser.errorf("the array of %c contains an invalid element", arrayType)
+			}
+			if parser.accept(']') {
+				break
+			} else if err := parser.expect(','); err != nil {
+				return nil, err
+			}
+		}
+	}
+	switch arrayType {
+	case 'B':
+		return bytesValue, nil
+	case 'I':
+		return intsValue, nil
+	}
+	return longsValue, nil
+}
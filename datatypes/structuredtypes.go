@@ -0,0 +1,371 @@
+package datatypes
+
+import (
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"math"
+	"strings"
+)
+
+// this file contains utility methods for reading and writing the composed data types as described here: http://wiki.vg/Protocol#Data_types
+// like String, the types which are prefixed by their length in bytes also return the amount of bytes read or written
+
+// the protocol version which changed the layout of a position from x/y/z to x/z/y (1.14)
+const PositionLayoutVersion = 477
+
+// limits of the composed types
+const (
+	maximumIdentifierLength = 32767
+	// the maximum length (in characters) of a JSON text component
+	MaximumTextComponentLength = 262144
+	// the default namespace of identifiers without a namespace
+	DefaultNamespace = "minecraft"
+)
+
+// the error which is thrown if the prepended length of an array is not valid (lower than 0 or higher than the maximum length)
+type ErrInvalidArrayLength struct {
+	Length        int
+	MaximumLength int
+}
+
+func (errInvalidArrayLength ErrInvalidArrayLength) Error() string {
+	return fmt.Sprintf("the prepended array length (%v) is not valid (maximum: %v)", errInvalidArrayLength.Length, errInvalidArrayLength.MaximumLength)
+}
+
+// the error which is thrown if a uuid could not be parsed
+type ErrInvalidUuid struct {
+	Value string
+}
+
+func (errInvalidUuid ErrInvalidUuid) Error() string {
+	return fmt.Sprintf("the uuid %q is not valid", errInvalidUuid.Value)
+}
+
+// the error which is thrown if an identifier does not consist of a valid namespace and path
+type ErrInvalidIdentifier struct {
+	Value string
+}
+
+func (errInvalidIdentifier ErrInvalidIdentifier) Error() string {
+	return fmt.Sprintf("the identifier %q is not valid", errInvalidIdentifier.Value)
+}
+
+// an unsigned 128-bit integer which is sent as two longs (most significant first)
+type Uuid [16]byte
+
+// this method parses a uuid in its hyphenated form or as 32 hexadecimal digits
+// returns the parsed uuid or an error if the value is not a valid uuid
+func ParseUuid(value string) (uuid Uuid, err error) {
+	digits := value
+	if len(value) == 36 {
+		if value[8] != '-' || value[13] != '-' || value[18] != '-' || value[23] != '-' {
+			return uuid, ErrInvalidUuid{value}
+		}
+		digits = strings.Replace(value, "-", "", -1)
+	}
+	if len(digits) != 32 {
+		return uuid, ErrInvalidUuid{value}
+	}
+	if _, err = hex.Decode(uuid[:], []byte(digits)); err != nil {
+		return uuid, ErrInvalidUuid{value}
+	}
+	return uuid, nil
+}
+
+// returns the uuid in its hyphenated form
+func (uuid Uuid) String() string {
+	encoded := hex.EncodeToString(uuid[:])
+	return encoded[0:8] + "-" + encoded[8:12] + "-" + encoded[12:16] + "-" + encoded[16:20] + "-" + encoded[20:32]
+}
+
+// this method reads a uuid from the given io.Reader
+// returns the read uuid or an error if something went wrong
+func ReadUuid(reader io.Reader) (value Uuid, err error) {
+	_, err = io.ReadFull(reader, value[:])
+	return
+}
+
+// this method writes a uuid to the given io.Writer
+// returns an error if something went wrong
+func WriteUuid(writer io.Writer, value Uuid) error {
+	_, err := writer.Write(value[:])
+	return err
+}
+
+// the position of a block which is packed into a long with 26 bits for x and z and 12 bits for y
+type Position struct {
+	X, Y, Z int
+}
+
+// this method reads a position in the layout of the given protocol version from the given io.Reader
+// returns the read position or an error if something went wrong
+func ReadPosition(reader io.Reader, protocolVersion int) (value Position, err error) {
+	encoded, err := ReadLong(reader)
+	if err != nil {
+		return value, err
+	}
+	// the arithmetic shifts restore the sign of the packed values
+	value.X = int(encoded >> 38)
+	if protocolVersion >= PositionLayoutVersion {
+		value.Y = int(encoded << 52 >> 52)
+		value.Z = int(encoded << 26 >> 38)
+	} else {
+		value.Y = int(encoded << 26 >> 52)
+		value.Z = int(encoded << 38 >> 38)
+	}
+	return value, nil
+}
+
+// this method writes a position in the layout of the given protocol version to the given io.Writer
+// coordinates which exceed their bits are truncated
+// returns an error if something went wrong
+func WritePosition(writer io.Writer, value Position, protocolVersion int) error {
+	x, y, z := int64(value.X)&0x3FFFFFF, int64(value.Y)&0xFFF, int64(value.Z)&0x3FFFFFF
+	if protocolVersion >= PositionLayoutVersion {
+		return WriteLong(writer, x<<38|z<<12|y)
+	}
+	return WriteLong(writer, x<<38|y<<26|z)
+}
+
+// returns whether the given value is a valid identifier (http://wiki.vg/Identifier)
+// the namespace is optional, the path may contain slashes
+func IsValidIdentifier(value string) bool {
+	if len(value) == 0 || len(value) > maximumIdentifierLength {
+		return false
+	}
+	namespace, path := DefaultNamespace, value
+	if separator := strings.IndexByte(value, ':'); separator >= 0 {
+		namespace, path = value[:separator], value[separator+1:]
+	}
+	if len(namespace) == 0 || len(path) == 0 {
+		return false
+	}
+	for _, character := range []byte(namespace) {
+		if !isIdentifierCharacter(character) {
+			return false
+		}
+	}
+	for _, character := range []byte(path) {
+		if !isIdentifierCharacter(character) && character != '/' {
+			return false
+		}
+	}
+	return true
+}
+
+func isIdentifierCharacter(character byte) bool {
+	return character >= 'a' && character <= 'z' || character >= '0' && character <= '9' || character == '.' || character == '-' || character == '_'
+}
+
+// this method reads an identifier (a namespaced location like minecraft:stone) from the given io.Reader
+// returns the read identifier and the amount of bytes read or an error if something went wrong
+func ReadIdentifier(reader io.Reader) (value string, err error, totalBytesRead int) {
+	if value, err, totalBytesRead = ReadString(reader); err != nil {
+		return value, err, totalBytesRead
+	}
+	if !IsValidIdentifier(value) {
+		return "", ErrInvalidIdentifier{value}, totalBytesRead
+	}
+	return value, nil, totalBytesRead
+}
+
+// this method writes an identifier to the given io.Writer
+// returns the amount of bytes written or an error if the identifier is not valid or something went wrong
+func WriteIdentifier(writer io.Writer, value string) (err error, totalBytesWritten int) {
+	if !IsValidIdentifier(value) {
+		return ErrInvalidIdentifier{value}, totalBytesWritten
+	}
+	return WriteString(writer, value)
+}
+
+// this method reads a byte array which is prefixed by its length as VarInt from the given io.Reader
+// returns the read bytes and the amount of bytes read or an error if something went wrong
+func ReadByteArray(reader io.Reader, maximumLength int) (value []byte, err error, totalBytesRead int) {
+	length, err, prependedLengthByteAmount := ReadVarInt(reader)
+	totalBytesRead += prependedLengthByteAmount
+	if err != nil {
+		return nil, err, totalBytesRead
+	} else if length < 0 || length > maximumLength {
+		return nil, ErrInvalidArrayLength{length, maximumLength}, totalBytesRead
+	}
+	value = make([]byte, length)
+	bytesRead, err := io.ReadFull(reader, value)
+	totalBytesRead += bytesRead
+	if err == io.EOF {
+		// the array has not ended yet but there is no more byte available
+		err = io.ErrUnexpectedEOF
+	}
+	if err != nil {
+		return nil, err, totalBytesRead
+	}
+	return value, nil, totalBytesRead
+}
+
+// this method writes a byte array which is prefixed by its length as VarInt to the given io.Writer
+// returns the amount of bytes written or an error if something went wrong
+func WriteByteArray(writer io.Writer, value []byte) (err error, totalBytesWritten int) {
+	if err, totalBytesWritten = WriteVarInt(writer, len(value)); err != nil {
+		return err, totalBytesWritten
+	}
+	bytesWritten, err := writer.Write(value)
+	totalBytesWritten += bytesWritten
+	return err, totalBytesWritten
+}
+
+// this method reads a byte array which is prefixed by its length as short from the given io.Reader (the layout of 1.7)
+// returns the read bytes or an error if something went wrong
+func ReadShortPrefixedByteArray(reader io.Reader, maximumLength int) (value []byte, err error) {
+	length, err := ReadShort(reader)
+	if err != nil {
+		return nil, err
+	} else if length < 0 || int(length) > maximumLength {
+		return nil, ErrInvalidArrayLength{int(length), maximumLength}
+	}
+	value = make([]byte, length)
+	if _, err = io.ReadFull(reader, value); err == io.EOF {
+		err = io.ErrUnexpectedEOF
+	}
+	if err != nil {
+		return nil, err
+	}
+	return value, nil
+}
+
+// this method writes a byte array which is prefixed by its length as short to the given io.Writer (the layout of 1.7)
+// returns an error if something went wrong
+func WriteShortPrefixedByteArray(writer io.Writer, value []byte) error {
+	if len(value) > math.MaxInt16 {
+		return ErrInvalidArrayLength{len(value), math.MaxInt16}
+	}
+	if err := WriteShort(writer, int16(len(value))); err != nil {
+		return err
+	}
+	_, err := writer.Write(value)
+	return err
+}
+
+// this method reads an array which is prefixed by its length as VarInt from the given io.Reader
+// the given function reads the element with the given index, the amount of elements is limited by the maximum length
+// returns the amount of read elements or an error if something went wrong
+func ReadPrefixedArray(reader io.Reader, maximumLength int, readElement func(reader io.Reader, index int) error) (length int, err error) {
+	if length, err, _ = ReadVarInt(reader); err != nil {
+		return 0, err
+	} else if length < 0 || length > maximumLength {
+		return 0, ErrInvalidArrayLength{length, maximumLength}
+	}
+	for index := 0; index < length; index++ {
+		if err = readElement(reader, index); err != nil {
+			return index, err
+		}
+	}
+	return length, nil
+}
+
+// this method writes an array with the given length which is prefixed by its length as VarInt to the given io.Writer
+// the given function writes the element with the given index
+// returns an error if something went wrong
+func WritePrefixedArray(writer io.Writer, length int, writeElement func(writer io.Writer, index int) error) error {
+	if err, _ := WriteVarInt(writer, length); err != nil {
+		return err
+	}
+	for index := 0; index < length; index++ {
+		if err := writeElement(writer, index); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// this method reads an optional value which is prefixed by a boolean from the given io.Reader
+// the given function reads the value if it is present
+// returns whether the value was present or an error if something went wrong
+func ReadOptional(reader io.Reader, readValue func(reader io.Reader) error) (present bool, err error) {
+	if present, err = ReadBoolean(reader); err != nil || !present {
+		return present, err
+	}
+	return true, readValue(reader)
+}
+
+// this method writes an optional value which is prefixed by a boolean to the given io.Writer
+// the given function writes the value if it is present
+// returns an error if something went wrong
+func WriteOptional(writer io.Writer, present bool, writeValue func(writer io.Writer) error) error {
+	if err := WriteBoolean(writer, present); err != nil || !present {
+		return err
+	}
+	return writeValue(writer)
+}
+
+// a set of bits which is sent as array of longs (the bit with the index i is stored in the long i/64)
+type BitSet []int64
+
+// returns whether the bit with the given index is set
+func (bitSet BitSet) Get(index int) bool {
+	if index < 0 || index/64 >= len(bitSet) {
+		return false
+	}
+	return bitSet[index/64]&(1<<uint(index%64)) != 0
+}
+
+// this method sets the bit with the given index, the set grows if it is too small
+func (bitSet *BitSet) Set(index int, value bool) {
+	for index/64 >= len(*bitSet) {
+		*bitSet = append(*bitSet, 0)
+	}
+	if value {
+		(*bitSet)[index/64] |= 1 << uint(index%64)
+	} else {
+		(*bitSet)[index/64] &^= 1 << uint(index%64)
+	}
+}
+
+// this method reads a bit set which is prefixed by its amount of longs from the given io.Reader
+// returns the read bit set or an error if something went wrong
+func ReadBitSet(reader io.Reader, maximumLongs int) (value BitSet, err error) {
+	_, err = ReadPrefixedArray(reader, maximumLongs, func(reader io.Reader, index int) error {
+		long, err := ReadLong(reader)
+		value = append(value, long)
+		return err
+	})
+	if err != nil {
+		return nil, err
+	}
+	return value, nil
+}
+
+// this method writes a bit set which is prefixed by its amount of longs to the given io.Writer
+// returns an error if something went wrong
+func WriteBitSet(writer io.Writer, value BitSet) error {
+	return WritePrefixedArray(writer, len(value), func(writer io.Writer, index int) error {
+		return WriteLong(writer, value[index])
+	})
+}
+
+// this method reads a text component which is sent as JSON string (up to 1.20.2) and decodes it into the given value
+// returns the amount of bytes read or an error if something went wrong
+func ReadTextComponent(reader io.Reader, value interface{}) (err error, totalBytesRead int) {
+	// a character is encoded with up to 3 bytes (4 byte characters count as 2 characters)
+	data, err, totalBytesRead := ReadByteArray(reader, MaximumTextComponentLength*3)
+	if err != nil {
+		return err, totalBytesRead
+	}
+	if err = json.Unmarshal(data, value); err != nil {
+		return err, totalBytesRead
+	}
+	return nil, totalBytesRead
+}
+
+// this method encodes the given value as JSON string and writes it as text component to the given io.Writer
+// returns the amount of bytes written or an error if something went wrong
+func WriteTextComponent(writer io.Writer, value interface{}) (err error, totalBytesWritten int) {
+	data, err := json.Marshal(value)
+	if err != nil {
+		return err, totalBytesWritten
+	}
+	if len(data) > MaximumTextComponentLength*3 {
+		return ErrInvalidArrayLength{len(data), MaximumTextComponentLength * 3}, totalBytesWritten
+	}
+	return WriteByteArray(writer, data)
+}
@@ -0,0 +1,322 @@
+package datatypes
+
+import (
+	"bytes"
+	"encoding/hex"
+	"io"
+	"math"
+	"strings"
+	"testing"
+)
+
+func TestFixedSizeGolden(t *testing.T) {
+	buffer := bytes.NewBuffer([]byte{})
+	WriteBoolean(buffer, true)
+	WriteBoolean(buffer, false)
+	WriteByte(buffer, -2)
+	WriteUnsignedByte(buffer, 200)
+	WriteShort(buffer, -2)
+	WriteInt(buffer, -559038737)
+	WriteFloat(buffer, 1.5)
+	WriteDouble(buffer, -0.25)
+	WriteAngle(buffer, NewAngle(90))
+	const golden = "0100fec8fffedeadbeef3fc00000bfd000000000000040"
+	if encoded := hex.EncodeToString(buffer.Bytes()); encoded != golden {
+		t.Fatalf("the values were written as %v instead of %v", encoded, golden)
+	}
+	if value, err := ReadBoolean(buffer); err != nil || !value {
+		t.Errorf("read the boolean %v (error: %v)", value, err)
+	}
+	if value, err := ReadBoolean(buffer); err != nil || value {
+		t.Errorf("read the boolean %v (error: %v)", value, err)
+	}
+	if value, err := ReadByte(buffer); err != nil || value != -2 {
+		t.Errorf("read the byte %v (error: %v)", value, err)
+	}
+	if value, err := ReadUnsignedByte(buffer); err != nil || value != 200 {
+		t.Errorf("read the unsigned byte %v (error: %v)", value, err)
+	}
+	if value, err := ReadShort(buffer); err != nil || value != -2 {
+		t.Errorf("read the short %v (error: %v)", value, err)
+	}
+	if value, err := ReadInt(buffer); err != nil || value != -559038737 {
+		t.Errorf("read the int %v (error: %v)", value, err)
+	}
+	if value, err := ReadFloat(buffer); err != nil || value != 1.5 {
+		t.Errorf("read the float %v (error: %v)", value, err)
+	}
+	if value, err := ReadDouble(buffer); err != nil || value != -0.25 {
+		t.Errorf("read the double %v (error: %v)", value, err)
+	}
+	if value, err := ReadAngle(buffer); err != nil || value.Degrees() != 90 {
+		t.Errorf("read the angle %v (error: %v)", value, err)
+	}
+	if _, err := ReadUnsignedByte(buffer); err != io.EOF {
+		t.Errorf("reading after the end returned %v", err)
+	}
+	if _, err := ReadInt(bytes.NewReader([]byte{0x01, 0x02})); err != io.ErrUnexpectedEOF {
+		t.Errorf("a truncated int returned %v", err)
+	}
+}
+
+func TestAngle(t *testing.T) {
+	angles := map[float64]Angle{0: 0, 45: 32, 180: 128, 359: 255, 360: 0, -90: 192, 450: 64}
+	for degrees, angle := range angles {
+		if NewAngle(degrees) != angle {
+			t.Errorf("%v degrees were converted to %v instead of %v", degrees, NewAngle(degrees), angle)
+		}
+	}
+}
+
+func TestUuid(t *testing.T) {
+	const notch = "069a79f4-44e9-4726-a5be-fca90e38aaf5"
+	uuid, err := ParseUuid(notch)
+	if err != nil || uuid.String() != notch {
+		t.Fatalf("%v was parsed as %v (error: %v)", notch, uuid, err)
+	}
+	if undashed, err := ParseUuid(strings.Replace(notch, "-", "", -1)); err != nil || undashed != uuid {
+		t.Errorf("the uuid without hyphens was parsed as %v (error: %v)", undashed, err)
+	}
+	buffer := bytes.NewBuffer([]byte{})
+	WriteUuid(buffer, uuid)
+	if encoded := hex.EncodeToString(buffer.Bytes()); encoded != "069a79f444e94726a5befca90e38aaf5" {
+		t.Errorf("the uuid was written as %v", encoded)
+	}
+	if read, err := ReadUuid(buffer); err != nil || read != uuid {
+		t.Errorf("the uuid was read as %v (error: %v)", read, err)
+	}
+	for _, invalid := range []string{"", "069a79f4", "069a79f4-44e9-4726-a5be-fca90e38aaf", "069a79f4+44e9+4726+a5be+fca90e38aaf5", "g69a79f444e94726a5befca90e38aaf5"} {
+		if _, err := ParseUuid(invalid); err == nil {
+			t.Errorf("the invalid uuid %q was parsed", invalid)
+		}
+	}
+}
+
+// the example of http://wiki.vg/Protocol#Position
+func TestPositionGolden(t *testing.T) {
+	position := Position{18357644, 831, -20882616}
+	layouts := map[int]string{PositionLayoutVersion: "4607632c15b4833f", 340: "4607630cfec15b48"}
+	for protocolVersion, golden := range layouts {
+		buffer := bytes.NewBuffer([]byte{})
+		WritePosition(buffer, position, protocolVersion)
+		if encoded := hex.EncodeToString(buffer.Bytes()); encoded != golden {
+			t.Errorf("%v: the position was written as %v instead of %v", protocolVersion, encoded, golden)
+		}
+		if read, err := ReadPosition(buffer, protocolVersion); err != nil || read != position {
+			t.Errorf("%v: the position was read as %+v (error: %v)", protocolVersion, read, err)
+		}
+	}
+}
+
+func TestPositionRoundTrip(t *testing.T) {
+	for _, x := range []int{-33554432, -1, 0, 1, 33554431} {
+		for _, y := range []int{-2048, -64, 0, 319, 2047} {
+			for _, protocolVersion := range []int{47, PositionLayoutVersion} {
+				position := Position{x, y, -x}
+				if x == -33554432 {
+					position.Z = x
+				}
+				buffer := bytes.NewBuffer([]byte{})
+				WritePosition(buffer, position, protocolVersion)
+				if read, err := ReadPosition(buffer, protocolVersion); err != nil || read != position {
+					t.Errorf("%v: the position %+v was read as %+v (error: %v)", protocolVersion, position, read, err)
+				}
+			}
+		}
+	}
+}
+
+func TestIdentifier(t *testing.T) {
+	for _, valid := range []string{"stone", "minecraft:stone", "minecraft:textures/block/stone.png", "my-plugin_1.0:a/b"} {
+		buffer := bytes.NewBuffer([]byte{})
+		if err, _ := WriteIdentifier(buffer, valid); err != nil {
+			t.Errorf("could not write the identifier %v: %v", valid, err)
+		}
+		if read, err, _ := ReadIdentifier(buffer); err != nil || read != valid {
+			t.Errorf("the identifier %v was read as %v (error: %v)", valid, read, err)
+		}
+	}
+	for _, invalid := range []string{"", ":", "minecraft:", ":stone", "Minecraft:stone", "minecraft:stone:slab", "my/plugin:stone", "minecraft:stone block"} {
+		if IsValidIdentifier(invalid) {
+			t.Errorf("the invalid identifier %q was accepted", invalid)
+		}
+		if err, _ := WriteIdentifier(bytes.NewBuffer([]byte{}), invalid); err == nil {
+			t.Errorf("the invalid identifier %q was written", invalid)
+		}
+	}
+	buffer := bytes.NewBuffer([]byte{})
+	WriteString(buffer, "Minecraft:Stone")
+	if _, err, _ := ReadIdentifier(buffer); err != (ErrInvalidIdentifier{"Minecraft:Stone"}) {
+		t.Errorf("reading an invalid identifier returned %v", err)
+	}
+}
+
+func TestByteArray(t *testing.T) {
+	for _, length := range []int{0, 1, 127, 128, 5000} {
+		value := bytes.Repeat([]byte{0xab}, length)
+		buffer := bytes.NewBuffer([]byte{})
+		err, bytesWritten := WriteByteArray(buffer, value)
+		if err != nil || bytesWritten != buffer.Len() || bytesWritten != VarIntSize(length)+length {
+			t.Errorf("wrote %v bytes for an array with %v bytes (error: %v)", bytesWritten, length, err)
+		}
+		read, err, bytesRead := ReadByteArray(buffer, length)
+		if err != nil || !bytes.Equal(read, value) || bytesRead != bytesWritten {
+			t.Errorf("an array with %v bytes was read with %v bytes (error: %v)", length, len(read), err)
+		}
+	}
+	buffer := bytes.NewBuffer([]byte{})
+	WriteByteArray(buffer, []byte{1, 2, 3})
+	if _, err, _ := ReadByteArray(buffer, 2); err != (ErrInvalidArrayLength{3, 2}) {
+		t.Errorf("an array which exceeds the maximum length returned %v", err)
+	}
+	if _, err, _ := ReadByteArray(bytes.NewReader([]byte{0x03, 0x01}), 3); err != io.ErrUnexpectedEOF {
+		t.Errorf("a truncated array returned %v", err)
+	}
+	if _, err, _ := ReadByteArray(bytes.NewReader([]byte{0xff, 0xff, 0xff, 0xff, 0x0f}), 3); err != (ErrInvalidArrayLength{-1, 3}) {
+		t.Errorf("an array with a negative length returned %v", err)
+	}
+}
+
+func TestShortPrefixedByteArray(t *testing.T) {
+	buffer := bytes.NewBuffer([]byte{})
+	if err := WriteShortPrefixedByteArray(buffer, []byte{1, 2, 3}); err != nil || !bytes.Equal(buffer.Bytes(), []byte{0x00, 0x03, 1, 2, 3}) {
+		t.Errorf("the array was written as %x (error: %v)", buffer.Bytes(), err)
+	}
+	if read, err := ReadShortPrefixedByteArray(bytes.NewReader(buffer.Bytes()), 3); err != nil || !bytes.Equal(read, []byte{1, 2, 3}) {
+		t.Errorf("the array was read as %x (error: %v)", read, err)
+	}
+	if _, err := ReadShortPrefixedByteArray(bytes.NewReader(buffer.Bytes()), 2); err != (ErrInvalidArrayLength{3, 2}) {
+		t.Errorf("an array which exceeds the maximum length returned %v", err)
+	}
+	if _, err := ReadShortPrefixedByteArray(bytes.NewReader([]byte{0x00, 0x03, 0x01}), 3); err != io.ErrUnexpectedEOF {
+		t.Errorf("a truncated array returned %v", err)
+	}
+	if _, err := ReadShortPrefixedByteArray(bytes.NewReader([]byte{0xff, 0xff}), 3); err != (ErrInvalidArrayLength{-1, 3}) {
+		t.Errorf("an array with a negative length returned %v", err)
+	}
+	if err := WriteShortPrefixedByteArray(buffer, make([]byte, 32768)); err == nil {
+		t.Error("an array which is longer than a short was written")
+	}
+}
+
+func TestPrefixedArrayAndOptional(t *testing.T) {
+	values := []string{"first", "second", "third"}
+	buffer := bytes.NewBuffer([]byte{})
+	err := WritePrefixedArray(buffer, len(values), func(writer io.Writer, index int) error {
+		return WriteOptional(writer, index != 1, func(writer io.Writer) error {
+			err, _ := WriteString(writer, values[index])
+			return err
+		})
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	var read []string
+	length, err := ReadPrefixedArray(buffer, 3, func(reader io.Reader, index int) error {
+		value := ""
+		_, err := ReadOptional(reader, func(reader io.Reader) (err error) {
+			value, err, _ = ReadString(reader)
+			return err
+		})
+		read = append(read, value)
+		return err
+	})
+	if err != nil || length != 3 || read[0] != "first" || read[1] != "" || read[2] != "third" || buffer.Len() != 0 {
+		t.Errorf("the array was read as %q with the length %v (error: %v)", read, length, err)
+	}
+	buffer.Reset()
+	WriteVarInt(buffer, 4)
+	if _, err = ReadPrefixedArray(buffer, 3, nil); err != (ErrInvalidArrayLength{4, 3}) {
+		t.Errorf("an array which exceeds the maximum length returned %v", err)
+	}
+}
+
+func TestBitSet(t *testing.T) {
+	bitSet := BitSet{}
+	for _, index := range []int{0, 3, 63, 64, 130} {
+		bitSet.Set(index, true)
+	}
+	bitSet.Set(3, false)
+	if len(bitSet) != 3 || bitSet[0] != math.MinInt64|1 || bitSet[1] != 1 || bitSet[2] != 4 {
+		t.Errorf("the bits were set as %x", []int64(bitSet))
+	}
+	for index, expected := range map[int]bool{0: true, 3: false, 63: true, 64: true, 130: true, 131: false, 1000: false, -1: false} {
+		if bitSet.Get(index) != expected {
+			t.Errorf("the bit %v is %v", index, !expected)
+		}
+	}
+	buffer := bytes.NewBuffer([]byte{})
+	if err := WriteBitSet(buffer, bitSet); err != nil {
+		t.Fatal(err)
+	}
+	if encoded := hex.EncodeToString(buffer.Bytes()); encoded != "03800000000000000100000000000000010000000000000004" {
+		t.Errorf("the bit set was written as %v", encoded)
+	}
+	read, err := ReadBitSet(buffer, 3)
+	if err != nil || len(read) != 3 || read[0] != bitSet[0] || read[1] != bitSet[1] || read[2] != bitSet[2] {
+		t.Errorf("the bit set was read as %x (error: %v)", []int64(read), err)
+	}
+}
+
+func TestTextComponent(t *testing.T) {
+	type component struct {
+		Text  string      `json:"text"`
+		Color string      `json:"color,omitempty"`
+		Extra []component `json:"extra,omitempty"`
+	}
+	value := component{Text: "Hello ", Extra: []component{{Text: "world", Color: "green"}}}
+	buffer := bytes.NewBuffer([]byte{})
+	if err, _ := WriteTextComponent(buffer, value); err != nil {
+		t.Fatal(err)
+	}
+	if encoded := buffer.String()[1:]; encoded != `{"text":"Hello ","extra":[{"text":"world","color":"green"}]}` {
+		t.Errorf("the text component was written as %v", encoded)
+	}
+	read := component{}
+	if err, _ := ReadTextComponent(buffer, &read); err != nil || read.Text != value.Text || len(read.Extra) != 1 || read.Extra[0].Text != "world" || read.Extra[0].Color != "green" {
+		t.Errorf("the text component was read as %+v (error: %v)", read, err)
+	}
+	// plain strings are valid text components as well
+	buffer.Reset()
+	WriteString(buffer, `"plain"`)
+	var plain interface{}
+	if err, _ := ReadTextComponent(buffer, &plain); err != nil || plain != "plain" {
+		t.Errorf("the plain text component was read as %v (error: %v)", plain, err)
+	}
+}
+
+func FuzzReadStructuredTypes(f *testing.F) {
+	f.Add([]byte{0x01, 0x4e, 0x00, 0x00, 0x00, 0x00, 0x00, 0x00, 0x00, 0x00})
+	f.Add(decodeGolden(f, "0f6d696e6563726166743a73746f6e65"))
+	f.Add(decodeGolden(f, "03800000000000000100000000000000010000000000000004"))
+	f.Fuzz(func(t *testing.T, data []byte) {
+		if value, err, bytesRead := ReadIdentifier(bytes.NewReader(data)); err == nil {
+			if !IsValidIdentifier(value) || bytesRead > len(data) {
+				t.Fatalf("read the invalid identifier %q", value)
+			}
+		}
+		if value, err, bytesRead := ReadByteArray(bytes.NewReader(data), 64); err == nil {
+			if len(value) > 64 || !bytes.Equal(value, data[bytesRead-len(value):bytesRead]) {
+				t.Fatalf("read an array with %v bytes which does not match the data %x", len(value), data)
+			}
+		}
+		if value, err := ReadBitSet(bytes.NewReader(data), 8); err == nil {
+			buffer := bytes.NewBuffer([]byte{})
+			WriteBitSet(buffer, value)
+			if read, err := ReadBitSet(buffer, 8); err != nil || len(read) != len(value) {
+				t.Fatalf("the bit set %x was read as %x (error: %v)", []int64(value), []int64(read), err)
+			}
+		}
+		for _, protocolVersion := range []int{47, PositionLayoutVersion} {
+			if value, err := ReadPosition(bytes.NewReader(data), protocolVersion); err == nil {
+				buffer := bytes.NewBuffer([]byte{})
+				WritePosition(buffer, value, protocolVersion)
+				if !bytes.Equal(buffer.Bytes(), data[:8]) {
+					t.Fatalf("the position %+v was written as %x instead of %x", value, buffer.Bytes(), data[:8])
+				}
+			}
+		}
+		var text interface{}
+		ReadTextComponent(bytes.NewReader(data), &text)
+	})
+}
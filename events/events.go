@@ -0,0 +1,108 @@
+package events
+
+import (
+	"fmt"
+	"sync"
+	"time"
+)
+
+// this package contains the events of the server and the webhooks which send them
+
+// the types of the events
+const (
+	ServerStarted = "server_started"
+	ServerStopped = "server_stopped"
+	// a player sent the Login Start (the outcome is the login outcome of the access log)
+	LoginAttempt = "login_attempt"
+	// an address connected for the first time since the server was started
+	UniqueVisitor = "unique_visitor"
+	// a connection of a banned address or a login of a banned player was rejected
+	BanHit      = "ban_hit"
+	BackendUp   = "backend_up"
+	BackendDown = "backend_down"
+)
+
+// the types which can be selected by the webhooks
+var Types = []string{ServerStarted, ServerStopped, LoginAttempt, UniqueVisitor, BanHit, BackendUp, BackendDown}
+
+// an event of the server, which values are set depends on its type
+type Event struct {
+	Type string    `json:"type"`
+	Time time.Time `json:"time"`
+	// the address of the server (started) or of the backend server (backend up/down)
+	Address    string `json:"address,omitempty"`
+	Ip         string `json:"ip,omitempty"`
+	PlayerName string `json:"player-name,omitempty"`
+	PlayerUuid string `json:"player-uuid,omitempty"`
+	Outcome    string `json:"outcome,omitempty"`
+	// the banned address, network or player name of a ban hit
+	Ban    string `json:"ban,omitempty"`
+	Reason string `json:"reason,omitempty"`
+	// whether the maintenance mode was enabled
+	Maintenance bool `json:"maintenance,omitempty"`
+}
+
+// returns a description of the event which is sent as text (e.g. to Discord)
+func (event Event) String() (text string) {
+	switch event.Type {
+	case ServerStarted:
+		text = fmt.Sprintf("The server was started on %v.", event.Address)
+	case ServerStopped:
+		text = "The server was stopped."
+	case LoginAttempt:
+		text = fmt.Sprintf("%v (%v) tried to join. [outcome=%v]", event.PlayerName, event.Ip, event.Outcome)
+	case UniqueVisitor:
+		text = fmt.Sprintf("New visitor from %v.", event.Ip)
+	case BanHit:
+		if event.PlayerName != "" {
+			text = fmt.Sprintf("Banned player %v (%v) tried to join. [reason=%v]", event.PlayerName, event.Ip, event.Reason)
+		} else {
+			text = fmt.Sprintf("Rejected the banned address %v. [ban=%v, reason=%v]", event.Ip, event.Ban, event.Reason)
+		}
+	case BackendUp:
+		text = fmt.Sprintf("The backend server %v is available.", event.Address)
+	case BackendDown:
+		text = fmt.Sprintf("The backend server %v is not available: %v", event.Address, event.Reason)
+	default:
+		text = event.Type
+	}
+	if event.Maintenance {
+		text += " (maintenance)"
+	}
+	return text
+}
+
+// distributes the published events to the subscribed handlers
+type Bus struct {
+	mutex    sync.RWMutex
+	handlers []func(event Event)
+}
+
+func NewBus() *Bus {
+	return &Bus{}
+}
+
+// this method adds a handler which receives all events which are published afterwards
+// the handlers are called by the goroutine which publishes the event, so they must not block (e.g. Webhook.Handle queues the events)
+func (bus *Bus) Subscribe(handler func(event Event)) {
+	bus.mutex.Lock()
+	defer bus.mutex.Unlock()
+	bus.handlers = append(bus.handlers, handler)
+}
+
+// this method passes the event to the handlers, the time of the event is set if it is zero
+// the events of a nil bus are dropped
+func (bus *Bus) Publish(event Event) {
+	if bus == nil {
+		return
+	}
+	if event.Time.IsZero() {
+		event.Time = time.Now()
+	}
+	bus.mutex.RLock()
+	handlers := bus.handlers
+	bus.mutex.RUnlock()
+	for _, handler := range handlers {
+		handler(event)
+	}
+}
@@ -0,0 +1,153 @@
+package events
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+// a receiver which records the bodies of the requests and answers them with the given status codes (200 after the last one)
+type testReceiver struct {
+	mutex    sync.Mutex
+	statuses []int
+	bodies   []string
+	received chan struct{}
+}
+
+func startTestReceiver(t *testing.T, statuses ...int) (*testReceiver, *httptest.Server) {
+	receiver := &testReceiver{statuses: statuses, received: make(chan struct{}, 100)}
+	httpServer := httptest.NewServer(http.HandlerFunc(func(writer http.ResponseWriter, request *http.Request) {
+		body, _ := ioutil.ReadAll(request.Body)
+		receiver.mutex.Lock()
+		receiver.bodies = append(receiver.bodies, string(body))
+		status := http.StatusOK
+		if len(receiver.statuses) > 0 {
+			status, receiver.statuses = receiver.statuses[0], receiver.statuses[1:]
+		}
+		receiver.mutex.Unlock()
+		if status == http.StatusTooManyRequests {
+			writer.Header().Set("Retry-After", "0.01")
+		}
+		writer.WriteHeader(status)
+		receiver.received <- struct{}{}
+	}))
+	t.Cleanup(httpServer.Close)
+	return receiver, httpServer
+}
+
+// this method waits for the given amount of requests and returns the bodies of all requests
+func (receiver *testReceiver) wait(t *testing.T, requests int) []string {
+	t.Helper()
+	for ; requests > 0; requests-- {
+		select {
+		case <-receiver.received:
+		case <-time.After(5 * time.Second):
+			t.Fatal("the webhook did not send a request")
+		}
+	}
+	receiver.mutex.Lock()
+	defer receiver.mutex.Unlock()
+	return append([]string{}, receiver.bodies...)
+}
+
+func TestBus(t *testing.T) {
+	var nilBus *Bus
+	nilBus.Publish(Event{Type: ServerStarted})
+	bus := NewBus()
+	var received []Event
+	bus.Subscribe(func(event Event) {
+		received = append(received, event)
+	})
+	bus.Publish(Event{Type: LoginAttempt, PlayerName: "Notch"})
+	if len(received) != 1 || received[0].PlayerName != "Notch" || received[0].Time.IsZero() {
+		t.Errorf("received unexpected events: %+v", received)
+	}
+}
+
+func TestNewWebhook(t *testing.T) {
+	for _, options := range []WebhookOptions{
+		{Url: "ftp://localhost", Format: "json"},
+		{Url: "http://localhost", Format: "xml"},
+		{Url: "http://localhost", Payload: `{"text": {text}`},
+		{Url: "http://localhost", Format: "json", Events: []string{"unknown"}},
+	} {
+		if _, err := NewWebhook(options); err == nil {
+			t.Errorf("a webhook with the options %+v was created", options)
+		}
+	}
+}
+
+func TestWebhookBatches(t *testing.T) {
+	receiver, httpServer := startTestReceiver(t)
+	webhook, err := NewWebhook(WebhookOptions{
+		Url:              httpServer.URL,
+		Format:           "json",
+		Events:           []string{LoginAttempt},
+		BatchInterval:    time.Minute,
+		MaximumBatchSize: 2,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer webhook.Close()
+	webhook.Handle(Event{Type: LoginAttempt, PlayerName: "Notch"})
+	webhook.Handle(Event{Type: UniqueVisitor, Ip: "127.0.0.1"})
+	webhook.Handle(Event{Type: LoginAttempt, PlayerName: "jeb_"})
+	var payload struct {
+		Events []Event `json:"events"`
+	}
+	if err := json.Unmarshal([]byte(receiver.wait(t, 1)[0]), &payload); err != nil {
+		t.Fatal(err)
+	}
+	if len(payload.Events) != 2 || payload.Events[0].PlayerName != "Notch" || payload.Events[1].PlayerName != "jeb_" {
+		t.Errorf("received an unexpected batch: %+v", payload.Events)
+	}
+}
+
+func TestDiscordWebhook(t *testing.T) {
+	receiver, httpServer := startTestReceiver(t, http.StatusTooManyRequests, http.StatusInternalServerError)
+	webhook, err := NewWebhook(WebhookOptions{
+		Url:             httpServer.URL,
+		Format:          "discord",
+		MaintenanceOnly: true,
+		BatchInterval:   10 * time.Millisecond,
+		Retries:         2,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	webhook.Handle(Event{Type: LoginAttempt, PlayerName: "jeb_", Ip: "127.0.0.1", Outcome: "disconnected"})
+	webhook.Handle(Event{Type: LoginAttempt, PlayerName: "Notch", Ip: "127.0.0.1", Outcome: "disconnected", Maintenance: true})
+	// the first request is rate limited, the second one fails and the third one is accepted
+	bodies := receiver.wait(t, 3)
+	webhook.Close()
+	var payload struct {
+		Content string `json:"content"`
+	}
+	if err := json.Unmarshal([]byte(bodies[2]), &payload); err != nil {
+		t.Fatal(err)
+	}
+	if len(bodies) != 3 || bodies[0] != bodies[2] || payload.Content != "Notch (127.0.0.1) tried to join. [outcome=disconnected] (maintenance)" {
+		t.Errorf("received unexpected requests: %q", bodies)
+	}
+}
+
+func TestWebhookClose(t *testing.T) {
+	receiver, httpServer := startTestReceiver(t, http.StatusBadRequest)
+	webhook, err := NewWebhook(WebhookOptions{Url: httpServer.URL, Format: "json", BatchInterval: time.Minute})
+	if err != nil {
+		t.Fatal(err)
+	}
+	webhook.Handle(Event{Type: ServerStopped})
+	// the queued events are sent when the webhook is closed, rejected requests are not retried
+	webhook.Close()
+	webhook.Handle(Event{Type: ServerStopped})
+	if bodies := receiver.wait(t, 1); len(bodies) != 1 || !strings.Contains(bodies[0], ServerStopped) {
+		t.Errorf("received unexpected requests: %q", bodies)
+	}
+}
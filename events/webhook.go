@@ -0,0 +1,272 @@
+package events
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// the placeholders of the webhook payloads which are replaced by JSON values
+const (
+	// a string with the descriptions of the events of a batch (a line per event)
+	textPlaceholder = "{text}"
+	// an array with the events of a batch
+	eventsPlaceholder = "{events}"
+)
+
+// the payloads of the formats, the discord format creates a message (https://discord.com/developers/docs/resources/webhook#execute-webhook)
+var payloadPresets = map[string]string{
+	"json":    `{"events": {events}}`,
+	"discord": `{"content": {text}}`,
+}
+
+// Discord rejects messages which are longer
+const maximumTextLength = 2000
+
+// the default values of the options which are zero
+const (
+	defaultBatchInterval    = 2 * time.Second
+	defaultMaximumBatchSize = 10
+	defaultRetries          = 3
+)
+
+// the amount of events which are queued while a batch is sent, further events are dropped
+const queueSize = 1000
+
+// the delay before the first retry, it is doubled for every further retry (unless the receiver sends Retry-After)
+const firstRetryDelay = time.Second
+
+// the longest delay which is waited for if a receiver requests a delay
+const maximumRetryDelay = time.Minute
+
+const requestTimeout = 10 * time.Second
+
+type WebhookOptions struct {
+	Url string
+	// json or discord (the payload of the preset is used if no payload is set)
+	Format string
+	// a custom JSON body in which {text} and {events} are replaced by the events of a batch
+	Payload string
+	// the types of the events which are sent (all events if it is empty)
+	Events []string
+	// only events which happened while the maintenance mode was enabled are sent
+	MaintenanceOnly bool
+	// the events of this interval are sent in a single request (the default is used if it is zero)
+	BatchInterval time.Duration
+	// a batch is sent before the interval ended if it contains this amount of events
+	MaximumBatchSize int
+	// the amount of retries of a request which failed by a network error, a server error or a rate limit (negative disables the retries)
+	Retries int
+}
+
+// sends the events to an URL, the events are batched and the requests are retried
+type Webhook struct {
+	options WebhookOptions
+	// the host of the URL which is used in the log (the path of the URL may contain a secret token)
+	host    string
+	types   map[string]bool
+	client  *http.Client
+	queue   chan Event
+	closing chan struct{}
+	done    chan struct{}
+	// protects the queue against events which are handled while it is closed
+	mutex  sync.RWMutex
+	closed bool
+}
+
+// this method creates a webhook and starts sending the events which are passed to Handle
+// returns an error if the URL, the format, the payload or an event type is invalid
+func NewWebhook(options WebhookOptions) (*Webhook, error) {
+	parsedUrl, err := url.Parse(options.Url)
+	if err != nil || (parsedUrl.Scheme != "http" && parsedUrl.Scheme != "https") || parsedUrl.Host == "" {
+		return nil, fmt.Errorf("invalid webhook URL")
+	}
+	if options.Payload == "" {
+		if options.Payload = payloadPresets[options.Format]; options.Payload == "" {
+			return nil, fmt.Errorf("unknown webhook format %q", options.Format)
+		}
+	}
+	if !json.Valid([]byte(replacePlaceholders(options.Payload, `""`, `[]`))) {
+		return nil, fmt.Errorf("the webhook payload is not valid JSON")
+	}
+	types := map[string]bool{}
+	for _, eventType := range options.Events {
+		if !isType(eventType) {
+			return nil, fmt.Errorf("unknown event type %q", eventType)
+		}
+		types[eventType] = true
+	}
+	if options.BatchInterval <= 0 {
+		options.BatchInterval = defaultBatchInterval
+	}
+	if options.MaximumBatchSize <= 0 {
+		options.MaximumBatchSize = defaultMaximumBatchSize
+	}
+	if options.Retries == 0 {
+		options.Retries = defaultRetries
+	}
+	webhook := &Webhook{
+		options: options,
+		host:    parsedUrl.Host,
+		types:   types,
+		client:  &http.Client{Timeout: requestTimeout},
+		queue:   make(chan Event, queueSize),
+		closing: make(chan struct{}),
+		done:    make(chan struct{}),
+	}
+	go webhook.run()
+	return webhook, nil
+}
+
+func isType(eventType string) bool {
+	for _, knownType := range Types {
+		if knownType == eventType {
+			return true
+		}
+	}
+	return false
+}
+
+// this method queues the event if it is selected by the options, it does not block (the event is dropped if the queue is full)
+// it is subscribed to the bus of the server
+func (webhook *Webhook) Handle(event Event) {
+	if (len(webhook.types) > 0 && !webhook.types[event.Type]) || (webhook.options.MaintenanceOnly && !event.Maintenance) {
+		return
+	}
+	webhook.mutex.RLock()
+	defer webhook.mutex.RUnlock()
+	if webhook.closed {
+		return
+	}
+	select {
+	case webhook.queue <- event:
+	default:
+		log.Printf("The event queue of the webhook %v is full, the event was dropped. [type=%v]\n", webhook.host, event.Type)
+	}
+}
+
+// this method sends the queued events and stops the webhook, failed requests are not retried anymore
+func (webhook *Webhook) Close() {
+	webhook.mutex.Lock()
+	if !webhook.closed {
+		webhook.closed = true
+		close(webhook.closing)
+		close(webhook.queue)
+	}
+	webhook.mutex.Unlock()
+	<-webhook.done
+}
+
+// this method collects the queued events into batches until the queue is closed
+func (webhook *Webhook) run() {
+	defer close(webhook.done)
+	var batch []Event
+	var timeout <-chan time.Time
+	for {
+		select {
+		case event, open := <-webhook.queue:
+			if !open {
+				if len(batch) > 0 {
+					webhook.send(batch)
+				}
+				return
+			}
+			if batch = append(batch, event); len(batch) == 1 {
+				timeout = time.After(webhook.options.BatchInterval)
+			}
+			if len(batch) < webhook.options.MaximumBatchSize {
+				continue
+			}
+		case <-timeout:
+		}
+		webhook.send(batch)
+		batch, timeout = nil, nil
+	}
+}
+
+// this method posts the batch and retries it after network errors, server errors and rate limits
+func (webhook *Webhook) send(batch []Event) {
+	body, err := webhook.payload(batch)
+	if err != nil {
+		log.Printf("Could not encode the events of the webhook %v: %v\n", webhook.host, err)
+		return
+	}
+	delay := firstRetryDelay
+	for attempt := 0; ; attempt++ {
+		retryAfter, err := webhook.post(body)
+		if err == nil {
+			return
+		} else if retryAfter < 0 || attempt >= webhook.options.Retries {
+			log.Printf("Could not send %v events to the webhook %v: %v\n", len(batch), webhook.host, err)
+			return
+		}
+		if retryAfter == 0 {
+			retryAfter, delay = delay, delay*2
+		} else if retryAfter > maximumRetryDelay {
+			retryAfter = maximumRetryDelay
+		}
+		select {
+		case <-webhook.closing:
+			log.Printf("Could not send %v events to the webhook %v before it was closed: %v\n", len(batch), webhook.host, err)
+			return
+		case <-time.After(retryAfter):
+		}
+	}
+}
+
+// this method posts the body once
+// returns the delay the receiver requested (zero if it did not request one, negative if the request must not be retried)
+func (webhook *Webhook) post(body []byte) (time.Duration, error) {
+	response, err := webhook.client.Post(webhook.options.Url, "application/json", bytes.NewReader(body))
+	if err != nil {
+		// the error contains the URL
+		if urlError, isUrlError := err.(*url.Error); isUrlError {
+			err = urlError.Err
+		}
+		return 0, err
+	}
+	response.Body.Close()
+	switch {
+	case response.StatusCode < 300:
+		return 0, nil
+	case response.StatusCode == http.StatusTooManyRequests:
+		seconds, _ := strconv.ParseFloat(response.Header.Get("Retry-After"), 64)
+		return time.Duration(seconds * float64(time.Second)), fmt.Errorf("rate limited (%v)", response.Status)
+	case response.StatusCode >= 500:
+		return 0, fmt.Errorf("server error (%v)", response.Status)
+	default:
+		return -1, fmt.Errorf("the request was rejected (%v)", response.Status)
+	}
+}
+
+// returns the payload with the events of the batch
+func (webhook *Webhook) payload(batch []Event) ([]byte, error) {
+	lines := make([]string, len(batch))
+	for index, event := range batch {
+		lines[index] = event.String()
+	}
+	text := strings.Join(lines, "\n")
+	if len(text) > maximumTextLength {
+		text = strings.ToValidUTF8(text[:maximumTextLength-3], "") + "..."
+	}
+	encodedText, err := json.Marshal(text)
+	if err != nil {
+		return nil, err
+	}
+	encodedEvents, err := json.Marshal(batch)
+	if err != nil {
+		return nil, err
+	}
+	return []byte(replacePlaceholders(webhook.options.Payload, string(encodedText), string(encodedEvents))), nil
+}
+
+func replacePlaceholders(payload, text, events string) string {
+	return strings.NewReplacer(textPlaceholder, text, eventsPlaceholder, events).Replace(payload)
+}
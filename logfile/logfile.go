@@ -0,0 +1,272 @@
+package logfile
+
+import (
+	"compress/gzip"
+	"io"
+	"io/ioutil"
+	"log"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// this file contains a log file which is appended to and rotated by its size and age
+
+// the time format which is inserted into the names of rotated files (their names are sorted by it)
+const backupTimeFormat = "2006-01-02T15-04-05.000"
+
+// the options which determine when a log file is rotated and how many rotated files are kept
+// the rotated files are named like the log file with the time of the rotation in front of the extension
+// (e.g. latest.2006-01-02T15-04-05.000.log)
+type Options struct {
+	// size in bytes which is not exceeded by the log file (0 disables the rotation by size)
+	MaximumSize int64
+	// the log file is rotated when the first line of a new interval is written (0 disables the rotation by time)
+	// the intervals are aligned to the zero time in UTC (e.g. 24 hours rotate the log file at midnight UTC)
+	Interval time.Duration
+	// amount of rotated files which are kept (0 keeps all of them)
+	MaximumBackups int
+	// whether the rotated files are compressed with gzip
+	Compress bool
+}
+
+// a log file which is opened in append mode and rotated according to its options
+// it is safe for concurrent use and can be used as output of a logger
+type File struct {
+	mutex     sync.Mutex
+	path      string
+	options   Options
+	file      *os.File
+	size      int64
+	lastWrite time.Time
+	closed    bool
+	// the compression and removal of rotated files which runs in the background
+	maintenance sync.Mutex
+	background  sync.WaitGroup
+	now         func() time.Time
+}
+
+// this method opens the log file at the given path (it is created if it does not exist)
+// returns an error if the file could not be opened
+func Open(path string, options Options) (*File, error) {
+	logFile := &File{path: path, options: options, now: time.Now}
+	if err := logFile.open(); err != nil {
+		return nil, err
+	}
+	return logFile, nil
+}
+
+// the size and the time of the last write are taken from the existing file so that a restart does not delay the rotation
+func (logFile *File) open() error {
+	file, err := os.OpenFile(logFile.path, os.O_WRONLY|os.O_APPEND|os.O_CREATE, 0644)
+	if err != nil {
+		return err
+	}
+	info, err := file.Stat()
+	if err != nil {
+		file.Close()
+		return err
+	}
+	logFile.file, logFile.size = file, info.Size()
+	if info.Size() > 0 {
+		logFile.lastWrite = info.ModTime()
+	} else {
+		logFile.lastWrite = time.Time{}
+	}
+	return nil
+}
+
+// this method appends the given data to the log file and rotates it before if needed
+// if the file could not be opened before, it is opened again so that the logging continues after a disk error
+// an error is also returned if the data was written but the log file could not be rotated
+func (logFile *File) Write(data []byte) (int, error) {
+	logFile.mutex.Lock()
+	defer logFile.mutex.Unlock()
+	if logFile.closed {
+		return 0, os.ErrClosed
+	}
+	if logFile.file == nil {
+		if err := logFile.open(); err != nil {
+			return 0, err
+		}
+	}
+	now := logFile.now()
+	var rotateErr error
+	if logFile.shouldRotate(int64(len(data)), now) {
+		if rotateErr = logFile.rotate(now); rotateErr != nil && logFile.file == nil {
+			return 0, rotateErr
+		}
+	}
+	n, err := logFile.file.Write(data)
+	logFile.size += int64(n)
+	if n > 0 {
+		logFile.lastWrite = now
+	}
+	if err == nil && rotateErr != nil {
+		// the data was written to the log file which could not be rotated
+		err = rotateErr
+	}
+	return n, err
+}
+
+func (logFile *File) shouldRotate(length int64, now time.Time) bool {
+	if logFile.size == 0 {
+		return false
+	}
+	if logFile.options.MaximumSize > 0 && logFile.size+length > logFile.options.MaximumSize {
+		return true
+	}
+	return logFile.options.Interval > 0 && !logFile.lastWrite.IsZero() &&
+		!now.Truncate(logFile.options.Interval).Equal(logFile.lastWrite.Truncate(logFile.options.Interval))
+}
+
+// the log file is renamed and a new one is created, the rotated file is compressed and old files are removed in the background
+// if the file could not be renamed, it is opened again and the logging continues in it
+// nothing is logged while the mutex is held because the file can be the output of the standard logger
+func (logFile *File) rotate(now time.Time) error {
+	logFile.file.Close()
+	logFile.file = nil
+	backupPath := logFile.backupPath(now)
+	renameErr := os.Rename(logFile.path, backupPath)
+	if err := logFile.open(); err != nil {
+		return err
+	}
+	if renameErr != nil {
+		return renameErr
+	}
+	logFile.background.Add(1)
+	go func() {
+		defer logFile.background.Done()
+		logFile.maintenance.Lock()
+		defer logFile.maintenance.Unlock()
+		if logFile.options.Compress {
+			if err := compress(backupPath); err != nil {
+				log.Printf("Could not compress the rotated log file %v: %v\n", backupPath, err)
+			}
+		}
+		if err := logFile.removeOldBackups(); err != nil {
+			log.Printf("Could not remove the old log files of %v: %v\n", logFile.path, err)
+		}
+	}()
+	return nil
+}
+
+// returns a path for a rotated file which does not exist yet
+func (logFile *File) backupPath(now time.Time) string {
+	extension := filepath.Ext(logFile.path)
+	prefix := strings.TrimSuffix(logFile.path, extension) + "." + now.Format(backupTimeFormat)
+	backupPath := prefix + extension
+	for counter := 1; exists(backupPath) || exists(backupPath+".gz"); counter++ {
+		backupPath = prefix + "-" + strconv.Itoa(counter) + extension
+	}
+	return backupPath
+}
+
+func exists(path string) bool {
+	_, err := os.Lstat(path)
+	return err == nil
+}
+
+// returns the paths of the rotated files from the oldest to the newest one
+func (logFile *File) backups() ([]string, error) {
+	directory := filepath.Dir(logFile.path)
+	extension := filepath.Ext(logFile.path)
+	prefix := strings.TrimSuffix(filepath.Base(logFile.path), extension) + "."
+	files, err := ioutil.ReadDir(directory)
+	if err != nil {
+		return nil, err
+	}
+	var backups []string
+	for _, file := range files {
+		name := strings.TrimSuffix(file.Name(), ".gz")
+		if file.IsDir() || len(name) < len(prefix)+len(backupTimeFormat)+len(extension) ||
+			!strings.HasPrefix(name, prefix) || !strings.HasSuffix(name, extension) {
+			continue
+		}
+		if _, err := time.Parse(backupTimeFormat, name[len(prefix):len(prefix)+len(backupTimeFormat)]); err != nil {
+			continue
+		}
+		backups = append(backups, filepath.Join(directory, file.Name()))
+	}
+	// the names are compared without their extensions because files of the same time have a counter in front of them
+	sortKey := func(path string) string {
+		return strings.TrimSuffix(strings.TrimSuffix(path, ".gz"), extension)
+	}
+	sort.Slice(backups, func(i, j int) bool {
+		return sortKey(backups[i]) < sortKey(backups[j])
+	})
+	return backups, nil
+}
+
+func (logFile *File) removeOldBackups() error {
+	if logFile.options.MaximumBackups <= 0 {
+		return nil
+	}
+	backups, err := logFile.backups()
+	if err != nil {
+		return err
+	}
+	for len(backups) > logFile.options.MaximumBackups {
+		if err := os.Remove(backups[0]); err != nil {
+			return err
+		}
+		backups = backups[1:]
+	}
+	return nil
+}
+
+// the given file is replaced by a gzip file with the same name and the .gz extension
+func compress(path string) error {
+	source, err := os.Open(path)
+	if err != nil {
+		return err
+	}
+	defer source.Close()
+	destination, err := os.OpenFile(path+".gz", os.O_WRONLY|os.O_CREATE|os.O_EXCL, 0644)
+	if err != nil {
+		return err
+	}
+	gzipWriter := gzip.NewWriter(destination)
+	_, err = io.Copy(gzipWriter, source)
+	if closeErr := gzipWriter.Close(); err == nil {
+		err = closeErr
+	}
+	if closeErr := destination.Close(); err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		os.Remove(path + ".gz")
+		return err
+	}
+	source.Close()
+	return os.Remove(path)
+}
+
+// this method closes and opens the log file again (e.g. after it was moved by an external tool like logrotate)
+func (logFile *File) Reopen() error {
+	logFile.mutex.Lock()
+	defer logFile.mutex.Unlock()
+	if logFile.file != nil {
+		logFile.file.Close()
+		logFile.file = nil
+	}
+	return logFile.open()
+}
+
+// this method closes the log file and waits until the rotated files are compressed
+func (logFile *File) Close() error {
+	logFile.mutex.Lock()
+	logFile.closed = true
+	var err error
+	if logFile.file != nil {
+		err = logFile.file.Close()
+		logFile.file = nil
+	}
+	logFile.mutex.Unlock()
+	logFile.background.Wait()
+	return err
+}
@@ -0,0 +1,189 @@
+package logfile
+
+import (
+	"compress/gzip"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+// this method opens a log file in a temporary directory whose clock is advanced by the returned function
+func openTestFile(t *testing.T, options Options) (*File, string, func(time.Duration)) {
+	directory := t.TempDir()
+	path := filepath.Join(directory, "latest.log")
+	logFile, err := Open(path, options)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() {
+		logFile.Close()
+	})
+	now := time.Date(2024, 1, 1, 12, 0, 0, 0, time.UTC)
+	logFile.now = func() time.Time {
+		return now
+	}
+	return logFile, directory, func(duration time.Duration) {
+		now = now.Add(duration)
+	}
+}
+
+func write(t *testing.T, logFile *File, line string) {
+	t.Helper()
+	if _, err := logFile.Write([]byte(line)); err != nil {
+		t.Fatal(err)
+	}
+}
+
+// returns the contents of the files in the given directory by their names (gzip files are decompressed)
+func readDirectory(t *testing.T, directory string) map[string]string {
+	t.Helper()
+	files, err := ioutil.ReadDir(directory)
+	if err != nil {
+		t.Fatal(err)
+	}
+	contents := map[string]string{}
+	for _, file := range files {
+		data, err := ioutil.ReadFile(filepath.Join(directory, file.Name()))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if strings.HasSuffix(file.Name(), ".gz") {
+			reader, err := gzip.NewReader(strings.NewReader(string(data)))
+			if err != nil {
+				t.Fatal(err)
+			}
+			if data, err = ioutil.ReadAll(reader); err != nil {
+				t.Fatal(err)
+			}
+		}
+		contents[file.Name()] = string(data)
+	}
+	return contents
+}
+
+func TestAppend(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "latest.log")
+	for _, line := range []string{"first\n", "second\n"} {
+		logFile, err := Open(path, Options{})
+		if err != nil {
+			t.Fatal(err)
+		}
+		write(t, logFile, line)
+		if err := logFile.Close(); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if data, _ := ioutil.ReadFile(path); string(data) != "first\nsecond\n" {
+		t.Errorf("the log file contains %q after a restart", data)
+	}
+}
+
+func TestRotateBySize(t *testing.T) {
+	logFile, directory, _ := openTestFile(t, Options{MaximumSize: 10, Compress: true})
+	write(t, logFile, "12345\n")
+	write(t, logFile, "1234\n")
+	write(t, logFile, "abc\n")
+	logFile.Close()
+	contents := readDirectory(t, directory)
+	expected := map[string]string{
+		"latest.log":                            "1234\nabc\n",
+		"latest.2024-01-01T12-00-00.000.log.gz": "12345\n",
+	}
+	if len(contents) != len(expected) {
+		t.Fatalf("the directory contains %v", contents)
+	}
+	for name, content := range expected {
+		if contents[name] != content {
+			t.Errorf("%v contains %q instead of %q", name, contents[name], content)
+		}
+	}
+}
+
+func TestRotateByInterval(t *testing.T) {
+	logFile, directory, advance := openTestFile(t, Options{Interval: 24 * time.Hour, MaximumBackups: 2})
+	for day := 1; day <= 4; day++ {
+		write(t, logFile, "day\n")
+		advance(time.Hour)
+		write(t, logFile, "same day\n")
+		advance(23 * time.Hour)
+	}
+	logFile.Close()
+	contents := readDirectory(t, directory)
+	for _, name := range []string{"latest.log", "latest.2024-01-03T12-00-00.000.log", "latest.2024-01-04T12-00-00.000.log"} {
+		if contents[name] != "day\nsame day\n" {
+			t.Errorf("%v contains %q", name, contents[name])
+		}
+	}
+	if len(contents) != 3 {
+		t.Errorf("the old log files were not removed: %v", contents)
+	}
+}
+
+func TestBackupOrder(t *testing.T) {
+	logFile, directory, _ := openTestFile(t, Options{MaximumSize: 1, MaximumBackups: 2})
+	for _, line := range []string{"1", "2", "3", "4"} {
+		write(t, logFile, line)
+	}
+	logFile.Close()
+	contents := readDirectory(t, directory)
+	expected := map[string]string{
+		"latest.log":                           "4",
+		"latest.2024-01-01T12-00-00.000-1.log": "2",
+		"latest.2024-01-01T12-00-00.000-2.log": "3",
+	}
+	if len(contents) != len(expected) {
+		t.Fatalf("the directory contains %v", contents)
+	}
+	for name, content := range expected {
+		if contents[name] != content {
+			t.Errorf("%v contains %q instead of %q", name, contents[name], content)
+		}
+	}
+}
+
+func TestReopen(t *testing.T) {
+	logFile, directory, _ := openTestFile(t, Options{})
+	write(t, logFile, "before\n")
+	if err := os.Rename(filepath.Join(directory, "latest.log"), filepath.Join(directory, "moved.log")); err != nil {
+		t.Fatal(err)
+	}
+	if err := logFile.Reopen(); err != nil {
+		t.Fatal(err)
+	}
+	write(t, logFile, "after\n")
+	logFile.Close()
+	contents := readDirectory(t, directory)
+	if contents["moved.log"] != "before\n" || contents["latest.log"] != "after\n" {
+		t.Errorf("the log file was not opened again: %v", contents)
+	}
+	if _, err := logFile.Write([]byte("closed\n")); err == nil {
+		t.Error("a closed log file was written")
+	}
+}
+
+func TestOpenAfterDiskError(t *testing.T) {
+	directory := t.TempDir()
+	path := filepath.Join(directory, "logs", "latest.log")
+	os.Mkdir(filepath.Dir(path), 0755)
+	logFile, err := Open(path, Options{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer logFile.Close()
+	os.RemoveAll(filepath.Dir(path))
+	logFile.mutex.Lock()
+	logFile.file.Close()
+	logFile.file = nil
+	logFile.mutex.Unlock()
+	if _, err := logFile.Write([]byte("lost\n")); err == nil {
+		t.Error("a line was written to a missing directory")
+	}
+	os.Mkdir(filepath.Dir(path), 0755)
+	write(t, logFile, "recovered\n")
+	if data, _ := ioutil.ReadFile(path); string(data) != "recovered\n" {
+		t.Errorf("the log file contains %q after the directory was created again", data)
+	}
+}
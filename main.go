@@ -6,10 +6,22 @@ import (
 	"github.com/michivip/mcstatusserver/configuration"
 	"log"
 	"os"
-	"io/ioutil"
-	"encoding/base64"
 	"io"
 	"bufio"
+	"github.com/michivip/mcstatusserver/bans"
+	"github.com/michivip/mcstatusserver/protocol"
+	"github.com/michivip/mcstatusserver/metrics"
+	"net"
+	"github.com/michivip/mcstatusserver/logfile"
+	"github.com/michivip/mcstatusserver/admin"
+	"github.com/michivip/mcstatusserver/rcon"
+	"github.com/michivip/mcstatusserver/commands"
+	"github.com/michivip/mcstatusserver/events"
+	"sync"
+	"os/signal"
+	"syscall"
+	"time"
+	"fmt"
 )
 
 const asciiArt = "                           _             _                                                           \n" +
@@ -21,90 +33,218 @@ const asciiArt = "                           _             _
 
 func main() {
 	configurationFile := flag.String("config", "config.json", "The path to your custom configuration logFile.")
+	noConsole := flag.Bool("no-console", false, "Does not read commands from the standard input (e.g. when the server runs as a service).")
 	flag.Parse()
 
 	os.Stdout.WriteString(asciiArt)
 	config := configuration.LoadConfiguration(*configurationFile)
-	encodedFavicon := loadFavicon(config)
-	config.Motd.FaviconPath = encodedFavicon
-startLog:
-	logFile, err := os.OpenFile(config.LogFile, os.O_RDWR, os.ModePerm)
-	if os.IsNotExist(err) {
-		logFile, err = os.Create(config.LogFile)
-		if err != nil {
-			log.Fatalf("There was an error while creating the logging file (%v):\n", config.LogFile)
-			panic(err)
+	if err := configuration.LoadFavicons(config); err != nil {
+		log.Fatalf("There was an error while loading the favicons: %v\n", err)
+	}
+	logRotation := logfile.Options{
+		MaximumSize:    int64(config.LogRotation.MaximumSize) << 20,
+		Interval:       time.Duration(config.LogRotation.Interval) * time.Millisecond,
+		MaximumBackups: config.LogRotation.MaximumBackups,
+		Compress:       config.LogRotation.Compress,
+	}
+	logFile, err := logfile.Open(config.LogFile, logRotation)
+	if err != nil {
+		log.Fatalf("There was an error while opening the logging file (%v): %v\n", config.LogFile, err)
+	}
+	log.SetOutput(&ConsoleFileWriter{File: logFile})
+	logFiles := []*logfile.File{logFile}
+	logLevel, err := server.ParseLogLevel(config.LogLevel)
+	if err != nil {
+		log.Fatalf("There was an error while parsing the log level: %v\n", err)
+	}
+	server.SetLogLevel(logLevel)
+	if config.ProtocolVersionsFile != "" {
+		if err = protocol.LoadVersions(config.ProtocolVersionsFile); err != nil {
+			log.Fatalf("There was an error while loading the protocol versions: %v\n", err)
 		}
-	} else if err != nil {
-		log.Fatalf("There was an error while opening the logging file (%v):\n", config.LogFile)
-		panic(err)
-	} else {
-		logFile.Close()
-		if err = os.Remove(config.LogFile); err != nil {
-			log.Fatalf("There was an error while removing the old logging file (%v):\n", config.LogFile)
-			panic(err)
+	}
+	banLists, err := bans.LoadLists(config.Bans.BannedIpsFile, config.Bans.BannedPlayersFile, config.Bans.WhitelistFile)
+	if err != nil {
+		log.Fatalf("There was an error while loading the ban lists: %v\n", err)
+	}
+	if config.Bans.ProfileServer != "" {
+		banLists.ResolvePlayer = bans.ProfileServerResolver(config.Bans.ProfileServer)
+	}
+	mcServer := server.NewServer(config, banLists)
+	if config.AccessLog.Enabled {
+		var accessLogWriter io.Writer = os.Stdout
+		if config.AccessLog.File != "" {
+			accessLogFile, err := logfile.Open(config.AccessLog.File, logRotation)
+			if err != nil {
+				log.Fatalf("There was an error while opening the access log file (%v): %v\n", config.AccessLog.File, err)
+			}
+			defer accessLogFile.Close()
+			accessLogWriter = accessLogFile
+			logFiles = append(logFiles, accessLogFile)
+		}
+		if mcServer.AccessLog, err = server.NewAccessLogger(accessLogWriter, config.AccessLog.Format, config.AccessLog.Fields); err != nil {
+			log.Fatalf("There was an error while creating the access log: %v\n", err)
 		}
-		goto startLog
 	}
-	log.SetOutput(ConsoleFileWriter{logFile})
-	listener := server.StartServer(config)
+	reopenOnSignal(logFiles)
+	var webhooks []*events.Webhook
+	for _, values := range config.Webhooks {
+		webhook, err := events.NewWebhook(events.WebhookOptions{
+			Url:              values.Url,
+			Format:           values.Format,
+			Payload:          values.Payload,
+			Events:           values.Events,
+			MaintenanceOnly:  values.MaintenanceOnly,
+			BatchInterval:    time.Duration(values.BatchInterval) * time.Millisecond,
+			MaximumBatchSize: values.MaximumBatchSize,
+			Retries:          values.Retries,
+		})
+		if err != nil {
+			log.Fatalf("There was an error while creating a webhook: %v\n", err)
+		}
+		mcServer.Events.Subscribe(webhook.Handle)
+		webhooks = append(webhooks, webhook)
+	}
+	listener, err := mcServer.Listen()
+	if err != nil {
+		log.Fatalf("There was an error while starting the server: %v\n", err)
+	}
 	defer func() {
 		log.Println("Shutting down server...")
-		listener.Close()
+		mcServer.Close()
+		// the webhooks are closed after the server so that they send the stop event
+		for _, webhook := range webhooks {
+			webhook.Close()
+		}
 		log.Println("Closing log file...")
 		logFile.Close()
 	}()
-	go server.WaitForConnections(listener, config)
-	reader := bufio.NewReader(os.Stdin)
-	for {
-		text, _ := reader.ReadString('\n')
-		if text == "stop\n" || text == "close\n" {
-			server.Closed = true
-			break
+	go func() {
+		if err := mcServer.Serve(listener); err != nil {
+			log.Fatalf("There was an error while accepting a TCP connection: %v\n", err)
+		}
+	}()
+	if config.Metrics.Enabled {
+		metricsListener, err := net.Listen("tcp", config.Metrics.Address)
+		if err != nil {
+			log.Fatalf("There was an error while starting the metrics listener: %v\n", err)
 		}
+		log.Printf("Serving metrics on http://%v%v\n", metricsListener.Addr(), config.Metrics.Path)
+		go func() {
+			log.Fatalf("There was an error while serving the metrics: %v\n", metrics.Serve(metricsListener, config.Metrics.Path, metrics.DefaultRegistry))
+		}()
+	}
+	stopped := make(chan struct{})
+	var stopOnce sync.Once
+	stop := func() {
+		stopOnce.Do(func() {
+			close(stopped)
+		})
+	}
+	reload := func() error {
+		return reloadConfiguration(*configurationFile, mcServer)
 	}
+	commandRegistry, err := newCommandRegistry(mcServer, reload, stop)
+	if err != nil {
+		log.Fatalf("There was an error while registering the commands: %v\n", err)
+	}
+	if config.Admin.Enabled {
+		adminHandler, err := admin.NewHandler(mcServer, config.Admin.Token, reload)
+		if err != nil {
+			log.Fatalf("There was an error while starting the admin API: %v\n", err)
+		}
+		adminHandler.Commands = commandRegistry
+		adminListener, err := net.Listen("tcp", config.Admin.Address)
+		if err != nil {
+			log.Fatalf("There was an error while starting the admin API listener: %v\n", err)
+		}
+		log.Printf("Serving the admin API on http://%v\n", adminListener.Addr())
+		go func() {
+			log.Fatalf("There was an error while serving the admin API: %v\n", admin.Serve(adminListener, adminHandler))
+		}()
+	}
+	if config.Rcon.Enabled {
+		rconServer, err := rcon.NewServer(config.Rcon.Password, rconExecutor(commandRegistry))
+		if err != nil {
+			log.Fatalf("There was an error while starting RCON: %v\n", err)
+		}
+		rconListener, err := net.Listen("tcp", config.Rcon.Address)
+		if err != nil {
+			log.Fatalf("There was an error while starting the RCON listener: %v\n", err)
+		}
+		defer rconServer.Close()
+		log.Printf("Serving RCON on %v\n", rconListener.Addr())
+		go func() {
+			if err := rconServer.Serve(rconListener); err != nil {
+				log.Fatalf("There was an error while accepting an RCON connection: %v\n", err)
+			}
+		}()
+	}
+	signals := make(chan os.Signal, 1)
+	signal.Notify(signals, os.Interrupt, syscall.SIGTERM)
+	go func() {
+		log.Printf("Received the signal %v, stopping the server.\n", <-signals)
+		// a second signal terminates the server immediately if the shutdown hangs
+		signal.Stop(signals)
+		stop()
+	}()
+	if !*noConsole {
+		go readConsole(commandRegistry)
+	}
+	<-stopped
 }
 
-type SyncWriter interface {
-	io.Writer
-	Sync() error
+// this method executes the commands of the standard input until it is closed
+// without a console (e.g. /dev/null as standard input of a service) the commands are only accepted by RCON and the admin API
+func readConsole(registry *commands.Registry) {
+	reader := bufio.NewReader(os.Stdin)
+	for {
+		text, err := reader.ReadString('\n')
+		executeCommand(registry, text, commands.ConsoleSource, logWriter{})
+		if err != nil {
+			if err != io.EOF {
+				log.Printf("Could not read the console: %v\n", err)
+			}
+			log.Println("The console was closed, the server is stopped by a signal (e.g. Ctrl+C).")
+			return
+		}
+	}
 }
 
+// writes the log to the standard output and the log file
+// the standard logger serializes the writes, errors of the log file are reported once on the standard error
+// until it can be written again so that a full disk does not stop the server
 type ConsoleFileWriter struct {
-	FileWriter SyncWriter
+	File    io.Writer
+	failing bool
 }
 
-func (consoleFileWriter ConsoleFileWriter) Write(p []byte) (n int, err error) {
-	n, err = consoleFileWriter.FileWriter.Write(p)
-	if err != nil {
-		panic(err)
-		return
-	}
-	err = consoleFileWriter.FileWriter.Sync()
-	if err != nil {
-		panic(err)
-		return
+func (consoleFileWriter *ConsoleFileWriter) Write(p []byte) (n int, err error) {
+	if _, err = consoleFileWriter.File.Write(p); err != nil {
+		if !consoleFileWriter.failing {
+			fmt.Fprintf(os.Stderr, "Could not write the log file: %v\n", err)
+		}
+		consoleFileWriter.failing = true
+	} else {
+		consoleFileWriter.failing = false
 	}
-	n, err = os.Stdout.Write(p)
-	return
+	return os.Stdout.Write(p)
 }
 
-func loadFavicon(config *configuration.ServerConfiguration) string {
-	faviconPath := config.Motd.FaviconPath
-	if faviconPath == "" {
-		return ""
-	}
-	faviconFile, err := os.Open(faviconPath)
+// this method reads the configuration file and the ban lists again and replaces the configuration of the server
+// the address, the log files and the listeners of the metrics and the admin API are only changed by a restart
+func reloadConfiguration(configurationFile string, mcServer *server.Server) error {
+	config, err := configuration.ReadConfiguration(configurationFile)
 	if err != nil {
-		panic(err)
+		return err
 	}
-	faviconBytes, err := ioutil.ReadAll(faviconFile)
-	if err != nil {
-		panic(err)
+	if err = configuration.LoadFavicons(config); err != nil {
+		return err
 	}
-	base64Favicon := base64.RawStdEncoding.EncodeToString(faviconBytes)
-	if err := faviconFile.Close(); err != nil {
-		panic(err)
+	if err = mcServer.BanLists.Reload(); err != nil {
+		return fmt.Errorf("could not reload the ban lists: %v", err)
 	}
-	return "data:image/png;base64," + base64Favicon
+	mcServer.SetConfiguration(config)
+	log.Println("Reloaded the configuration.")
+	return nil
 }
@@ -0,0 +1,399 @@
+package metrics
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"math"
+	"net"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
+)
+
+// this package contains counters, gauges and histograms which are exposed in the Prometheus text format:
+// https://prometheus.io/docs/instrumenting/exposition_formats/#text-based-format
+
+// the content type of the text format
+const ContentType = "text/plain; version=0.0.4; charset=utf-8"
+
+// the maximum amount of label value combinations of a metric, further combinations are counted with the OtherLabelValue
+// it limits the memory which is used by labels that are sent by clients (e.g. the requested hostname)
+const DefaultMaximumSeries = 1000
+
+// the label value which replaces the values of combinations beyond the maximum amount of series
+const OtherLabelValue = "other"
+
+// the registry which is used by the server
+var DefaultRegistry = NewRegistry()
+
+// a metric family which writes its samples in the text format
+type metric interface {
+	name() string
+	write(data *bytes.Buffer)
+}
+
+// a set of metrics which are written together
+type Registry struct {
+	mutex   sync.RWMutex
+	metrics []metric
+	names   map[string]bool
+}
+
+// this method creates an empty registry
+func NewRegistry() *Registry {
+	return &Registry{names: map[string]bool{}}
+}
+
+func (registry *Registry) register(metric metric) {
+	registry.mutex.Lock()
+	defer registry.mutex.Unlock()
+	if registry.names[metric.name()] {
+		panic(fmt.Sprintf("the metric %v is already registered", metric.name()))
+	}
+	registry.names[metric.name()] = true
+	registry.metrics = append(registry.metrics, metric)
+}
+
+// this method writes all metrics of the registry in the text format to the given io.Writer
+// the metrics are sorted by their name, the series of a metric by their label values
+func (registry *Registry) WriteTo(writer io.Writer) (int64, error) {
+	registry.mutex.RLock()
+	metrics := append([]metric{}, registry.metrics...)
+	registry.mutex.RUnlock()
+	sort.Slice(metrics, func(i, j int) bool {
+		return metrics[i].name() < metrics[j].name()
+	})
+	data := bytes.NewBuffer([]byte{})
+	for _, metric := range metrics {
+		metric.write(data)
+	}
+	return data.WriteTo(writer)
+}
+
+// the registry can be used as handler of the HTTP server which is scraped by Prometheus
+func (registry *Registry) ServeHTTP(writer http.ResponseWriter, request *http.Request) {
+	if request.Method != http.MethodGet && request.Method != http.MethodHead {
+		writer.Header().Set("Allow", "GET, HEAD")
+		http.Error(writer, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	writer.Header().Set("Content-Type", ContentType)
+	if request.Method == http.MethodGet {
+		registry.WriteTo(writer)
+	}
+}
+
+// this method serves the metrics of the registry with the given path to the connections of the given listener
+// returns the error which stopped the HTTP server
+func Serve(listener net.Listener, path string, registry *Registry) error {
+	mux := http.NewServeMux()
+	mux.Handle(path, registry)
+	return http.Serve(listener, mux)
+}
+
+// the description and the labels of a metric family
+type family struct {
+	metricName string
+	help       string
+	metricType string
+	labelNames []string
+}
+
+func (family *family) name() string {
+	return family.metricName
+}
+
+func (family *family) writeHeader(data *bytes.Buffer) {
+	fmt.Fprintf(data, "# HELP %v %v\n# TYPE %v %v\n", family.metricName, escapeHelp(family.help), family.metricName, family.metricType)
+}
+
+// this method writes a sample with the given name suffix, label values (and additional labels) and value
+func (family *family) writeSample(data *bytes.Buffer, suffix string, labelValues []string, extraLabel string, extraValue string, value float64) {
+	data.WriteString(family.metricName + suffix)
+	if len(labelValues) > 0 || extraLabel != "" {
+		data.WriteByte('{')
+		for index, labelValue := range labelValues {
+			if index > 0 {
+				data.WriteByte(',')
+			}
+			data.WriteString(family.labelNames[index] + `="` + escapeLabelValue(labelValue) + `"`)
+		}
+		if extraLabel != "" {
+			if len(labelValues) > 0 {
+				data.WriteByte(',')
+			}
+			data.WriteString(extraLabel + `="` + escapeLabelValue(extraValue) + `"`)
+		}
+		data.WriteByte('}')
+	}
+	data.WriteString(" " + formatValue(value) + "\n")
+}
+
+func escapeHelp(help string) string {
+	return strings.NewReplacer(`\`, `\\`, "\n", `\n`).Replace(help)
+}
+
+func escapeLabelValue(value string) string {
+	return strings.NewReplacer(`\`, `\\`, "\n", `\n`, `"`, `\"`).Replace(value)
+}
+
+func formatValue(value float64) string {
+	switch {
+	case math.IsInf(value, 1):
+		return "+Inf"
+	case math.IsInf(value, -1):
+		return "-Inf"
+	case math.IsNaN(value):
+		return "NaN"
+	}
+	return strconv.FormatFloat(value, 'g', -1, 64)
+}
+
+// the series of a metric family, they are created on their first use
+type seriesSet struct {
+	family
+	mutex         sync.RWMutex
+	series        map[string]interface{}
+	labelValues   map[string][]string
+	maximumSeries int
+	newSeries     func() interface{}
+}
+
+func newSeriesSet(family family, newSeries func() interface{}) *seriesSet {
+	return &seriesSet{
+		family:        family,
+		series:        map[string]interface{}{},
+		labelValues:   map[string][]string{},
+		maximumSeries: DefaultMaximumSeries,
+		newSeries:     newSeries,
+	}
+}
+
+// returns the series of the given label values, the values of a new series beyond the maximum are replaced by OtherLabelValue
+func (set *seriesSet) get(labelValues []string) interface{} {
+	if len(labelValues) != len(set.labelNames) {
+		panic(fmt.Sprintf("the metric %v has %v labels but got %v values", set.metricName, len(set.labelNames), len(labelValues)))
+	}
+	key := strings.Join(labelValues, "\xff")
+	set.mutex.RLock()
+	series, found := set.series[key]
+	set.mutex.RUnlock()
+	if found {
+		return series
+	}
+	set.mutex.Lock()
+	defer set.mutex.Unlock()
+	if series, found = set.series[key]; found {
+		return series
+	}
+	if len(set.series) >= set.maximumSeries {
+		otherValues := make([]string, len(labelValues))
+		for index := range otherValues {
+			otherValues[index] = OtherLabelValue
+		}
+		labelValues, key = otherValues, strings.Join(otherValues, "\xff")
+		if series, found = set.series[key]; found {
+			return series
+		}
+	}
+	series = set.newSeries()
+	set.series[key] = series
+	set.labelValues[key] = append([]string{}, labelValues...)
+	return series
+}
+
+// calls the given function for every series sorted by their label values
+func (set *seriesSet) each(function func(labelValues []string, series interface{})) {
+	set.mutex.RLock()
+	keys := make([]string, 0, len(set.series))
+	for key := range set.series {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	entries := make([]interface{}, len(keys))
+	labelValues := make([][]string, len(keys))
+	for index, key := range keys {
+		entries[index], labelValues[index] = set.series[key], set.labelValues[key]
+	}
+	set.mutex.RUnlock()
+	for index := range entries {
+		function(labelValues[index], entries[index])
+	}
+}
+
+// a value which only increases (e.g. the amount of accepted connections)
+type Counter struct {
+	value uint64
+}
+
+// this method increases the counter by one
+func (counter *Counter) Inc() {
+	atomic.AddUint64(&counter.value, 1)
+}
+
+// this method increases the counter by the given amount
+func (counter *Counter) Add(amount uint64) {
+	atomic.AddUint64(&counter.value, amount)
+}
+
+// returns the current value of the counter
+func (counter *Counter) Value() uint64 {
+	return atomic.LoadUint64(&counter.value)
+}
+
+// a counter which is split by labels
+type CounterVec struct {
+	set *seriesSet
+}
+
+// this method registers a counter without labels
+func (registry *Registry) NewCounter(name, help string) *Counter {
+	return registry.NewCounterVec(name, help).WithLabelValues()
+}
+
+// this method registers a counter with the given labels
+func (registry *Registry) NewCounterVec(name, help string, labelNames ...string) *CounterVec {
+	counterVec := &CounterVec{newSeriesSet(family{name, help, "counter", labelNames}, func() interface{} { return &Counter{} })}
+	registry.register(counterVec)
+	return counterVec
+}
+
+// returns the counter of the given label values (in the order of the label names)
+func (counterVec *CounterVec) WithLabelValues(labelValues ...string) *Counter {
+	return counterVec.set.get(labelValues).(*Counter)
+}
+
+// returns the sum of the counters of all label values
+func (counterVec *CounterVec) Sum() (sum uint64) {
+	counterVec.set.each(func(_ []string, series interface{}) {
+		sum += series.(*Counter).Value()
+	})
+	return sum
+}
+
+func (counterVec *CounterVec) name() string {
+	return counterVec.set.metricName
+}
+
+func (counterVec *CounterVec) write(data *bytes.Buffer) {
+	counterVec.set.writeHeader(data)
+	counterVec.set.each(func(labelValues []string, series interface{}) {
+		counterVec.set.writeSample(data, "", labelValues, "", "", float64(series.(*Counter).Value()))
+	})
+}
+
+// a value which can go up and down (e.g. the amount of active connections)
+type Gauge struct {
+	value int64
+}
+
+// this method increases the gauge by one
+func (gauge *Gauge) Inc() {
+	atomic.AddInt64(&gauge.value, 1)
+}
+
+// this method decreases the gauge by one
+func (gauge *Gauge) Dec() {
+	atomic.AddInt64(&gauge.value, -1)
+}
+
+// this method sets the gauge to the given value
+func (gauge *Gauge) Set(value int64) {
+	atomic.StoreInt64(&gauge.value, value)
+}
+
+// returns the current value of the gauge
+func (gauge *Gauge) Value() int64 {
+	return atomic.LoadInt64(&gauge.value)
+}
+
+type gaugeFamily struct {
+	family
+	gauge *Gauge
+}
+
+// this method registers a gauge without labels
+func (registry *Registry) NewGauge(name, help string) *Gauge {
+	gaugeFamily := &gaugeFamily{family{name, help, "gauge", nil}, &Gauge{}}
+	registry.register(gaugeFamily)
+	return gaugeFamily.gauge
+}
+
+func (gaugeFamily *gaugeFamily) write(data *bytes.Buffer) {
+	gaugeFamily.writeHeader(data)
+	gaugeFamily.writeSample(data, "", nil, "", "", float64(gaugeFamily.gauge.Value()))
+}
+
+// the default buckets of histograms which measure durations in seconds
+var DefaultDurationBuckets = []float64{0.0005, 0.001, 0.0025, 0.005, 0.01, 0.025, 0.05, 0.1, 0.25, 0.5, 1, 2.5, 5, 10}
+
+// a histogram which counts the observed values in buckets (e.g. the durations of the packet handlers)
+type Histogram struct {
+	mutex   sync.Mutex
+	buckets []float64
+	counts  []uint64
+	count   uint64
+	sum     float64
+}
+
+// this method counts the given value in the buckets it fits in
+func (histogram *Histogram) Observe(value float64) {
+	index := sort.SearchFloat64s(histogram.buckets, value)
+	histogram.mutex.Lock()
+	defer histogram.mutex.Unlock()
+	if index < len(histogram.counts) {
+		histogram.counts[index]++
+	}
+	histogram.count++
+	histogram.sum += value
+}
+
+// a histogram which is split by labels
+type HistogramVec struct {
+	set *seriesSet
+}
+
+// this method registers a histogram with the given (sorted) upper bounds of the buckets and the given labels
+func (registry *Registry) NewHistogramVec(name, help string, buckets []float64, labelNames ...string) *HistogramVec {
+	if !sort.Float64sAreSorted(buckets) {
+		panic(fmt.Sprintf("the buckets of the histogram %v are not sorted", name))
+	}
+	histogramVec := &HistogramVec{newSeriesSet(family{name, help, "histogram", labelNames}, func() interface{} {
+		return &Histogram{buckets: buckets, counts: make([]uint64, len(buckets))}
+	})}
+	registry.register(histogramVec)
+	return histogramVec
+}
+
+// returns the histogram of the given label values (in the order of the label names)
+func (histogramVec *HistogramVec) WithLabelValues(labelValues ...string) *Histogram {
+	return histogramVec.set.get(labelValues).(*Histogram)
+}
+
+func (histogramVec *HistogramVec) name() string {
+	return histogramVec.set.metricName
+}
+
+func (histogramVec *HistogramVec) write(data *bytes.Buffer) {
+	set := histogramVec.set
+	set.writeHeader(data)
+	set.each(func(labelValues []string, series interface{}) {
+		histogram := series.(*Histogram)
+		histogram.mutex.Lock()
+		counts, count, sum := append([]uint64{}, histogram.counts...), histogram.count, histogram.sum
+		histogram.mutex.Unlock()
+		// the buckets are cumulative
+		cumulative := uint64(0)
+		for index, upperBound := range histogram.buckets {
+			cumulative += counts[index]
+			set.writeSample(data, "_bucket", labelValues, "le", formatValue(upperBound), float64(cumulative))
+		}
+		set.writeSample(data, "_bucket", labelValues, "le", "+Inf", float64(count))
+		set.writeSample(data, "_sum", labelValues, "", "", sum)
+		set.writeSample(data, "_count", labelValues, "", "", float64(count))
+	})
+}
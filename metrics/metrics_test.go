@@ -0,0 +1,101 @@
+package metrics
+
+import (
+	"bytes"
+	"io/ioutil"
+	"net"
+	"net/http"
+	"strconv"
+	"testing"
+)
+
+func TestTextFormatGolden(t *testing.T) {
+	registry := NewRegistry()
+	registry.NewCounter("test_requests_total", "Requests.").Add(3)
+	closed := registry.NewCounterVec("test_closed_total", "Closed connections\nby reason.", "reason")
+	closed.WithLabelValues("timeout").Inc()
+	closed.WithLabelValues(`say "hi"\`).Inc()
+	closed.WithLabelValues("eof").Add(2)
+	gauge := registry.NewGauge("test_active", "Active connections.")
+	gauge.Inc()
+	gauge.Inc()
+	gauge.Dec()
+	histogram := registry.NewHistogramVec("test_duration_seconds", "Durations.", []float64{0.1, 1}, "packet")
+	histogram.WithLabelValues("Ping").Observe(0.05)
+	histogram.WithLabelValues("Ping").Observe(0.5)
+	histogram.WithLabelValues("Ping").Observe(2)
+	const golden = `# HELP test_active Active connections.
+# TYPE test_active gauge
+test_active 1
+# HELP test_closed_total Closed connections\nby reason.
+# TYPE test_closed_total counter
+test_closed_total{reason="eof"} 2
+test_closed_total{reason="say \"hi\"\\"} 1
+test_closed_total{reason="timeout"} 1
+# HELP test_duration_seconds Durations.
+# TYPE test_duration_seconds histogram
+test_duration_seconds_bucket{packet="Ping",le="0.1"} 1
+test_duration_seconds_bucket{packet="Ping",le="1"} 2
+test_duration_seconds_bucket{packet="Ping",le="+Inf"} 3
+test_duration_seconds_sum{packet="Ping"} 2.55
+test_duration_seconds_count{packet="Ping"} 3
+# HELP test_requests_total Requests.
+# TYPE test_requests_total counter
+test_requests_total 3
+`
+	buffer := bytes.NewBuffer([]byte{})
+	if _, err := registry.WriteTo(buffer); err != nil {
+		t.Fatal(err)
+	}
+	if buffer.String() != golden {
+		t.Errorf("the metrics were written as\n%v\ninstead of\n%v", buffer.String(), golden)
+	}
+}
+
+func TestMaximumSeries(t *testing.T) {
+	registry := NewRegistry()
+	hostnames := registry.NewCounterVec("test_hostnames_total", "Hostnames.", "hostname")
+	for index := 0; index < DefaultMaximumSeries+10; index++ {
+		hostnames.WithLabelValues(strconv.Itoa(index)).Inc()
+	}
+	if value := hostnames.WithLabelValues(OtherLabelValue).Value(); value != 10 {
+		t.Errorf("the series beyond the maximum were counted as %v instead of 10", value)
+	}
+	if value := hostnames.WithLabelValues("0").Value(); value != 1 {
+		t.Errorf("an existing series was counted as %v", value)
+	}
+}
+
+func TestDuplicateRegistration(t *testing.T) {
+	registry := NewRegistry()
+	registry.NewCounter("test_total", "Test.")
+	defer func() {
+		if recover() == nil {
+			t.Error("a metric was registered twice")
+		}
+	}()
+	registry.NewGauge("test_total", "Test.")
+}
+
+func TestServe(t *testing.T) {
+	registry := NewRegistry()
+	registry.NewCounter("test_total", "Test.").Inc()
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer listener.Close()
+	go Serve(listener, "/metrics", registry)
+	response, err := http.Get("http://" + listener.Addr().String() + "/metrics")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer response.Body.Close()
+	body, _ := ioutil.ReadAll(response.Body)
+	if response.StatusCode != http.StatusOK || response.Header.Get("Content-Type") != ContentType {
+		t.Errorf("the metrics were served with the status %v and the content type %v", response.Status, response.Header.Get("Content-Type"))
+	}
+	if !bytes.Contains(body, []byte("\ntest_total 1\n")) {
+		t.Errorf("the served metrics do not contain the counter:\n%s", body)
+	}
+}
@@ -0,0 +1,259 @@
+package protocol
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"sort"
+	"sync"
+)
+
+// this file contains the protocol versions of the Minecraft releases (http://wiki.vg/Protocol_version_numbers)
+
+// protocol versions which introduced the features and changed the layouts of the packets
+// the packet ids and layouts are fixed by the protocol version
+const (
+	// 1.8 prefixes the byte arrays of the encryption packets with a VarInt instead of a short
+	VarIntByteArraysVersion = 47
+	// 1.16 added hex colors to text components
+	HexColorsVersion = 735
+	// 1.16 sends the uuid of the Login Success packet as 16 bytes instead of a string
+	BinaryUuidVersion = 735
+	// 1.19 added the signature of the chat key to the Login Start packet, the signed salt to the Encryption Response
+	// and the profile properties to the Login Success packet
+	ChatKeyVersion = 759
+	// 1.19.1 clients may send their uuid in the Login Start packet
+	LoginStartUuidVersion = 760
+	// 1.19.3 removed the signature of the chat key and the signed salt again
+	ChatKeyRemovedVersion = 761
+	// 1.20.2 added the configuration state and made the uuid of the Login Start packet mandatory
+	ConfigurationStateVersion = 764
+	// 1.20.3 sends text components as NBT instead of JSON strings
+	NbtTextComponentsVersion = 765
+	// 1.20.5 added cookies, the Transfer packet, the should authenticate flag of the Encryption Request
+	// and the strict error handling flag of the Login Success packet
+	TransferVersion = 766
+	// 1.21.2 removed the strict error handling flag of the Login Success packet
+	StrictErrorHandlingRemovedVersion = 768
+)
+
+// the features of a protocol version
+// the features which change the layouts of the packets are derived from the protocol number, the versions file may only
+// override the features which can be honored for every protocol version (see overridableFeatures)
+type Features struct {
+	HexColors bool `json:"hex-colors"`
+	// the client may send its uuid in the Login Start packet
+	LoginStartUuid     bool `json:"login-start-uuid"`
+	ConfigurationState bool `json:"configuration-state"`
+	Transfer           bool `json:"transfer"`
+	NbtTextComponents  bool `json:"nbt-text-components"`
+	// the release was published before the netty rewrite (1.7), its clients ping with the legacy ping
+	LegacyPing bool `json:"legacy-ping"`
+}
+
+// the features which can be overridden by the versions file and their fields
+// hex colors only change how texts are rendered, the legacy ping is only known for the listed releases
+var overridableFeatures = map[string]func(features *Features) *bool{
+	"hex-colors":  func(features *Features) *bool { return &features.HexColors },
+	"legacy-ping": func(features *Features) *bool { return &features.LegacyPing },
+}
+
+// a protocol version and the name of the latest release which uses it
+type Version struct {
+	Protocol int      `json:"protocol"`
+	Name     string   `json:"name"`
+	Features Features `json:"features"`
+}
+
+// the name of protocol versions which are not known
+const UnknownName = "unknown"
+
+var versions = struct {
+	sync.RWMutex
+	byProtocol map[int]Version
+}{byProtocol: map[int]Version{}}
+
+func init() {
+	for protocol, name := range releases {
+		versions.byProtocol[protocol] = Version{protocol, name, DefaultFeatures(protocol)}
+	}
+	for protocol, name := range legacyReleases {
+		features := DefaultFeatures(protocol)
+		features.LegacyPing = true
+		versions.byProtocol[protocol] = Version{protocol, name, features}
+	}
+}
+
+// the protocol versions of the releases since the netty rewrite (1.7)
+var releases = map[int]string{
+	4:   "1.7.5",
+	5:   "1.7.10",
+	47:  "1.8.9",
+	107: "1.9",
+	108: "1.9.1",
+	109: "1.9.2",
+	110: "1.9.4",
+	210: "1.10.2",
+	315: "1.11",
+	316: "1.11.2",
+	335: "1.12",
+	338: "1.12.1",
+	340: "1.12.2",
+	393: "1.13",
+	401: "1.13.1",
+	404: "1.13.2",
+	477: "1.14",
+	480: "1.14.1",
+	485: "1.14.2",
+	490: "1.14.3",
+	498: "1.14.4",
+	573: "1.15",
+	575: "1.15.1",
+	578: "1.15.2",
+	735: "1.16",
+	736: "1.16.1",
+	751: "1.16.2",
+	753: "1.16.3",
+	754: "1.16.5",
+	755: "1.17",
+	756: "1.17.1",
+	757: "1.18.1",
+	758: "1.18.2",
+	759: "1.19",
+	760: "1.19.2",
+	761: "1.19.3",
+	762: "1.19.4",
+	763: "1.20.1",
+	764: "1.20.2",
+	765: "1.20.4",
+	766: "1.20.6",
+	767: "1.21.1",
+	768: "1.21.3",
+	769: "1.21.4",
+	770: "1.21.5",
+	771: "1.21.6",
+	772: "1.21.8",
+}
+
+// the protocol versions of the releases before the netty rewrite which use the legacy ping
+// 1.4.2 is missing because its protocol version (47) is used by 1.8 as well
+var legacyReleases = map[int]string{
+	49: "1.4.5",
+	51: "1.4.7",
+	60: "1.5.1",
+	61: "1.5.2",
+	73: "1.6.1",
+	74: "1.6.2",
+	78: "1.6.4",
+}
+
+// this method returns the features of a protocol version which are derived from its number
+// it is used for versions which are not listed (e.g. newer releases) and the entries of the versions file
+// the legacy ping is only derived for the listed releases because the numbers of the legacy releases are reused by snapshots
+func DefaultFeatures(protocol int) Features {
+	return Features{
+		HexColors:          protocol >= HexColorsVersion,
+		LoginStartUuid:     protocol >= LoginStartUuidVersion,
+		ConfigurationState: protocol >= ConfigurationStateVersion,
+		Transfer:           protocol >= TransferVersion,
+		NbtTextComponents:  protocol >= NbtTextComponentsVersion,
+	}
+}
+
+// this method searches the given protocol version
+func Lookup(protocol int) (Version, bool) {
+	versions.RLock()
+	defer versions.RUnlock()
+	version, found := versions.byProtocol[protocol]
+	return version, found
+}
+
+// returns the release name of the given protocol version or UnknownName
+func Name(protocol int) string {
+	if version, found := Lookup(protocol); found {
+		return version.Name
+	}
+	return UnknownName
+}
+
+// returns the release name and the number of the given protocol version for log messages, e.g. "1.20.1 (763)"
+func Describe(protocol int) string {
+	return fmt.Sprintf("%v (%v)", Name(protocol), protocol)
+}
+
+// returns the features of the given protocol version
+// versions which are not known get the default features
+func FeaturesOf(protocol int) Features {
+	if version, found := Lookup(protocol); found {
+		return version.Features
+	}
+	return DefaultFeatures(protocol)
+}
+
+// returns all known protocol versions sorted by their number
+func Versions() []Version {
+	versions.RLock()
+	defer versions.RUnlock()
+	list := make([]Version, 0, len(versions.byProtocol))
+	for _, version := range versions.byProtocol {
+		list = append(list, version)
+	}
+	sort.Slice(list, func(i, j int) bool {
+		return list[i].Protocol < list[j].Protocol
+	})
+	return list
+}
+
+// an entry of the versions file, the features are optional and override the default features per key
+type versionEntry struct {
+	Protocol int             `json:"protocol"`
+	Name     string          `json:"name"`
+	Features map[string]bool `json:"features,omitempty"`
+}
+
+// the error which is thrown if an entry of the versions file is not valid
+type ErrInvalidVersionEntry struct {
+	Index  int
+	Reason string
+}
+
+func (errInvalidVersionEntry ErrInvalidVersionEntry) Error() string {
+	return fmt.Sprintf("invalid protocol version entry at index %v: %v", errInvalidVersionEntry.Index, errInvalidVersionEntry.Reason)
+}
+
+// this method loads the protocol versions of the given JSON file which add or override the known versions
+// the file contains an array of objects with the protocol, name and optional features, e.g.
+// [{"protocol": 773, "name": "1.21.10", "features": {"hex-colors": true}}]
+// the entries get the default features of their protocol version, the listed features override them
+func LoadVersions(path string) error {
+	file, err := os.Open(path)
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+	var entries []versionEntry
+	if err = json.NewDecoder(file).Decode(&entries); err != nil {
+		return err
+	}
+	loaded := make([]Version, 0, len(entries))
+	for index, entry := range entries {
+		if entry.Name == "" {
+			return ErrInvalidVersionEntry{index, "the name is missing"}
+		}
+		version := Version{entry.Protocol, entry.Name, DefaultFeatures(entry.Protocol)}
+		for name, enabled := range entry.Features {
+			feature, overridable := overridableFeatures[name]
+			if !overridable {
+				return ErrInvalidVersionEntry{index, fmt.Sprintf("the feature %q can not be overridden", name)}
+			}
+			*feature(&version.Features) = enabled
+		}
+		loaded = append(loaded, version)
+	}
+	versions.Lock()
+	defer versions.Unlock()
+	for _, version := range loaded {
+		versions.byProtocol[version.Protocol] = version
+	}
+	return nil
+}
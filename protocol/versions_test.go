@@ -0,0 +1,134 @@
+package protocol
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+// this method restores the known versions after a test which loaded a versions file
+func restoreVersions(t *testing.T) {
+	versions.RLock()
+	known := make(map[int]Version, len(versions.byProtocol))
+	for protocol, version := range versions.byProtocol {
+		known[protocol] = version
+	}
+	versions.RUnlock()
+	t.Cleanup(func() {
+		versions.Lock()
+		defer versions.Unlock()
+		versions.byProtocol = known
+	})
+}
+
+func writeVersionsFile(t *testing.T, content string) string {
+	path := filepath.Join(t.TempDir(), "versions.json")
+	if err := os.WriteFile(path, []byte(content), 0644); err != nil {
+		t.Fatal(err)
+	}
+	return path
+}
+
+func TestNameAndFeatures(t *testing.T) {
+	latest := Features{HexColors: true, LoginStartUuid: true, ConfigurationState: true, Transfer: true, NbtTextComponents: true}
+	for _, test := range []struct {
+		protocol int
+		name     string
+		features Features
+	}{
+		{47, "1.8.9", Features{}},
+		{78, "1.6.4", Features{LegacyPing: true}},
+		{340, "1.12.2", Features{}},
+		{734, UnknownName, Features{}},
+		{735, "1.16", Features{HexColors: true}},
+		{759, "1.19", Features{HexColors: true}},
+		{760, "1.19.2", Features{HexColors: true, LoginStartUuid: true}},
+		{763, "1.20.1", Features{HexColors: true, LoginStartUuid: true}},
+		{764, "1.20.2", Features{HexColors: true, LoginStartUuid: true, ConfigurationState: true}},
+		{765, "1.20.4", Features{HexColors: true, LoginStartUuid: true, ConfigurationState: true, NbtTextComponents: true}},
+		{766, "1.20.6", latest},
+		{767, "1.21.1", latest},
+		// versions which are not known get the default features of newer releases
+		{1000000, UnknownName, latest},
+		{-1, UnknownName, Features{}},
+	} {
+		if name := Name(test.protocol); name != test.name {
+			t.Errorf("%v: the name is %q instead of %q", test.protocol, name, test.name)
+		}
+		if features := FeaturesOf(test.protocol); features != test.features {
+			t.Errorf("%v: the features are %+v instead of %+v", test.protocol, features, test.features)
+		}
+	}
+	if description := Describe(763); description != "1.20.1 (763)" {
+		t.Errorf("763 was described as %q", description)
+	}
+}
+
+func TestVersionsAreSorted(t *testing.T) {
+	list := Versions()
+	for index := 1; index < len(list); index++ {
+		if list[index-1].Protocol >= list[index].Protocol {
+			t.Fatalf("%v is listed before %v", list[index-1].Protocol, list[index].Protocol)
+		}
+	}
+}
+
+func TestLoadVersions(t *testing.T) {
+	restoreVersions(t)
+	path := writeVersionsFile(t, `[
+		{"protocol": 773, "name": "1.21.10"},
+		{"protocol": 767, "name": "1.21", "features": {"hex-colors": false}},
+		{"protocol": 1073742000, "name": "25w41a", "features": {}},
+		{"protocol": 30, "name": "1.2.5", "features": {"legacy-ping": true}}
+	]`)
+	if err := LoadVersions(path); err != nil {
+		t.Fatal(err)
+	}
+	latest := Features{HexColors: true, LoginStartUuid: true, ConfigurationState: true, Transfer: true, NbtTextComponents: true}
+	for _, test := range []struct {
+		protocol int
+		name     string
+		features Features
+	}{
+		// the features are derived from the protocol number if they are left out
+		{773, "1.21.10", latest},
+		{1073742000, "25w41a", latest},
+		// the listed features override the derived features, the others keep their values
+		{767, "1.21", Features{LoginStartUuid: true, ConfigurationState: true, Transfer: true, NbtTextComponents: true}},
+		{30, "1.2.5", Features{LegacyPing: true}},
+		// other versions keep their values
+		{766, "1.20.6", latest},
+	} {
+		if version, found := Lookup(test.protocol); !found || version.Name != test.name || version.Features != test.features {
+			t.Errorf("%v: loaded %+v (%v) instead of %v %+v", test.protocol, version, found, test.name, test.features)
+		}
+	}
+}
+
+func TestLoadInvalidVersions(t *testing.T) {
+	restoreVersions(t)
+	path := writeVersionsFile(t, `[{"protocol": 773, "name": "1.21.10"}, {"protocol": 774}]`)
+	if err, isInvalidEntry := LoadVersions(path).(ErrInvalidVersionEntry); !isInvalidEntry || err.Index != 1 {
+		t.Errorf("loaded an entry without name: %v", err)
+	}
+	// the valid entries of an invalid file are not loaded
+	if _, found := Lookup(773); found {
+		t.Error("an entry of the invalid file was loaded")
+	}
+	// the features which change the layouts of the packets follow the protocol number
+	for _, feature := range []string{"nbt-text-components", "login-start-uuid", "configuration-state", "transfer", "unknown"} {
+		path = writeVersionsFile(t, `[{"protocol": 773, "name": "1.21.10", "features": {"`+feature+`": false}}]`)
+		if _, isInvalidEntry := LoadVersions(path).(ErrInvalidVersionEntry); !isInvalidEntry {
+			t.Errorf("loaded an entry which overrides the feature %v", feature)
+		}
+	}
+	if FeaturesOf(773) != DefaultFeatures(773) {
+		t.Errorf("the features of 773 were overridden: %+v", FeaturesOf(773))
+	}
+	if err := LoadVersions(writeVersionsFile(t, `{"protocol": 773}`)); err == nil {
+		t.Error("loaded a file which is not an array")
+	}
+	if err := LoadVersions(filepath.Join(t.TempDir(), "missing.json")); !os.IsNotExist(err) {
+		t.Errorf("loading a missing file returned %v", err)
+	}
+}
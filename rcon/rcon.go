@@ -0,0 +1,233 @@
+package rcon
+
+import (
+	"bufio"
+	"bytes"
+	"crypto/subtle"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"net"
+	"sync"
+	"time"
+	"unicode/utf8"
+)
+
+// this package contains a server for the Source RCON protocol which is also used by the vanilla server
+// (https://developer.valvesoftware.com/wiki/Source_RCON_Protocol)
+
+// the types of the packets, the auth response and the exec command share their value
+const (
+	TypeResponseValue int32 = 0
+	TypeExecCommand   int32 = 2
+	TypeAuthResponse  int32 = 2
+	TypeAuth          int32 = 3
+)
+
+// the maximum length of the body of a response packet, longer responses are split into multiple packets like by the vanilla server
+const MaximumResponseLength = 4096
+
+// the maximum length of a received packet (request id, type, body and its two null bytes)
+const maximumPacketLength = 4 + 4 + MaximumResponseLength + 2
+
+// the request id of the auth response which is sent if the password was wrong
+const authFailureId int32 = -1
+
+// the time in which a client has to send the password
+const authenticationTimeout = 10 * time.Second
+
+// a packet of the RCON protocol which is sent with its length as little endian integers
+type Packet struct {
+	RequestId int32
+	Type      int32
+	Body      string
+}
+
+// the error which is returned if a received packet is too short or too long
+var ErrInvalidPacketLength = errors.New("invalid packet length")
+
+// this method reads a packet, the body is terminated by a null byte
+func ReadPacket(reader io.Reader) (Packet, error) {
+	var length int32
+	if err := binary.Read(reader, binary.LittleEndian, &length); err != nil {
+		return Packet{}, err
+	}
+	if length < 4+4+2 || length > maximumPacketLength {
+		return Packet{}, ErrInvalidPacketLength
+	}
+	data := make([]byte, length)
+	if _, err := io.ReadFull(reader, data); err != nil {
+		if err == io.EOF {
+			err = io.ErrUnexpectedEOF
+		}
+		return Packet{}, err
+	}
+	body := data[8:]
+	if end := bytes.IndexByte(body, 0); end >= 0 {
+		body = body[:end]
+	}
+	return Packet{
+		RequestId: int32(binary.LittleEndian.Uint32(data[0:4])),
+		Type:      int32(binary.LittleEndian.Uint32(data[4:8])),
+		Body:      string(body),
+	}, nil
+}
+
+// this method writes the given packet with a single write
+func WritePacket(writer io.Writer, packet Packet) error {
+	data := make([]byte, 4+4+4+len(packet.Body)+2)
+	binary.LittleEndian.PutUint32(data[0:4], uint32(4+4+len(packet.Body)+2))
+	binary.LittleEndian.PutUint32(data[4:8], uint32(packet.RequestId))
+	binary.LittleEndian.PutUint32(data[8:12], uint32(packet.Type))
+	copy(data[12:], packet.Body)
+	_, err := writer.Write(data)
+	return err
+}
+
+// executes a command of an authenticated client and returns its output
+type Executor func(command string, remoteAddress net.Addr) string
+
+// a server which executes the commands of the clients which sent the password
+type Server struct {
+	password    string
+	execute     Executor
+	mutex       sync.Mutex
+	listener    net.Listener
+	connections map[net.Conn]struct{}
+	closed      bool
+}
+
+// this method creates a server which executes the commands with the given executor
+// returns an error if the password is empty (the vanilla server does not start RCON without password either)
+func NewServer(password string, execute Executor) (*Server, error) {
+	if password == "" {
+		return nil, fmt.Errorf("RCON needs a password")
+	}
+	return &Server{password: password, execute: execute, connections: map[net.Conn]struct{}{}}, nil
+}
+
+// this method accepts the clients of the given listener until the server is closed
+// returns nil if the server was closed or the error which stopped accepting clients
+func (server *Server) Serve(listener net.Listener) error {
+	server.mutex.Lock()
+	if server.closed {
+		server.mutex.Unlock()
+		return listener.Close()
+	}
+	server.listener = listener
+	server.mutex.Unlock()
+	for {
+		conn, err := listener.Accept()
+		if err != nil {
+			server.mutex.Lock()
+			defer server.mutex.Unlock()
+			if server.closed {
+				return nil
+			}
+			return err
+		}
+		server.mutex.Lock()
+		if server.closed {
+			conn.Close()
+		} else {
+			server.connections[conn] = struct{}{}
+			go server.handle(conn)
+		}
+		server.mutex.Unlock()
+	}
+}
+
+// this method stops accepting clients and closes the connected clients
+func (server *Server) Close() (err error) {
+	server.mutex.Lock()
+	defer server.mutex.Unlock()
+	server.closed = true
+	if server.listener != nil {
+		err = server.listener.Close()
+	}
+	for conn := range server.connections {
+		conn.Close()
+	}
+	return err
+}
+
+// this method answers the packets of a client until it disconnects
+// a client which sends a wrong password or a command before the password is disconnected
+func (server *Server) handle(conn net.Conn) {
+	defer func() {
+		conn.Close()
+		server.mutex.Lock()
+		delete(server.connections, conn)
+		server.mutex.Unlock()
+	}()
+	reader := bufio.NewReader(conn)
+	authenticated := false
+	conn.SetReadDeadline(time.Now().Add(authenticationTimeout))
+	for {
+		packet, err := ReadPacket(reader)
+		if err != nil {
+			if err != io.EOF && !server.isClosed() {
+				log.Printf("[%v] Could not read RCON packet: %v\n", conn.RemoteAddr(), err)
+			}
+			return
+		}
+		switch {
+		case packet.Type == TypeAuth:
+			if subtle.ConstantTimeCompare([]byte(packet.Body), []byte(server.password)) != 1 {
+				log.Printf("[%v] RCON client sent a wrong password.\n", conn.RemoteAddr())
+				WritePacket(conn, Packet{authFailureId, TypeAuthResponse, ""})
+				return
+			}
+			authenticated = true
+			conn.SetReadDeadline(time.Time{})
+			log.Printf("[%v] RCON client authenticated.\n", conn.RemoteAddr())
+			err = WritePacket(conn, Packet{packet.RequestId, TypeAuthResponse, ""})
+		case !authenticated:
+			WritePacket(conn, Packet{authFailureId, TypeAuthResponse, ""})
+			return
+		case packet.Type == TypeExecCommand:
+			err = writeResponse(conn, packet.RequestId, server.execute(packet.Body, conn.RemoteAddr()))
+		case packet.Type == TypeResponseValue:
+			// clients send an empty response value after a command to find the end of a multi-packet response, it is mirrored
+			err = WritePacket(conn, Packet{packet.RequestId, TypeResponseValue, ""})
+		default:
+			err = WritePacket(conn, Packet{packet.RequestId, TypeResponseValue, fmt.Sprintf("Unknown request %x", packet.Type)})
+		}
+		if err != nil {
+			return
+		}
+	}
+}
+
+func (server *Server) isClosed() bool {
+	server.mutex.Lock()
+	defer server.mutex.Unlock()
+	return server.closed
+}
+
+// this method writes the output of a command as response packets with the request id of the command
+// the output is split into packets of the maximum response length (an empty output is sent as a single empty packet)
+// the packets end before a character which does not fit completely, so that every packet is valid UTF-8
+func writeResponse(writer io.Writer, requestId int32, output string) error {
+	for {
+		length := len(output)
+		if length > MaximumResponseLength {
+			length = MaximumResponseLength
+			// an invalid output without the start of a character is split at the maximum length
+			for back := 1; back < utf8.UTFMax && !utf8.RuneStart(output[length]); back++ {
+				length--
+			}
+			if !utf8.RuneStart(output[length]) {
+				length = MaximumResponseLength
+			}
+		}
+		if err := WritePacket(writer, Packet{requestId, TypeResponseValue, output[:length]}); err != nil {
+			return err
+		}
+		if output = output[length:]; output == "" {
+			return nil
+		}
+	}
+}
@@ -0,0 +1,136 @@
+package rcon
+
+import (
+	"bufio"
+	"bytes"
+	"net"
+	"strings"
+	"testing"
+	"unicode/utf8"
+)
+
+const testPassword = "secret"
+
+// this method starts a server which answers the commands with their repeated text and connects to it
+func startTestServer(t *testing.T) (net.Conn, *bufio.Reader) {
+	server, err := NewServer(testPassword, func(command string, remoteAddress net.Addr) string {
+		if command == "long" {
+			return strings.Repeat("a", MaximumResponseLength+10)
+		}
+		return "executed " + command
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	go server.Serve(listener)
+	t.Cleanup(func() {
+		server.Close()
+	})
+	conn, err := net.Dial("tcp", listener.Addr().String())
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() {
+		conn.Close()
+	})
+	return conn, bufio.NewReader(conn)
+}
+
+// this method sends the given packet and returns the next received packet
+func exchange(t *testing.T, conn net.Conn, reader *bufio.Reader, packet Packet) Packet {
+	t.Helper()
+	if err := WritePacket(conn, packet); err != nil {
+		t.Fatal(err)
+	}
+	response, err := ReadPacket(reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return response
+}
+
+func TestNewServer(t *testing.T) {
+	if _, err := NewServer("", nil); err == nil {
+		t.Error("a server without a password was created")
+	}
+}
+
+func TestAuthentication(t *testing.T) {
+	conn, reader := startTestServer(t)
+	if response := exchange(t, conn, reader, Packet{1, TypeExecCommand, "list"}); response.RequestId != authFailureId {
+		t.Errorf("a command without authentication was answered with %+v", response)
+	}
+	conn, reader = startTestServer(t)
+	if response := exchange(t, conn, reader, Packet{2, TypeAuth, "wrong"}); response.RequestId != authFailureId || response.Type != TypeAuthResponse {
+		t.Errorf("a wrong password was answered with %+v", response)
+	}
+	if _, err := ReadPacket(reader); err == nil {
+		t.Error("the connection was not closed after a wrong password")
+	}
+}
+
+func TestCommands(t *testing.T) {
+	conn, reader := startTestServer(t)
+	if response := exchange(t, conn, reader, Packet{3, TypeAuth, testPassword}); response.RequestId != 3 || response.Type != TypeAuthResponse {
+		t.Fatalf("the password was answered with %+v", response)
+	}
+	if response := exchange(t, conn, reader, Packet{4, TypeExecCommand, "banlist"}); response != (Packet{4, TypeResponseValue, "executed banlist"}) {
+		t.Errorf("the command was answered with %+v", response)
+	}
+	// the end of a multi-packet response is found by the mirrored empty response value
+	if err := WritePacket(conn, Packet{5, TypeExecCommand, "long"}); err != nil {
+		t.Fatal(err)
+	}
+	if err := WritePacket(conn, Packet{6, TypeResponseValue, ""}); err != nil {
+		t.Fatal(err)
+	}
+	output := ""
+	for {
+		response, err := ReadPacket(reader)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if response.RequestId == 6 {
+			break
+		} else if response.RequestId != 5 || len(response.Body) > MaximumResponseLength {
+			t.Fatalf("received an unexpected packet: %+v", response)
+		}
+		output += response.Body
+	}
+	if output != strings.Repeat("a", MaximumResponseLength+10) {
+		t.Errorf("received a response with %v bytes", len(output))
+	}
+}
+
+func TestResponseSplitsAtCharacters(t *testing.T) {
+	for _, output := range []string{
+		// the two bytes of the character would be split by the maximum length
+		strings.Repeat("a", MaximumResponseLength-1) + "ä" + "b",
+		strings.Repeat("a", MaximumResponseLength-2) + "😀" + "b",
+		strings.Repeat("€", MaximumResponseLength),
+		// an invalid output is still split
+		strings.Repeat("\x80", MaximumResponseLength+10),
+	} {
+		data := bytes.NewBuffer([]byte{})
+		if err := writeResponse(data, 7, output); err != nil {
+			t.Fatal(err)
+		}
+		received := ""
+		for data.Len() > 0 {
+			response, err := ReadPacket(data)
+			if err != nil {
+				t.Fatal(err)
+			} else if len(response.Body) > MaximumResponseLength || (utf8.ValidString(output) && !utf8.ValidString(response.Body)) {
+				t.Errorf("received a response with %v bytes which is not valid UTF-8", len(response.Body))
+			}
+			received += response.Body
+		}
+		if received != output {
+			t.Errorf("received %v bytes instead of %v", len(received), len(output))
+		}
+	}
+}
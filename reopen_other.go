@@ -0,0 +1,9 @@
+//go:build !unix
+
+package main
+
+import "github.com/michivip/mcstatusserver/logfile"
+
+// there is no SIGUSR1 on this platform, the log files are only rotated by their options
+func reopenOnSignal(logFiles []*logfile.File) {
+}
@@ -0,0 +1,28 @@
+//go:build unix
+
+package main
+
+import (
+	"log"
+	"os"
+	"os/signal"
+	"syscall"
+
+	"github.com/michivip/mcstatusserver/logfile"
+)
+
+// this method opens the given log files again when the process receives SIGUSR1 (e.g. after logrotate moved them)
+func reopenOnSignal(logFiles []*logfile.File) {
+	signals := make(chan os.Signal, 1)
+	signal.Notify(signals, syscall.SIGUSR1)
+	go func() {
+		for range signals {
+			for _, logFile := range logFiles {
+				if err := logFile.Reopen(); err != nil {
+					log.Printf("There was an error while opening a log file again: %v\n", err)
+				}
+			}
+			log.Println("Opened the log files again.")
+		}
+	}()
+}
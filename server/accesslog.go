@@ -0,0 +1,252 @@
+package server
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log"
+	"net"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// this file contains the access log which contains a structured event per connection
+
+// the formats of the access log
+const (
+	AccessLogJson   = "json"
+	AccessLogLogfmt = "logfmt"
+)
+
+// the fields of an access event in the order they are written
+var AccessLogFields = []string{
+	"time", "remote_ip", "forwarded_ip", "protocol_version", "version", "hostname", "port", "intent",
+	"player_name", "outcome", "close_reason", "duration_ms", "bytes_in", "bytes_out",
+}
+
+// the values of a connection which are written to the access log when it was closed
+// the values are collected by the packet handlers, values which are unknown are left empty
+type AccessEvent struct {
+	Time     time.Time
+	RemoteIp string
+	// the ip of the client which was forwarded by a proxy (BungeeCord ip forwarding)
+	ForwardedIp     string
+	ProtocolVersion int
+	Version         string
+	Hostname        string
+	Port            uint16
+	// status, login, transfer or legacy_ping (empty if the connection was closed before the handshake)
+	Intent     string
+	PlayerName string
+	// what the server answered (e.g. status, ping or the outcome of a login attempt)
+	Outcome     string
+	CloseReason string
+	Duration    time.Duration
+	BytesIn     int64
+	BytesOut    int64
+}
+
+// returns the value of the field with the given name
+func (event *AccessEvent) field(name string) interface{} {
+	switch name {
+	case "time":
+		return event.Time.Format(time.RFC3339Nano)
+	case "remote_ip":
+		return event.RemoteIp
+	case "forwarded_ip":
+		return event.ForwardedIp
+	case "protocol_version":
+		return event.ProtocolVersion
+	case "version":
+		return event.Version
+	case "hostname":
+		return event.Hostname
+	case "port":
+		return event.Port
+	case "intent":
+		return event.Intent
+	case "player_name":
+		return event.PlayerName
+	case "outcome":
+		return event.Outcome
+	case "close_reason":
+		return event.CloseReason
+	case "duration_ms":
+		return float64(event.Duration) / float64(time.Millisecond)
+	case "bytes_in":
+		return event.BytesIn
+	case "bytes_out":
+		return event.BytesOut
+	}
+	return nil
+}
+
+// this method writes the given fields of the event as JSON object in their order
+func (event *AccessEvent) writeJson(buffer *bytes.Buffer, fields []string) error {
+	for index, field := range fields {
+		if index == 0 {
+			buffer.WriteByte('{')
+		} else {
+			buffer.WriteByte(',')
+		}
+		name, _ := json.Marshal(field)
+		encoded, err := json.Marshal(event.field(field))
+		if err != nil {
+			return err
+		}
+		buffer.Write(name)
+		buffer.WriteByte(':')
+		buffer.Write(encoded)
+	}
+	buffer.WriteByte('}')
+	return nil
+}
+
+// the event is encoded with all fields like in the access log
+func (event AccessEvent) MarshalJSON() ([]byte, error) {
+	buffer := bytes.NewBuffer([]byte{})
+	err := event.writeJson(buffer, AccessLogFields)
+	return buffer.Bytes(), err
+}
+
+// writes the access events of the connections as JSON lines or logfmt
+type AccessLogger struct {
+	mutex  sync.Mutex
+	writer io.Writer
+	format string
+	fields []string
+}
+
+// this method creates an access logger which writes the given fields (all fields if empty) in the given format
+// returns an error if the format or a field is not known
+func NewAccessLogger(writer io.Writer, format string, fields []string) (*AccessLogger, error) {
+	if format != AccessLogJson && format != AccessLogLogfmt {
+		return nil, fmt.Errorf("unknown access log format %q (supported: %v, %v)", format, AccessLogJson, AccessLogLogfmt)
+	}
+	if len(fields) == 0 {
+		fields = AccessLogFields
+	}
+	for _, field := range fields {
+		if (&AccessEvent{}).field(field) == nil {
+			return nil, fmt.Errorf("unknown access log field %q (supported: %v)", field, strings.Join(AccessLogFields, ", "))
+		}
+	}
+	return &AccessLogger{writer: writer, format: format, fields: fields}, nil
+}
+
+// this method writes the given event as a single line
+func (accessLogger *AccessLogger) Log(event *AccessEvent) error {
+	line := bytes.NewBuffer([]byte{})
+	if accessLogger.format == AccessLogJson {
+		if err := event.writeJson(line, accessLogger.fields); err != nil {
+			return err
+		}
+	} else {
+		for index, field := range accessLogger.fields {
+			if index > 0 {
+				line.WriteByte(' ')
+			}
+			line.WriteString(field + "=" + formatLogfmtValue(event.field(field)))
+		}
+	}
+	line.WriteByte('\n')
+	accessLogger.mutex.Lock()
+	defer accessLogger.mutex.Unlock()
+	_, err := accessLogger.writer.Write(line.Bytes())
+	return err
+}
+
+// values which contain spaces, quotes or equal signs (and empty values) are quoted
+func formatLogfmtValue(value interface{}) string {
+	var formatted string
+	switch value := value.(type) {
+	case string:
+		formatted = value
+	case float64:
+		formatted = strconv.FormatFloat(value, 'f', -1, 64)
+	default:
+		formatted = fmt.Sprint(value)
+	}
+	if formatted == "" || strings.ContainsAny(formatted, " =\"\\") || strings.IndexFunc(formatted, func(character rune) bool {
+		return character < 0x20 || character == 0x7F
+	}) >= 0 {
+		return strconv.Quote(formatted)
+	}
+	return formatted
+}
+
+// the hostname of the handshake without the data which is appended by proxies and mods
+// BungeeCord ip forwarding appends the ip of the client (and its uuid and profile) separated by null characters,
+// forge clients append their marker (e.g. "\x00FML\x00")
+func parseHandshakeAddress(serverAddress string) (hostname string, forwardedIp net.IP) {
+	parts := strings.Split(serverAddress, "\x00")
+	hostname = strings.ToLower(strings.TrimSuffix(parts[0], "."))
+	if len(parts) >= 3 {
+		forwardedIp = net.ParseIP(parts[1])
+	}
+	return hostname, forwardedIp
+}
+
+// a connection which counts the bytes which were read and written
+type countingConn struct {
+	net.Conn
+	bytesIn  int64
+	bytesOut int64
+}
+
+func (countingConn *countingConn) Read(data []byte) (int, error) {
+	n, err := countingConn.Conn.Read(data)
+	atomic.AddInt64(&countingConn.bytesIn, int64(n))
+	return n, err
+}
+
+func (countingConn *countingConn) Write(data []byte) (int, error) {
+	n, err := countingConn.Conn.Write(data)
+	atomic.AddInt64(&countingConn.bytesOut, int64(n))
+	return n, err
+}
+
+// this method keeps the given event for RecentAccessEvents and writes it to the access log (if there is one)
+// errors are logged
+func (server *Server) logAccess(event *AccessEvent) {
+	server.mutex.Lock()
+	server.accessEvents[server.accessEventCount%recentAccessEventsCapacity] = *event
+	server.accessEventCount++
+	server.mutex.Unlock()
+	if server.AccessLog == nil {
+		return
+	}
+	if err := server.AccessLog.Log(event); err != nil {
+		log.Printf("Could not write the access log: %v\n", err)
+	}
+}
+
+// returns the last access events (at most the given limit), the newest event comes first
+func (server *Server) RecentAccessEvents(limit int) []AccessEvent {
+	server.mutex.Lock()
+	defer server.mutex.Unlock()
+	count := server.accessEventCount
+	if count > recentAccessEventsCapacity {
+		count = recentAccessEventsCapacity
+	}
+	if limit > 0 && limit < count {
+		count = limit
+	}
+	events := make([]AccessEvent, count)
+	for index := range events {
+		events[index] = server.accessEvents[(server.accessEventCount-1-index)%recentAccessEventsCapacity]
+	}
+	return events
+}
+
+// returns the given ip as string or an empty string if it is nil
+func ipString(ip net.IP) string {
+	if ip == nil {
+		return ""
+	}
+	return ip.String()
+}
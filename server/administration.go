@@ -0,0 +1,57 @@
+package server
+
+import (
+	"sort"
+
+	"github.com/michivip/mcstatusserver/configuration"
+)
+
+// this file contains the open connections of a server which are listed and kicked by administration tools (e.g. the admin API)
+
+// the text which is displayed to kicked players if no other text is given
+var DefaultKickText = configuration.ChatValue{Text: "You were kicked from the server."}
+
+// this method assigns an id to the given connection and adds it to the open connections
+func (server *Server) register(connection *Connection) {
+	server.mutex.Lock()
+	defer server.mutex.Unlock()
+	server.nextConnectionId++
+	connection.Id = server.nextConnectionId
+	server.connections[connection.Id] = connection
+}
+
+func (server *Server) unregister(connection *Connection) {
+	server.mutex.Lock()
+	defer server.mutex.Unlock()
+	delete(server.connections, connection.Id)
+}
+
+// returns the values of the open connections ordered by their ids
+func (server *Server) Connections() []ConnectionInfo {
+	server.mutex.Lock()
+	connections := make([]*Connection, 0, len(server.connections))
+	for _, connection := range server.connections {
+		connections = append(connections, connection)
+	}
+	server.mutex.Unlock()
+	infos := make([]ConnectionInfo, len(connections))
+	for index, connection := range connections {
+		infos[index] = connection.Info()
+	}
+	sort.Slice(infos, func(i, j int) bool {
+		return infos[i].Id < infos[j].Id
+	})
+	return infos
+}
+
+// this method kicks the connection with the given id (see Connection.Kick)
+// returns false if there is no open connection with the id
+func (server *Server) Kick(id uint64, text configuration.ChatValue) bool {
+	server.mutex.Lock()
+	connection, found := server.connections[id]
+	server.mutex.Unlock()
+	if found {
+		connection.Kick(text)
+	}
+	return found
+}
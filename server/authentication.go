@@ -0,0 +1,334 @@
+package server
+
+import (
+	"bytes"
+	"crypto"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/binary"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"net/url"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/michivip/mcstatusserver/configuration"
+	"github.com/michivip/mcstatusserver/datatypes"
+	"github.com/michivip/mcstatusserver/protocol"
+)
+
+// this file contains the online mode login (http://wiki.vg/Protocol_Encryption)
+
+const (
+	encryptionRequestId   = 1
+	encryptionResponseId  = 1
+	serverKeyBits         = 1024
+	verifyTokenLength     = 4
+	maximumSecretLength   = 256
+	maximumServerIdLength = 20
+)
+
+// the key pair of the server is generated once on the first online mode login
+var serverKey struct {
+	once       sync.Once
+	privateKey *rsa.PrivateKey
+	publicKey  []byte
+	err        error
+}
+
+var sessionServerClient = &http.Client{Timeout: 10 * time.Second}
+
+// the profile of a player which was verified by the session server
+type GameProfile struct {
+	Id         string `json:"id"`
+	Name       string `json:"name"`
+	Properties []struct {
+		Name      string `json:"name"`
+		Value     string `json:"value"`
+		Signature string `json:"signature,omitempty"`
+	} `json:"properties"`
+}
+
+// the error which is thrown if a player could not be authenticated
+// the connection is encrypted already if the error is returned after the Encryption Response was read
+type ErrAuthenticationFailed struct {
+	PlayerName string
+	Reason     string
+}
+
+func (errAuthenticationFailed ErrAuthenticationFailed) Error() string {
+	return fmt.Sprintf("could not authenticate player %v: %v", errAuthenticationFailed.PlayerName, errAuthenticationFailed.Reason)
+}
+
+func (errAuthenticationFailed ErrAuthenticationFailed) IsFatal() bool {
+	return false
+}
+
+func getServerKey() (*rsa.PrivateKey, []byte, error) {
+	serverKey.once.Do(func() {
+		serverKey.privateKey, serverKey.err = rsa.GenerateKey(rand.Reader, serverKeyBits)
+		if serverKey.err == nil {
+			serverKey.publicKey, serverKey.err = x509.MarshalPKIXPublicKey(&serverKey.privateKey.PublicKey)
+		}
+	})
+	return serverKey.privateKey, serverKey.publicKey, serverKey.err
+}
+
+// this method performs the online mode login: it sends the Encryption Request, reads the Encryption Response,
+// enables the encryption of the connection and verifies the player with the session server
+// returns the verified profile or an error if something went wrong
+func authenticate(connection *Connection, loginStart LoginStart, values configuration.OnlineModeValues) (GameProfile, ConnectionError) {
+	privateKey, publicKey, err := getServerKey()
+	if err != nil {
+		return GameProfile{}, ErrBasedConnectionError{fmt.Errorf("could not generate the server key: %v", err), true}
+	}
+	verifyToken := make([]byte, verifyTokenLength)
+	if _, err = rand.Read(verifyToken); err != nil {
+		return GameProfile{}, ErrBasedConnectionError{err, true}
+	}
+	encryptionRequest := &EncryptionRequestPacket{
+		PublicKey:          publicKey,
+		VerifyToken:        verifyToken,
+		ShouldAuthenticate: true,
+	}
+	if connectionError := connection.SendPacket(encryptionRequest); connectionError != nil {
+		return GameProfile{}, connectionError
+	}
+	rawPacket, err := connection.ReadPacket()
+	if err != nil {
+		return GameProfile{}, ErrBasedConnectionError{err, false}
+	}
+	packet, _, err := DefaultPacketRegistry.Decode(LoginState, ServerboundDirection, connection.ProtocolVersion, rawPacket)
+	if connectionError, ok := err.(ConnectionError); ok {
+		return GameProfile{}, connectionError
+	} else if err != nil {
+		return GameProfile{}, ErrBasedConnectionError{err, false}
+	}
+	encryptionResponse, ok := packet.(*EncryptionResponsePacket)
+	if !ok {
+		return GameProfile{}, ErrInvalidDataReceived{fmt.Sprintf("packet id %v instead of Encryption Response", rawPacket.Id)}
+	}
+	sharedSecret, err := rsa.DecryptPKCS1v15(rand.Reader, privateKey, encryptionResponse.SharedSecret)
+	if err != nil || len(sharedSecret) != 16 {
+		return GameProfile{}, ErrInvalidDataReceived{"shared secret"}
+	}
+	// the client encrypts everything after the Encryption Response
+	if err = enableEncryption(connection, sharedSecret); err != nil {
+		return GameProfile{}, ErrBasedConnectionError{err, true}
+	}
+	if connectionError := verifyEncryptionResponse(encryptionResponse, loginStart, privateKey, verifyToken); connectionError != nil {
+		return GameProfile{}, connectionError
+	}
+	serverHash := datatypes.MinecraftDigest([]byte(""), sharedSecret, publicKey)
+	profile, err := requestProfile(values, loginStart.Name, serverHash, connection.RemoteIp())
+	if err != nil {
+		return GameProfile{}, ErrAuthenticationFailed{loginStart.Name, err.Error()}
+	}
+	return profile, nil
+}
+
+// the Encryption Request which is sent by online mode servers
+type EncryptionRequestPacket struct {
+	// the server id is always an empty string
+	ServerId    string
+	PublicKey   []byte
+	VerifyToken []byte
+	// whether the client authenticates with the session server (1.20.5+)
+	ShouldAuthenticate bool
+}
+
+func (encryptionRequest *EncryptionRequestPacket) Decode(reader io.Reader, protocolVersion int) (err error) {
+	// the server id is read as byte array because it is empty in general
+	serverId, err, _ := datatypes.ReadByteArray(reader, maximumServerIdLength)
+	if err != nil {
+		return ErrInvalidDataReceived{"server id"}
+	}
+	encryptionRequest.ServerId = string(serverId)
+	if encryptionRequest.PublicKey, err = readEncryptionByteArray(reader, maximumPublicKeyLength, protocolVersion); err != nil {
+		return ErrInvalidDataReceived{"public key"}
+	}
+	if encryptionRequest.VerifyToken, err = readEncryptionByteArray(reader, maximumSecretLength, protocolVersion); err != nil {
+		return ErrInvalidDataReceived{"verify token"}
+	}
+	encryptionRequest.ShouldAuthenticate = true
+	if protocolVersion >= protocol.TransferVersion {
+		if encryptionRequest.ShouldAuthenticate, err = datatypes.ReadBoolean(reader); err != nil {
+			return ErrInvalidDataReceived{"should authenticate"}
+		}
+	}
+	return nil
+}
+
+func (encryptionRequest *EncryptionRequestPacket) Encode(data *bytes.Buffer, protocolVersion int) error {
+	if err, _ := datatypes.WriteByteArray(data, []byte(encryptionRequest.ServerId)); err != nil {
+		return err
+	}
+	if err := writeEncryptionByteArray(data, encryptionRequest.PublicKey, protocolVersion); err != nil {
+		return err
+	}
+	if err := writeEncryptionByteArray(data, encryptionRequest.VerifyToken, protocolVersion); err != nil {
+		return err
+	}
+	if protocolVersion >= protocol.TransferVersion {
+		datatypes.WriteBoolean(data, encryptionRequest.ShouldAuthenticate)
+	}
+	return nil
+}
+
+// the Encryption Response of the client
+// 1.19 and 1.19.1/1.19.2 clients may send a salt and its signature instead of the verify token
+type EncryptionResponsePacket struct {
+	SharedSecret []byte
+	// nil if the client signed the verify token
+	VerifyToken   []byte
+	Salt          int64
+	SaltSignature []byte
+}
+
+func (encryptionResponse *EncryptionResponsePacket) Decode(reader io.Reader, protocolVersion int) (err error) {
+	if encryptionResponse.SharedSecret, err = readEncryptionByteArray(reader, maximumSecretLength, protocolVersion); err != nil {
+		return ErrInvalidDataReceived{"shared secret"}
+	}
+	hasVerifyToken := true
+	if protocolVersion >= protocol.ChatKeyVersion && protocolVersion < protocol.ChatKeyRemovedVersion {
+		if hasVerifyToken, err = datatypes.ReadBoolean(reader); err != nil {
+			return ErrInvalidDataReceived{"verify token presence"}
+		}
+	}
+	if hasVerifyToken {
+		if encryptionResponse.VerifyToken, err = readEncryptionByteArray(reader, maximumSecretLength, protocolVersion); err != nil {
+			return ErrInvalidDataReceived{"verify token"}
+		}
+		return nil
+	}
+	if encryptionResponse.Salt, err = datatypes.ReadLong(reader); err != nil {
+		return ErrInvalidDataReceived{"salt"}
+	}
+	if encryptionResponse.SaltSignature, err, _ = datatypes.ReadByteArray(reader, maximumSignatureLength); err != nil {
+		return ErrInvalidDataReceived{"salt signature"}
+	}
+	return nil
+}
+
+func (encryptionResponse *EncryptionResponsePacket) Encode(data *bytes.Buffer, protocolVersion int) error {
+	if err := writeEncryptionByteArray(data, encryptionResponse.SharedSecret, protocolVersion); err != nil {
+		return err
+	}
+	hasVerifyToken := encryptionResponse.VerifyToken != nil
+	if protocolVersion >= protocol.ChatKeyVersion && protocolVersion < protocol.ChatKeyRemovedVersion {
+		datatypes.WriteBoolean(data, hasVerifyToken)
+	} else if !hasVerifyToken {
+		return fmt.Errorf("protocol version %v does not support signed verify tokens", protocolVersion)
+	}
+	if hasVerifyToken {
+		return writeEncryptionByteArray(data, encryptionResponse.VerifyToken, protocolVersion)
+	}
+	if err := datatypes.WriteLong(data, encryptionResponse.Salt); err != nil {
+		return err
+	}
+	err, _ := datatypes.WriteByteArray(data, encryptionResponse.SaltSignature)
+	return err
+}
+
+// 1.7 clients prefix the keys, tokens and secrets of the encryption packets with their length as short
+func readEncryptionByteArray(reader io.Reader, maximumLength int, protocolVersion int) (value []byte, err error) {
+	if protocolVersion < protocol.VarIntByteArraysVersion {
+		return datatypes.ReadShortPrefixedByteArray(reader, maximumLength)
+	}
+	value, err, _ = datatypes.ReadByteArray(reader, maximumLength)
+	return value, err
+}
+
+func writeEncryptionByteArray(data *bytes.Buffer, value []byte, protocolVersion int) error {
+	if protocolVersion < protocol.VarIntByteArraysVersion {
+		return datatypes.WriteShortPrefixedByteArray(data, value)
+	}
+	err, _ := datatypes.WriteByteArray(data, value)
+	return err
+}
+
+// this method checks the verify token of the Encryption Response
+// 1.19 and 1.19.1/1.19.2 clients may sign the verify token with their chat key instead of encrypting it
+func verifyEncryptionResponse(encryptionResponse *EncryptionResponsePacket, loginStart LoginStart, privateKey *rsa.PrivateKey, verifyToken []byte) ConnectionError {
+	if encryptionResponse.VerifyToken == nil {
+		if loginStart.Signature == nil {
+			return ErrAuthenticationFailed{loginStart.Name, "signed verify token without public key"}
+		}
+		parsedKey, err := x509.ParsePKIXPublicKey(loginStart.Signature.PublicKey)
+		if err != nil {
+			return ErrInvalidDataReceived{"signature public key"}
+		}
+		publicKey, ok := parsedKey.(*rsa.PublicKey)
+		if !ok {
+			return ErrInvalidDataReceived{"signature public key type"}
+		}
+		signedData := make([]byte, len(verifyToken)+8)
+		copy(signedData, verifyToken)
+		binary.BigEndian.PutUint64(signedData[len(verifyToken):], uint64(encryptionResponse.Salt))
+		digest := sha256.Sum256(signedData)
+		if rsa.VerifyPKCS1v15(publicKey, crypto.SHA256, digest[:], encryptionResponse.SaltSignature) != nil {
+			return ErrAuthenticationFailed{loginStart.Name, "invalid verify token signature"}
+		}
+		return nil
+	}
+	decryptedToken, err := rsa.DecryptPKCS1v15(rand.Reader, privateKey, encryptionResponse.VerifyToken)
+	if err != nil || !bytes.Equal(decryptedToken, verifyToken) {
+		return ErrAuthenticationFailed{loginStart.Name, "invalid verify token"}
+	}
+	return nil
+}
+
+// this method wraps the reader and writer of the connection with the AES/CFB8 stream cipher
+func enableEncryption(connection *Connection, sharedSecret []byte) error {
+	reader, err := datatypes.NewDecryptingReader(connection.Reader, sharedSecret)
+	if err != nil {
+		return err
+	}
+	writer, err := datatypes.NewEncryptingWriter(connection.Writer, sharedSecret)
+	if err != nil {
+		return err
+	}
+	connection.Reader = reader
+	connection.update(func() {
+		connection.Writer = writer
+	})
+	return nil
+}
+
+// this method asks the session server whether the player joined with the given server hash
+func requestProfile(values configuration.OnlineModeValues, playerName, serverHash string, ip net.IP) (GameProfile, error) {
+	parameters := url.Values{}
+	parameters.Set("username", playerName)
+	parameters.Set("serverId", serverHash)
+	if values.PreventProxyConnections && ip != nil {
+		parameters.Set("ip", ip.String())
+	}
+	response, err := sessionServerClient.Get(strings.TrimRight(values.SessionServer, "/") + "/session/minecraft/hasJoined?" + parameters.Encode())
+	if err != nil {
+		return GameProfile{}, err
+	}
+	defer response.Body.Close()
+	if response.StatusCode == http.StatusNoContent {
+		return GameProfile{}, fmt.Errorf("the session server did not confirm the join")
+	} else if response.StatusCode != http.StatusOK {
+		return GameProfile{}, fmt.Errorf("the session server responded with status %v", response.Status)
+	}
+	profile := GameProfile{}
+	if err = json.NewDecoder(response.Body).Decode(&profile); err != nil {
+		return GameProfile{}, err
+	}
+	// the name may differ in its case only, the profile of another player must not be used
+	if !strings.EqualFold(profile.Name, playerName) {
+		return GameProfile{}, fmt.Errorf("the session server sent the profile of %v", quotePlayerName(profile.Name))
+	}
+	if len(profile.Id) == 32 {
+		profile.Id = profile.Id[0:8] + "-" + profile.Id[8:12] + "-" + profile.Id[12:16] + "-" + profile.Id[16:20] + "-" + profile.Id[20:32]
+	}
+	return profile, nil
+}
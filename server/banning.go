@@ -0,0 +1,37 @@
+package server
+
+import (
+	"strings"
+
+	"github.com/michivip/mcstatusserver/bans"
+	"github.com/michivip/mcstatusserver/configuration"
+)
+
+// this method fills the placeholders {reason}, {source}, {created} and {expires} of the given ban message
+func renderBanMessage(message configuration.ChatValue, banDetails bans.BanDetails) configuration.ChatValue {
+	expires := banDetails.Expires
+	if expires == "" || expires == bans.Forever {
+		expires = "never"
+	}
+	return replaceChatPlaceholders(message, strings.NewReplacer(
+		"{reason}", banDetails.Reason,
+		"{source}", banDetails.Source,
+		"{created}", banDetails.Created,
+		"{expires}", expires,
+	))
+}
+
+// this method returns a copy of the given chat value with all placeholders of the replacer filled in
+func replaceChatPlaceholders(chat configuration.ChatValue, replacer *strings.Replacer) configuration.ChatValue {
+	chat.Text = replacer.Replace(chat.Text)
+	if chat.Extra == nil {
+		return chat
+	}
+	extra := make([]configuration.ChatComponentValue, len(chat.Extra))
+	for index, component := range chat.Extra {
+		component.Text = replacer.Replace(component.Text)
+		extra[index] = component
+	}
+	chat.Extra = extra
+	return chat
+}
@@ -0,0 +1,56 @@
+package server
+
+import (
+	"log"
+	"time"
+
+	"github.com/michivip/mcstatusserver/configuration"
+)
+
+// this file contains the queue for clients which support the Transfer packet (1.20.5+)
+// they are held in the configuration state until the backend server is available and are transferred to it afterwards
+
+const configurationKeepAliveDelay = 10 * time.Second
+
+// the configuration session of queued players: it is started when the player acknowledged the login,
+// holds the player in the configuration state while the player waits in the queue and transfers the player
+// to the backend server when it is available (the player receives the disconnect text if the queue was disabled)
+// the packets of the client (client information, plugin messages, keep alive responses) are ignored by the packet loop
+// the position is not shown to the player because the configuration state has no packet which displays text
+func runConfigurationQueue(connection *Connection, disconnectText configuration.ChatValue) {
+	values, playerName := connection.Config.Queue, connection.Player.Name
+	player := playerQueue.Join(playerName)
+	defer playerQueue.Leave(player)
+	position, size := playerQueue.Position(player)
+	log.Printf("[%v] Player joined the queue. [playerName=%v, position=%v, size=%v]\n", connection.Conn.RemoteAddr(), playerName, position, size)
+	keepAliveTicker := time.NewTicker(configurationKeepAliveDelay)
+	defer keepAliveTicker.Stop()
+	for {
+		select {
+		case <-connection.Done():
+			log.Printf("[%v] Player left the queue. [playerName=%v]\n", connection.Conn.RemoteAddr(), playerName)
+			return
+		case <-player.released:
+			log.Printf("[%v] Transferring player to the backend server. [playerName=%v, host=%v, port=%v]\n", connection.Conn.RemoteAddr(), playerName, values.TransferHost, values.TransferPort)
+			if err := connection.Transfer(values.TransferHost, values.TransferPort); err != nil {
+				log.Printf("[%v] Could not transfer player: %v\n", connection.Conn.RemoteAddr(), err)
+				connection.Close()
+			}
+			// the client closes the connection when it connects to the backend server
+			return
+		case <-player.removed:
+			log.Printf("[%v] The queue was disabled. [playerName=%v]\n", connection.Conn.RemoteAddr(), playerName)
+			if err := connection.SendPacket(&DisconnectPacket{disconnectText}); err != nil {
+				log.Printf("[%v] Could not disconnect player: %v\n", connection.Conn.RemoteAddr(), err)
+			}
+			connection.Close()
+			return
+		case now := <-keepAliveTicker.C:
+			if err := connection.KeepAlive(now.UnixNano() / int64(time.Millisecond)); err != nil {
+				log.Printf("[%v] Could not send keep alive: %v\n", connection.Conn.RemoteAddr(), err)
+				connection.Close()
+				return
+			}
+		}
+	}
+}
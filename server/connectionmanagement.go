@@ -2,19 +2,333 @@ package server
 
 import (
 	"net"
+	"bufio"
 	"fmt"
+	"io"
+	"time"
+	"bytes"
+	"sync"
+	"reflect"
+	"github.com/michivip/mcstatusserver/bans"
+	"github.com/michivip/mcstatusserver/configuration"
+	"github.com/michivip/mcstatusserver/datatypes"
+	"github.com/michivip/mcstatusserver/protocol"
+	"github.com/michivip/mcstatusserver/events"
 )
 
-var States map[*net.TCPConn]ConnectionState = make(map[*net.TCPConn]ConnectionState)
-
 type ConnectionState uint8
 
 const HandshakingState ConnectionState = ConnectionState(0)
 const StatusState ConnectionState = ConnectionState(1)
 const LoginState ConnectionState = ConnectionState(2)
 
+// states which are not requested by the handshake but entered after the login (1.20.2+ clients enter the configuration state first)
+const ConfigurationState ConnectionState = ConnectionState(3)
+const PlayState ConnectionState = ConnectionState(4)
+
+// the handshake intent of clients which were transferred by another server (1.20.5+), they continue with the login
+const TransferIntent int = 3
+
+// the state is encoded as its name (e.g. in the responses of the admin API)
+func (state ConnectionState) MarshalText() ([]byte, error) {
+	return []byte(state.String()), nil
+}
+
+func (state ConnectionState) String() string {
+	switch state {
+	case HandshakingState:
+		return "handshaking"
+	case StatusState:
+		return "status"
+	case LoginState:
+		return "login"
+	case ConfigurationState:
+		return "configuration"
+	case PlayState:
+		return "play"
+	default:
+		return fmt.Sprintf("unknown(%d)", uint8(state))
+	}
+}
+
+// the direction of a packet (http://wiki.vg/Protocol#Definitions)
+type PacketDirection uint8
+
+const ServerboundDirection PacketDirection = PacketDirection(0)
+const ClientboundDirection PacketDirection = PacketDirection(1)
+
+// the state of a single client connection
+// the values which are read by other goroutines (see Info and Kick) are changed with update
 type Connection struct {
+	// a unique id of the connection which is assigned by the server
+	Id uint64
+	// a network connection or any other stream (e.g. a net.Pipe in tests)
+	Conn net.Conn
+	// packets are read from the Reader and written to the Writer (which are wrapped by the encryption)
+	// the Reader is buffered, packets are read with ReadPacket
+	Reader       io.Reader
+	Writer       io.Writer
 	CurrentState ConnectionState
+	Config       *configuration.ServerConfiguration
+	BanLists     *bans.Lists
+	// the values of the handshake packet (zero until the handshake was received)
+	ProtocolVersion int
+	ServerAddress   string
+	ServerPort      uint16
+	// whether the client was transferred by another server
+	Transferred bool
+	// the player which completed the Login Start (the name and uuid are verified in online mode)
+	Player LoginStart
+	// closes the connection if it is not stopped (e.g. by sessions which keep the connection open)
+	IdleTimeout *time.Timer
+	// set by packet handlers which completed the connection (the packet loop stops afterwards)
+	Finished bool
+	// the values which are written to the access log when the connection was closed
+	Access AccessEvent
+	// the bus of the server which receives the events of the connection (nil drops the events)
+	Events *events.Bus
+	// the hooks of the server when the connection was accepted
+	Hooks Hooks
+	// started when the client acknowledged the login and entered the configuration state
+	configurationSession func(connection *Connection)
+	// receives the packets of the client which are awaited by the configuration session (nil if it does not await any)
+	configurationResponses chan Packet
+	closed               chan struct{}
+	closeOnce            sync.Once
+	writeMutex           sync.Mutex
+	packetReader         *datatypes.PacketReader
+	readMutex            sync.Mutex
+}
+
+// this method creates the connection state of a new client which starts in the handshaking state
+func NewConnection(conn net.Conn, config *configuration.ServerConfiguration, banLists *bans.Lists) *Connection {
+	return &Connection{
+		Conn:         conn,
+		Reader:       bufio.NewReader(conn),
+		Writer:       conn,
+		CurrentState: HandshakingState,
+		Config:       config,
+		BanLists:     banLists,
+		closed:       make(chan struct{}),
+		packetReader: datatypes.NewPacketReader(0),
+	}
+}
+
+// this method reads the next packet of the client, its length is limited by the maximum length of the current state
+// the content of the packet is only valid until the next packet is read
+func (connection *Connection) ReadPacket() (datatypes.Packet, error) {
+	connection.readMutex.Lock()
+	defer connection.readMutex.Unlock()
+	connection.packetReader.MaximumLength = connection.maximumPacketLength()
+	return connection.packetReader.ReadPacket(connection.Reader)
+}
+
+// this method returns the buffer of the packet reader to the pool after the connection was closed
+// it waits until a packet which is read by another goroutine failed
+func (connection *Connection) releasePacketReader() {
+	connection.readMutex.Lock()
+	defer connection.readMutex.Unlock()
+	connection.packetReader.Release()
+}
+
+// the minimum length of the handshake if ip forwarding is enabled
+const forwardedHandshakeLength = 32 * 1024
+
+func (connection *Connection) maximumPacketLength() int {
+	if connection.Config == nil {
+		return 0
+	}
+	values := connection.Config.MaximumPacketLength
+	switch connection.CurrentState {
+	case HandshakingState:
+		// BungeeCord appends the profile of the player (including the signed skin textures) to the handshake
+		if connection.Config.IpForwarding && values.Handshaking > 0 && values.Handshaking < forwardedHandshakeLength {
+			return forwardedHandshakeLength
+		}
+		return values.Handshaking
+	case StatusState:
+		return values.Status
+	case LoginState:
+		return values.Login
+	case ConfigurationState:
+		return values.Configuration
+	default:
+		return values.Play
+	}
+}
+
+// returns the ip address of the client or nil if the connection is not a network connection (e.g. a net.Pipe)
+func (connection *Connection) RemoteIp() net.IP {
+	return remoteIp(connection.Conn.RemoteAddr())
+}
+
+func remoteIp(address net.Addr) net.IP {
+	if tcpAddress, isTcp := address.(*net.TCPAddr); isTcp {
+		return tcpAddress.IP
+	}
+	return nil
+}
+
+// returns a channel which is closed when the connection was closed
+func (connection *Connection) Done() <-chan struct{} {
+	return connection.closed
+}
+
+// this method closes the connection, it may be called multiple times and from multiple goroutines
+func (connection *Connection) Close() {
+	connection.closeOnce.Do(func() {
+		close(connection.closed)
+		connection.Conn.Close()
+	})
+}
+
+// returns whether the connection was closed by the server
+func (connection *Connection) IsClosing() bool {
+	select {
+	case <-connection.closed:
+		return true
+	default:
+		return false
+	}
+}
+
+// this method changes values of the connection which are read by other goroutines
+// (the state, protocol version, writer and the hostname and player name of the access event)
+func (connection *Connection) update(change func()) {
+	connection.writeMutex.Lock()
+	defer connection.writeMutex.Unlock()
+	change()
+}
+
+// a snapshot of the values of a connection which can be read by other goroutines (e.g. the admin API)
+type ConnectionInfo struct {
+	Id              uint64          `json:"id"`
+	RemoteAddress   string          `json:"remote-address"`
+	State           ConnectionState `json:"state"`
+	ProtocolVersion int             `json:"protocol-version"`
+	Version         string          `json:"version"`
+	Hostname        string          `json:"hostname"`
+	PlayerName      string          `json:"player-name"`
+	ConnectedAt     time.Time       `json:"connected-at"`
+}
+
+// returns the current values of the connection, it is safe to call it from other goroutines
+func (connection *Connection) Info() ConnectionInfo {
+	connection.writeMutex.Lock()
+	defer connection.writeMutex.Unlock()
+	info := ConnectionInfo{
+		Id:              connection.Id,
+		RemoteAddress:   connection.Conn.RemoteAddr().String(),
+		State:           connection.CurrentState,
+		ProtocolVersion: connection.ProtocolVersion,
+		Hostname:        connection.Access.Hostname,
+		PlayerName:      connection.Access.PlayerName,
+		ConnectedAt:     connection.Access.Time,
+	}
+	if info.ProtocolVersion != 0 {
+		info.Version = protocol.Name(info.ProtocolVersion)
+	}
+	return info
+}
+
+// this method sends the disconnect packet with the given text (in the login, configuration and play state) and closes the connection
+// other than Disconnect it is safe to call it from other goroutines, errors are ignored because the connection is closed anyway
+func (connection *Connection) Kick(text configuration.ChatValue) {
+	connection.writeMutex.Lock()
+	var packet Packet
+	switch connection.CurrentState {
+	case LoginState:
+		packet = &LoginDisconnectPacket{text}
+	case ConfigurationState, PlayState:
+		packet = &DisconnectPacket{text}
+	}
+	if packetId, supported := DefaultPacketRegistry.PacketId(connection.CurrentState, ClientboundDirection, connection.ProtocolVersion, packet); packet != nil && supported {
+		data := bytes.NewBuffer([]byte{})
+		if err := packet.Encode(data, connection.ProtocolVersion); err == nil {
+			datatypes.WritePacket(connection.Writer, datatypes.Packet{Content: data, Id: packetId})
+		}
+	}
+	connection.writeMutex.Unlock()
+	connection.Close()
+}
+
+// this method writes a packet with the given id and content to the client
+// it is safe to write packets from multiple goroutines
+func (connection *Connection) WritePacket(packetId int, data *bytes.Buffer) ConnectionError {
+	connection.writeMutex.Lock()
+	defer connection.writeMutex.Unlock()
+	if err, _ := datatypes.WritePacket(connection.Writer, datatypes.Packet{Content: data, Id: packetId}); err != nil {
+		return ErrBasedConnectionError{err, false}
+	}
+	return nil
+}
+
+// this method writes a packet which was encoded already (including its length and id) to the client
+func (connection *Connection) WriteEncodedPacket(encoded []byte) ConnectionError {
+	connection.writeMutex.Lock()
+	defer connection.writeMutex.Unlock()
+	if bytesWritten, err := connection.Writer.Write(encoded); err != nil {
+		return ErrBasedConnectionError{err, false}
+	} else if bytesWritten < len(encoded) {
+		return ErrBasedConnectionError{io.ErrUnexpectedEOF, false}
+	}
+	return nil
+}
+
+// this method encodes the given packet and sends it with its id in the current state and protocol version of the connection
+func (connection *Connection) SendPacket(packet Packet) ConnectionError {
+	packetId, supported := DefaultPacketRegistry.PacketId(connection.CurrentState, ClientboundDirection, connection.ProtocolVersion, packet)
+	if !supported {
+		return ErrUnsupportedPacket{reflect.TypeOf(packet).Elem().Name(), connection.CurrentState, connection.ProtocolVersion}
+	}
+	data := bytes.NewBuffer([]byte{})
+	if err := packet.Encode(data, connection.ProtocolVersion); err != nil {
+		if connectionError, ok := err.(ConnectionError); ok {
+			return connectionError
+		}
+		return ErrBasedConnectionError{err, false}
+	}
+	return connection.WritePacket(packetId, data)
+}
+
+// this method sends the disconnect packet of the current state with the given text to the client
+// the connection is finished, the packet loop closes it after the current packet was handled
+func (connection *Connection) Disconnect(text configuration.ChatValue) ConnectionError {
+	connection.Finished = true
+	if connection.CurrentState == LoginState {
+		return connection.SendPacket(&LoginDisconnectPacket{text})
+	}
+	return connection.SendPacket(&DisconnectPacket{text})
+}
+
+// this method transfers the client to the given server (configuration or play state of 1.20.5+ clients)
+func (connection *Connection) Transfer(host string, port int) ConnectionError {
+	return connection.SendPacket(&TransferPacket{host, port})
+}
+
+// this method stores a cookie on the client which is sent to the server the client is transferred to (1.20.5+)
+func (connection *Connection) StoreCookie(key string, payload []byte) ConnectionError {
+	return connection.SendPacket(&StoreCookiePacket{key, payload})
+}
+
+// this method sends the keep alive packet of the configuration state with the given id
+func (connection *Connection) KeepAlive(id int64) ConnectionError {
+	return connection.SendPacket(&KeepAlivePacket{id})
+}
+
+// the error which is thrown if a packet does not exist in the current state or protocol version of the client
+type ErrUnsupportedPacket struct {
+	PacketName      string
+	State           ConnectionState
+	ProtocolVersion int
+}
+
+func (errUnsupportedPacket ErrUnsupportedPacket) Error() string {
+	return fmt.Sprintf("the %v packet is not supported in the %v state of %v", errUnsupportedPacket.PacketName, errUnsupportedPacket.State, protocol.Describe(errUnsupportedPacket.ProtocolVersion))
+}
+
+func (errUnsupportedPacket ErrUnsupportedPacket) IsFatal() bool {
+	return false
 }
 
 type ErrNoStateFound struct {
@@ -25,13 +339,14 @@ func (errNoStateFound ErrNoStateFound) Error() string {
 	return fmt.Sprintf("could not find any state for value: %v", errNoStateFound.RawState)
 }
 
+// this method returns the state which is requested by the next state (intent) value of the handshake
 func GetConnectionStateFromInt(rawState int) (ConnectionState, error) {
 	switch rawState {
 	case 0:
 		return HandshakingState, nil
 	case 1:
 		return StatusState, nil
-	case 2:
+	case 2, TransferIntent:
 		return LoginState, nil
 	default:
 		return ConnectionState(0), ErrNoStateFound{RawState: rawState}
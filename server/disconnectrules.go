@@ -0,0 +1,80 @@
+package server
+
+import (
+	"net"
+	"strings"
+
+	"github.com/michivip/mcstatusserver/bans"
+	"github.com/michivip/mcstatusserver/configuration"
+)
+
+// the values a disconnect rule is matched against
+type loginAttempt struct {
+	PlayerName  string
+	PlayerUuid  string
+	Ip          net.IP
+	Whitelisted bool
+}
+
+// this method chooses the disconnect text of the first rule which matches the login attempt
+// the placeholder {name} is replaced with the player name
+// returns the default disconnect text if no rule matches
+func chooseDisconnectText(values configuration.LoginAttemptValues, attempt loginAttempt) configuration.ChatValue {
+	text := values.DisconnectText
+	for _, rule := range values.Rules {
+		if matchesDisconnectRule(rule, attempt) {
+			text = rule.DisconnectText
+			break
+		}
+	}
+	return replaceChatPlaceholders(text, strings.NewReplacer("{name}", attempt.PlayerName))
+}
+
+func matchesDisconnectRule(rule configuration.DisconnectRuleValues, attempt loginAttempt) bool {
+	if len(rule.Names) > 0 && !containsFold(rule.Names, attempt.PlayerName) {
+		return false
+	}
+	if len(rule.Uuids) > 0 && (attempt.PlayerUuid == "" || !containsFold(normalizeUuids(rule.Uuids), normalizeUuid(attempt.PlayerUuid))) {
+		return false
+	}
+	if !rule.MatchesNamePattern(attempt.PlayerName) {
+		return false
+	}
+	if len(rule.Ips) > 0 && !containsIp(rule.Ips, attempt.Ip) {
+		return false
+	}
+	if rule.Whitelisted != nil && *rule.Whitelisted != attempt.Whitelisted {
+		return false
+	}
+	return true
+}
+
+func containsFold(values []string, value string) bool {
+	for _, candidate := range values {
+		if strings.EqualFold(candidate, value) {
+			return true
+		}
+	}
+	return false
+}
+
+func containsIp(values []string, ip net.IP) bool {
+	for _, value := range values {
+		if network, err := bans.ParseIpNetwork(value); err == nil && network.Contains(ip) {
+			return true
+		}
+	}
+	return false
+}
+
+func normalizeUuid(uuid string) string {
+	return strings.Replace(uuid, "-", "", -1)
+}
+
+func normalizeUuids(uuids []string) []string {
+	normalized := make([]string, len(uuids))
+	for index, uuid := range uuids {
+		normalized[index] = normalizeUuid(uuid)
+	}
+	return normalized
+}
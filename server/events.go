@@ -0,0 +1,48 @@
+package server
+
+import (
+	"github.com/michivip/mcstatusserver/events"
+)
+
+// this file contains the events which the server publishes on its bus
+
+// the amount of addresses which are kept to find unique visitors, all addresses are forgotten when it is reached
+const maximumVisitors = 100000
+
+// this method publishes an event of the server, the maintenance mode is taken from the current configuration
+func (server *Server) publish(event events.Event) {
+	event.Maintenance = server.Configuration().Maintenance.Enabled
+	server.Events.Publish(event)
+}
+
+// this method publishes an event of the connection with its address and the maintenance mode of its configuration
+func (connection *Connection) publish(event events.Event) {
+	event.Ip = connection.clientIp()
+	event.Maintenance = connection.Config.Maintenance.Enabled
+	connection.Events.Publish(event)
+}
+
+// returns the address of the client, which is the forwarded address of the handshake if ip forwarding is enabled
+func (connection *Connection) clientIp() string {
+	if connection.Access.ForwardedIp != "" {
+		return connection.Access.ForwardedIp
+	}
+	return connection.Access.RemoteIp
+}
+
+// this method publishes a unique visitor event if the address of the connection did not connect before
+func (server *Server) recordVisitor(connection *Connection) {
+	ip := connection.clientIp()
+	server.mutex.Lock()
+	_, visited := server.visitors[ip]
+	if !visited {
+		if len(server.visitors) >= maximumVisitors {
+			server.visitors = map[string]struct{}{}
+		}
+		server.visitors[ip] = struct{}{}
+	}
+	server.mutex.Unlock()
+	if !visited {
+		connection.publish(events.Event{Type: events.UniqueVisitor})
+	}
+}
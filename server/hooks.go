@@ -0,0 +1,104 @@
+package server
+
+import (
+	"net"
+
+	"github.com/michivip/mcstatusserver/configuration"
+)
+
+// this file contains the interfaces with which applications which embed the server customize it without changing the configuration
+
+// the values of a connection which are known after its handshake
+type HandshakeContext struct {
+	RemoteAddress net.Addr
+	// the address of the client, which is the address forwarded by BungeeCord if ip forwarding is enabled
+	Ip              string
+	ProtocolVersion int
+	// the hostname the client connected to (without the values forwarded by a proxy)
+	Hostname    string
+	ServerPort  uint16
+	Transferred bool
+	// the configuration the connection was accepted with
+	Config *configuration.ServerConfiguration
+}
+
+// returns the values of the handshake of the connection
+func (connection *Connection) HandshakeContext() HandshakeContext {
+	return HandshakeContext{
+		RemoteAddress:   connection.Conn.RemoteAddr(),
+		Ip:              connection.clientIp(),
+		ProtocolVersion: connection.ProtocolVersion,
+		Hostname:        connection.Access.Hostname,
+		ServerPort:      connection.ServerPort,
+		Transferred:     connection.Transferred,
+		Config:          connection.Config,
+	}
+}
+
+// returns the status of a client instead of the configured MOTD (legacy pings still receive the configured MOTD)
+type StatusProvider interface {
+	// returns nil to send the configured MOTD, an error closes the connection
+	Status(context HandshakeContext) (*StatusResponse, error)
+}
+
+type StatusProviderFunc func(context HandshakeContext) (*StatusResponse, error)
+
+func (statusProviderFunc StatusProviderFunc) Status(context HandshakeContext) (*StatusResponse, error) {
+	return statusProviderFunc(context)
+}
+
+// decides the text a player is disconnected with after the bans, the whitelist and the online mode were checked
+type LoginHandler interface {
+	// returns the disconnect text of the player, the given text was chosen by the configuration (the disconnect rules or the maintenance mode)
+	DisconnectText(context HandshakeContext, player LoginStart, text configuration.ChatValue) configuration.ChatValue
+}
+
+type LoginHandlerFunc func(context HandshakeContext, player LoginStart, text configuration.ChatValue) configuration.ChatValue
+
+func (loginHandlerFunc LoginHandlerFunc) DisconnectText(context HandshakeContext, player LoginStart, text configuration.ChatValue) configuration.ChatValue {
+	return loginHandlerFunc(context, player, text)
+}
+
+// decides whether an accepted connection is handled
+type ConnectionFilter interface {
+	// returns false to close the connection without a response (like the connections of banned addresses)
+	Accept(conn net.Conn) bool
+}
+
+type ConnectionFilterFunc func(conn net.Conn) bool
+
+func (connectionFilterFunc ConnectionFilterFunc) Accept(conn net.Conn) bool {
+	return connectionFilterFunc(conn)
+}
+
+// wraps the handlers of the received packets (e.g. to inspect the packets or to answer them differently)
+// it is called once per connection, the returned handler calls next to continue with the handler of the packet
+type PacketMiddleware func(next PacketHandler) PacketHandler
+
+// the customizations of a server, they are set before the server is started (the zero value keeps the behavior of the configuration)
+type Hooks struct {
+	StatusProvider StatusProvider
+	LoginHandler   LoginHandler
+	// the filters are asked in their order, the first filter which refuses a connection closes it
+	ConnectionFilters []ConnectionFilter
+	// the first middleware is the outermost one
+	PacketMiddleware []PacketMiddleware
+}
+
+// returns whether all filters accept the connection
+func (hooks *Hooks) accept(conn net.Conn) bool {
+	for _, filter := range hooks.ConnectionFilters {
+		if !filter.Accept(conn) {
+			return false
+		}
+	}
+	return true
+}
+
+// returns the handler wrapped by the packet middleware
+func (hooks *Hooks) wrap(handler PacketHandler) PacketHandler {
+	for index := len(hooks.PacketMiddleware) - 1; index >= 0; index-- {
+		handler = hooks.PacketMiddleware[index](handler)
+	}
+	return handler
+}
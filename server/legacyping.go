@@ -0,0 +1,121 @@
+package server
+
+import (
+	"bufio"
+	"bytes"
+	"io"
+	"regexp"
+	"strconv"
+	"strings"
+	"unicode/utf16"
+
+	"github.com/michivip/mcstatusserver/datatypes"
+	"github.com/michivip/mcstatusserver/protocol"
+)
+
+// this file contains the status response for clients before the netty rewrite (http://wiki.vg/Server_List_Ping#1.6)
+
+const (
+	legacyPingId          = 0xFE
+	legacyPingPayload     = 0x01
+	legacyPluginMessageId = 0xFA
+	legacyKickId          = 0xFF
+	// the plugin message of 1.6 clients contains the protocol version, the host name and the port
+	maximumLegacyPingLength = 1024
+)
+
+var formattingCodePattern = regexp.MustCompile("§.?")
+
+// the legacy ping of a client
+type legacyPing struct {
+	// whether the client sent the payload byte (1.4 and newer)
+	Payload bool
+	// the protocol version of the plugin message (1.6) or 0 if it is unknown
+	ProtocolVersion int
+}
+
+// this method checks whether the client started the connection with a legacy ping instead of a handshake
+// vanilla servers treat the first byte 0xFE as legacy ping as well (a handshake packet would be at least 254 bytes long)
+// returns the legacy ping (nil if the client sent a handshake) and an error if its data could not be read
+func readLegacyPing(connection *Connection) (*legacyPing, error) {
+	reader, buffered := connection.Reader.(*bufio.Reader)
+	if !buffered {
+		return nil, nil
+	}
+	if first, err := reader.Peek(1); err != nil || first[0] != legacyPingId {
+		return nil, nil
+	}
+	reader.Discard(1)
+	ping := &legacyPing{}
+	// 1.3 and older clients send the single byte, 1.4 and newer clients the payload (and the plugin message since 1.6)
+	// the following bytes are sent at once so the reader does not wait for bytes which are not buffered yet
+	if reader.Buffered() == 0 {
+		return ping, nil
+	} else if next, _ := reader.Peek(1); next[0] != legacyPingPayload {
+		return ping, nil
+	}
+	reader.Discard(1)
+	ping.Payload = true
+	if reader.Buffered() == 0 {
+		return ping, nil
+	} else if next, _ := reader.Peek(1); next[0] != legacyPluginMessageId {
+		return ping, nil
+	}
+	reader.Discard(1)
+	if _, err := readLegacyString(reader); err != nil {
+		return ping, err
+	}
+	length, err := datatypes.ReadUnsignedShort(reader)
+	if err != nil {
+		return ping, err
+	} else if length < 1 || length > maximumLegacyPingLength {
+		return ping, ErrInvalidDataReceived{"legacy ping length"}
+	}
+	data := make([]byte, length)
+	if _, err = io.ReadFull(reader, data); err != nil {
+		return ping, err
+	}
+	ping.ProtocolVersion = int(data[0])
+	return ping, nil
+}
+
+// this method answers the legacy ping with the values of the MOTD
+// 1.4 and newer clients receive the protocol and version name, older clients only the description and player counts
+func handleLegacyPing(connection *Connection, ping *legacyPing) ConnectionError {
+	motd := statusMotd(connection.Config)
+	var response string
+	if ping.Payload {
+		versionName := strings.Replace(motd.Version.Name, versionPlaceholder, protocol.Name(ping.ProtocolVersion), -1)
+		response = strings.Join([]string{"§1", strconv.Itoa(motd.Version.Protocol), versionName, motd.Description.Text, strconv.Itoa(motd.Players.Online), strconv.Itoa(motd.Players.Max)}, "\x00")
+	} else {
+		// the fields are separated by the section sign so the formatting codes are removed from the description
+		description := formattingCodePattern.ReplaceAllString(motd.Description.Text, "")
+		response = strings.Join([]string{description, strconv.Itoa(motd.Players.Online), strconv.Itoa(motd.Players.Max)}, "§")
+	}
+	data := bytes.NewBuffer([]byte{legacyKickId})
+	writeLegacyString(data, response)
+	return connection.WriteEncodedPacket(data.Bytes())
+}
+
+// reads a string with the length in characters as unsigned short followed by the UTF-16 characters
+func readLegacyString(reader io.Reader) (string, error) {
+	length, err := datatypes.ReadUnsignedShort(reader)
+	if err != nil {
+		return "", err
+	}
+	characters := make([]uint16, length)
+	for index := range characters {
+		if characters[index], err = datatypes.ReadUnsignedShort(reader); err != nil {
+			return "", err
+		}
+	}
+	return string(utf16.Decode(characters)), nil
+}
+
+func writeLegacyString(data *bytes.Buffer, value string) {
+	characters := utf16.Encode([]rune(value))
+	datatypes.WriteUnsignedShort(data, uint16(len(characters)))
+	for _, character := range characters {
+		datatypes.WriteUnsignedShort(data, character)
+	}
+}
@@ -0,0 +1,526 @@
+package server
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"log"
+	"time"
+
+	"github.com/michivip/mcstatusserver/configuration"
+	"github.com/michivip/mcstatusserver/datatypes"
+	"github.com/michivip/mcstatusserver/protocol"
+)
+
+// this file contains the limbo: an empty world in which players wait instead of being disconnected
+
+const (
+	limboKeepAliveInterval = 10 * time.Second
+	limboGameMode          = 3 // spectator, players do not fall through the empty world
+	limboSpawnY            = 64
+	limboDimension         = "minecraft:overworld"
+)
+
+// the Game Event which tells 1.20.3+ clients that the chunks around the player are sent
+const gameEventStartWaitingForChunks = 13
+
+// the title actions which are used by the limbo
+const (
+	titleActionTitle    = 0
+	titleActionSubtitle = 1
+)
+
+// the chat positions which are used by the limbo
+const (
+	chatPositionChat      = 0
+	chatPositionActionBar = 2
+)
+
+// the play packets of a protocol version which are needed by the limbo
+// the disconnect packet and the packets of the configuration state are registered in the packet registry
+type limboProtocol struct {
+	keepAliveId     int
+	joinGameId      int
+	chatId          int
+	spawnPositionId int
+	positionId      int
+	chunkDataId     int
+	titleId         int
+	// the Set Subtitle Text packet (1.17+), 0 if the subtitle is an action of the title packet
+	subtitleId int
+	// the Game Event packet which ends the loading screen of 1.20.3+ clients, 0 if the clients do not wait for it
+	gameEventId        int
+	writeKeepAlive     func(data *bytes.Buffer, id int64)
+	writeJoinGame      func(data *bytes.Buffer)
+	writeSpawnPosition func(data *bytes.Buffer)
+	writePosition      func(data *bytes.Buffer)
+	// writes where a chat message is displayed (chatPositionChat or chatPositionActionBar)
+	writeChatPosition func(data *bytes.Buffer, position byte)
+	// nil if no chunk is sent
+	writeEmptyChunk func(data *bytes.Buffer)
+	// the registries which are synchronized in the configuration state (1.20.5+), the client loads the data of their entries
+	// from its vanilla data pack, nil if the client enters the play state with the login
+	registries []*RegistryDataPacket
+	// the versions of the vanilla data pack which are offered to the client (the releases of the protocol version)
+	dataPackVersions []string
+}
+
+// the protocol versions which are supported by the limbo (http://wiki.vg/Protocol_version_numbers)
+// 1.20.2 - 1.20.4 are missing because they need the complete data of the registries,
+// later versions are missing because the layouts of their play packets changed again
+var limboProtocols = map[int]*limboProtocol{
+	// 1.8 - 1.8.9
+	47: {
+		keepAliveId:     0x00,
+		joinGameId:      0x01,
+		chatId:          0x02,
+		spawnPositionId: 0x05,
+		positionId:      0x08,
+		chunkDataId:     0x21,
+		titleId:         0x45,
+		writeKeepAlive: func(data *bytes.Buffer, id int64) {
+			datatypes.WriteVarInt(data, int(int32(id)))
+		},
+		writeJoinGame: func(data *bytes.Buffer) {
+			writeBigEndian(data, int32(0))      // entity id
+			data.WriteByte(limboGameMode)       // game mode
+			data.WriteByte(0)                   // dimension: overworld
+			data.WriteByte(0)                   // difficulty: peaceful
+			data.WriteByte(1)                   // max players
+			datatypes.WriteString(data, "flat") // level type
+			data.WriteByte(0)                   // reduced debug info
+		},
+		writeSpawnPosition: func(data *bytes.Buffer) {
+			datatypes.WritePosition(data, datatypes.Position{Y: limboSpawnY}, 47)
+		},
+		writePosition: func(data *bytes.Buffer) {
+			writeBigEndian(data, float64(0), float64(limboSpawnY), float64(0), float32(0), float32(0))
+			data.WriteByte(0) // flags: absolute values
+		},
+		writeChatPosition: writeChatPositionByte,
+		// a chunk without sections unloads the chunk in 1.8, the client shows the void without any chunk
+		writeEmptyChunk: nil,
+	},
+	// 1.12.2
+	340: {
+		keepAliveId:     0x1F,
+		joinGameId:      0x23,
+		chatId:          0x0F,
+		spawnPositionId: 0x46,
+		positionId:      0x2F,
+		chunkDataId:     0x20,
+		titleId:         0x48,
+		writeKeepAlive: func(data *bytes.Buffer, id int64) {
+			writeBigEndian(data, id)
+		},
+		writeJoinGame: func(data *bytes.Buffer) {
+			writeBigEndian(data, int32(0))      // entity id
+			data.WriteByte(limboGameMode)       // game mode
+			writeBigEndian(data, int32(0))      // dimension: overworld
+			data.WriteByte(0)                   // difficulty: peaceful
+			data.WriteByte(1)                   // max players
+			datatypes.WriteString(data, "flat") // level type
+			data.WriteByte(0)                   // reduced debug info
+		},
+		writeSpawnPosition: func(data *bytes.Buffer) {
+			datatypes.WritePosition(data, datatypes.Position{Y: limboSpawnY}, 340)
+		},
+		writePosition: func(data *bytes.Buffer) {
+			writeBigEndian(data, float64(0), float64(limboSpawnY), float64(0), float32(0), float32(0))
+			data.WriteByte(0)              // flags: absolute values
+			datatypes.WriteVarInt(data, 1) // teleport id
+		},
+		writeChatPosition: writeChatPositionByte,
+		writeEmptyChunk: func(data *bytes.Buffer) {
+			writeBigEndian(data, int32(0), int32(0))
+			data.WriteByte(1)                // ground-up continuous
+			datatypes.WriteVarInt(data, 0)   // primary bit mask: no sections
+			datatypes.WriteVarInt(data, 256) // size of the biome array
+			data.Write(make([]byte, 256))    // biomes: ocean
+			datatypes.WriteVarInt(data, 0)   // block entities
+		},
+	},
+	// 1.20.5 - 1.20.6
+	766: newConfiguredLimboProtocol([]string{"1.20.5", "1.20.6"}, []*RegistryDataPacket{
+		limboRegistry("minecraft:dimension_type", limboDimension),
+		limboRegistry("minecraft:worldgen/biome", "minecraft:plains"),
+		limboRegistry("minecraft:chat_type", "minecraft:chat"),
+		limboRegistry("minecraft:damage_type", limboDamageTypes...),
+		limboRegistry("minecraft:wolf_variant", "minecraft:pale"),
+		limboRegistry("minecraft:trim_pattern", "minecraft:coast"),
+		limboRegistry("minecraft:trim_material", "minecraft:iron"),
+		limboRegistry("minecraft:banner_pattern", "minecraft:base"),
+	}),
+	// 1.21 - 1.21.1
+	767: newConfiguredLimboProtocol([]string{"1.21", "1.21.1"}, []*RegistryDataPacket{
+		limboRegistry("minecraft:dimension_type", limboDimension),
+		limboRegistry("minecraft:worldgen/biome", "minecraft:plains"),
+		limboRegistry("minecraft:chat_type", "minecraft:chat"),
+		// the campfire damage type was added in 1.21
+		limboRegistry("minecraft:damage_type", append([]string{"minecraft:campfire"}, limboDamageTypes...)...),
+		limboRegistry("minecraft:wolf_variant", "minecraft:pale"),
+		limboRegistry("minecraft:painting_variant", "minecraft:kebab"),
+		limboRegistry("minecraft:trim_pattern", "minecraft:coast"),
+		limboRegistry("minecraft:trim_material", "minecraft:iron"),
+		limboRegistry("minecraft:banner_pattern", "minecraft:base"),
+		limboRegistry("minecraft:enchantment", "minecraft:protection"),
+		limboRegistry("minecraft:jukebox_song", "minecraft:13"),
+	}),
+}
+
+// the damage types which are looked up by every world of the client (the damage sources of the environment),
+// the client does not create the world if one of them is missing
+var limboDamageTypes = []string{
+	"minecraft:in_fire", "minecraft:lightning_bolt", "minecraft:on_fire", "minecraft:lava", "minecraft:hot_floor",
+	"minecraft:in_wall", "minecraft:cramming", "minecraft:drown", "minecraft:starve", "minecraft:cactus", "minecraft:fall",
+	"minecraft:fly_into_wall", "minecraft:out_of_world", "minecraft:generic", "minecraft:magic", "minecraft:wither",
+	"minecraft:dragon_breath", "minecraft:dry_out", "minecraft:sweet_berry_bush", "minecraft:freeze", "minecraft:stalagmite",
+	"minecraft:outside_border", "minecraft:generic_kill",
+}
+
+// returns a registry whose entries are loaded by the client from its vanilla data pack
+// every synchronized registry gets an entry because the client rejects some of them if they are empty
+func limboRegistry(registry string, entries ...string) *RegistryDataPacket {
+	registryData := &RegistryDataPacket{Registry: registry}
+	for _, entry := range entries {
+		registryData.Entries = append(registryData.Entries, RegistryEntry{Id: entry})
+	}
+	return registryData
+}
+
+// returns the play packets of 1.20.5 - 1.21.1 which enter the play state through the configuration state
+func newConfiguredLimboProtocol(dataPackVersions []string, registries []*RegistryDataPacket) *limboProtocol {
+	return &limboProtocol{
+		keepAliveId:     0x26,
+		joinGameId:      0x2B,
+		chatId:          0x6C,
+		spawnPositionId: 0x56,
+		positionId:      0x40,
+		titleId:         0x65,
+		subtitleId:      0x63,
+		gameEventId:     0x22,
+		writeKeepAlive: func(data *bytes.Buffer, id int64) {
+			writeBigEndian(data, id)
+		},
+		writeJoinGame: func(data *bytes.Buffer) {
+			writeBigEndian(data, int32(0))                  // entity id
+			data.WriteByte(0)                               // hardcore
+			datatypes.WriteVarInt(data, 1)                  // dimension names
+			datatypes.WriteIdentifier(data, limboDimension) // the overworld
+			datatypes.WriteVarInt(data, 1)                  // max players
+			datatypes.WriteVarInt(data, 2)                  // view distance
+			datatypes.WriteVarInt(data, 2)                  // simulation distance
+			data.Write([]byte{0, 1, 0})                     // reduced debug info, respawn screen, limited crafting
+			datatypes.WriteVarInt(data, 0)                  // dimension type: the first entry of the registry
+			datatypes.WriteIdentifier(data, limboDimension) // dimension name
+			writeBigEndian(data, int64(0))                  // hashed seed
+			data.WriteByte(limboGameMode)                   // game mode
+			data.WriteByte(0xFF)                            // previous game mode: none
+			data.Write([]byte{0, 1, 0})                     // debug, flat, death location: none
+			datatypes.WriteVarInt(data, 0)                  // portal cooldown
+			data.WriteByte(0)                               // enforces secure chat
+		},
+		writeSpawnPosition: func(data *bytes.Buffer) {
+			datatypes.WritePosition(data, datatypes.Position{Y: limboSpawnY}, protocol.TransferVersion)
+			writeBigEndian(data, float32(0)) // angle
+		},
+		writePosition: func(data *bytes.Buffer) {
+			writeBigEndian(data, float64(0), float64(limboSpawnY), float64(0), float32(0), float32(0))
+			data.WriteByte(0)              // flags: absolute values
+			datatypes.WriteVarInt(data, 1) // teleport id
+		},
+		// the System Chat Message tells whether the text is displayed in the action bar
+		writeChatPosition: func(data *bytes.Buffer, position byte) {
+			datatypes.WriteBoolean(data, position == chatPositionActionBar)
+		},
+		registries:       registries,
+		dataPackVersions: dataPackVersions,
+	}
+}
+
+// this method checks whether the limbo is configured and supported for the given protocol version
+func isLimboEnabledForVersion(values configuration.LimboValues, protocolVersion int) bool {
+	if _, supported := limboProtocols[protocolVersion]; !supported {
+		return false
+	}
+	for _, enabledVersion := range values.ProtocolVersions {
+		if enabledVersion == protocolVersion {
+			return true
+		}
+	}
+	return false
+}
+
+// this method completes the login and keeps the player in an empty world until the player leaves
+// or the maximum duration is exceeded (the player receives the disconnect text then)
+// if the queue is enabled the player waits in the queue and receives the ready message when the backend server is available
+// the connection is finished afterwards
+func runLimbo(connection *Connection, values configuration.LimboValues, queueValues configuration.QueueValues, disconnectText configuration.ChatValue) ConnectionError {
+	limbo, loginStart := limboProtocols[connection.ProtocolVersion], connection.Player
+	connection.Finished = true
+	if !connection.IdleTimeout.Stop() {
+		// the connection was closed by the idle timeout already
+		return nil
+	}
+	if err := writeLoginSuccess(connection, loginStart.Uuid, loginStart.Name); err != nil {
+		return err
+	}
+	connection.update(func() {
+		connection.CurrentState = PlayState
+	})
+	// the client does not send anything which has to be answered, a closed connection ends the limbo
+	clientLeft := make(chan struct{})
+	go func() {
+		defer close(clientLeft)
+		for {
+			if _, err := connection.ReadPacket(); err != nil {
+				return
+			}
+		}
+	}()
+	return keepInLimbo(connection, limbo, values, queueValues, disconnectText, clientLeft)
+}
+
+// the configuration session of the limbo for 1.20.5+ clients: the registries are synchronized with the vanilla data pack
+// of the client and the configuration is finished, the player is kept in the limbo like older clients afterwards
+// the packets of the client are read by the packet loop, it forwards the awaited responses
+// the queue is not joined because these clients wait in the queue of the configuration state
+func runConfigurationLimbo(connection *Connection, values configuration.LimboValues, disconnectText configuration.ChatValue) {
+	defer connection.Close()
+	limbo, playerName := limboProtocols[connection.ProtocolVersion], connection.Player.Name
+	knowsDataPack, err := offerLimboDataPack(connection, limbo)
+	if err != nil {
+		log.Printf("[%v] Could not configure the limbo: %v\n", connection.Conn.RemoteAddr(), err)
+		return
+	} else if !knowsDataPack {
+		// the data of the registries is only sent by the vanilla data pack
+		log.Printf("[%v] Player does not know the vanilla data pack of the limbo. [playerName=%v]\n", connection.Conn.RemoteAddr(), playerName)
+		connection.SendPacket(&DisconnectPacket{disconnectText})
+		return
+	}
+	if err := finishLimboConfiguration(connection, limbo); err != nil {
+		log.Printf("[%v] Could not configure the limbo: %v\n", connection.Conn.RemoteAddr(), err)
+		return
+	}
+	if err := keepInLimbo(connection, limbo, values, configuration.QueueValues{}, disconnectText, connection.Done()); err != nil {
+		log.Printf("[%v] Could not keep the player in the limbo: %v\n", connection.Conn.RemoteAddr(), err)
+	}
+}
+
+// this method offers the vanilla data pack to the client and returns whether the client knows it
+func offerLimboDataPack(connection *Connection, limbo *limboProtocol) (bool, ConnectionError) {
+	if err := connection.SendPacket(&FeatureFlagsPacket{[]string{"minecraft:vanilla"}}); err != nil {
+		return false, err
+	}
+	offered := &KnownPacksPacket{}
+	for _, version := range limbo.dataPackVersions {
+		offered.Packs = append(offered.Packs, KnownPack{"minecraft", "core", version})
+	}
+	if err := connection.SendPacket(offered); err != nil {
+		return false, err
+	}
+	response, err := awaitConfigurationResponse(connection)
+	if err != nil {
+		return false, err
+	}
+	knownPacks, isKnownPacks := response.(*KnownPacksPacket)
+	if !isKnownPacks {
+		return false, ErrInvalidDataReceived{"response to the known packs"}
+	}
+	for _, pack := range knownPacks.Packs {
+		for _, offeredPack := range offered.Packs {
+			if pack == offeredPack {
+				return true, nil
+			}
+		}
+	}
+	return false, nil
+}
+
+// this method sends the registries and waits until the client acknowledged the end of the configuration
+// the packet loop moves the connection into the play state when it received the acknowledgement
+func finishLimboConfiguration(connection *Connection, limbo *limboProtocol) ConnectionError {
+	for _, registry := range limbo.registries {
+		if err := connection.SendPacket(registry); err != nil {
+			return err
+		}
+	}
+	if err := connection.SendPacket(&FinishConfigurationPacket{}); err != nil {
+		return err
+	}
+	response, err := awaitConfigurationResponse(connection)
+	if err != nil {
+		return err
+	} else if _, acknowledged := response.(*FinishConfigurationPacket); !acknowledged {
+		return ErrInvalidDataReceived{"acknowledgement of the finished configuration"}
+	}
+	return nil
+}
+
+// this method waits for the next response of the client which is forwarded by the packet loop
+// the client has to respond within the connection timeout
+func awaitConfigurationResponse(connection *Connection) (Packet, ConnectionError) {
+	timeout := time.NewTimer(time.Millisecond * time.Duration(connection.Config.ConnectionTimeout))
+	defer timeout.Stop()
+	select {
+	case packet := <-connection.configurationResponses:
+		return packet, nil
+	case <-connection.Done():
+		return nil, ErrBasedConnectionError{errors.New("the connection was closed"), false}
+	case <-timeout.C:
+		return nil, ErrBasedConnectionError{errors.New("the client did not respond in time"), false}
+	}
+}
+
+// this method spawns the player in the empty world and keeps the player there until the client left (left is closed)
+// or the maximum duration is exceeded (the player receives the disconnect text then)
+// if the queue is enabled the player waits in the queue and receives the ready message when the backend server is available
+// or the disconnect text when the queue was disabled
+// the connection is not finished because the limbo of the configuration state runs beside the packet loop, the caller closes it
+func keepInLimbo(connection *Connection, limbo *limboProtocol, values configuration.LimboValues, queueValues configuration.QueueValues, disconnectText configuration.ChatValue, left <-chan struct{}) ConnectionError {
+	playerName := connection.Player.Name
+	log.Printf("[%v] Player entered the limbo. [playerName=%v]\n", connection.Conn.RemoteAddr(), playerName)
+	actionBar := values.ActionBar
+	// players in the queue see their position instead of the action bar
+	var player *queuedPlayer
+	var released, removed <-chan struct{}
+	if queueValues.Enabled {
+		player = playerQueue.Join(playerName)
+		defer playerQueue.Leave(player)
+		released, removed = player.released, player.removed
+		actionBar = renderQueuePosition(queueValues.PositionMessage, player)
+	}
+	if err := writeLimboWorld(connection, limbo, values, actionBar); err != nil {
+		return err
+	}
+	var maximumDuration <-chan time.Time
+	if values.MaximumDuration > 0 {
+		maximumDuration = time.After(time.Millisecond * time.Duration(values.MaximumDuration))
+	}
+	actionBarInterval := time.Duration(values.ActionBarInterval) * time.Millisecond
+	if actionBarInterval <= 0 {
+		actionBarInterval = limboKeepAliveInterval
+	}
+	actionBarTicker := time.NewTicker(actionBarInterval)
+	defer actionBarTicker.Stop()
+	keepAliveTicker := time.NewTicker(limboKeepAliveInterval)
+	defer keepAliveTicker.Stop()
+	for {
+		select {
+		case <-left:
+			log.Printf("[%v] Player left the limbo. [playerName=%v]\n", connection.Conn.RemoteAddr(), playerName)
+			return nil
+		case <-maximumDuration:
+			log.Printf("[%v] Maximum limbo duration exceeded. [playerName=%v]\n", connection.Conn.RemoteAddr(), playerName)
+			return connection.SendPacket(&DisconnectPacket{disconnectText})
+		case <-released:
+			log.Printf("[%v] The backend server is available for the player. [playerName=%v]\n", connection.Conn.RemoteAddr(), playerName)
+			// these clients do not support the Transfer packet, they have to reconnect themselves
+			return connection.SendPacket(&DisconnectPacket{queueValues.ReadyMessage})
+		case <-removed:
+			log.Printf("[%v] The queue was disabled. [playerName=%v]\n", connection.Conn.RemoteAddr(), playerName)
+			return connection.SendPacket(&DisconnectPacket{disconnectText})
+		case <-actionBarTicker.C:
+			if player != nil {
+				actionBar = renderQueuePosition(queueValues.PositionMessage, player)
+			}
+			if err := writeLimboChat(connection, limbo, actionBar, chatPositionActionBar); err != nil {
+				return err
+			}
+		case now := <-keepAliveTicker.C:
+			data := bytes.NewBuffer([]byte{})
+			limbo.writeKeepAlive(data, now.UnixNano()/int64(time.Millisecond))
+			if err := connection.WritePacket(limbo.keepAliveId, data); err != nil {
+				return err
+			}
+		}
+	}
+}
+
+// this method sends the packets which spawn the player in the empty world and the configured messages
+func writeLimboWorld(connection *Connection, limbo *limboProtocol, values configuration.LimboValues, actionBar configuration.ChatValue) ConnectionError {
+	data := bytes.NewBuffer([]byte{})
+	limbo.writeJoinGame(data)
+	if err := connection.WritePacket(limbo.joinGameId, data); err != nil {
+		return err
+	}
+	data = bytes.NewBuffer([]byte{})
+	limbo.writeSpawnPosition(data)
+	if err := connection.WritePacket(limbo.spawnPositionId, data); err != nil {
+		return err
+	}
+	if limbo.writeEmptyChunk != nil {
+		data = bytes.NewBuffer([]byte{})
+		limbo.writeEmptyChunk(data)
+		if err := connection.WritePacket(limbo.chunkDataId, data); err != nil {
+			return err
+		}
+	}
+	data = bytes.NewBuffer([]byte{})
+	limbo.writePosition(data)
+	if err := connection.WritePacket(limbo.positionId, data); err != nil {
+		return err
+	}
+	if limbo.gameEventId != 0 {
+		data = bytes.NewBuffer([]byte{})
+		writeBigEndian(data, uint8(gameEventStartWaitingForChunks), float32(0))
+		if err := connection.WritePacket(limbo.gameEventId, data); err != nil {
+			return err
+		}
+	}
+	if !isEmptyChat(values.Subtitle) {
+		if err := writeLimboTitle(connection, limbo, titleActionSubtitle, values.Subtitle); err != nil {
+			return err
+		}
+	}
+	// the subtitle is displayed together with the next title
+	if !isEmptyChat(values.Title) || !isEmptyChat(values.Subtitle) {
+		if err := writeLimboTitle(connection, limbo, titleActionTitle, values.Title); err != nil {
+			return err
+		}
+	}
+	if err := writeLimboChat(connection, limbo, values.ChatMessage, chatPositionChat); err != nil {
+		return err
+	}
+	return writeLimboChat(connection, limbo, actionBar, chatPositionActionBar)
+}
+
+func writeLimboTitle(connection *Connection, limbo *limboProtocol, action int, text configuration.ChatValue) ConnectionError {
+	packetId, data := limbo.titleId, bytes.NewBuffer([]byte{})
+	if limbo.subtitleId == 0 {
+		datatypes.WriteVarInt(data, action)
+	} else if action == titleActionSubtitle {
+		packetId = limbo.subtitleId
+	}
+	if err := writeChatValue(data, text, connection.ProtocolVersion, PlayState); err != nil {
+		return err
+	}
+	return connection.WritePacket(packetId, data)
+}
+
+func writeLimboChat(connection *Connection, limbo *limboProtocol, text configuration.ChatValue, position byte) ConnectionError {
+	if isEmptyChat(text) {
+		return nil
+	}
+	data := bytes.NewBuffer([]byte{})
+	if err := writeChatValue(data, text, connection.ProtocolVersion, PlayState); err != nil {
+		return err
+	}
+	limbo.writeChatPosition(data, position)
+	return connection.WritePacket(limbo.chatId, data)
+}
+
+// clients before 1.19 receive the position of a chat message as byte
+func writeChatPositionByte(data *bytes.Buffer, position byte) {
+	data.WriteByte(position)
+}
+
+func isEmptyChat(text configuration.ChatValue) bool {
+	return text.Text == "" && len(text.Extra) == 0
+}
+
+func writeBigEndian(data *bytes.Buffer, values ...interface{}) {
+	for _, value := range values {
+		binary.Write(data, binary.BigEndian, value)
+	}
+}
@@ -0,0 +1,142 @@
+package server
+
+import (
+	"bytes"
+	"io"
+	"strconv"
+
+	"github.com/michivip/mcstatusserver/datatypes"
+	"github.com/michivip/mcstatusserver/protocol"
+)
+
+// limits of the Login Start fields
+const (
+	maximumPlayerNameLength = 16
+	maximumPublicKeyLength  = 512
+	maximumSignatureLength  = 4096
+)
+
+// the values of a Login Start packet (http://wiki.vg/Protocol#Login_Start)
+// which fields are set depends on the protocol version of the client
+type LoginStart struct {
+	Name string
+	// the uuid in its hyphenated form or an empty string if the client did not send it
+	Uuid string
+	// the signature data of the player`s chat key or nil if the client did not send it
+	Signature *LoginStartSignature
+}
+
+// the chat key signature data which is sent by 1.19 and 1.19.1/1.19.2 clients
+type LoginStartSignature struct {
+	Timestamp int64
+	PublicKey []byte
+	Signature []byte
+}
+
+// this method reads a Login Start packet in the layout of the given protocol version and validates its values
+// returns the read Login Start packet or an error if something went wrong
+func ReadLoginStart(reader io.Reader, protocolVersion int) (loginStart LoginStart, err error) {
+	if loginStart.Name, err, _ = datatypes.ReadString(reader); err != nil {
+		return loginStart, ErrInvalidDataReceived{"player name"}
+	}
+	if !isValidPlayerName(loginStart.Name) {
+		return loginStart, ErrInvalidDataReceived{"player name " + quotePlayerName(loginStart.Name)}
+	}
+	if protocolVersion >= protocol.ChatKeyVersion && protocolVersion < protocol.ChatKeyRemovedVersion {
+		hasSignature, err := datatypes.ReadBoolean(reader)
+		if err != nil {
+			return loginStart, ErrInvalidDataReceived{"signature presence"}
+		}
+		if hasSignature {
+			if loginStart.Signature, err = readLoginStartSignature(reader); err != nil {
+				return loginStart, err
+			}
+		}
+	}
+	// the uuid is optional until the configuration state was added
+	features := protocol.FeaturesOf(protocolVersion)
+	hasUuid := features.ConfigurationState
+	if features.LoginStartUuid && !features.ConfigurationState {
+		if hasUuid, err = datatypes.ReadBoolean(reader); err != nil {
+			return loginStart, ErrInvalidDataReceived{"uuid presence"}
+		}
+	}
+	if hasUuid {
+		uuid, err := datatypes.ReadUuid(reader)
+		if err != nil {
+			return loginStart, ErrInvalidDataReceived{"player uuid"}
+		}
+		loginStart.Uuid = uuid.String()
+	}
+	return loginStart, nil
+}
+
+func (loginStart *LoginStart) Decode(reader io.Reader, protocolVersion int) (err error) {
+	*loginStart, err = ReadLoginStart(reader, protocolVersion)
+	return err
+}
+
+// this method writes the Login Start packet in the layout of the given protocol version
+func (loginStart *LoginStart) Encode(data *bytes.Buffer, protocolVersion int) error {
+	if err, _ := datatypes.WriteString(data, loginStart.Name); err != nil {
+		return err
+	}
+	if protocolVersion >= protocol.ChatKeyVersion && protocolVersion < protocol.ChatKeyRemovedVersion {
+		datatypes.WriteBoolean(data, loginStart.Signature != nil)
+		if loginStart.Signature != nil {
+			datatypes.WriteLong(data, loginStart.Signature.Timestamp)
+			datatypes.WriteByteArray(data, loginStart.Signature.PublicKey)
+			datatypes.WriteByteArray(data, loginStart.Signature.Signature)
+		}
+	}
+	features := protocol.FeaturesOf(protocolVersion)
+	hasUuid := features.ConfigurationState
+	if features.LoginStartUuid && !features.ConfigurationState {
+		hasUuid = loginStart.Uuid != ""
+		datatypes.WriteBoolean(data, hasUuid)
+	}
+	if hasUuid {
+		uuid, err := datatypes.ParseUuid(loginStart.Uuid)
+		if err != nil {
+			return err
+		}
+		datatypes.WriteUuid(data, uuid)
+	}
+	return nil
+}
+
+func readLoginStartSignature(reader io.Reader) (*LoginStartSignature, error) {
+	signature := &LoginStartSignature{}
+	var err error
+	if signature.Timestamp, err = datatypes.ReadLong(reader); err != nil {
+		return nil, ErrInvalidDataReceived{"signature timestamp"}
+	}
+	if signature.PublicKey, err, _ = datatypes.ReadByteArray(reader, maximumPublicKeyLength); err != nil {
+		return nil, ErrInvalidDataReceived{"signature public key"}
+	}
+	if signature.Signature, err, _ = datatypes.ReadByteArray(reader, maximumSignatureLength); err != nil {
+		return nil, ErrInvalidDataReceived{"signature"}
+	}
+	return signature, nil
+}
+
+// a valid player name consists of 1 to 16 characters which are letters, digits or underscores
+func isValidPlayerName(name string) bool {
+	if len(name) == 0 || len(name) > maximumPlayerNameLength {
+		return false
+	}
+	for _, character := range []byte(name) {
+		if !(character >= 'a' && character <= 'z' || character >= 'A' && character <= 'Z' || character >= '0' && character <= '9' || character == '_') {
+			return false
+		}
+	}
+	return true
+}
+
+// this method quotes an invalid player name so that it can be written into the log safely
+func quotePlayerName(name string) string {
+	if len(name) > 64 {
+		name = name[:64]
+	}
+	return strconv.Quote(name)
+}
@@ -0,0 +1,85 @@
+package server
+
+import (
+	"bytes"
+	"encoding/hex"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+// the encoded fields of the Login Start layouts
+const (
+	testNotchName      = "054e6f746368"
+	testNotchUuid      = "069a79f444e94726a5befca90e38aaf5"
+	testNotchSignature = "0000018000000000" + "02aabb" + "01cc"
+)
+
+func TestReadLoginStart(t *testing.T) {
+	signature := &LoginStartSignature{Timestamp: 0x18000000000, PublicKey: []byte{0xaa, 0xbb}, Signature: []byte{0xcc}}
+	uuid := "069a79f4-44e9-4726-a5be-fca90e38aaf5"
+	for _, test := range []struct {
+		protocolVersion int
+		encoded         string
+		loginStart      LoginStart
+	}{
+		// the name only
+		{47, testNotchName, LoginStart{Name: "Notch"}},
+		{758, testNotchName, LoginStart{Name: "Notch"}},
+		// 1.19: the signature presence and the signature
+		{759, testNotchName + "00", LoginStart{Name: "Notch"}},
+		{759, testNotchName + "01" + testNotchSignature, LoginStart{Name: "Notch", Signature: signature}},
+		// 1.19.1: the signature and the uuid with their presence
+		{760, testNotchName + "00" + "00", LoginStart{Name: "Notch"}},
+		{760, testNotchName + "00" + "01" + testNotchUuid, LoginStart{Name: "Notch", Uuid: uuid}},
+		{760, testNotchName + "01" + testNotchSignature + "01" + testNotchUuid, LoginStart{Name: "Notch", Uuid: uuid, Signature: signature}},
+		// 1.19.3: the uuid with its presence
+		{761, testNotchName + "00", LoginStart{Name: "Notch"}},
+		{763, testNotchName + "01" + testNotchUuid, LoginStart{Name: "Notch", Uuid: uuid}},
+		// 1.20.2: the uuid
+		{764, testNotchName + testNotchUuid, LoginStart{Name: "Notch", Uuid: uuid}},
+		{767, testNotchName + testNotchUuid, LoginStart{Name: "Notch", Uuid: uuid}},
+	} {
+		encoded, _ := hex.DecodeString(test.encoded)
+		loginStart, err := ReadLoginStart(bytes.NewReader(encoded), test.protocolVersion)
+		if err != nil {
+			t.Errorf("%v: could not read %v: %v", test.protocolVersion, test.encoded, err)
+			continue
+		} else if !reflect.DeepEqual(loginStart, test.loginStart) {
+			t.Errorf("%v: read %+v instead of %+v", test.protocolVersion, loginStart, test.loginStart)
+		}
+		data := bytes.NewBuffer([]byte{})
+		if err = loginStart.Encode(data, test.protocolVersion); err != nil || hex.EncodeToString(data.Bytes()) != test.encoded {
+			t.Errorf("%v: %+v was encoded as %x (%v)", test.protocolVersion, loginStart, data.Bytes(), err)
+		}
+	}
+}
+
+func TestReadInvalidLoginStart(t *testing.T) {
+	for _, test := range []struct {
+		protocolVersion int
+		encoded         string
+		field           string
+	}{
+		{47, "00", "player name"},
+		{47, "064e6f74206368", "player name"},
+		{47, "11" + hex.EncodeToString([]byte(strings.Repeat("a", 17))), "player name"},
+		{47, "064e6f746368c2a7", "player name"},
+		{759, testNotchName, "signature presence"},
+		{759, testNotchName + "01" + "0000018000000000", "signature public key"},
+		// the public key is longer than allowed
+		{759, testNotchName + "01" + "0000018000000000" + "8104" + strings.Repeat("aa", 513) + "01cc", "signature public key"},
+		{759, testNotchName + "01" + "0000018000000000" + "02aabb", "signature"},
+		{760, testNotchName + "00", "uuid presence"},
+		{760, testNotchName + "00" + "01" + "069a79f4", "player uuid"},
+		{761, testNotchName, "uuid presence"},
+		{764, testNotchName, "player uuid"},
+	} {
+		encoded, _ := hex.DecodeString(test.encoded)
+		_, err := ReadLoginStart(bytes.NewReader(encoded), test.protocolVersion)
+		// an invalid name is quoted after the field
+		if invalidData, isInvalidData := err.(ErrInvalidDataReceived); !isInvalidData || (invalidData.DataName != test.field && !strings.HasPrefix(invalidData.DataName, test.field+" \"")) {
+			t.Errorf("%v: %v returned %v instead of invalid %v", test.protocolVersion, test.encoded, err, test.field)
+		}
+	}
+}
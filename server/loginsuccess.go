@@ -0,0 +1,89 @@
+package server
+
+import (
+	"bytes"
+	"io"
+
+	"github.com/michivip/mcstatusserver/datatypes"
+	"github.com/michivip/mcstatusserver/protocol"
+)
+
+const loginSuccessId = 0x02
+
+// the Login Success packet completes the login, no profile properties (e.g. skins) are sent (http://wiki.vg/Protocol#Login_Success)
+type LoginSuccessPacket struct {
+	// the uuid in its hyphenated form
+	Uuid string
+	Name string
+}
+
+func (loginSuccess *LoginSuccessPacket) Decode(reader io.Reader, protocolVersion int) (err error) {
+	if protocolVersion >= protocol.BinaryUuidVersion {
+		var uuid datatypes.Uuid
+		uuid, err = datatypes.ReadUuid(reader)
+		loginSuccess.Uuid = uuid.String()
+	} else {
+		loginSuccess.Uuid, err, _ = datatypes.ReadString(reader)
+	}
+	if err != nil {
+		return ErrInvalidDataReceived{"player uuid"}
+	}
+	if loginSuccess.Name, err, _ = datatypes.ReadString(reader); err != nil {
+		return ErrInvalidDataReceived{"player name"}
+	}
+	if protocolVersion >= protocol.ChatKeyVersion {
+		properties, err, _ := datatypes.ReadVarInt(reader)
+		if err != nil || properties < 0 {
+			return ErrInvalidDataReceived{"profile properties"}
+		}
+		// the properties are skipped: name, value and the optional signature
+		for index := 0; index < properties; index++ {
+			if _, err, _ = datatypes.ReadString(reader); err != nil {
+				return ErrInvalidDataReceived{"profile property name"}
+			}
+			if _, err, _ = datatypes.ReadString(reader); err != nil {
+				return ErrInvalidDataReceived{"profile property value"}
+			}
+			if signed, err := datatypes.ReadBoolean(reader); err != nil {
+				return ErrInvalidDataReceived{"profile property signature presence"}
+			} else if signed {
+				if _, err, _ = datatypes.ReadString(reader); err != nil {
+					return ErrInvalidDataReceived{"profile property signature"}
+				}
+			}
+		}
+	}
+	if protocolVersion >= protocol.TransferVersion && protocolVersion < protocol.StrictErrorHandlingRemovedVersion {
+		if _, err = datatypes.ReadBoolean(reader); err != nil {
+			return ErrInvalidDataReceived{"strict error handling"}
+		}
+	}
+	return nil
+}
+
+// this method writes the Login Success packet in the layout of the given protocol version
+func (loginSuccess *LoginSuccessPacket) Encode(data *bytes.Buffer, protocolVersion int) error {
+	if protocolVersion >= protocol.BinaryUuidVersion {
+		uuid, err := datatypes.ParseUuid(loginSuccess.Uuid)
+		if err != nil {
+			return err
+		}
+		datatypes.WriteUuid(data, uuid)
+	} else {
+		datatypes.WriteString(data, loginSuccess.Uuid)
+	}
+	datatypes.WriteString(data, loginSuccess.Name)
+	if protocolVersion >= protocol.ChatKeyVersion {
+		datatypes.WriteVarInt(data, 0)
+	}
+	if protocolVersion >= protocol.TransferVersion && protocolVersion < protocol.StrictErrorHandlingRemovedVersion {
+		data.WriteByte(0)
+	}
+	return nil
+}
+
+// this method sends the Login Success packet in the layout of the protocol version of the connection
+// the uuid is expected in its hyphenated form
+func writeLoginSuccess(connection *Connection, uuid, name string) ConnectionError {
+	return connection.SendPacket(&LoginSuccessPacket{uuid, name})
+}
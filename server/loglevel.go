@@ -0,0 +1,42 @@
+package server
+
+import (
+	"fmt"
+	"log"
+	"sync/atomic"
+)
+
+// the level of the diagnostic log, the lines about the lifecycle of every connection are debug lines
+// (they are replaced by the access log) while errors and the actions of players are info lines
+type LogLevel int32
+
+const (
+	DebugLevel LogLevel = iota
+	InfoLevel
+)
+
+// the debug level keeps the lines of every connection like before the access log was added
+var currentLogLevel = int32(DebugLevel)
+
+// this method parses a log level ("debug" or "info", empty is debug)
+func ParseLogLevel(value string) (LogLevel, error) {
+	switch value {
+	case "", "debug":
+		return DebugLevel, nil
+	case "info":
+		return InfoLevel, nil
+	}
+	return DebugLevel, fmt.Errorf("unknown log level %q (supported: debug, info)", value)
+}
+
+// this method sets the level of the diagnostic log of all servers
+func SetLogLevel(level LogLevel) {
+	atomic.StoreInt32(&currentLogLevel, int32(level))
+}
+
+// writes a debug line to the standard logger if the debug level is enabled
+func logDebugf(format string, values ...interface{}) {
+	if LogLevel(atomic.LoadInt32(&currentLogLevel)) <= DebugLevel {
+		log.Printf(format, values...)
+	}
+}
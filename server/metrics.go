@@ -0,0 +1,122 @@
+package server
+
+import (
+	"reflect"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/michivip/mcstatusserver/events"
+	"github.com/michivip/mcstatusserver/metrics"
+	"github.com/michivip/mcstatusserver/protocol"
+)
+
+// the metrics of the server which are registered in metrics.DefaultRegistry
+var (
+	connectionsAccepted = metrics.DefaultRegistry.NewCounter("mcstatusserver_connections_accepted_total",
+		"Connections which were accepted (including the ones which are rejected because of an ip ban).")
+	connectionsActive = metrics.DefaultRegistry.NewGauge("mcstatusserver_connections_active",
+		"Connections which are currently open.")
+	connectionsClosed = metrics.DefaultRegistry.NewCounterVec("mcstatusserver_connections_closed_total",
+		"Connections which were closed by the reason they were closed for.", "reason")
+	statusRequests = metrics.DefaultRegistry.NewCounter("mcstatusserver_status_requests_total",
+		"Status requests which were answered with the MOTD.")
+	pings = metrics.DefaultRegistry.NewCounterVec("mcstatusserver_pings_total",
+		"Pings which were answered by their type (ping after a status request or legacy ping of clients before 1.7).", "type")
+	loginAttempts = metrics.DefaultRegistry.NewCounterVec("mcstatusserver_login_attempts_total",
+		"Login attempts by their outcome.", "outcome")
+	handshakes = metrics.DefaultRegistry.NewCounterVec("mcstatusserver_handshakes_total",
+		"Handshakes by the protocol version of the client and the requested state.", "protocol_version", "version", "intent")
+	requestedHostnames = metrics.DefaultRegistry.NewCounterVec("mcstatusserver_requested_hostnames_total",
+		"Handshakes by the hostname the client connected to.", "hostname")
+	packetDecodeErrors = metrics.DefaultRegistry.NewCounterVec("mcstatusserver_packet_decode_errors_total",
+		"Packets which could not be read or decoded by the state of the connection and the type of the error.", "state", "error")
+	packetHandlerDuration = metrics.DefaultRegistry.NewHistogramVec("mcstatusserver_packet_handler_duration_seconds",
+		"The time the packet handlers needed (including writing the responses) by the packet type.", metrics.DefaultDurationBuckets, "packet")
+)
+
+// the values of the metrics of the process and the uptime of a server (e.g. for the stats command)
+type Stats struct {
+	Uptime              time.Duration
+	ConnectionsAccepted uint64
+	ConnectionsActive   int64
+	StatusRequests      uint64
+	Pings               uint64
+	LoginAttempts       uint64
+}
+
+// returns the current stats, the metrics are shared by all servers of the process
+func (server *Server) Stats() Stats {
+	return Stats{
+		Uptime:              time.Since(server.started),
+		ConnectionsAccepted: connectionsAccepted.Value(),
+		ConnectionsActive:   connectionsActive.Value(),
+		StatusRequests:      statusRequests.Value(),
+		Pings:               pings.Sum(),
+		LoginAttempts:       loginAttempts.Sum(),
+	}
+}
+
+// the reasons of closed connections
+const (
+	closeReasonFinished       = "finished"
+	closeReasonEof            = "eof"
+	closeReasonIdleTimeout    = "idle_timeout"
+	closeReasonInvalidData    = "invalid_data"
+	closeReasonHandlerError   = "handler_error"
+	closeReasonPanic          = "panic"
+	closeReasonBannedIp       = "banned_ip"
+	closeReasonFiltered       = "filtered"
+	closeReasonLegacyPing     = "legacy_ping"
+	closeReasonClosedByServer = "closed_by_server"
+)
+
+// the types of packet decode errors
+const (
+	decodeErrorTruncated     = "truncated"
+	decodeErrorInvalidLength = "invalid_length"
+	decodeErrorUnknownPacket = "unknown_packet"
+	decodeErrorInvalidPacket = "invalid_packet"
+)
+
+// the outcomes of login attempts
+const (
+	loginOutcomeDisconnected         = "disconnected"
+	loginOutcomeBanned               = "banned"
+	loginOutcomeNotWhitelisted       = "not_whitelisted"
+	loginOutcomeAuthenticationFailed = "authentication_failed"
+	loginOutcomeQueue                = "queue"
+	loginOutcomeQueueReady           = "queue_ready"
+	loginOutcomeLimbo                = "limbo"
+)
+
+// the hostname of a handshake is lowercased and limited because it is chosen by the client
+const maximumHostnameLabelLength = 64
+
+func recordHandshake(handshake *HandshakePacket, hostname, intent string) {
+	handshakes.WithLabelValues(strconv.Itoa(handshake.ProtocolVersion), protocol.Name(handshake.ProtocolVersion), intent).Inc()
+	if len(hostname) > maximumHostnameLabelLength {
+		hostname = strings.ToValidUTF8(hostname[:maximumHostnameLabelLength], "")
+	}
+	requestedHostnames.WithLabelValues(hostname).Inc()
+}
+
+// the outcome is counted, written to the access log and published as login attempt
+func recordLoginOutcome(connection *Connection, loginStart LoginStart, outcome string) {
+	loginAttempts.WithLabelValues(outcome).Inc()
+	connection.Access.Outcome = outcome
+	connection.publish(events.Event{Type: events.LoginAttempt, PlayerName: loginStart.Name, PlayerUuid: loginStart.Uuid, Outcome: outcome})
+}
+
+// returns the name of the packet type which is used as label (e.g. "LoginStart")
+func packetTypeName(packet Packet) string {
+	packetType := reflect.TypeOf(packet)
+	if packetType.Kind() == reflect.Ptr {
+		packetType = packetType.Elem()
+	}
+	return strings.TrimSuffix(packetType.Name(), "Packet")
+}
+
+func observePacketHandler(packet Packet, start time.Time) {
+	packetHandlerDuration.WithLabelValues(packetTypeName(packet)).Observe(time.Since(start).Seconds())
+}
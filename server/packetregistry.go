@@ -0,0 +1,158 @@
+package server
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"math"
+	"reflect"
+	"sync"
+
+	"github.com/michivip/mcstatusserver/datatypes"
+	"github.com/michivip/mcstatusserver/protocol"
+)
+
+// this file contains the registry which maps the packet ids of the states, directions and protocol versions to packet types
+
+// a packet type which can be read from and written to the packet content in the layout of a protocol version
+type Packet interface {
+	Decode(reader io.Reader, protocolVersion int) error
+	Encode(data *bytes.Buffer, protocolVersion int) error
+}
+
+// a range of protocol versions, both bounds are inclusive
+// a maximum of 0 includes all newer protocol versions
+type ProtocolRange struct {
+	Minimum int
+	Maximum int
+}
+
+// the range which includes every protocol version
+// it includes negative versions as well because tools send their status requests with the protocol version -1
+var AllVersions = ProtocolRange{Minimum: math.MinInt32}
+
+func (protocolRange ProtocolRange) Contains(protocolVersion int) bool {
+	return protocolVersion >= protocolRange.Minimum && (protocolRange.Maximum == 0 || protocolVersion <= protocolRange.Maximum)
+}
+
+// returns the range for log messages, e.g. "1.20.2 (764) - 1.20.4 (765)"
+func (protocolRange ProtocolRange) String() string {
+	if protocolRange == AllVersions {
+		return "all versions"
+	} else if protocolRange.Maximum == 0 {
+		return protocol.Describe(protocolRange.Minimum) + " and newer"
+	}
+	return protocol.Describe(protocolRange.Minimum) + " - " + protocol.Describe(protocolRange.Maximum)
+}
+
+func (protocolRange ProtocolRange) overlaps(other ProtocolRange) bool {
+	return (other.Maximum == 0 || protocolRange.Minimum <= other.Maximum) && (protocolRange.Maximum == 0 || other.Minimum <= protocolRange.Maximum)
+}
+
+// a packet type which is sent with the given id in the given state, direction and protocol versions
+type PacketRegistration struct {
+	State     ConnectionState
+	Direction PacketDirection
+	Versions  ProtocolRange
+	Id        int
+	// creates an empty packet which the content is decoded into
+	New func() Packet
+}
+
+type packetKey struct {
+	State     ConnectionState
+	Direction PacketDirection
+	Id        int
+}
+
+type packetTypeKey struct {
+	State     ConnectionState
+	Direction PacketDirection
+	Type      reflect.Type
+}
+
+// the packet types of all states, directions and protocol versions
+type PacketRegistry struct {
+	mutex  sync.RWMutex
+	byId   map[packetKey][]PacketRegistration
+	byType map[packetTypeKey][]PacketRegistration
+}
+
+func NewPacketRegistry() *PacketRegistry {
+	return &PacketRegistry{byId: map[packetKey][]PacketRegistration{}, byType: map[packetTypeKey][]PacketRegistration{}}
+}
+
+// the registry which is used by the connections of the server
+var DefaultPacketRegistry = NewPacketRegistry()
+
+// the error which is thrown if a registration overlaps an existing registration
+type ErrPacketAlreadyRegistered struct {
+	Registration PacketRegistration
+}
+
+func (errPacketAlreadyRegistered ErrPacketAlreadyRegistered) Error() string {
+	registration := errPacketAlreadyRegistered.Registration
+	return fmt.Sprintf("a packet with the id %v is already registered in the %v state for the protocol versions %v", registration.Id, registration.State, registration.Versions)
+}
+
+// this method adds a packet type to the registry
+// returns an error if another packet type was registered with the same id or the same type overlaps the protocol versions
+func (registry *PacketRegistry) Register(registration PacketRegistration) error {
+	registry.mutex.Lock()
+	defer registry.mutex.Unlock()
+	idKey := packetKey{registration.State, registration.Direction, registration.Id}
+	typeKey := packetTypeKey{registration.State, registration.Direction, reflect.TypeOf(registration.New())}
+	for _, registered := range append(registry.byId[idKey], registry.byType[typeKey]...) {
+		if registered.Versions.overlaps(registration.Versions) {
+			return ErrPacketAlreadyRegistered{registration}
+		}
+	}
+	registry.byId[idKey] = append(registry.byId[idKey], registration)
+	registry.byType[typeKey] = append(registry.byType[typeKey], registration)
+	return nil
+}
+
+// this method registers the given packet types and panics if one of them could not be registered
+func (registry *PacketRegistry) MustRegister(registrations ...PacketRegistration) {
+	for _, registration := range registrations {
+		if err := registry.Register(registration); err != nil {
+			panic(err)
+		}
+	}
+}
+
+// this method searches the packet type which is sent with the given id
+func (registry *PacketRegistry) Lookup(state ConnectionState, direction PacketDirection, protocolVersion int, packetId int) (PacketRegistration, bool) {
+	registry.mutex.RLock()
+	defer registry.mutex.RUnlock()
+	for _, registration := range registry.byId[packetKey{state, direction, packetId}] {
+		if registration.Versions.Contains(protocolVersion) {
+			return registration, true
+		}
+	}
+	return PacketRegistration{}, false
+}
+
+// this method returns the id which the given packet is sent with
+// returns false if the packet does not exist in the given state, direction and protocol version
+func (registry *PacketRegistry) PacketId(state ConnectionState, direction PacketDirection, protocolVersion int, packet Packet) (int, bool) {
+	registry.mutex.RLock()
+	defer registry.mutex.RUnlock()
+	for _, registration := range registry.byType[packetTypeKey{state, direction, reflect.TypeOf(packet)}] {
+		if registration.Versions.Contains(protocolVersion) {
+			return registration.Id, true
+		}
+	}
+	return 0, false
+}
+
+// this method decodes the content of a received packet into its packet type
+// registered is false if there is no packet type with the id of the packet
+func (registry *PacketRegistry) Decode(state ConnectionState, direction PacketDirection, protocolVersion int, rawPacket datatypes.Packet) (packet Packet, registered bool, err error) {
+	registration, registered := registry.Lookup(state, direction, protocolVersion, rawPacket.Id)
+	if !registered {
+		return nil, false, nil
+	}
+	packet = registration.New()
+	return packet, true, packet.Decode(rawPacket.Content, protocolVersion)
+}
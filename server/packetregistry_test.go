@@ -0,0 +1,158 @@
+package server
+
+import (
+	"bytes"
+	"io"
+	"testing"
+)
+
+// packet types which are only registered in the registries of the tests
+type testPacket struct {
+	Content []byte
+}
+
+func (packet *testPacket) Decode(reader io.Reader, protocolVersion int) (err error) {
+	packet.Content, err = io.ReadAll(reader)
+	return
+}
+
+func (packet *testPacket) Encode(data *bytes.Buffer, protocolVersion int) error {
+	_, err := data.Write(packet.Content)
+	return err
+}
+
+type otherTestPacket struct {
+	testPacket
+}
+
+func newTestPacket() Packet {
+	return &testPacket{}
+}
+
+func newOtherTestPacket() Packet {
+	return &otherTestPacket{}
+}
+
+func TestProtocolRangeContains(t *testing.T) {
+	for _, test := range []struct {
+		protocolRange   ProtocolRange
+		protocolVersion int
+		contains        bool
+	}{
+		{ProtocolRange{47, 340}, 46, false},
+		{ProtocolRange{47, 340}, 47, true},
+		{ProtocolRange{47, 340}, 340, true},
+		{ProtocolRange{47, 340}, 341, false},
+		{ProtocolRange{764, 0}, 763, false},
+		{ProtocolRange{764, 0}, 764, true},
+		{ProtocolRange{764, 0}, 1000000, true},
+		{AllVersions, -1, true},
+		{AllVersions, 0, true},
+		{AllVersions, 767, true},
+	} {
+		if contains := test.protocolRange.Contains(test.protocolVersion); contains != test.contains {
+			t.Errorf("%+v contains %v: %v instead of %v", test.protocolRange, test.protocolVersion, contains, test.contains)
+		}
+	}
+}
+
+func TestPacketRegistryOverlaps(t *testing.T) {
+	for _, test := range []struct {
+		registered ProtocolRange
+		registers  ProtocolRange
+		overlaps   bool
+	}{
+		{ProtocolRange{47, 340}, ProtocolRange{341, 763}, false},
+		{ProtocolRange{341, 763}, ProtocolRange{47, 340}, false},
+		{ProtocolRange{47, 340}, ProtocolRange{340, 763}, true},
+		{ProtocolRange{340, 763}, ProtocolRange{47, 340}, true},
+		{ProtocolRange{47, 763}, ProtocolRange{340, 340}, true},
+		{ProtocolRange{340, 340}, ProtocolRange{47, 763}, true},
+		// open-ended ranges
+		{ProtocolRange{764, 0}, ProtocolRange{47, 763}, false},
+		{ProtocolRange{47, 763}, ProtocolRange{764, 0}, false},
+		{ProtocolRange{764, 0}, ProtocolRange{47, 764}, true},
+		{ProtocolRange{47, 764}, ProtocolRange{764, 0}, true},
+		{ProtocolRange{764, 0}, ProtocolRange{767, 0}, true},
+		{ProtocolRange{764, 0}, ProtocolRange{1000000, 1000000}, true},
+		{AllVersions, ProtocolRange{47, 47}, true},
+	} {
+		// the same id with another type and the same type with another id are both rejected
+		for _, second := range []PacketRegistration{
+			{LoginState, ServerboundDirection, test.registers, 0x00, newOtherTestPacket},
+			{LoginState, ServerboundDirection, test.registers, 0x01, newTestPacket},
+		} {
+			registry := NewPacketRegistry()
+			registry.MustRegister(PacketRegistration{LoginState, ServerboundDirection, test.registered, 0x00, newTestPacket})
+			err := registry.Register(second)
+			if _, alreadyRegistered := err.(ErrPacketAlreadyRegistered); alreadyRegistered != test.overlaps {
+				t.Errorf("registering %v (id %v) after %v returned %v", test.registers, second.Id, test.registered, err)
+			}
+		}
+	}
+}
+
+func TestPacketRegistryLookup(t *testing.T) {
+	registry := NewPacketRegistry()
+	registry.MustRegister(
+		PacketRegistration{PlayState, ClientboundDirection, ProtocolRange{47, 339}, 0x40, newTestPacket},
+		PacketRegistration{PlayState, ClientboundDirection, ProtocolRange{340, 763}, 0x1A, newTestPacket},
+		PacketRegistration{PlayState, ClientboundDirection, ProtocolRange{764, 0}, 0x1B, newTestPacket},
+		// another packet type reuses the id in the versions in which it is free
+		PacketRegistration{PlayState, ClientboundDirection, ProtocolRange{340, 0}, 0x40, newOtherTestPacket},
+	)
+	for _, test := range []struct {
+		protocolVersion int
+		id              int
+		registered      bool
+		other           bool
+	}{
+		{46, 0x40, false, false},
+		{47, 0x40, true, false},
+		{339, 0x40, true, false},
+		{340, 0x40, true, true},
+		{1000000, 0x40, true, true},
+		{339, 0x1A, false, false},
+		{340, 0x1A, true, false},
+		{763, 0x1A, true, false},
+		{764, 0x1A, false, false},
+		{763, 0x1B, false, false},
+		{764, 0x1B, true, false},
+		{1000000, 0x1B, true, false},
+	} {
+		registration, registered := registry.Lookup(PlayState, ClientboundDirection, test.protocolVersion, test.id)
+		if registered != test.registered {
+			t.Errorf("%v: the id %v was registered: %v", test.protocolVersion, test.id, registered)
+		} else if !registered {
+			continue
+		} else if _, other := registration.New().(*otherTestPacket); other != test.other {
+			t.Errorf("%v: the id %v was looked up as %T", test.protocolVersion, test.id, registration.New())
+		}
+	}
+	for _, test := range []struct {
+		protocolVersion int
+		id              int
+		supported       bool
+	}{
+		{46, 0, false},
+		{47, 0x40, true},
+		{339, 0x40, true},
+		{340, 0x1A, true},
+		{763, 0x1A, true},
+		{764, 0x1B, true},
+		{1000000, 0x1B, true},
+	} {
+		id, supported := registry.PacketId(PlayState, ClientboundDirection, test.protocolVersion, &testPacket{})
+		if supported != test.supported || id != test.id {
+			t.Errorf("%v: the packet has the id %v (%v) instead of %v (%v)", test.protocolVersion, id, supported, test.id, test.supported)
+		}
+	}
+	if _, supported := registry.PacketId(PlayState, ClientboundDirection, 339, &otherTestPacket{}); supported {
+		t.Error("the other packet has an id before it was registered")
+	}
+	if _, supported := registry.PacketId(PlayState, ServerboundDirection, 767, &testPacket{}); supported {
+		t.Error("the packet has an id in a direction it was not registered in")
+	} else if _, registered := registry.Lookup(ConfigurationState, ClientboundDirection, 767, 0x1B); registered {
+		t.Error("the id was found in a state it was not registered in")
+	}
+}
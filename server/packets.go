@@ -0,0 +1,413 @@
+package server
+
+import (
+	"bytes"
+	"io"
+	"reflect"
+
+	"github.com/michivip/mcstatusserver/configuration"
+	"github.com/michivip/mcstatusserver/datatypes"
+	"github.com/michivip/mcstatusserver/protocol"
+)
+
+// this file contains the packet types of the server, their ids and the handlers of the received packets (http://wiki.vg/Protocol)
+
+func init() {
+	DefaultPacketRegistry.MustRegister(
+		// handshaking
+		PacketRegistration{HandshakingState, ServerboundDirection, AllVersions, 0x00, func() Packet { return &HandshakePacket{} }},
+		// status
+		PacketRegistration{StatusState, ServerboundDirection, AllVersions, 0x00, func() Packet { return &StatusRequestPacket{} }},
+		PacketRegistration{StatusState, ServerboundDirection, AllVersions, 0x01, func() Packet { return &PingPacket{} }},
+		PacketRegistration{StatusState, ClientboundDirection, AllVersions, 0x00, func() Packet { return &StatusResponsePacket{} }},
+		PacketRegistration{StatusState, ClientboundDirection, AllVersions, 0x01, func() Packet { return &PingPacket{} }},
+		// login
+		PacketRegistration{LoginState, ServerboundDirection, AllVersions, 0x00, func() Packet { return &LoginStart{} }},
+		PacketRegistration{LoginState, ServerboundDirection, AllVersions, encryptionResponseId, func() Packet { return &EncryptionResponsePacket{} }},
+		PacketRegistration{LoginState, ServerboundDirection, ProtocolRange{protocol.ConfigurationStateVersion, 0}, 0x03, func() Packet { return &LoginAcknowledgedPacket{} }},
+		PacketRegistration{LoginState, ClientboundDirection, AllVersions, 0x00, func() Packet { return &LoginDisconnectPacket{} }},
+		PacketRegistration{LoginState, ClientboundDirection, AllVersions, encryptionRequestId, func() Packet { return &EncryptionRequestPacket{} }},
+		PacketRegistration{LoginState, ClientboundDirection, AllVersions, loginSuccessId, func() Packet { return &LoginSuccessPacket{} }},
+		// configuration (1.20.5 added the Cookie Request packet at 0x00 which moved the other packets)
+		PacketRegistration{ConfigurationState, ClientboundDirection, ProtocolRange{protocol.ConfigurationStateVersion, protocol.TransferVersion - 1}, 0x01, func() Packet { return &DisconnectPacket{} }},
+		PacketRegistration{ConfigurationState, ClientboundDirection, ProtocolRange{protocol.ConfigurationStateVersion, protocol.TransferVersion - 1}, 0x03, func() Packet { return &KeepAlivePacket{} }},
+		PacketRegistration{ConfigurationState, ClientboundDirection, ProtocolRange{protocol.TransferVersion, 0}, 0x02, func() Packet { return &DisconnectPacket{} }},
+		PacketRegistration{ConfigurationState, ClientboundDirection, ProtocolRange{protocol.TransferVersion, 0}, 0x04, func() Packet { return &KeepAlivePacket{} }},
+		PacketRegistration{ConfigurationState, ClientboundDirection, ProtocolRange{protocol.TransferVersion, 0}, 0x0A, func() Packet { return &StoreCookiePacket{} }},
+		PacketRegistration{ConfigurationState, ClientboundDirection, ProtocolRange{protocol.TransferVersion, 0}, 0x0B, func() Packet { return &TransferPacket{} }},
+		// the configuration of the limbo (the registries are synchronized with the vanilla data pack of 1.20.5+ clients)
+		PacketRegistration{ConfigurationState, ClientboundDirection, ProtocolRange{protocol.TransferVersion, 0}, 0x03, func() Packet { return &FinishConfigurationPacket{} }},
+		PacketRegistration{ConfigurationState, ClientboundDirection, ProtocolRange{protocol.TransferVersion, 0}, 0x07, func() Packet { return &RegistryDataPacket{} }},
+		PacketRegistration{ConfigurationState, ClientboundDirection, ProtocolRange{protocol.TransferVersion, 0}, 0x0C, func() Packet { return &FeatureFlagsPacket{} }},
+		PacketRegistration{ConfigurationState, ClientboundDirection, ProtocolRange{protocol.TransferVersion, 0}, 0x0E, func() Packet { return &KnownPacksPacket{} }},
+		PacketRegistration{ConfigurationState, ServerboundDirection, ProtocolRange{protocol.TransferVersion, 0}, 0x03, func() Packet { return &FinishConfigurationPacket{} }},
+		PacketRegistration{ConfigurationState, ServerboundDirection, ProtocolRange{protocol.TransferVersion, 0}, 0x07, func() Packet { return &KnownPacksPacket{} }},
+		// play (only entered by clients in the limbo, the other play packets are sent by the limbo itself)
+		PacketRegistration{PlayState, ClientboundDirection, ProtocolRange{47, 47}, 0x40, func() Packet { return &DisconnectPacket{} }},
+		PacketRegistration{PlayState, ClientboundDirection, ProtocolRange{340, 340}, 0x1A, func() Packet { return &DisconnectPacket{} }},
+		PacketRegistration{PlayState, ClientboundDirection, ProtocolRange{protocol.TransferVersion, 767}, 0x1D, func() Packet { return &DisconnectPacket{} }},
+	)
+}
+
+// handles a received packet which was decoded into its packet type
+type PacketHandler func(connection *Connection, packet Packet) ConnectionError
+
+// the handlers of the serverbound packets which are handled by the packet loop
+// packets without a handler close the connection in the handshaking, status and login state
+// and are ignored in the configuration and play state (the client sends settings, plugin messages and so on)
+var packetHandlers = map[reflect.Type]PacketHandler{
+	reflect.TypeOf(&HandshakePacket{}):         handleHandshakePacket,
+	reflect.TypeOf(&StatusRequestPacket{}):     handleStatusRequestPacket,
+	reflect.TypeOf(&PingPacket{}):              handlePingPacket,
+	reflect.TypeOf(&LoginStart{}):              handleLoginStartPacket,
+	reflect.TypeOf(&LoginAcknowledgedPacket{}): handleLoginAcknowledgedPacket,
+	// the responses which are awaited by the configuration session of the limbo
+	reflect.TypeOf(&KnownPacksPacket{}):          forwardConfigurationResponse,
+	reflect.TypeOf(&FinishConfigurationPacket{}): forwardConfigurationResponse,
+}
+
+// handles a decoded packet with the handler of its type, it is the innermost handler of the packet middleware
+func dispatchPacket(connection *Connection, packet Packet) ConnectionError {
+	return packetHandlers[reflect.TypeOf(packet)](connection, packet)
+}
+
+// this method decodes a received packet and searches its handler in the current state of the connection
+// if there is no handler, ignored tells whether the packet is skipped or the connection has to be closed
+func lookupPacketHandler(connection *Connection, rawPacket datatypes.Packet) (handler PacketHandler, packet Packet, ignored bool, err error) {
+	ignored = connection.CurrentState == ConfigurationState || connection.CurrentState == PlayState
+	packet, registered, err := DefaultPacketRegistry.Decode(connection.CurrentState, ServerboundDirection, connection.ProtocolVersion, rawPacket)
+	if !registered {
+		return nil, nil, ignored, nil
+	} else if err != nil {
+		return nil, packet, false, err
+	}
+	return packetHandlers[reflect.TypeOf(packet)], packet, ignored, nil
+}
+
+// the first packet of every connection (http://wiki.vg/Protocol#Handshake)
+type HandshakePacket struct {
+	ProtocolVersion int
+	ServerAddress   string
+	ServerPort      uint16
+	// the raw next state (intent), see GetConnectionStateFromInt
+	NextState int
+}
+
+func (handshake *HandshakePacket) Decode(reader io.Reader, protocolVersion int) (err error) {
+	if handshake.ProtocolVersion, err, _ = datatypes.ReadVarInt(reader); err != nil {
+		return ErrInvalidDataReceived{"protocol version"}
+	}
+	if handshake.ServerAddress, err, _ = datatypes.ReadString(reader); err != nil {
+		return ErrInvalidDataReceived{"server connect address"}
+	}
+	if handshake.ServerPort, err = datatypes.ReadUnsignedShort(reader); err != nil {
+		return ErrInvalidDataReceived{"server port"}
+	}
+	if handshake.NextState, err, _ = datatypes.ReadVarInt(reader); err != nil {
+		return ErrInvalidDataReceived{"next state"}
+	}
+	return nil
+}
+
+func (handshake *HandshakePacket) Encode(data *bytes.Buffer, protocolVersion int) error {
+	datatypes.WriteVarInt(data, handshake.ProtocolVersion)
+	if err, _ := datatypes.WriteString(data, handshake.ServerAddress); err != nil {
+		return err
+	}
+	datatypes.WriteUnsignedShort(data, handshake.ServerPort)
+	datatypes.WriteVarInt(data, handshake.NextState)
+	return nil
+}
+
+// the status request does not contain any fields
+type StatusRequestPacket struct{}
+
+func (statusRequest *StatusRequestPacket) Decode(reader io.Reader, protocolVersion int) error {
+	return nil
+}
+
+func (statusRequest *StatusRequestPacket) Encode(data *bytes.Buffer, protocolVersion int) error {
+	return nil
+}
+
+// the status of the server as JSON string
+type StatusResponsePacket struct {
+	Response string
+}
+
+func (statusResponse *StatusResponsePacket) Decode(reader io.Reader, protocolVersion int) (err error) {
+	if statusResponse.Response, err, _ = datatypes.ReadString(reader); err != nil {
+		return ErrInvalidDataReceived{"status response"}
+	}
+	return nil
+}
+
+func (statusResponse *StatusResponsePacket) Encode(data *bytes.Buffer, protocolVersion int) error {
+	err, _ := datatypes.WriteString(data, statusResponse.Response)
+	return err
+}
+
+// the ping request of the client and the pong response of the server have the same layout
+type PingPacket struct {
+	Payload int64
+}
+
+func (ping *PingPacket) Decode(reader io.Reader, protocolVersion int) (err error) {
+	if ping.Payload, err = datatypes.ReadLong(reader); err != nil {
+		return ErrInvalidDataReceived{"ping payload"}
+	}
+	return nil
+}
+
+func (ping *PingPacket) Encode(data *bytes.Buffer, protocolVersion int) error {
+	return datatypes.WriteLong(data, ping.Payload)
+}
+
+// the acknowledgement of the Login Success which moves 1.20.2+ clients into the configuration state
+type LoginAcknowledgedPacket struct{}
+
+func (loginAcknowledged *LoginAcknowledgedPacket) Decode(reader io.Reader, protocolVersion int) error {
+	return nil
+}
+
+func (loginAcknowledged *LoginAcknowledgedPacket) Encode(data *bytes.Buffer, protocolVersion int) error {
+	return nil
+}
+
+// the disconnect packet of the login state which always contains a JSON text
+type LoginDisconnectPacket struct {
+	Text configuration.ChatValue
+}
+
+func (disconnect *LoginDisconnectPacket) Decode(reader io.Reader, protocolVersion int) error {
+	return readChatValue(reader, &disconnect.Text, protocolVersion, LoginState)
+}
+
+func (disconnect *LoginDisconnectPacket) Encode(data *bytes.Buffer, protocolVersion int) error {
+	if err := writeChatValue(data, disconnect.Text, protocolVersion, LoginState); err != nil {
+		return err
+	}
+	return nil
+}
+
+// the disconnect packet of the configuration and play state, 1.20.3+ clients receive the text as NBT
+type DisconnectPacket struct {
+	Text configuration.ChatValue
+}
+
+func (disconnect *DisconnectPacket) Decode(reader io.Reader, protocolVersion int) error {
+	// the configuration and the play state use the same encoding
+	return readChatValue(reader, &disconnect.Text, protocolVersion, PlayState)
+}
+
+func (disconnect *DisconnectPacket) Encode(data *bytes.Buffer, protocolVersion int) error {
+	if err := writeChatValue(data, disconnect.Text, protocolVersion, PlayState); err != nil {
+		return err
+	}
+	return nil
+}
+
+// the keep alive packet of the configuration state
+type KeepAlivePacket struct {
+	Id int64
+}
+
+func (keepAlive *KeepAlivePacket) Decode(reader io.Reader, protocolVersion int) (err error) {
+	if keepAlive.Id, err = datatypes.ReadLong(reader); err != nil {
+		return ErrInvalidDataReceived{"keep alive id"}
+	}
+	return nil
+}
+
+func (keepAlive *KeepAlivePacket) Encode(data *bytes.Buffer, protocolVersion int) error {
+	return datatypes.WriteLong(data, keepAlive.Id)
+}
+
+// transfers the client to another server (1.20.5+)
+type TransferPacket struct {
+	Host string
+	Port int
+}
+
+func (transfer *TransferPacket) Decode(reader io.Reader, protocolVersion int) (err error) {
+	if transfer.Host, err, _ = datatypes.ReadString(reader); err != nil {
+		return ErrInvalidDataReceived{"transfer host"}
+	}
+	if transfer.Port, err, _ = datatypes.ReadVarInt(reader); err != nil {
+		return ErrInvalidDataReceived{"transfer port"}
+	}
+	return nil
+}
+
+func (transfer *TransferPacket) Encode(data *bytes.Buffer, protocolVersion int) error {
+	if err, _ := datatypes.WriteString(data, transfer.Host); err != nil {
+		return err
+	}
+	err, _ := datatypes.WriteVarInt(data, transfer.Port)
+	return err
+}
+
+// stores a cookie on the client which is sent to the server the client is transferred to (1.20.5+)
+type StoreCookiePacket struct {
+	Key     string
+	Payload []byte
+}
+
+// the maximum size of a cookie payload
+const maximumCookieLength = 5120
+
+func (storeCookie *StoreCookiePacket) Decode(reader io.Reader, protocolVersion int) (err error) {
+	if storeCookie.Key, err, _ = datatypes.ReadString(reader); err != nil {
+		return ErrInvalidDataReceived{"cookie key"}
+	}
+	if storeCookie.Payload, err, _ = datatypes.ReadByteArray(reader, maximumCookieLength); err != nil {
+		return ErrInvalidDataReceived{"cookie payload"}
+	}
+	return nil
+}
+
+func (storeCookie *StoreCookiePacket) Encode(data *bytes.Buffer, protocolVersion int) error {
+	if err, _ := datatypes.WriteString(data, storeCookie.Key); err != nil {
+		return err
+	}
+	err, _ := datatypes.WriteByteArray(data, storeCookie.Payload)
+	return err
+}
+
+// the maximum amount of known packs and registry entries which are decoded
+const (
+	maximumKnownPacks      = 64
+	maximumRegistryEntries = 4096
+)
+
+// a data pack which the client and the server know without transmitting its content (1.20.5+)
+type KnownPack struct {
+	Namespace string
+	Id        string
+	Version   string
+}
+
+// the known packs which are offered by the server, the client answers with the packs it knows of them (1.20.5+)
+type KnownPacksPacket struct {
+	Packs []KnownPack
+}
+
+func (knownPacks *KnownPacksPacket) Decode(reader io.Reader, protocolVersion int) error {
+	length, err := datatypes.ReadPrefixedArray(reader, maximumKnownPacks, func(reader io.Reader, index int) (err error) {
+		pack := KnownPack{}
+		if pack.Namespace, err, _ = datatypes.ReadString(reader); err != nil {
+			return err
+		}
+		if pack.Id, err, _ = datatypes.ReadString(reader); err != nil {
+			return err
+		}
+		if pack.Version, err, _ = datatypes.ReadString(reader); err != nil {
+			return err
+		}
+		knownPacks.Packs = append(knownPacks.Packs, pack)
+		return nil
+	})
+	if err != nil || length != len(knownPacks.Packs) {
+		return ErrInvalidDataReceived{"known packs"}
+	}
+	return nil
+}
+
+func (knownPacks *KnownPacksPacket) Encode(data *bytes.Buffer, protocolVersion int) error {
+	return datatypes.WritePrefixedArray(data, len(knownPacks.Packs), func(writer io.Writer, index int) error {
+		pack := knownPacks.Packs[index]
+		for _, value := range []string{pack.Namespace, pack.Id, pack.Version} {
+			if err, _ := datatypes.WriteString(writer, value); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+}
+
+// an entry of a synchronized registry
+type RegistryEntry struct {
+	Id string
+	// the NBT data of the entry or nil if the client loads it from the known packs
+	Data interface{}
+}
+
+// the entries of a registry which is synchronized in the configuration state (1.20.5+)
+type RegistryDataPacket struct {
+	Registry string
+	Entries  []RegistryEntry
+}
+
+func (registryData *RegistryDataPacket) Decode(reader io.Reader, protocolVersion int) (err error) {
+	if registryData.Registry, err, _ = datatypes.ReadIdentifier(reader); err != nil {
+		return ErrInvalidDataReceived{"registry"}
+	}
+	_, err = datatypes.ReadPrefixedArray(reader, maximumRegistryEntries, func(reader io.Reader, index int) (err error) {
+		entry := RegistryEntry{}
+		if entry.Id, err, _ = datatypes.ReadIdentifier(reader); err != nil {
+			return err
+		}
+		if _, err = datatypes.ReadOptional(reader, func(reader io.Reader) (err error) {
+			entry.Data, err = datatypes.ReadNetworkNbt(reader)
+			return err
+		}); err != nil {
+			return err
+		}
+		registryData.Entries = append(registryData.Entries, entry)
+		return nil
+	})
+	if err != nil {
+		return ErrInvalidDataReceived{"registry entries"}
+	}
+	return nil
+}
+
+func (registryData *RegistryDataPacket) Encode(data *bytes.Buffer, protocolVersion int) error {
+	if err, _ := datatypes.WriteIdentifier(data, registryData.Registry); err != nil {
+		return err
+	}
+	return datatypes.WritePrefixedArray(data, len(registryData.Entries), func(writer io.Writer, index int) error {
+		entry := registryData.Entries[index]
+		if err, _ := datatypes.WriteIdentifier(writer, entry.Id); err != nil {
+			return err
+		}
+		return datatypes.WriteOptional(writer, entry.Data != nil, func(writer io.Writer) error {
+			return datatypes.WriteNetworkNbt(writer, entry.Data)
+		})
+	})
+}
+
+// the feature flags which are enabled on the server (1.20.5+ layout)
+type FeatureFlagsPacket struct {
+	Flags []string
+}
+
+func (featureFlags *FeatureFlagsPacket) Decode(reader io.Reader, protocolVersion int) error {
+	_, err := datatypes.ReadPrefixedArray(reader, maximumRegistryEntries, func(reader io.Reader, index int) error {
+		flag, err, _ := datatypes.ReadIdentifier(reader)
+		featureFlags.Flags = append(featureFlags.Flags, flag)
+		return err
+	})
+	if err != nil {
+		return ErrInvalidDataReceived{"feature flags"}
+	}
+	return nil
+}
+
+func (featureFlags *FeatureFlagsPacket) Encode(data *bytes.Buffer, protocolVersion int) error {
+	return datatypes.WritePrefixedArray(data, len(featureFlags.Flags), func(writer io.Writer, index int) error {
+		err, _ := datatypes.WriteIdentifier(writer, featureFlags.Flags[index])
+		return err
+	})
+}
+
+// finishes the configuration state, the client acknowledges it with the same packet and enters the play state
+type FinishConfigurationPacket struct{}
+
+func (finishConfiguration *FinishConfigurationPacket) Decode(reader io.Reader, protocolVersion int) error {
+	return nil
+}
+
+func (finishConfiguration *FinishConfigurationPacket) Encode(data *bytes.Buffer, protocolVersion int) error {
+	return nil
+}
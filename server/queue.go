@@ -0,0 +1,197 @@
+package server
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"log"
+	"net"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/michivip/mcstatusserver/configuration"
+	"github.com/michivip/mcstatusserver/datatypes"
+	"github.com/michivip/mcstatusserver/events"
+)
+
+// this file contains the waiting queue: players are held until the backend server is available
+
+const backendTimeout = 5 * time.Second
+
+// a player which waits in the queue
+// the released channel is closed when the backend server is available for the player,
+// the removed channel is closed when the queue was disabled (the player receives the disconnect text then)
+type queuedPlayer struct {
+	Name     string
+	released chan struct{}
+	removed  chan struct{}
+}
+
+// the players which wait for the backend server in the order they joined
+type waitingQueue struct {
+	mutex            sync.Mutex
+	players          []*queuedPlayer
+	backendAvailable bool
+}
+
+var playerQueue = &waitingQueue{}
+
+// this method adds a player at the end of the queue
+func (queue *waitingQueue) Join(name string) *queuedPlayer {
+	queue.mutex.Lock()
+	defer queue.mutex.Unlock()
+	player := &queuedPlayer{Name: name, released: make(chan struct{}), removed: make(chan struct{})}
+	queue.players = append(queue.players, player)
+	return player
+}
+
+// this method removes a player from the queue (e.g. if the player left)
+func (queue *waitingQueue) Leave(player *queuedPlayer) {
+	queue.mutex.Lock()
+	defer queue.mutex.Unlock()
+	for index, queued := range queue.players {
+		if queued == player {
+			queue.players = append(queue.players[:index], queue.players[index+1:]...)
+			return
+		}
+	}
+}
+
+// returns the position (starting at 1) of the player and the size of the queue
+// the position is 0 if the player is not queued anymore
+func (queue *waitingQueue) Position(player *queuedPlayer) (int, int) {
+	queue.mutex.Lock()
+	defer queue.mutex.Unlock()
+	for index, queued := range queue.players {
+		if queued == player {
+			return index + 1, len(queue.players)
+		}
+	}
+	return 0, len(queue.players)
+}
+
+// returns whether the last check found the backend server available
+func (queue *waitingQueue) IsBackendAvailable() bool {
+	queue.mutex.Lock()
+	defer queue.mutex.Unlock()
+	return queue.backendAvailable
+}
+
+// this method stores the result of a backend check and releases the first players if the backend is available
+// maximumReleases limits the released players (0 releases all of them)
+func (queue *waitingQueue) update(backendAvailable bool, maximumReleases int) {
+	queue.mutex.Lock()
+	defer queue.mutex.Unlock()
+	queue.backendAvailable = backendAvailable
+	if !backendAvailable {
+		return
+	}
+	releases := len(queue.players)
+	if maximumReleases > 0 && maximumReleases < releases {
+		releases = maximumReleases
+	}
+	for _, player := range queue.players[:releases] {
+		close(player.released)
+	}
+	queue.players = append([]*queuedPlayer(nil), queue.players[releases:]...)
+}
+
+// this method removes all players because the queue was disabled and forgets the availability of the backend server
+// the players are not released because the backend server was not found available for them
+func (queue *waitingQueue) removeAll() {
+	queue.mutex.Lock()
+	defer queue.mutex.Unlock()
+	queue.backendAvailable = false
+	for _, player := range queue.players {
+		close(player.removed)
+	}
+	queue.players = nil
+}
+
+// this method fills the placeholders {position} and {size} of the given position message
+func renderQueuePosition(message configuration.ChatValue, player *queuedPlayer) configuration.ChatValue {
+	position, size := playerQueue.Position(player)
+	return replaceChatPlaceholders(message, strings.NewReplacer("{position}", strconv.Itoa(position), "{size}", strconv.Itoa(size)))
+}
+
+// this method checks the backend server in the configured interval until the server is closed or the monitor is stopped
+// the changes of the availability are published as backend up and down events
+func (server *Server) monitorBackend(values configuration.QueueValues, stop <-chan struct{}) {
+	interval := time.Duration(values.CheckInterval) * time.Millisecond
+	if interval <= 0 {
+		interval = 5 * time.Second
+	}
+	wasAvailable := false
+	for {
+		err := pingBackend(values.BackendAddress)
+		if available := err == nil; available != wasAvailable {
+			if available {
+				log.Printf("The backend server %v is available.\n", values.BackendAddress)
+				server.publish(events.Event{Type: events.BackendUp, Address: values.BackendAddress})
+			} else {
+				log.Printf("The backend server %v is not available: %v\n", values.BackendAddress, err)
+				server.publish(events.Event{Type: events.BackendDown, Address: values.BackendAddress, Reason: err.Error()})
+			}
+			wasAvailable = available
+		}
+		select {
+		case <-stop:
+			// the check was started before the monitor was stopped, its result is not valid anymore
+			return
+		default:
+		}
+		playerQueue.update(err == nil, values.TransfersPerCheck)
+		select {
+		case <-server.closed:
+			return
+		case <-stop:
+			return
+		case <-time.After(interval):
+		}
+	}
+}
+
+// this method requests the status of the backend server (http://wiki.vg/Server_List_Ping)
+// returns an error if the server did not respond with a valid status
+func pingBackend(address string) error {
+	host, rawPort, err := net.SplitHostPort(address)
+	if err != nil {
+		return err
+	}
+	port, err := strconv.ParseUint(rawPort, 10, 16)
+	if err != nil {
+		return err
+	}
+	conn, err := net.DialTimeout("tcp", address, backendTimeout)
+	if err != nil {
+		return err
+	}
+	defer conn.Close()
+	conn.SetDeadline(time.Now().Add(backendTimeout))
+	data := bytes.NewBuffer([]byte{})
+	datatypes.WriteVarInt(data, -1)
+	datatypes.WriteString(data, host)
+	datatypes.WriteUnsignedShort(data, uint16(port))
+	datatypes.WriteVarInt(data, int(StatusState))
+	if err, _ = datatypes.WritePacket(conn, datatypes.Packet{Content: data, Id: 0}); err != nil {
+		return err
+	}
+	if err, _ = datatypes.WritePacket(conn, datatypes.Packet{Content: bytes.NewBuffer([]byte{}), Id: 0}); err != nil {
+		return err
+	}
+	packet, err, _ := datatypes.ReadPacket(conn)
+	if err != nil {
+		return err
+	} else if packet.Id != 0 {
+		return fmt.Errorf("received packet id %v instead of the status response", packet.Id)
+	}
+	response, err, _ := datatypes.ReadString(packet.Content)
+	if err != nil {
+		return err
+	}
+	// the description of other servers may be a string or a chat component, only the JSON object is validated
+	status := map[string]interface{}{}
+	return json.Unmarshal([]byte(response), &status)
+}
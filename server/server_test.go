@@ -0,0 +1,1053 @@
+package server
+
+import (
+	"bufio"
+	"bytes"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"io"
+	"io/ioutil"
+	"log"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"os"
+	"reflect"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+	"unicode/utf16"
+
+	"github.com/michivip/mcstatusserver/bans"
+	"github.com/michivip/mcstatusserver/configuration"
+	"github.com/michivip/mcstatusserver/datatypes"
+	"github.com/michivip/mcstatusserver/events"
+	"github.com/michivip/mcstatusserver/metrics"
+)
+
+// this file contains the end-to-end tests which drive a server with a scripted client
+
+const testTimeout = 5 * time.Second
+
+// the log output of the server which is written by multiple connection goroutines
+type testLog struct {
+	mutex  sync.Mutex
+	buffer bytes.Buffer
+}
+
+func (testLog *testLog) Write(data []byte) (int, error) {
+	testLog.mutex.Lock()
+	defer testLog.mutex.Unlock()
+	return testLog.buffer.Write(data)
+}
+
+func (testLog *testLog) String() string {
+	testLog.mutex.Lock()
+	defer testLog.mutex.Unlock()
+	return testLog.buffer.String()
+}
+
+type testServer struct {
+	*Server
+	Address string
+	Log     *testLog
+}
+
+// this method starts a server with the default configuration on an ephemeral port
+// the configuration can be adjusted by the given function before the server is started
+func startTestServer(t *testing.T, configure func(config *configuration.ServerConfiguration)) *testServer {
+	return startTestServerWithHooks(t, configure, Hooks{})
+}
+
+func startTestServerWithHooks(t *testing.T, configure func(config *configuration.ServerConfiguration), hooks Hooks) *testServer {
+	config := configuration.DefaultConfiguration()
+	config.Address = "127.0.0.1:0"
+	config.Motd.FaviconPath = ""
+	config.ConnectionTimeout = int(testTimeout / time.Millisecond)
+	if configure != nil {
+		configure(config)
+	}
+	banLists, err := bans.LoadLists("", "", "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	serverLog := &testLog{}
+	log.SetOutput(serverLog)
+	server := NewServer(config, banLists)
+	server.Hooks = hooks
+	listener, err := server.Listen()
+	if err != nil {
+		t.Fatal(err)
+	}
+	served := make(chan error, 1)
+	go func() {
+		served <- server.Serve(listener)
+	}()
+	t.Cleanup(func() {
+		server.Close()
+		if err := <-served; err != nil {
+			t.Errorf("the server stopped with an error: %v", err)
+		}
+		log.SetOutput(os.Stderr)
+		if t.Failed() {
+			t.Logf("server log:\n%v", serverLog)
+		}
+	})
+	return &testServer{server, listener.Addr().String(), serverLog}
+}
+
+// this method waits until the server logged a line which contains the given text
+func (testServer *testServer) expectLog(t *testing.T, text string) {
+	t.Helper()
+	deadline := time.Now().Add(testTimeout)
+	for !strings.Contains(testServer.Log.String(), text) {
+		if time.Now().After(deadline) {
+			t.Fatalf("the server did not log %q", text)
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+}
+
+func (testServer *testServer) dial(t *testing.T) *testClient {
+	conn, err := net.DialTimeout("tcp", testServer.Address, testTimeout)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return newTestClient(t, conn)
+}
+
+// a client which sends the packets of the registry and decodes the responses of the server
+type testClient struct {
+	t               *testing.T
+	conn            net.Conn
+	reader          *bufio.Reader
+	writer          io.Writer
+	State           ConnectionState
+	ProtocolVersion int
+}
+
+func newTestClient(t *testing.T, conn net.Conn) *testClient {
+	conn.SetDeadline(time.Now().Add(testTimeout))
+	t.Cleanup(func() {
+		conn.Close()
+	})
+	return &testClient{t: t, conn: conn, reader: bufio.NewReader(conn), writer: conn}
+}
+
+func (client *testClient) send(packet Packet) {
+	client.t.Helper()
+	packetId, registered := DefaultPacketRegistry.PacketId(client.State, ServerboundDirection, client.ProtocolVersion, packet)
+	if !registered {
+		client.t.Fatalf("the packet %T is not registered in the %v state", packet, client.State)
+	}
+	data := bytes.NewBuffer([]byte{})
+	if err := packet.Encode(data, client.ProtocolVersion); err != nil {
+		client.t.Fatal(err)
+	}
+	if err, _ := datatypes.WritePacket(client.writer, datatypes.Packet{Id: packetId, Content: data}); err != nil {
+		client.t.Fatal(err)
+	}
+}
+
+func (client *testClient) receive() Packet {
+	client.t.Helper()
+	rawPacket, err, _ := datatypes.ReadPacket(client.reader)
+	if err != nil {
+		client.t.Fatalf("could not read a packet in the %v state: %v", client.State, err)
+	}
+	packet, registered, err := DefaultPacketRegistry.Decode(client.State, ClientboundDirection, client.ProtocolVersion, rawPacket)
+	if err != nil {
+		client.t.Fatalf("could not decode the packet %v: %v", rawPacket.Id, err)
+	} else if !registered {
+		client.t.Fatalf("received the unknown packet %v in the %v state", rawPacket.Id, client.State)
+	}
+	return packet
+}
+
+// this method sends the handshake packet and enters the given state
+func (client *testClient) handshake(protocolVersion int, nextState ConnectionState) {
+	client.t.Helper()
+	client.ProtocolVersion = protocolVersion
+	client.send(&HandshakePacket{ProtocolVersion: protocolVersion, ServerAddress: "localhost", ServerPort: 25565, NextState: int(nextState)})
+	client.State = nextState
+}
+
+// this method encrypts the packets which are sent and decrypts the packets which are received afterwards
+func (client *testClient) enableEncryption(sharedSecret []byte) {
+	client.t.Helper()
+	// the server does not send anything before it received the Encryption Response, so nothing is buffered yet
+	reader, err := datatypes.NewDecryptingReader(client.reader, sharedSecret)
+	if err != nil {
+		client.t.Fatal(err)
+	}
+	writer, err := datatypes.NewEncryptingWriter(client.conn, sharedSecret)
+	if err != nil {
+		client.t.Fatal(err)
+	}
+	client.reader, client.writer = bufio.NewReader(reader), writer
+}
+
+// this method expects the server to close the connection
+func (client *testClient) expectClosed() {
+	client.t.Helper()
+	if _, err := client.reader.ReadByte(); err != io.EOF {
+		client.t.Errorf("the connection was not closed by the server: %v", err)
+	}
+}
+
+func (client *testClient) status() StatusResponse {
+	client.t.Helper()
+	client.send(&StatusRequestPacket{})
+	response, isResponse := client.receive().(*StatusResponsePacket)
+	if !isResponse {
+		client.t.Fatal("the server did not respond with a Status Response")
+	}
+	status := StatusResponse{}
+	if err := json.Unmarshal([]byte(response.Response), &status); err != nil {
+		client.t.Fatalf("the status response is not valid: %v", err)
+	}
+	return status
+}
+
+func TestStatusAndPing(t *testing.T) {
+	server := startTestServer(t, func(config *configuration.ServerConfiguration) {
+		config.Motd.Version.Name = "test {version}"
+		config.Motd.Description.Text = "integration test"
+	})
+	client := server.dial(t)
+	client.handshake(763, StatusState)
+	status := client.status()
+	if status.Version.Name != "test 1.20.1" || status.Version.Protocol != -1 || status.Description.Text != "integration test" {
+		t.Errorf("received an unexpected status: %+v", status)
+	}
+	if status.Players.Max != 1337 || status.Players.Online != 42 || len(status.Players.Sample) != 2 {
+		t.Errorf("received unexpected player counts: %+v", status.Players)
+	}
+	client.send(&PingPacket{Payload: 1234567890})
+	if pong, isPong := client.receive().(*PingPacket); !isPong || pong.Payload != 1234567890 {
+		t.Errorf("the server did not respond to the ping: %+v", pong)
+	}
+	client.conn.Close()
+	server.expectLog(t, "Received handshake packet. [version=1.20.1 (763), connectAddress=localhost, port=25565, nextRawState=1]")
+	server.expectLog(t, "<-- Closed connection.")
+}
+
+func TestStatusWithoutProtocolVersion(t *testing.T) {
+	server := startTestServer(t, nil)
+	client := server.dial(t)
+	// tools which do not know the protocol version of the server send -1 (e.g. the check of the backend server)
+	client.handshake(-1, StatusState)
+	client.status()
+}
+
+func TestStatusOverPipe(t *testing.T) {
+	server := startTestServer(t, nil)
+	serverConn, clientConn := net.Pipe()
+	go server.ServeConn(serverConn)
+	client := newTestClient(t, clientConn)
+	client.handshake(47, StatusState)
+	if status := client.status(); status.Version.Name != "mcstatusserver 420" {
+		t.Errorf("received an unexpected status: %+v", status)
+	}
+	server.expectLog(t, "Received handshake packet. [version=1.8.9 (47)")
+}
+
+// the legacy pings which are sent by the different client versions and the responses of the server
+func TestLegacyPing(t *testing.T) {
+	pingHost := []byte{0xfe, 0x01, 0xfa}
+	pingHost = appendLegacyString(pingHost, "MC|PingHost")
+	hostData := appendLegacyString([]byte{78}, "localhost")
+	hostData = append(hostData, 0x00, 0x00, 0x63, 0xdd)
+	pingHost = append(pingHost, byte(len(hostData)>>8), byte(len(hostData)))
+	pingHost = append(pingHost, hostData...)
+	pings := []struct {
+		name     string
+		data     []byte
+		response string
+		logLine  string
+	}{
+		{"1.3", []byte{0xfe}, "test motd§42§1337", "[version=unknown (0), payload=false]"},
+		{"1.5", []byte{0xfe, 0x01}, "§1\x00-1\x00legacy unknown\x00§ctest motd\x0042\x001337", "[version=unknown (0), payload=true]"},
+		{"1.6", pingHost, "§1\x00-1\x00legacy 1.6.4\x00§ctest motd\x0042\x001337", "[version=1.6.4 (78), payload=true]"},
+	}
+	server := startTestServer(t, func(config *configuration.ServerConfiguration) {
+		config.Motd.Version.Name = "legacy {version}"
+		config.Motd.Description.Text = "§ctest motd"
+	})
+	for _, ping := range pings {
+		client := server.dial(t)
+		if _, err := client.conn.Write(ping.data); err != nil {
+			t.Fatal(err)
+		}
+		data, err := io.ReadAll(client.reader)
+		if err != nil {
+			t.Fatalf("%v: %v", ping.name, err)
+		}
+		if len(data) < 3 || data[0] != 0xff {
+			t.Fatalf("%v: received %x instead of a kick packet", ping.name, data)
+		}
+		characters := make([]uint16, (len(data)-3)/2)
+		for index := range characters {
+			characters[index] = uint16(data[3+2*index])<<8 | uint16(data[4+2*index])
+		}
+		if response := string(utf16.Decode(characters)); response != ping.response {
+			t.Errorf("%v: received %q instead of %q", ping.name, response, ping.response)
+		} else if length := int(data[1])<<8 | int(data[2]); length != len(characters) {
+			t.Errorf("%v: the prepended length %v differs from %v characters", ping.name, length, len(characters))
+		}
+		server.expectLog(t, "Received legacy ping. "+ping.logLine)
+	}
+}
+
+func appendLegacyString(data []byte, value string) []byte {
+	characters := utf16.Encode([]rune(value))
+	data = append(data, byte(len(characters)>>8), byte(len(characters)))
+	for _, character := range characters {
+		data = append(data, byte(character>>8), byte(character))
+	}
+	return data
+}
+
+func TestLoginDisconnect(t *testing.T) {
+	server := startTestServer(t, nil)
+	for _, protocolVersion := range []int{47, 340, 763, 764, 767} {
+		client := server.dial(t)
+		client.handshake(protocolVersion, LoginState)
+		client.send(&LoginStart{Name: "Notch", Uuid: "069a79f4-44e9-4726-a5be-fca90e38aaf5"})
+		disconnect, isDisconnect := client.receive().(*LoginDisconnectPacket)
+		if !isDisconnect {
+			t.Fatalf("%v: the server did not send a Login Disconnect", protocolVersion)
+		}
+		if disconnect.Text.Text != "You are not " || len(disconnect.Text.Extra) != 2 {
+			t.Errorf("%v: received an unexpected disconnect text: %+v", protocolVersion, disconnect.Text)
+		}
+		client.expectClosed()
+	}
+	// offline mode servers log the offline uuid instead of the uuid the client sent
+	server.expectLog(t, "Received login attempt. [playerName=Notch, uuid=b50ad385-829d-3141-a216-7e7d7539ba7f, signed=false, whitelisted=false, transferred=false]")
+}
+
+func TestOnlineMode(t *testing.T) {
+	// the mock of the session server confirms the join of Notch, Renamed receives the profile of another player
+	joins := make(chan url.Values, 10)
+	sessionServer := httptest.NewServer(http.HandlerFunc(func(writer http.ResponseWriter, request *http.Request) {
+		if request.URL.Path != "/session/minecraft/hasJoined" {
+			writer.WriteHeader(http.StatusNotFound)
+			return
+		}
+		joins <- request.URL.Query()
+		switch request.URL.Query().Get("username") {
+		case "Notch":
+			writer.Write([]byte(`{"id": "069a79f444e94726a5befca90e38aaf5", "name": "Notch", "properties": [{"name": "textures", "value": "e30="}]}`))
+		case "Renamed":
+			writer.Write([]byte(`{"id": "853c80ef3c3749fdaa49938b674adae6", "name": "jeb_", "properties": []}`))
+		default:
+			writer.WriteHeader(http.StatusNoContent)
+		}
+	}))
+	defer sessionServer.Close()
+	server := startTestServer(t, func(config *configuration.ServerConfiguration) {
+		config.OnlineMode.Enabled = true
+		config.OnlineMode.SessionServer = sessionServer.URL + "/"
+		config.OnlineMode.PreventProxyConnections = true
+	})
+	for _, test := range []struct {
+		protocolVersion int
+		name            string
+		text            string
+	}{
+		{767, "Notch", "You are not "},
+		{340, "Notch", "You are not "},
+		{5, "Notch", "You are not "},
+		{767, "Unknown", "Failed to verify username!"},
+		{767, "Renamed", "Failed to verify username!"},
+	} {
+		client := server.dial(t)
+		client.handshake(test.protocolVersion, LoginState)
+		client.send(&LoginStart{Name: test.name, Uuid: "00000000-0000-0000-0000-000000000000"})
+		encryptionRequest, isEncryptionRequest := client.receive().(*EncryptionRequestPacket)
+		if !isEncryptionRequest {
+			t.Fatalf("%v: the server did not send an Encryption Request", test.name)
+		} else if encryptionRequest.ServerId != "" || len(encryptionRequest.VerifyToken) != verifyTokenLength || !encryptionRequest.ShouldAuthenticate {
+			t.Errorf("%v: received an unexpected Encryption Request: %+v", test.name, encryptionRequest)
+		}
+		parsedKey, err := x509.ParsePKIXPublicKey(encryptionRequest.PublicKey)
+		if err != nil {
+			t.Fatal(err)
+		}
+		publicKey := parsedKey.(*rsa.PublicKey)
+		sharedSecret := make([]byte, 16)
+		rand.Read(sharedSecret)
+		encryptedSecret, _ := rsa.EncryptPKCS1v15(rand.Reader, publicKey, sharedSecret)
+		encryptedToken, _ := rsa.EncryptPKCS1v15(rand.Reader, publicKey, encryptionRequest.VerifyToken)
+		client.send(&EncryptionResponsePacket{SharedSecret: encryptedSecret, VerifyToken: encryptedToken})
+		client.enableEncryption(sharedSecret)
+		// the disconnect can only be decoded if the server encrypts it with the shared secret
+		if disconnect, isDisconnect := client.receive().(*LoginDisconnectPacket); !isDisconnect || disconnect.Text.Text != test.text {
+			t.Errorf("%v: received %+v instead of %q", test.name, disconnect, test.text)
+		}
+		client.expectClosed()
+		select {
+		case join := <-joins:
+			serverHash := datatypes.MinecraftDigest([]byte(""), sharedSecret, encryptionRequest.PublicKey)
+			if join.Get("username") != test.name || join.Get("serverId") != serverHash || join.Get("ip") != "127.0.0.1" {
+				t.Errorf("%v: the session server received %v instead of the server hash %v", test.name, join, serverHash)
+			}
+		default:
+			t.Errorf("%v: the session server was not asked", test.name)
+		}
+	}
+	// the uuid of the profile replaces the uuid the client sent
+	server.expectLog(t, "Received login attempt. [playerName=Notch, uuid=069a79f4-44e9-4726-a5be-fca90e38aaf5, signed=false, whitelisted=false, transferred=false]")
+	server.expectLog(t, "Player could not be authenticated. [playerName=Unknown, reason=the session server did not confirm the join]")
+	server.expectLog(t, "Player could not be authenticated. [playerName=Renamed, reason=the session server sent the profile of \"jeb_\"]")
+}
+
+func TestOfflineModeIgnoresTheSentUuid(t *testing.T) {
+	server := startTestServer(t, func(config *configuration.ServerConfiguration) {
+		config.Bans.EnforceWhitelist = true
+		config.Bans.WhitelistMessage = configuration.ChatValue{Text: "not whitelisted"}
+	})
+	if _, err := server.BanLists.AddToWhitelist("Notch"); err != nil {
+		t.Fatal(err)
+	}
+	for _, test := range []struct {
+		name     string
+		uuid     string
+		accepted bool
+	}{
+		{"Notch", bans.OfflinePlayerUuid("Notch"), true},
+		// the uuid of a whitelisted player does not admit another name
+		{"Griefer", bans.OfflinePlayerUuid("Notch"), false},
+		// the offline uuid is derived from the name, the sent uuid is ignored
+		{"Notch", bans.OfflinePlayerUuid("Griefer"), true},
+	} {
+		client := server.dial(t)
+		client.handshake(767, LoginState)
+		client.send(&LoginStart{Name: test.name, Uuid: test.uuid})
+		disconnect, isDisconnect := client.receive().(*LoginDisconnectPacket)
+		if !isDisconnect {
+			t.Fatalf("%v: the server did not send a Login Disconnect", test.name)
+		} else if accepted := disconnect.Text.Text != "not whitelisted"; accepted != test.accepted {
+			t.Errorf("%v with the uuid %v was accepted: %v", test.name, test.uuid, accepted)
+		}
+		client.expectClosed()
+	}
+	server.expectLog(t, "Player which is not whitelisted tried to login. [playerName=Griefer, uuid="+bans.OfflinePlayerUuid("Griefer")+"]")
+}
+
+func TestEncryptionPacketLayouts(t *testing.T) {
+	for _, test := range []struct {
+		protocolVersion int
+		packet          Packet
+		encoded         string
+	}{
+		// 1.7 prefixes the byte arrays with a short, the server id is a string in all versions
+		{5, &EncryptionRequestPacket{PublicKey: []byte{1, 2}, VerifyToken: []byte{3}, ShouldAuthenticate: true}, "00" + "00020102" + "000103"},
+		{47, &EncryptionRequestPacket{PublicKey: []byte{1, 2}, VerifyToken: []byte{3}, ShouldAuthenticate: true}, "00" + "020102" + "0103"},
+		{767, &EncryptionRequestPacket{PublicKey: []byte{1, 2}, VerifyToken: []byte{3}, ShouldAuthenticate: true}, "00" + "020102" + "0103" + "01"},
+		{5, &EncryptionResponsePacket{SharedSecret: []byte{1, 2}, VerifyToken: []byte{3}}, "00020102" + "000103"},
+		{47, &EncryptionResponsePacket{SharedSecret: []byte{1, 2}, VerifyToken: []byte{3}}, "020102" + "0103"},
+	} {
+		data := bytes.NewBuffer([]byte{})
+		if err := test.packet.Encode(data, test.protocolVersion); err != nil || hex.EncodeToString(data.Bytes()) != test.encoded {
+			t.Errorf("%v: %T was encoded as %x instead of %v (%v)", test.protocolVersion, test.packet, data.Bytes(), test.encoded, err)
+			continue
+		}
+		decoded := reflect.New(reflect.TypeOf(test.packet).Elem()).Interface().(Packet)
+		if err := decoded.Decode(data, test.protocolVersion); err != nil || !reflect.DeepEqual(decoded, test.packet) {
+			t.Errorf("%v: %x was decoded as %+v (%v)", test.protocolVersion, test.encoded, decoded, err)
+		}
+	}
+}
+
+func TestLoginDisconnectRules(t *testing.T) {
+	whitelisted := true
+	server := startTestServer(t, func(config *configuration.ServerConfiguration) {
+		config.LoginAttempt.Rules = []configuration.DisconnectRuleValues{
+			{Names: []string{"jeb_"}, DisconnectText: configuration.ChatValue{Text: "named rule"}},
+			{NamePattern: "^Test[0-9]+$", DisconnectText: configuration.ChatValue{Text: "pattern rule"}},
+			{Whitelisted: &whitelisted, DisconnectText: configuration.ChatValue{Text: "whitelisted rule"}},
+		}
+		if err := configuration.CompileDisconnectRules(config.LoginAttempt.Rules); err != nil {
+			t.Fatal(err)
+		}
+	})
+	if err := configuration.CompileDisconnectRules([]configuration.DisconnectRuleValues{{NamePattern: "Test[0-9"}}); err == nil {
+		t.Error("an invalid name pattern was compiled")
+	}
+	if _, err := server.BanLists.AddToWhitelist("Dinnerbone"); err != nil {
+		t.Fatal(err)
+	}
+	players := map[string]string{
+		"jeb_":       "named rule",
+		"Test123":    "pattern rule",
+		"Test":       "You are not ",
+		"Dinnerbone": "whitelisted rule",
+	}
+	for name, text := range players {
+		client := server.dial(t)
+		client.handshake(340, LoginState)
+		client.send(&LoginStart{Name: name})
+		if disconnect, isDisconnect := client.receive().(*LoginDisconnectPacket); !isDisconnect || disconnect.Text.Text != text {
+			t.Errorf("%v received %+v instead of %q", name, disconnect, text)
+		}
+	}
+	server.expectLog(t, "Received login attempt. [playerName=Dinnerbone, uuid=4d258a81-2358-3084-8166-05b9faccad80, signed=false, whitelisted=true, transferred=false]")
+}
+
+func TestInvalidPacketLength(t *testing.T) {
+	server := startTestServer(t, nil)
+	client := server.dial(t)
+	client.conn.Write([]byte{0xff, 0xff, 0x7f})
+	client.expectClosed()
+	server.expectLog(t, "Received packet with invalid length. [length=2097151, maximum=1024, state=handshaking]")
+}
+
+func TestMetrics(t *testing.T) {
+	server := startTestServer(t, nil)
+	statusBefore, pingsBefore := statusRequests.Value(), pings.WithLabelValues("status").Value()
+	handshakesBefore := handshakes.WithLabelValues("763", "1.20.1", "status").Value()
+	hostnamesBefore := requestedHostnames.WithLabelValues("localhost").Value()
+	closedBefore := connectionsClosed.WithLabelValues(closeReasonEof).Value()
+	client := server.dial(t)
+	client.handshake(763, StatusState)
+	client.status()
+	client.send(&PingPacket{Payload: 1})
+	client.receive()
+	client.conn.Close()
+	server.expectLog(t, "<-- Closed connection.")
+	for name, increase := range map[string]uint64{
+		"status requests":     statusRequests.Value() - statusBefore,
+		"pings":               pings.WithLabelValues("status").Value() - pingsBefore,
+		"handshakes":          handshakes.WithLabelValues("763", "1.20.1", "status").Value() - handshakesBefore,
+		"requested hostnames": requestedHostnames.WithLabelValues("localhost").Value() - hostnamesBefore,
+		"closed connections":  connectionsClosed.WithLabelValues(closeReasonEof).Value() - closedBefore,
+	} {
+		if increase != 1 {
+			t.Errorf("the %v increased by %v instead of 1", name, increase)
+		}
+	}
+	exposition := bytes.NewBuffer([]byte{})
+	metrics.DefaultRegistry.WriteTo(exposition)
+	if !strings.Contains(exposition.String(), `mcstatusserver_packet_handler_duration_seconds_count{packet="StatusRequest"}`) {
+		t.Errorf("the handler duration of the status request is missing:\n%v", exposition)
+	}
+}
+
+func TestAccessLog(t *testing.T) {
+	server := startTestServer(t, func(config *configuration.ServerConfiguration) {
+		config.IpForwarding = true
+	})
+	accessLog := &testLog{}
+	accessLogger, err := NewAccessLogger(accessLog, AccessLogJson, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	server.AccessLog = accessLogger
+	serverConn, clientConn := net.Pipe()
+	go server.ServeConn(serverConn)
+	client := newTestClient(t, clientConn)
+	client.ProtocolVersion = 340
+	client.send(&HandshakePacket{ProtocolVersion: 340, ServerAddress: "Play.Example.com.\x00203.0.113.7\x00069a79f444e94726a5befca90e38aaf5", ServerPort: 25565, NextState: int(LoginState)})
+	client.State = LoginState
+	client.send(&LoginStart{Name: "Notch"})
+	if _, isDisconnect := client.receive().(*LoginDisconnectPacket); !isDisconnect {
+		t.Fatal("the server did not send a Login Disconnect")
+	}
+	client.expectClosed()
+	deadline := time.Now().Add(testTimeout)
+	for !strings.HasSuffix(accessLog.String(), "\n") {
+		if time.Now().After(deadline) {
+			t.Fatal("the server did not write an access event")
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+	event := map[string]interface{}{}
+	if err := json.Unmarshal([]byte(accessLog.String()), &event); err != nil {
+		t.Fatalf("the access event is not a JSON line: %v", err)
+	}
+	for field, value := range map[string]interface{}{
+		"forwarded_ip":     "203.0.113.7",
+		"protocol_version": 340.0,
+		"version":          "1.12.2",
+		"hostname":         "play.example.com",
+		"port":             25565.0,
+		"intent":           "login",
+		"player_name":      "Notch",
+		"outcome":          loginOutcomeDisconnected,
+		"close_reason":     closeReasonFinished,
+	} {
+		if event[field] != value {
+			t.Errorf("the field %v was written as %#v instead of %#v", field, event[field], value)
+		}
+	}
+	if event["bytes_in"].(float64) <= 0 || event["bytes_out"].(float64) <= 0 {
+		t.Errorf("the transferred bytes were not counted: %v", accessLog)
+	}
+	if !strings.HasPrefix(accessLog.String(), `{"time":`) {
+		t.Errorf("the fields were not written in their order: %v", accessLog)
+	}
+}
+
+func TestIpForwarding(t *testing.T) {
+	for _, test := range []struct {
+		ipForwarding bool
+		ip           string
+		forwardedIp  string
+	}{
+		{true, "203.0.113.7", "203.0.113.7"},
+		// the forwarded ip of a client which did not connect through the proxy is not trusted
+		{false, "127.0.0.1", ""},
+	} {
+		server := startTestServer(t, func(config *configuration.ServerConfiguration) {
+			config.IpForwarding = test.ipForwarding
+		})
+		published := make(chan events.Event, 100)
+		server.Events.Subscribe(func(event events.Event) {
+			published <- event
+		})
+		client := server.dial(t)
+		client.ProtocolVersion = 763
+		client.send(&HandshakePacket{ProtocolVersion: 763, ServerAddress: "play.example.com\x00203.0.113.7\x00069a79f444e94726a5befca90e38aaf5", ServerPort: 25565, NextState: int(LoginState)})
+		client.State = LoginState
+		client.send(&LoginStart{Name: "Notch"})
+		client.receive()
+		client.expectClosed()
+		deadline := time.After(testTimeout)
+	waitForLoginAttempt:
+		for {
+			select {
+			case event := <-published:
+				if event.Type == events.LoginAttempt {
+					if event.Ip != test.ip {
+						t.Errorf("ip forwarding %v: the login attempt was published with the ip %v", test.ipForwarding, event.Ip)
+					}
+					break waitForLoginAttempt
+				}
+			case <-deadline:
+				t.Fatalf("ip forwarding %v: the login attempt was not published", test.ipForwarding)
+			}
+		}
+		for len(server.RecentAccessEvents(1)) == 0 {
+			select {
+			case <-deadline:
+				t.Fatalf("ip forwarding %v: the access event was not recorded", test.ipForwarding)
+			case <-time.After(10 * time.Millisecond):
+			}
+		}
+		if event := server.RecentAccessEvents(1)[0]; event.RemoteIp != "127.0.0.1" || event.ForwardedIp != test.forwardedIp {
+			t.Errorf("ip forwarding %v: the access event has the ips %v and %v", test.ipForwarding, event.RemoteIp, event.ForwardedIp)
+		}
+	}
+}
+
+func TestForwardedHandshakeLength(t *testing.T) {
+	// BungeeCord appends the ip, the uuid and the properties of the profile with the signed skin textures
+	textures := base64.StdEncoding.EncodeToString([]byte(`{"timestamp":1760000000000,"profileId":"069a79f444e94726a5befca90e38aaf5","profileName":"Notch","signatureRequired":true,"textures":{"SKIN":{"url":"http://textures.minecraft.net/texture/292009a4925b58f02c77dadc3ecef07ea4c7472f64e0fdc32ce5522489362680"},"CAPE":{"url":"http://textures.minecraft.net/texture/2340c0e03dd24a11b15a8b33c2a7e9e32abb2051b2481d0ba7defd635ca7a933"}}}`))
+	signature := base64.StdEncoding.EncodeToString(bytes.Repeat([]byte{0x5a}, 512))
+	serverAddress := "play.example.com\x00203.0.113.7\x00069a79f444e94726a5befca90e38aaf5\x00" + `[{"name":"textures","value":"` + textures + `","signature":"` + signature + `"}]`
+	if len(serverAddress) <= configuration.DefaultConfiguration().MaximumPacketLength.Handshaking {
+		t.Fatalf("the forwarded handshake is only %v bytes long", len(serverAddress))
+	}
+	for _, ipForwarding := range []bool{true, false} {
+		server := startTestServer(t, func(config *configuration.ServerConfiguration) {
+			config.IpForwarding = ipForwarding
+		})
+		client := server.dial(t)
+		client.ProtocolVersion = 763
+		client.send(&HandshakePacket{ProtocolVersion: 763, ServerAddress: serverAddress, ServerPort: 25565, NextState: int(LoginState)})
+		client.State = LoginState
+		if !ipForwarding {
+			// the limit of the configuration applies to clients which did not connect through the proxy
+			client.expectClosed()
+			server.expectLog(t, "Received packet with invalid length.")
+			continue
+		}
+		client.send(&LoginStart{Name: "Notch"})
+		if _, isDisconnect := client.receive().(*LoginDisconnectPacket); !isDisconnect {
+			t.Error("the forwarded handshake was not accepted")
+		}
+	}
+}
+
+func TestForwardedIpBansAndRules(t *testing.T) {
+	server := startTestServer(t, func(config *configuration.ServerConfiguration) {
+		config.IpForwarding = true
+		config.LoginAttempt.Rules = []configuration.DisconnectRuleValues{
+			{Ips: []string{"203.0.113.0/24"}, DisconnectText: configuration.ChatValue{Text: "forwarded rule"}},
+		}
+	})
+	if err := server.BanLists.BanIp("198.51.100.1", "test", "banned behind the proxy", time.Time{}); err != nil {
+		t.Fatal(err)
+	}
+	login := func(forwardedIp string) *testClient {
+		client := server.dial(t)
+		client.ProtocolVersion = 763
+		client.send(&HandshakePacket{ProtocolVersion: 763, ServerAddress: "play.example.com\x00" + forwardedIp + "\x00069a79f444e94726a5befca90e38aaf5", ServerPort: 25565, NextState: int(LoginState)})
+		client.State = LoginState
+		return client
+	}
+	// the rules match the address of the client instead of the address of the proxy
+	client := login("203.0.113.7")
+	client.send(&LoginStart{Name: "Notch"})
+	if disconnect, isDisconnect := client.receive().(*LoginDisconnectPacket); !isDisconnect || disconnect.Text.Text != "forwarded rule" {
+		t.Errorf("the client received %+v instead of the text of the ip rule", disconnect)
+	}
+	// banned clients are rejected after the handshake although the proxy is not banned
+	client = login("198.51.100.1")
+	client.expectClosed()
+	server.expectLog(t, "Rejected connection from banned forwarded address. [ip=198.51.100.1, ban=198.51.100.1, reason=banned behind the proxy]")
+}
+
+func TestAccessLogLogfmt(t *testing.T) {
+	if _, err := NewAccessLogger(ioutil.Discard, AccessLogLogfmt, []string{"remote_ip", "unknown"}); err == nil {
+		t.Error("an unknown field was accepted")
+	}
+	accessLog := bytes.NewBuffer([]byte{})
+	accessLogger, err := NewAccessLogger(accessLog, AccessLogLogfmt, []string{"intent", "player_name", "hostname", "duration_ms", "port"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	event := &AccessEvent{Intent: "status", Hostname: `say "hi"`, Duration: 1500 * time.Microsecond, Port: 25565}
+	if err := accessLogger.Log(event); err != nil {
+		t.Fatal(err)
+	}
+	if line := `intent=status player_name="" hostname="say \"hi\"" duration_ms=1.5 port=25565` + "\n"; accessLog.String() != line {
+		t.Errorf("the event was written as %q instead of %q", accessLog, line)
+	}
+}
+
+func TestReloadQueue(t *testing.T) {
+	backend := startTestServer(t, nil)
+	server := startTestServer(t, nil)
+	waiting := playerQueue.Join("Notch")
+	defer playerQueue.Leave(waiting)
+	// the monitor of the backend server is started when a reload enables the queue
+	server.UpdateConfiguration(func(config *configuration.ServerConfiguration) {
+		config.Queue.Enabled = true
+		config.Queue.BackendAddress = backend.Address
+		config.Queue.CheckInterval = 10
+	})
+	server.expectLog(t, "The backend server "+backend.Address+" is available.")
+	select {
+	case <-waiting.released:
+	case <-time.After(testTimeout):
+		t.Fatal("the player was not released when the backend server was available")
+	}
+	// it is started again with the new backend address
+	server.UpdateConfiguration(func(config *configuration.ServerConfiguration) {
+		config.Queue.BackendAddress = "127.0.0.1:1"
+	})
+	deadline := time.Now().Add(testTimeout)
+	for playerQueue.IsBackendAvailable() {
+		if time.Now().After(deadline) {
+			t.Fatal("the new backend address was not checked")
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+	waiting = playerQueue.Join("Notch")
+	defer playerQueue.Leave(waiting)
+	// the players are not held forever when the queue is disabled, but they are not released to the backend server
+	server.UpdateConfiguration(func(config *configuration.ServerConfiguration) {
+		config.Queue.Enabled = false
+	})
+	select {
+	case <-waiting.removed:
+	default:
+		t.Error("the player was not removed when the queue was disabled")
+	}
+	select {
+	case <-waiting.released:
+		t.Error("the player was released when the queue was disabled")
+	default:
+	}
+	if playerQueue.IsBackendAvailable() {
+		t.Error("the queue kept the availability of the backend server after it was disabled")
+	}
+}
+
+func TestDisableQueue(t *testing.T) {
+	server := startTestServer(t, func(config *configuration.ServerConfiguration) {
+		config.Queue.Enabled = true
+		config.Queue.BackendAddress = "127.0.0.1:1"
+		config.Queue.CheckInterval = 10
+	})
+	client := server.dial(t)
+	client.handshake(767, LoginState)
+	client.send(&LoginStart{Name: "Notch", Uuid: "069a79f4-44e9-4726-a5be-fca90e38aaf5"})
+	if _, isSuccess := client.receive().(*LoginSuccessPacket); !isSuccess {
+		t.Fatal("the server did not send a Login Success")
+	}
+	client.send(&LoginAcknowledgedPacket{})
+	client.State = ConfigurationState
+	server.expectLog(t, "Player joined the queue. [playerName=Notch")
+	server.UpdateConfiguration(func(config *configuration.ServerConfiguration) {
+		config.Queue.Enabled = false
+	})
+	// the player is not transferred to the backend server which was not available
+	for {
+		packet := client.receive()
+		if _, isKeepAlive := packet.(*KeepAlivePacket); isKeepAlive {
+			continue
+		}
+		if disconnect, isDisconnect := packet.(*DisconnectPacket); !isDisconnect || disconnect.Text.Text != "You are not " {
+			t.Errorf("the player received %+v instead of the disconnect text", packet)
+		}
+		break
+	}
+	client.expectClosed()
+	server.expectLog(t, "The queue was disabled. [playerName=Notch]")
+}
+
+func TestMaintenance(t *testing.T) {
+	server := startTestServer(t, nil)
+	server.UpdateConfiguration(func(config *configuration.ServerConfiguration) {
+		config.Maintenance.Enabled = true
+	})
+	client := server.dial(t)
+	client.handshake(763, StatusState)
+	if status := client.status(); status.Description.Text != "The server is in maintenance." || status.Version.Name != "Maintenance" {
+		t.Errorf("the status does not show the maintenance texts: %+v", status)
+	}
+	client = server.dial(t)
+	client.handshake(763, LoginState)
+	client.send(&LoginStart{Name: "Notch"})
+	if disconnect, isDisconnect := client.receive().(*LoginDisconnectPacket); !isDisconnect || disconnect.Text.Text != "The server is in maintenance, please come back later." {
+		t.Errorf("the player did not receive the maintenance text: %+v", disconnect)
+	}
+}
+
+func TestConfiguredLimbo(t *testing.T) {
+	server := startTestServer(t, func(config *configuration.ServerConfiguration) {
+		config.Limbo.Enabled = true
+		config.Limbo.ProtocolVersions = []int{767}
+		config.Limbo.MaximumDuration = 500
+	})
+	login := func(knownPacks ...KnownPack) *testClient {
+		client := server.dial(t)
+		client.handshake(767, LoginState)
+		client.send(&LoginStart{Name: "Notch", Uuid: "069a79f4-44e9-4726-a5be-fca90e38aaf5"})
+		if _, isSuccess := client.receive().(*LoginSuccessPacket); !isSuccess {
+			t.Fatal("the server did not send a Login Success")
+		}
+		client.send(&LoginAcknowledgedPacket{})
+		client.State = ConfigurationState
+		if flags, isFeatureFlags := client.receive().(*FeatureFlagsPacket); !isFeatureFlags || !reflect.DeepEqual(flags.Flags, []string{"minecraft:vanilla"}) {
+			t.Fatalf("the server did not enable the vanilla features: %+v", flags)
+		}
+		offered, isKnownPacks := client.receive().(*KnownPacksPacket)
+		if !isKnownPacks || !reflect.DeepEqual(offered.Packs, []KnownPack{{"minecraft", "core", "1.21"}, {"minecraft", "core", "1.21.1"}}) {
+			t.Fatalf("the server did not offer the vanilla data pack: %+v", offered)
+		}
+		client.send(&KnownPacksPacket{knownPacks})
+		return client
+	}
+	client := login(KnownPack{"minecraft", "core", "1.21.1"})
+	registries := map[string]int{}
+	for {
+		packet := client.receive()
+		if _, finished := packet.(*FinishConfigurationPacket); finished {
+			break
+		}
+		registryData, isRegistryData := packet.(*RegistryDataPacket)
+		if !isRegistryData {
+			t.Fatalf("received %T instead of the registries", packet)
+		}
+		for _, entry := range registryData.Entries {
+			if entry.Data != nil {
+				t.Errorf("the entry %v of %v is not loaded from the data pack", entry.Id, registryData.Registry)
+			}
+		}
+		registries[registryData.Registry] = len(registryData.Entries)
+	}
+	if len(registries) != 11 || registries["minecraft:dimension_type"] != 1 || registries["minecraft:damage_type"] != len(limboDamageTypes)+1 {
+		t.Errorf("the server sent unexpected registries: %v", registries)
+	}
+	client.send(&FinishConfigurationPacket{})
+	client.State = PlayState
+	// the world is spawned with the play packets which are not registered: Login, Set Default Spawn Position,
+	// Synchronize Player Position, Game Event, Set Subtitle Text, Set Title Text and the System Chat Messages
+	for _, expectedId := range []int{0x2B, 0x56, 0x40, 0x22, 0x63, 0x65, 0x6C, 0x6C} {
+		rawPacket, err, _ := datatypes.ReadPacket(client.reader)
+		if err != nil {
+			t.Fatal(err)
+		} else if rawPacket.Id != expectedId {
+			t.Fatalf("received the packet %#x instead of %#x", rawPacket.Id, expectedId)
+		}
+	}
+	server.expectLog(t, "Player entered the limbo. [playerName=Notch]")
+	// the player receives the disconnect text after the maximum duration
+	for {
+		rawPacket, err, _ := datatypes.ReadPacket(client.reader)
+		if err != nil {
+			t.Fatal(err)
+		} else if rawPacket.Id != 0x1D {
+			continue
+		}
+		disconnect := &DisconnectPacket{}
+		if err := disconnect.Decode(rawPacket.Content, 767); err != nil || disconnect.Text.Text != "You are not " {
+			t.Errorf("received an unexpected disconnect text: %+v (%v)", disconnect.Text, err)
+		}
+		break
+	}
+	client.expectClosed()
+	// clients which do not know the vanilla data pack can not load the registries
+	client = login()
+	if disconnect, isDisconnect := client.receive().(*DisconnectPacket); !isDisconnect || disconnect.Text.Text != "You are not " {
+		t.Errorf("the player did not receive the disconnect text: %+v", disconnect)
+	}
+	client.expectClosed()
+	server.expectLog(t, "Player does not know the vanilla data pack of the limbo. [playerName=Notch]")
+}
+
+func TestKick(t *testing.T) {
+	server := startTestServer(t, nil)
+	client := server.dial(t)
+	client.handshake(763, LoginState)
+	var connections []ConnectionInfo
+	deadline := time.Now().Add(testTimeout)
+	for len(connections) != 1 || connections[0].State != LoginState {
+		if time.Now().After(deadline) {
+			t.Fatalf("the connection was not listed in the login state: %+v", connections)
+		}
+		time.Sleep(10 * time.Millisecond)
+		connections = server.Connections()
+	}
+	if info := connections[0]; info.ProtocolVersion != 763 || info.Version != "1.20.1" || info.Hostname != "localhost" {
+		t.Errorf("the connection was listed with unexpected values: %+v", info)
+	}
+	if server.Kick(connections[0].Id+1, configuration.ChatValue{}) {
+		t.Error("a connection which does not exist was kicked")
+	}
+	if !server.Kick(connections[0].Id, configuration.ChatValue{Text: "kicked"}) {
+		t.Fatal("the connection was not kicked")
+	}
+	if disconnect, isDisconnect := client.receive().(*LoginDisconnectPacket); !isDisconnect || disconnect.Text.Text != "kicked" {
+		t.Errorf("the player did not receive the kick text: %+v", disconnect)
+	}
+	client.expectClosed()
+	for len(server.RecentAccessEvents(1)) == 0 {
+		if time.Now().After(deadline) {
+			t.Fatal("the kicked connection was not closed")
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+	if event := server.RecentAccessEvents(1)[0]; event.CloseReason != closeReasonClosedByServer {
+		t.Errorf("the kick was recorded with the close reason %v", event.CloseReason)
+	}
+	if connections := server.Connections(); len(connections) != 0 {
+		t.Errorf("the kicked connection is still listed: %+v", connections)
+	}
+}
+
+func TestEvents(t *testing.T) {
+	server := startTestServer(t, func(config *configuration.ServerConfiguration) {
+		config.Maintenance.Enabled = true
+	})
+	published := make(chan events.Event, 100)
+	server.Events.Subscribe(func(event events.Event) {
+		if event.Type != events.ServerStarted {
+			published <- event
+		}
+	})
+	expectEvent := func(eventType string) events.Event {
+		t.Helper()
+		select {
+		case event := <-published:
+			if event.Type != eventType {
+				t.Fatalf("received the event %+v instead of %v", event, eventType)
+			}
+			return event
+		case <-time.After(testTimeout):
+			t.Fatalf("the event %v was not published", eventType)
+		}
+		return events.Event{}
+	}
+	if err := server.BanLists.BanPlayer("Griefer", "test", "griefing", time.Time{}); err != nil {
+		t.Fatal(err)
+	}
+	login := func(name string) {
+		client := server.dial(t)
+		client.handshake(763, LoginState)
+		client.send(&LoginStart{Name: name})
+		client.receive()
+		client.expectClosed()
+	}
+	login("Notch")
+	if event := expectEvent(events.LoginAttempt); event.PlayerName != "Notch" || !event.Maintenance || event.Ip != "127.0.0.1" || event.Outcome != loginOutcomeDisconnected {
+		t.Errorf("the login attempt was published as %+v", event)
+	}
+	// the address is published as unique visitor when its first connection was closed
+	expectEvent(events.UniqueVisitor)
+	login("Griefer")
+	if event := expectEvent(events.BanHit); event.PlayerName != "Griefer" || event.Reason != "griefing" {
+		t.Errorf("the ban hit was published as %+v", event)
+	}
+	expectEvent(events.LoginAttempt)
+	server.Close()
+	expectEvent(events.ServerStopped)
+}
+
+func TestHooks(t *testing.T) {
+	handledPackets := make(chan string, 10)
+	var wrappedConnections int32
+	server := startTestServerWithHooks(t, nil, Hooks{
+		StatusProvider: StatusProviderFunc(func(context HandshakeContext) (*StatusResponse, error) {
+			if context.ProtocolVersion != 763 {
+				return nil, nil
+			}
+			status := &StatusResponse{}
+			status.Description.Text = "custom status for " + context.Hostname
+			return status, nil
+		}),
+		LoginHandler: LoginHandlerFunc(func(context HandshakeContext, player LoginStart, text configuration.ChatValue) configuration.ChatValue {
+			return configuration.ChatValue{Text: "Goodbye " + player.Name}
+		}),
+		ConnectionFilters: []ConnectionFilter{ConnectionFilterFunc(func(conn net.Conn) bool {
+			return conn.RemoteAddr().Network() != "pipe"
+		})},
+		PacketMiddleware: []PacketMiddleware{func(next PacketHandler) PacketHandler {
+			atomic.AddInt32(&wrappedConnections, 1)
+			return func(connection *Connection, packet Packet) ConnectionError {
+				handledPackets <- packetTypeName(packet)
+				return next(connection, packet)
+			}
+		}},
+	})
+	client := server.dial(t)
+	client.handshake(763, StatusState)
+	if status := client.status(); status.Description.Text != "custom status for localhost" {
+		t.Errorf("the status of the provider was not sent: %+v", status)
+	}
+	client = server.dial(t)
+	client.handshake(47, StatusState)
+	if status := client.status(); status.Version.Name != "mcstatusserver 420" {
+		t.Errorf("the configured status was not sent: %+v", status)
+	}
+	client = server.dial(t)
+	client.handshake(763, LoginState)
+	client.send(&LoginStart{Name: "Notch"})
+	if disconnect, isDisconnect := client.receive().(*LoginDisconnectPacket); !isDisconnect || disconnect.Text.Text != "Goodbye Notch" {
+		t.Errorf("the text of the login handler was not sent: %+v", disconnect)
+	}
+	for _, expected := range []string{"Handshake", "StatusRequest", "Handshake", "StatusRequest", "Handshake", "LoginStart"} {
+		if packet := <-handledPackets; packet != expected {
+			t.Errorf("the middleware received %v instead of %v", packet, expected)
+		}
+	}
+	// the middleware is wrapped once per connection, not for every packet
+	if wrapped := atomic.LoadInt32(&wrappedConnections); wrapped != 3 {
+		t.Errorf("the middleware was wrapped %v times for 3 connections", wrapped)
+	}
+	serverConn, clientConn := net.Pipe()
+	go server.ServeConn(serverConn)
+	newTestClient(t, clientConn).expectClosed()
+}
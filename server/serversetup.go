@@ -5,102 +5,322 @@ import (
 	"github.com/michivip/mcstatusserver/datatypes"
 	"log"
 	"io"
-	"bytes"
-	"encoding/json"
-	"strings"
 	"github.com/michivip/mcstatusserver/configuration"
 	"fmt"
 	"time"
+	"github.com/michivip/mcstatusserver/bans"
+	"github.com/michivip/mcstatusserver/protocol"
+	"sync"
+	"sync/atomic"
+	"reflect"
+	"github.com/michivip/mcstatusserver/events"
 )
 
-var Closed = false
+// the amount of access events which are kept for RecentAccessEvents
+const recentAccessEventsCapacity = 100
 
-func StartServer(config *configuration.ServerConfiguration) *net.TCPListener {
-	log.Printf("Starting server on %v\n", config.Address)
-	tcpAddress, err := net.ResolveTCPAddr("tcp4", config.Address)
-	if err != nil {
-		log.Fatalf("An error ocurred while resolving the bind address:")
-		panic(err)
+// a status server which handles the connections of a listener
+// it can be started without a configuration file or console (e.g. in tests with configuration.DefaultConfiguration)
+type Server struct {
+	BanLists *bans.Lists
+	// receives an event per connection (nil if no access log is written)
+	AccessLog *AccessLogger
+	// the events of the server (e.g. login attempts), handlers are subscribed before the server is started
+	Events *events.Bus
+	// the customizations of an application which embeds the server (see Hooks)
+	Hooks Hooks
+
+	closed    chan struct{}
+	closeOnce sync.Once
+	started   time.Time
+	mutex     sync.Mutex
+	listener  net.Listener
+	config    *configuration.ServerConfiguration
+	// the open connections by their ids
+	connections      map[uint64]*Connection
+	nextConnectionId uint64
+	// the last access events in a ring buffer
+	accessEvents     [recentAccessEventsCapacity]AccessEvent
+	accessEventCount int
+	// the addresses which connected since the server was started
+	visitors map[string]struct{}
+	// closed to stop the monitor of the backend server (nil if it is not running)
+	stopBackendMonitor chan struct{}
+}
+
+// this method creates a server with the given configuration and ban lists
+func NewServer(config *configuration.ServerConfiguration, banLists *bans.Lists) *Server {
+	return &Server{
+		config:      config,
+		BanLists:    banLists,
+		Events:      events.NewBus(),
+		closed:      make(chan struct{}),
+		started:     time.Now(),
+		connections: map[uint64]*Connection{},
+		visitors:    map[string]struct{}{},
+	}
+}
+
+// returns the configuration which is used by new connections
+func (server *Server) Configuration() *configuration.ServerConfiguration {
+	server.mutex.Lock()
+	defer server.mutex.Unlock()
+	return server.config
+}
+
+// this method replaces the configuration which is used by new connections (e.g. after it was reloaded)
+// open connections keep the configuration they were accepted with, the cached status responses are built again
+func (server *Server) SetConfiguration(config *configuration.ServerConfiguration) {
+	server.mutex.Lock()
+	defer server.mutex.Unlock()
+	previous := server.config
+	server.config = config
+	server.applyQueueChanges(previous.Queue, config.Queue)
+}
+
+// this method applies the given change to a copy of the current configuration and replaces it
+// the change must not modify the slices and maps of the configuration in place because they are shared with the copy
+func (server *Server) UpdateConfiguration(change func(config *configuration.ServerConfiguration)) {
+	server.mutex.Lock()
+	defer server.mutex.Unlock()
+	config := *server.config
+	change(&config)
+	previous := server.config
+	server.config = &config
+	server.applyQueueChanges(previous.Queue, config.Queue)
+}
+
+// this method restarts the monitor of the backend server if the queue values were changed while the server is running
+// the players which wait in the queue receive their disconnect text if the queue was disabled, so they are not held forever
+// it is called with the locked mutex
+func (server *Server) applyQueueChanges(previous, values configuration.QueueValues) {
+	if server.listener == nil || reflect.DeepEqual(previous, values) {
+		return
+	}
+	server.restartBackendMonitor(values)
+	if !values.Enabled {
+		playerQueue.removeAll()
+	}
+}
+
+// this method stops the running monitor of the backend server and starts a new one if the queue is enabled
+// it is called with the locked mutex
+func (server *Server) restartBackendMonitor(values configuration.QueueValues) {
+	if server.stopBackendMonitor != nil {
+		close(server.stopBackendMonitor)
+		server.stopBackendMonitor = nil
 	}
-	listener, err := net.ListenTCP("tcp4", tcpAddress)
+	if values.Enabled {
+		server.stopBackendMonitor = make(chan struct{})
+		go server.monitorBackend(values, server.stopBackendMonitor)
+	}
+}
+
+// this method binds the configured address (the port 0 binds an ephemeral port)
+// returns the listener which is passed to Serve or an error if the address could not be bound
+func (server *Server) Listen() (net.Listener, error) {
+	address := server.Configuration().Address
+	log.Printf("Starting server on %v\n", address)
+	listener, err := net.Listen("tcp4", address)
 	if err != nil {
-		log.Fatalf("Could not listen to bind address %v:\n", config.Address)
-		panic(err)
+		return nil, fmt.Errorf("could not listen to bind address %v: %v", address, err)
 	}
-	return listener
+	return listener, nil
 }
 
-func WaitForConnections(listener *net.TCPListener, config *configuration.ServerConfiguration) {
+// this method starts the background tasks of the server and accepts the connections of the given listener until the server is closed
+// returns nil if the server was closed or the error which stopped accepting connections
+func (server *Server) Serve(listener net.Listener) error {
+	server.mutex.Lock()
+	server.listener = listener
+	server.mutex.Unlock()
+	if server.IsClosed() {
+		return listener.Close()
+	}
+	server.publish(events.Event{Type: events.ServerStarted, Address: listener.Addr().String()})
+	server.mutex.Lock()
+	config := server.config
+	server.restartBackendMonitor(config.Queue)
+	server.mutex.Unlock()
+	if config.Limbo.Enabled {
+		for _, protocolVersion := range config.Limbo.ProtocolVersions {
+			if _, supported := limboProtocols[protocolVersion]; !supported {
+				log.Printf("The limbo does not support the protocol version %v, these clients receive the disconnect text.\n", protocol.Describe(protocolVersion))
+			}
+		}
+	}
 	for {
-		conn, err := listener.AcceptTCP()
+		conn, err := listener.Accept()
 		if err != nil {
-			if Closed {
-				return
-			} else {
-				log.Fatalln("There was an error while accepting a TCP connection:")
-				panic(err)
+			if server.IsClosed() {
+				return nil
 			}
+			return err
 		}
-		go handleConnection(conn, config)
+		go server.ServeConn(conn)
 	}
 }
 
-func handleConnection(conn *net.TCPConn, config *configuration.ServerConfiguration) {
-	log.Printf("[%v] --> Incoming connection.", conn.RemoteAddr())
+// this method handles a single connection until it is closed
+// the connection may be any stream (e.g. one end of a net.Pipe), ip bans are only checked for network connections
+func (server *Server) ServeConn(conn net.Conn) {
+	connectionsAccepted.Inc()
+	if ipBan, banned := server.BanLists.FindIpBan(remoteIp(conn.RemoteAddr())); banned {
+		log.Printf("[%v] Rejected connection from banned address. [ban=%v, reason=%v]\n", conn.RemoteAddr(), ipBan.Ip, ipBan.Reason)
+		conn.Close()
+		connectionsClosed.WithLabelValues(closeReasonBannedIp).Inc()
+		server.logAccess(&AccessEvent{Time: time.Now(), RemoteIp: ipString(remoteIp(conn.RemoteAddr())), CloseReason: closeReasonBannedIp})
+		server.publish(events.Event{Type: events.BanHit, Ip: ipString(remoteIp(conn.RemoteAddr())), Ban: ipBan.Ip, Reason: ipBan.Reason})
+		return
+	}
+	if !server.Hooks.accept(conn) {
+		logDebugf("[%v] Rejected connection by a connection filter.", conn.RemoteAddr())
+		conn.Close()
+		connectionsClosed.WithLabelValues(closeReasonFiltered).Inc()
+		server.logAccess(&AccessEvent{Time: time.Now(), RemoteIp: ipString(remoteIp(conn.RemoteAddr())), CloseReason: closeReasonFiltered})
+		return
+	}
+	server.handleConnection(&countingConn{Conn: conn}, server.Configuration())
+}
+
+// this method stops accepting connections and the background tasks, open connections are closed by their idle timeout
+func (server *Server) Close() (err error) {
+	server.closeOnce.Do(func() {
+		server.publish(events.Event{Type: events.ServerStopped})
+		close(server.closed)
+		server.mutex.Lock()
+		defer server.mutex.Unlock()
+		if server.listener != nil {
+			err = server.listener.Close()
+		}
+	})
+	return err
+}
+
+// returns whether the server was closed
+func (server *Server) IsClosed() bool {
+	select {
+	case <-server.closed:
+		return true
+	default:
+		return false
+	}
+}
+
+func (server *Server) handleConnection(conn *countingConn, config *configuration.ServerConfiguration) {
+	logDebugf("[%v] --> Incoming connection.", conn.RemoteAddr())
 	var connectionOpen bool = true
-	go func() {
-		time.Sleep(time.Millisecond * time.Duration(config.ConnectionTimeout))
+	idleTimeout := time.AfterFunc(time.Millisecond*time.Duration(config.ConnectionTimeout), func() {
 		connectionOpen = false
 		err := conn.Close()
 		if err == nil {
-			log.Printf("[%v] Idle timeout exceeded.", conn.RemoteAddr())
+			logDebugf("[%v] Idle timeout exceeded.", conn.RemoteAddr())
 		}
-	}()
+	})
+	// initial state is Handshaking (http://wiki.vg/Protocol#Definitions)
+	connection := NewConnection(conn, config, server.BanLists)
+	connection.IdleTimeout = idleTimeout
+	connection.Events = server.Events
+	connection.Hooks = server.Hooks
+	connection.Access = AccessEvent{Time: time.Now(), RemoteIp: ipString(connection.RemoteIp())}
+	server.register(connection)
+	connectionsActive.Inc()
+	// the reason is set before every return, a panic overrides it
+	closeReason := closeReasonFinished
 	defer func() {
 		if rec := recover(); rec != nil {
 			log.Printf("[%v] Recovered from handle packet method %T: %v", conn.RemoteAddr(), rec, rec)
+			closeReason = closeReasonPanic
 		}
-		conn.Close()
-		log.Printf("[%v] <-- Closed connection.", conn.RemoteAddr())
+		connection.Close()
+		connection.releasePacketReader()
+		server.unregister(connection)
+		connectionsActive.Dec()
+		connectionsClosed.WithLabelValues(closeReason).Inc()
+		access := &connection.Access
+		access.CloseReason, access.Duration = closeReason, time.Since(access.Time)
+		access.BytesIn, access.BytesOut = atomic.LoadInt64(&conn.bytesIn), atomic.LoadInt64(&conn.bytesOut)
+		server.logAccess(access)
+		if access.Intent != "" {
+			server.recordVisitor(connection)
+		}
+		logDebugf("[%v] <-- Closed connection.", conn.RemoteAddr())
 	}()
-	// initial state is Handshaking (http://wiki.vg/Protocol#Definitions)
-	States[conn] = HandshakingState
+	if legacyPing, err := readLegacyPing(connection); err != nil {
+		log.Printf("[%v] Received invalid legacy ping data.\n", conn.RemoteAddr())
+		closeReason = closeReasonInvalidData
+		return
+	} else if legacyPing != nil {
+		logDebugf("[%v] Received legacy ping. [version=%v, payload=%v]\n", conn.RemoteAddr(), protocol.Describe(legacyPing.ProtocolVersion), legacyPing.Payload)
+		closeReason = closeReasonLegacyPing
+		connection.Access.Intent, connection.Access.Outcome = closeReasonLegacyPing, closeReasonLegacyPing
+		connection.Access.ProtocolVersion, connection.Access.Version = legacyPing.ProtocolVersion, protocol.Name(legacyPing.ProtocolVersion)
+		pings.WithLabelValues("legacy").Inc()
+		if connectionError := handleLegacyPing(connection, legacyPing); connectionError != nil {
+			log.Printf("[%v] Could not answer the legacy ping: %v\n", conn.RemoteAddr(), connectionError)
+		}
+		return
+	}
+	// the packet middleware is wrapped around the dispatching of the packets once per connection
+	handlePacket := connection.Hooks.wrap(dispatchPacket)
 	// infinite loop of packet reading
 	for {
-		if packet, err, _ := datatypes.ReadPacket(conn); err != nil {
-			if err == io.EOF {
+		if packet, err := connection.ReadPacket(); err != nil {
+			if !connectionOpen {
+				closeReason = closeReasonIdleTimeout
+				return
+			} else if connection.IsClosing() {
+				closeReason = closeReasonClosedByServer
+				return
+			} else if err == io.EOF {
+				closeReason = closeReasonEof
 				return
-			} else if err == io.ErrUnexpectedEOF {
+			} else if err == io.ErrUnexpectedEOF || err == datatypes.InvalidTypeSize {
 				log.Printf("[%v] Received invalid packet data.\n", conn.RemoteAddr())
+				closeReason = closeReasonInvalidData
+				packetDecodeErrors.WithLabelValues(connection.CurrentState.String(), decodeErrorTruncated).Inc()
+				return
+			} else if lengthError, invalidLength := err.(datatypes.ErrInvalidPacketLength); invalidLength {
+				log.Printf("[%v] Received packet with invalid length. [length=%v, maximum=%v, state=%v]\n", conn.RemoteAddr(), lengthError.Length, lengthError.MaximumLength, connection.CurrentState)
+				closeReason = closeReasonInvalidData
+				packetDecodeErrors.WithLabelValues(connection.CurrentState.String(), decodeErrorInvalidLength).Inc()
 				return
-			} else if !connectionOpen{
-				break
 			} else {
 				log.Printf("[%v] Unknown error while reading packet:\n", conn.RemoteAddr())
 				panic(err)
 			}
 		} else {
-			var packetHandleError ConnectionError
-			switch packet.Id {
-			case 0:
-				packetHandleError = handleHandshakePacket(conn, packet, config)
-				break
-			case 1:
-				packetHandleError = handlePingPacket(conn, packet)
-				break
-			default:
-				log.Printf("[%v] Received packet with unknown ID: %v\n", conn.RemoteAddr(), packet.Id)
+			handler, decodedPacket, ignored, err := lookupPacketHandler(connection, packet)
+			if err != nil {
+				log.Printf("[%v] Could not decode packet with the id %v: %v\n", conn.RemoteAddr(), packet.Id, err)
+				closeReason = closeReasonInvalidData
+				packetDecodeErrors.WithLabelValues(connection.CurrentState.String(), decodeErrorInvalidPacket).Inc()
+				return
+			} else if handler == nil {
+				if ignored {
+					continue
+				}
+				log.Printf("[%v] Received packet with unknown ID: %v [state=%v]\n", conn.RemoteAddr(), packet.Id, connection.CurrentState)
+				closeReason = closeReasonInvalidData
+				packetDecodeErrors.WithLabelValues(connection.CurrentState.String(), decodeErrorUnknownPacket).Inc()
 				return
 			}
+			handleStart := time.Now()
+			packetHandleError := handlePacket(connection, decodedPacket)
+			observePacketHandler(decodedPacket, handleStart)
 			if packetHandleError != nil {
 				if packetHandleError.IsFatal() {
 					log.Printf("[%v] A fatal error ocurred while handling a packet with the id %v:\n", conn.RemoteAddr(), packet.Id)
-					panic(err)
+					panic(packetHandleError)
 				} else {
-					log.Printf("[%v] Packet handle error ocurred: %T: %v\n", conn.RemoteAddr(), err, err.Error())
+					log.Printf("[%v] Packet handle error ocurred: %T: %v\n", conn.RemoteAddr(), packetHandleError, packetHandleError.Error())
+					closeReason = closeReasonHandlerError
 					return
 				}
 			}
+			if connection.Finished {
+				return
+			}
 		}
 	}
 }
@@ -154,88 +374,185 @@ func (errInvalidDataReceived ErrInvalidDataReceived) IsFatal() bool {
 	return false
 }
 
-func handleHandshakePacket(conn *net.TCPConn, packet datatypes.Packet, config *configuration.ServerConfiguration) ConnectionError {
-	currentState := States[conn]
-	switch currentState {
-	case HandshakingState:
-		version, err, _ := datatypes.ReadVarInt(packet.Content)
-		if err != nil {
-			return ErrInvalidDataReceived{"protocol version"}
-		}
-		connectAddress, err, _ := datatypes.ReadString(packet.Content)
-		if err != nil {
-			return ErrInvalidDataReceived{"server connect address"}
-		}
-		port, err := datatypes.ReadUnsignedShort(packet.Content)
-		if err != nil {
-			return ErrInvalidDataReceived{"server port"}
-		}
-		nextRawState, err, _ := datatypes.ReadVarInt(packet.Content)
-		var nextState ConnectionState
-		if err != nil {
-			return ErrInvalidDataReceived{"next state"}
-		} else if nextState, err = GetConnectionStateFromInt(nextRawState); err != nil {
-			return ErrBasedConnectionError{err, false}
-		} else {
-			States[conn] = nextState
-		}
-		log.Printf("[%v] Received handshake packet. [version=%v, connectAddress=%v, port=%v, nextRawState=%v]\n", conn.RemoteAddr(), version, connectAddress, port, nextRawState)
-		return nil
-	case StatusState:
-		// no additional data is sent which can be read
-		data, err := json.Marshal(&StatusResponse{
-			Version:     config.Motd.Version,
-			Players:     config.Motd.Players,
-			Description: config.Motd.Description,
-			Favicon:     config.Motd.FaviconPath,
-		})
-		if err != nil {
-			return ErrBasedConnectionError{fmt.Errorf("could not serialize Handshake MOTD data: %v", err), true}
-		} else {
-			buffer := bytes.NewBuffer([]byte{})
-			if err, _ := datatypes.WriteString(buffer, string(data)); err != nil {
-				return ErrBasedConnectionError{err, false}
-			}
-			err, _ := datatypes.WritePacket(conn, datatypes.Packet{Content: buffer, Id: 0})
-			if err != nil {
-				return ErrBasedConnectionError{err, false}
-			}
-		}
+func handleHandshakePacket(connection *Connection, packet Packet) ConnectionError {
+	handshake := packet.(*HandshakePacket)
+	nextState, err := GetConnectionStateFromInt(handshake.NextState)
+	if err != nil {
+		return ErrBasedConnectionError{err, false}
+	}
+	hostname, forwardedIp := parseHandshakeAddress(handshake.ServerAddress)
+	if !connection.Config.IpForwarding {
+		// every client could send a forwarded ip, it is only trusted if the server is behind a proxy
+		forwardedIp = nil
+	}
+	connection.update(func() {
+		connection.CurrentState = nextState
+		connection.ProtocolVersion, connection.ServerAddress, connection.ServerPort = handshake.ProtocolVersion, handshake.ServerAddress, handshake.ServerPort
+		connection.Access.Hostname = hostname
+	})
+	connection.Transferred = handshake.NextState == TransferIntent
+	intent := nextState.String()
+	if connection.Transferred {
+		intent = "transfer"
+	}
+	recordHandshake(handshake, hostname, intent)
+	access := &connection.Access
+	access.ProtocolVersion, access.Version, access.Intent = handshake.ProtocolVersion, protocol.Name(handshake.ProtocolVersion), intent
+	access.ForwardedIp, access.Port = ipString(forwardedIp), handshake.ServerPort
+	logDebugf("[%v] Received handshake packet. [version=%v, connectAddress=%v, port=%v, nextRawState=%v]\n", connection.Conn.RemoteAddr(), protocol.Describe(handshake.ProtocolVersion), handshake.ServerAddress, handshake.ServerPort, handshake.NextState)
+	// the address of the proxy was checked when the connection was accepted, the address of the client is only known now
+	if forwardedIp == nil {
 		return nil
-	case LoginState:
-		playerName, err, _ := datatypes.ReadString(packet.Content)
-		if err != nil {
-			return ErrInvalidDataReceived{"player name"}
+	}
+	if ipBan, banned := connection.BanLists.FindIpBan(forwardedIp); banned {
+		log.Printf("[%v] Rejected connection from banned forwarded address. [ip=%v, ban=%v, reason=%v]\n", connection.Conn.RemoteAddr(), access.ForwardedIp, ipBan.Ip, ipBan.Reason)
+		connection.publish(events.Event{Type: events.BanHit, Ip: access.ForwardedIp, Ban: ipBan.Ip, Reason: ipBan.Reason})
+		access.Outcome = loginOutcomeBanned
+		connection.Finished = true
+	}
+	return nil
+}
+
+func handleStatusRequestPacket(connection *Connection, packet Packet) ConnectionError {
+	// no additional data is sent which can be read
+	var status *StatusResponse
+	if connection.Hooks.StatusProvider != nil {
+		var err error
+		if status, err = connection.Hooks.StatusProvider.Status(connection.HandshakeContext()); err != nil {
+			return ErrBasedConnectionError{err, false}
 		}
-		// maximum length of a player name is 16 ascii characters
-		if len(playerName) > 16 {
-			return ErrInvalidDataReceived{fmt.Sprintf("player name length %v", strings.Replace(playerName, "\\", "\\\\", -1))}
+	}
+	var encoded []byte
+	var err error
+	if status != nil {
+		encoded, err = encodeStatus(status)
+	} else {
+		encoded, err = statusResponses.get(connection.Config, connection.ProtocolVersion)
+	}
+	if err != nil {
+		return ErrBasedConnectionError{err, true}
+	}
+	statusRequests.Inc()
+	connection.Access.Outcome = "status"
+	return connection.WriteEncodedPacket(encoded)
+}
+
+func handleLoginStartPacket(connection *Connection, packet Packet) ConnectionError {
+	conn, config, banLists := connection.Conn, connection.Config, connection.BanLists
+	loginStart := *packet.(*LoginStart)
+	connection.update(func() {
+		connection.Access.PlayerName = loginStart.Name
+	})
+	if config.OnlineMode.Enabled {
+		profile, connectionError := authenticate(connection, loginStart, config.OnlineMode)
+		if authenticationError, failed := connectionError.(ErrAuthenticationFailed); failed {
+			log.Printf("[%v] Player could not be authenticated. [playerName=%v, reason=%v]\n", conn.RemoteAddr(), loginStart.Name, authenticationError.Reason)
+			recordLoginOutcome(connection, loginStart, loginOutcomeAuthenticationFailed)
+			return connection.Disconnect(config.OnlineMode.FailureMessage)
+		} else if connectionError != nil {
+			return connectionError
 		}
-		data := bytes.NewBuffer([]byte{})
-		jsonBytes, err := json.Marshal(config.LoginAttempt.DisconnectText)
-		if err, _ = datatypes.WriteString(data, string(jsonBytes)); err != nil {
-			return ErrBasedConnectionError{err, false}
+		loginStart.Name, loginStart.Uuid = profile.Name, profile.Id
+		connection.update(func() {
+			connection.Access.PlayerName = profile.Name
+		})
+	} else {
+		// offline mode servers assign the offline uuid regardless of the uuid the client sent,
+		// the sent uuid must not match the bans, the whitelist or the rules of another player
+		loginStart.Uuid = bans.OfflinePlayerUuid(loginStart.Name)
+	}
+	playerName := loginStart.Name
+	if playerBan, banned := banLists.FindPlayerBan(playerName, loginStart.Uuid); banned {
+		log.Printf("[%v] Banned player tried to login. [playerName=%v, uuid=%v, reason=%v]\n", conn.RemoteAddr(), playerName, loginStart.Uuid, playerBan.Reason)
+		connection.publish(events.Event{Type: events.BanHit, PlayerName: playerName, PlayerUuid: loginStart.Uuid, Ban: playerBan.Name, Reason: playerBan.Reason})
+		recordLoginOutcome(connection, loginStart, loginOutcomeBanned)
+		return connection.Disconnect(renderBanMessage(config.Bans.BanMessage, playerBan.BanDetails))
+	}
+	attempt := loginAttempt{
+		PlayerName:  playerName,
+		PlayerUuid:  loginStart.Uuid,
+		Ip:          net.ParseIP(connection.clientIp()),
+		Whitelisted: banLists.IsWhitelisted(playerName, loginStart.Uuid),
+	}
+	if config.Bans.EnforceWhitelist && !attempt.Whitelisted {
+		log.Printf("[%v] Player which is not whitelisted tried to login. [playerName=%v, uuid=%v]\n", conn.RemoteAddr(), playerName, loginStart.Uuid)
+		recordLoginOutcome(connection, loginStart, loginOutcomeNotWhitelisted)
+		return connection.Disconnect(config.Bans.WhitelistMessage)
+	}
+	log.Printf("[%v] Received login attempt. [playerName=%v, uuid=%v, signed=%v, whitelisted=%v, transferred=%v]\n", conn.RemoteAddr(), playerName, loginStart.Uuid, loginStart.Signature != nil, attempt.Whitelisted, connection.Transferred)
+	disconnectText := chooseDisconnectText(config.LoginAttempt, attempt)
+	if config.Maintenance.Enabled {
+		disconnectText = config.Maintenance.DisconnectText
+	}
+	connection.Player = loginStart
+	if connection.Hooks.LoginHandler != nil {
+		disconnectText = connection.Hooks.LoginHandler.DisconnectText(connection.HandshakeContext(), loginStart, disconnectText)
+	}
+	if config.Queue.Enabled && protocol.FeaturesOf(connection.ProtocolVersion).Transfer {
+		// the queue starts when the client entered the configuration state
+		connection.configurationSession = func(connection *Connection) {
+			runConfigurationQueue(connection, disconnectText)
 		}
-		if err, _ = datatypes.WritePacket(conn, datatypes.Packet{Content: data, Id: 0}); err != nil {
-			return ErrBasedConnectionError{err, false}
+		recordLoginOutcome(connection, loginStart, loginOutcomeQueue)
+		return writeLoginSuccess(connection, loginStart.Uuid, loginStart.Name)
+	}
+	if config.Limbo.Enabled && isLimboEnabledForVersion(config.Limbo, connection.ProtocolVersion) {
+		recordLoginOutcome(connection, loginStart, loginOutcomeLimbo)
+		if limboProtocols[connection.ProtocolVersion].registries != nil {
+			// the limbo starts when the client entered the configuration state
+			connection.configurationResponses = make(chan Packet, 1)
+			connection.configurationSession = func(connection *Connection) {
+				runConfigurationLimbo(connection, config.Limbo, disconnectText)
+			}
+			return writeLoginSuccess(connection, loginStart.Uuid, loginStart.Name)
 		}
+		return runLimbo(connection, config.Limbo, config.Queue, disconnectText)
+	}
+	if config.Queue.Enabled && playerQueue.IsBackendAvailable() {
+		recordLoginOutcome(connection, loginStart, loginOutcomeQueueReady)
+		return connection.Disconnect(config.Queue.ReadyMessage)
+	}
+	recordLoginOutcome(connection, loginStart, loginOutcomeDisconnected)
+	return connection.Disconnect(disconnectText)
+}
+
+// 1.20.2+ clients acknowledge the Login Success and enter the configuration state
+func handleLoginAcknowledgedPacket(connection *Connection, packet Packet) ConnectionError {
+	if connection.configurationSession == nil {
+		return ErrInvalidDataReceived{"login acknowledgement without login success"}
+	}
+	connection.update(func() {
+		connection.CurrentState = ConfigurationState
+	})
+	if !connection.IdleTimeout.Stop() {
+		// the connection was closed by the idle timeout already
 		return nil
-	default:
-		return ErrBasedConnectionError{fmt.Errorf("can not handle Handshake packet with current state: %v", currentState), false}
 	}
+	go connection.configurationSession(connection)
+	return nil
 }
 
-func handlePingPacket(conn *net.TCPConn, packet datatypes.Packet) ConnectionError {
-	payload, err := datatypes.ReadLong(packet.Content)
-	if err != nil {
-		return ErrInvalidDataReceived{"ping payload"}
+// passes a response of the client to the configuration session which awaits it, responses which are not awaited are ignored
+func forwardConfigurationResponse(connection *Connection, packet Packet) ConnectionError {
+	if connection.configurationResponses == nil {
+		return nil
 	}
-	payloadBuffer := bytes.NewBuffer([]byte{})
-	if err = datatypes.WriteLong(payloadBuffer, payload); err != nil {
-		return ErrBasedConnectionError{err, false}
+	if _, acknowledged := packet.(*FinishConfigurationPacket); acknowledged {
+		// the next packets of the client belong to the play state
+		connection.update(func() {
+			connection.CurrentState = PlayState
+		})
 	}
-	if err, _ = datatypes.WritePacket(conn, datatypes.Packet{Content: payloadBuffer, Id: 1}); err != nil {
-		return ErrBasedConnectionError{err, false}
+	select {
+	case connection.configurationResponses <- packet:
+	default:
+		return ErrInvalidDataReceived{"configuration response which was not awaited"}
 	}
 	return nil
 }
+
+func handlePingPacket(connection *Connection, packet Packet) ConnectionError {
+	pings.WithLabelValues("status").Inc()
+	connection.Access.Outcome = "ping"
+	return connection.SendPacket(&PingPacket{packet.(*PingPacket).Payload})
+}
@@ -0,0 +1,104 @@
+package server
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"strings"
+	"sync"
+
+	"github.com/michivip/mcstatusserver/configuration"
+	"github.com/michivip/mcstatusserver/datatypes"
+	"github.com/michivip/mcstatusserver/protocol"
+)
+
+// this file contains the cache of the encoded status responses which are sent byte-for-byte to every client
+
+const versionPlaceholder = "{version}"
+
+// the encoded Status Response packets of a configuration
+// a configuration with the {version} placeholder has a packet per release name, all other configurations have a single packet
+type statusResponseCache struct {
+	mutex   sync.RWMutex
+	config  *configuration.ServerConfiguration
+	packets map[string][]byte
+}
+
+var statusResponses = &statusResponseCache{}
+
+// this method drops the cached status responses, they are built again on the next status request
+// it has to be called when the values of the status (e.g. the MOTD or the player counts) were changed
+func InvalidateStatusResponses() {
+	statusResponses.mutex.Lock()
+	defer statusResponses.mutex.Unlock()
+	statusResponses.config, statusResponses.packets = nil, nil
+}
+
+// this method returns the encoded Status Response packet for the given configuration and protocol version
+// the packet is built on the first request and cached until the configuration changes or the cache is invalidated
+func (cache *statusResponseCache) get(config *configuration.ServerConfiguration, protocolVersion int) ([]byte, error) {
+	versionName := ""
+	if strings.Contains(statusMotd(config).Version.Name, versionPlaceholder) {
+		versionName = protocol.Name(protocolVersion)
+	}
+	cache.mutex.RLock()
+	encoded, found := cache.packets[versionName]
+	cached := found && cache.config == config
+	cache.mutex.RUnlock()
+	if cached {
+		return encoded, nil
+	}
+	encoded, err := encodeStatusResponse(config, versionName)
+	if err != nil {
+		return nil, err
+	}
+	cache.mutex.Lock()
+	defer cache.mutex.Unlock()
+	if cache.config != config {
+		cache.config, cache.packets = config, map[string][]byte{}
+	}
+	cache.packets[versionName] = encoded
+	return encoded, nil
+}
+
+// returns the MOTD which is sent in the status, the texts of the maintenance mode replace its values while it is enabled
+func statusMotd(config *configuration.ServerConfiguration) configuration.MessageOfTheDayValues {
+	motd := config.Motd
+	if config.Maintenance.Enabled {
+		if config.Maintenance.Description != "" {
+			motd.Description.Text = config.Maintenance.Description
+		}
+		if config.Maintenance.VersionName != "" {
+			motd.Version.Name = config.Maintenance.VersionName
+		}
+	}
+	return motd
+}
+
+// this method builds the Status Response packet including its length and id
+func encodeStatusResponse(config *configuration.ServerConfiguration, versionName string) ([]byte, error) {
+	motd := statusMotd(config)
+	version := motd.Version
+	version.Name = strings.Replace(version.Name, versionPlaceholder, versionName, -1)
+	return encodeStatus(&StatusResponse{
+		Version:     version,
+		Players:     motd.Players,
+		Description: motd.Description,
+		Favicon:     motd.FaviconPath,
+	})
+}
+
+// this method builds the Status Response packet of the given status
+func encodeStatus(status *StatusResponse) ([]byte, error) {
+	data, err := json.Marshal(status)
+	if err != nil {
+		return nil, fmt.Errorf("could not serialize Handshake MOTD data: %v", err)
+	}
+	content := bytes.NewBuffer(make([]byte, 0, len(data)+5))
+	if err = (&StatusResponsePacket{string(data)}).Encode(content, 0); err != nil {
+		return nil, err
+	}
+	// the Status Response has the same id in all protocol versions
+	packetId, _ := DefaultPacketRegistry.PacketId(StatusState, ClientboundDirection, 0, &StatusResponsePacket{})
+	return datatypes.EncodePacket(datatypes.Packet{Id: packetId, Content: content})
+}
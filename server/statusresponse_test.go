@@ -0,0 +1,74 @@
+package server
+
+import (
+	"bytes"
+	"io/ioutil"
+	"strings"
+	"testing"
+
+	"github.com/michivip/mcstatusserver/configuration"
+	"github.com/michivip/mcstatusserver/datatypes"
+)
+
+func newStatusTestConfiguration() *configuration.ServerConfiguration {
+	config := &configuration.ServerConfiguration{}
+	config.Motd.Version.Name = "mcstatusserver {version}"
+	config.Motd.Version.Protocol = -1
+	config.Motd.Players.Max = 100
+	config.Motd.Description.Text = "status test"
+	config.Motd.FaviconPath = "data:image/png;base64," + strings.Repeat("A", 8192)
+	return config
+}
+
+func TestStatusResponseIsCached(t *testing.T) {
+	config := newStatusTestConfiguration()
+	first, err := statusResponses.get(config, 763)
+	if err != nil {
+		t.Fatal(err)
+	}
+	second, err := statusResponses.get(config, 763)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if &first[0] != &second[0] {
+		t.Error("the status response was built again instead of being reused")
+	}
+	packet, err, _ := datatypes.ReadPacket(bytes.NewReader(first))
+	if err != nil {
+		t.Fatal(err)
+	}
+	response := &StatusResponsePacket{}
+	if err = response.Decode(packet.Content, 763); err != nil {
+		t.Fatal(err)
+	}
+	if !strings.Contains(response.Response, `"name":"mcstatusserver 1.20.1"`) {
+		t.Errorf("the version name was not rendered: %v", response.Response)
+	}
+	other, err := statusResponses.get(config, 47)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if bytes.Equal(first, other) {
+		t.Error("the status responses of different releases are equal")
+	}
+	InvalidateStatusResponses()
+	rebuilt, err := statusResponses.get(config, 763)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if &first[0] == &rebuilt[0] || !bytes.Equal(first, rebuilt) {
+		t.Error("the invalidated status response was not rebuilt")
+	}
+}
+
+func BenchmarkStatusRequest(b *testing.B) {
+	connection := &Connection{Writer: ioutil.Discard, CurrentState: StatusState, ProtocolVersion: 763, Config: newStatusTestConfiguration()}
+	packet := &StatusRequestPacket{}
+	b.ReportAllocs()
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		if err := handleStatusRequestPacket(connection, packet); err != nil {
+			b.Fatal(err)
+		}
+	}
+}
@@ -0,0 +1,222 @@
+package server
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+
+	"github.com/michivip/mcstatusserver/configuration"
+	"github.com/michivip/mcstatusserver/datatypes"
+	"github.com/michivip/mcstatusserver/protocol"
+)
+
+// this file contains the serialization of chat values as text components (http://wiki.vg/Text_formatting)
+// the encoding depends on the protocol version and the state: the Login Disconnect packet always uses a JSON string,
+// the other packets of 1.20.3+ clients use NBT
+// features which are not supported by the client are downgraded (hex colors) or dropped (unknown colors and fields)
+
+// 1.8 added the insertion field
+const insertionVersion = 47
+
+// the colors which are supported by every version and their RGB values (used to downgrade hex colors)
+var legacyColors = []struct {
+	name string
+	rgb  int
+}{
+	{"black", 0x000000}, {"dark_blue", 0x0000AA}, {"dark_green", 0x00AA00}, {"dark_aqua", 0x00AAAA},
+	{"dark_red", 0xAA0000}, {"dark_purple", 0xAA00AA}, {"gold", 0xFFAA00}, {"gray", 0xAAAAAA},
+	{"dark_gray", 0x555555}, {"blue", 0x5555FF}, {"green", 0x55FF55}, {"aqua", 0x55FFFF},
+	{"red", 0xFF5555}, {"light_purple", 0xFF55FF}, {"yellow", 0xFFFF55}, {"white", 0xFFFFFF},
+}
+
+// a text component in the layout of the wire encodings, absent styles are nil
+// the order of the fields is the order of the encoded fields
+type textComponent struct {
+	Text          string          `json:"text" nbt:"text"`
+	Bold          *bool           `json:"bold,omitempty" nbt:"bold,omitempty"`
+	Italic        *bool           `json:"italic,omitempty" nbt:"italic,omitempty"`
+	Underlined    *bool           `json:"underlined,omitempty" nbt:"underlined,omitempty"`
+	Strikethrough *bool           `json:"strikethrough,omitempty" nbt:"strikethrough,omitempty"`
+	Obfuscated    *bool           `json:"obfuscated,omitempty" nbt:"obfuscated,omitempty"`
+	Color         string          `json:"color,omitempty" nbt:"color,omitempty"`
+	Insertion     string          `json:"insertion,omitempty" nbt:"insertion,omitempty"`
+	Extra         []textComponent `json:"extra,omitempty" nbt:"extra,omitempty"`
+}
+
+// a component can be sent as plain string as well
+func (component *textComponent) UnmarshalJSON(data []byte) error {
+	var text string
+	if err := json.Unmarshal(data, &text); err == nil {
+		*component = textComponent{Text: text}
+		return nil
+	}
+	type plainTextComponent textComponent
+	return json.Unmarshal(data, (*plainTextComponent)(component))
+}
+
+// this method converts the given chat value into a text component for the given protocol version
+func newTextComponent(text configuration.ChatValue, protocolVersion int) textComponent {
+	component := newTextComponentPart(configuration.ChatComponentValue{
+		Text:          text.Text,
+		Bold:          text.Bold,
+		Italic:        text.Italic,
+		Underlined:    text.Underlined,
+		Strikethrough: text.Strikethrough,
+		Obfuscated:    text.Obfuscated,
+		Color:         text.Color,
+		Insertion:     text.Insertion,
+	}, protocolVersion)
+	for _, extra := range text.Extra {
+		component.Extra = append(component.Extra, newTextComponentPart(extra, protocolVersion))
+	}
+	return component
+}
+
+func newTextComponentPart(value configuration.ChatComponentValue, protocolVersion int) textComponent {
+	component := textComponent{
+		Text:          value.Text,
+		Bold:          parseTextStyle(value.Bold),
+		Italic:        parseTextStyle(value.Italic),
+		Underlined:    parseTextStyle(value.Underlined),
+		Strikethrough: parseTextStyle(value.Strikethrough),
+		Obfuscated:    parseTextStyle(value.Obfuscated),
+		Color:         textColorFor(value.Color, protocolVersion),
+	}
+	if protocolVersion >= insertionVersion {
+		component.Insertion = value.Insertion
+	}
+	return component
+}
+
+// the styles are configured as "true" or "false", other values are left out
+func parseTextStyle(value string) *bool {
+	if value != "true" && value != "false" {
+		return nil
+	}
+	style := value == "true"
+	return &style
+}
+
+func formatTextStyle(value *bool) string {
+	if value == nil {
+		return ""
+	}
+	return strconv.FormatBool(*value)
+}
+
+// this method returns the color which is sent to the given protocol version, an unknown color is left out
+// hex colors (#RRGGBB) are replaced by the closest legacy color for clients before 1.16
+func textColorFor(color string, protocolVersion int) string {
+	color = strings.ToLower(color)
+	if color == "reset" {
+		return color
+	}
+	for _, legacyColor := range legacyColors {
+		if legacyColor.name == color {
+			return color
+		}
+	}
+	if len(color) != 7 || color[0] != '#' {
+		return ""
+	}
+	rgb, err := strconv.ParseUint(color[1:], 16, 32)
+	if err != nil {
+		return ""
+	}
+	if protocol.FeaturesOf(protocolVersion).HexColors {
+		return color
+	}
+	closest, closestDistance := "", -1
+	for _, legacyColor := range legacyColors {
+		distance := 0
+		for shift := uint(0); shift <= 16; shift += 8 {
+			difference := int(rgb>>shift&0xFF) - legacyColor.rgb>>shift&0xFF
+			distance += difference * difference
+		}
+		if closestDistance < 0 || distance < closestDistance {
+			closest, closestDistance = legacyColor.name, distance
+		}
+	}
+	return closest
+}
+
+// returns whether the text components are sent as NBT to the given protocol version in the given state
+func usesNbtTextComponents(protocolVersion int, state ConnectionState) bool {
+	return state != LoginState && protocol.FeaturesOf(protocolVersion).NbtTextComponents
+}
+
+// this method writes the given chat value as text component in the encoding of the given protocol version and state
+func writeChatValue(data *bytes.Buffer, text configuration.ChatValue, protocolVersion int, state ConnectionState) ConnectionError {
+	component := newTextComponent(text, protocolVersion)
+	var err error
+	if usesNbtTextComponents(protocolVersion, state) {
+		err = datatypes.WriteNetworkNbt(data, component)
+	} else {
+		err, _ = datatypes.WriteTextComponent(data, component)
+	}
+	if err != nil {
+		return ErrBasedConnectionError{fmt.Errorf("could not serialize chat text: %v", err), true}
+	}
+	return nil
+}
+
+// this method reads a text component in the encoding of the given protocol version and state
+func readChatValue(reader io.Reader, text *configuration.ChatValue, protocolVersion int, state ConnectionState) error {
+	var component textComponent
+	if usesNbtTextComponents(protocolVersion, state) {
+		value, err := datatypes.ReadNetworkNbt(reader)
+		if err != nil || datatypes.UnmarshalNbt(normalizeTextComponentNbt(value), &component) != nil {
+			return ErrInvalidDataReceived{"chat text"}
+		}
+	} else if err, _ := datatypes.ReadTextComponent(reader, &component); err != nil {
+		return ErrInvalidDataReceived{"chat text"}
+	}
+	*text = configuration.ChatValue{
+		Text:          component.Text,
+		Bold:          formatTextStyle(component.Bold),
+		Italic:        formatTextStyle(component.Italic),
+		Underlined:    formatTextStyle(component.Underlined),
+		Strikethrough: formatTextStyle(component.Strikethrough),
+		Obfuscated:    formatTextStyle(component.Obfuscated),
+		Color:         component.Color,
+		Insertion:     component.Insertion,
+	}
+	for _, extra := range component.Extra {
+		text.Extra = append(text.Extra, configuration.ChatComponentValue{
+			Text:          extra.Text,
+			Bold:          formatTextStyle(extra.Bold),
+			Italic:        formatTextStyle(extra.Italic),
+			Underlined:    formatTextStyle(extra.Underlined),
+			Strikethrough: formatTextStyle(extra.Strikethrough),
+			Obfuscated:    formatTextStyle(extra.Obfuscated),
+			Color:         extra.Color,
+			Insertion:     extra.Insertion,
+		})
+	}
+	return nil
+}
+
+// a component (or an element of its extra list) can be sent as plain string tag, it is converted into a compound
+func normalizeTextComponentNbt(value interface{}) interface{} {
+	switch value := value.(type) {
+	case string:
+		return datatypes.NbtCompound{{Name: "text", Value: value}}
+	case datatypes.NbtCompound:
+		normalized := make(datatypes.NbtCompound, len(value))
+		for index, field := range value {
+			normalized[index] = field
+			if extra, isList := field.Value.(datatypes.NbtList); isList && field.Name == "extra" {
+				elements := make([]interface{}, len(extra.Elements))
+				for elementIndex, element := range extra.Elements {
+					elements[elementIndex] = normalizeTextComponentNbt(element)
+				}
+				normalized[index].Value = datatypes.NbtList{ElementType: datatypes.NbtTagCompound, Elements: elements}
+			}
+		}
+		return normalized
+	}
+	return value
+}
@@ -0,0 +1,106 @@
+package server
+
+import (
+	"bytes"
+	"encoding/hex"
+	"reflect"
+	"testing"
+
+	"github.com/michivip/mcstatusserver/configuration"
+	"github.com/michivip/mcstatusserver/datatypes"
+)
+
+var testChatValue = configuration.ChatValue{
+	Text:      "hi",
+	Bold:      "true",
+	Italic:    "false",
+	Color:     "#FF0000",
+	Insertion: "insert",
+	Extra:     []configuration.ChatComponentValue{{Text: "!", Underlined: "yes", Color: "rainbow"}},
+}
+
+func TestTextComponentEncoding(t *testing.T) {
+	for _, test := range []struct {
+		packet          Packet
+		protocolVersion int
+		golden          string
+	}{
+		// 1.7 does not know the insertion, the hex color is downgraded
+		{&LoginDisconnectPacket{testChatValue}, 5, `{"text":"hi","bold":true,"italic":false,"color":"dark_red","extra":[{"text":"!"}]}`},
+		{&LoginDisconnectPacket{testChatValue}, 340, `{"text":"hi","bold":true,"italic":false,"color":"dark_red","insertion":"insert","extra":[{"text":"!"}]}`},
+		{&DisconnectPacket{testChatValue}, 764, `{"text":"hi","bold":true,"italic":false,"color":"#ff0000","insertion":"insert","extra":[{"text":"!"}]}`},
+		// the Login Disconnect stays a JSON string for 1.20.3+
+		{&LoginDisconnectPacket{testChatValue}, 765, `{"text":"hi","bold":true,"italic":false,"color":"#ff0000","insertion":"insert","extra":[{"text":"!"}]}`},
+	} {
+		data := bytes.NewBuffer([]byte{})
+		if err := test.packet.Encode(data, test.protocolVersion); err != nil {
+			t.Fatalf("%v: could not encode %T: %v", test.protocolVersion, test.packet, err)
+		}
+		encoded, err, _ := datatypes.ReadString(data)
+		if err != nil || encoded != test.golden {
+			t.Errorf("%v: %T was encoded as %v instead of %v (error: %v)", test.protocolVersion, test.packet, encoded, test.golden, err)
+		}
+	}
+	data := bytes.NewBuffer([]byte{})
+	if err := (&DisconnectPacket{testChatValue}).Encode(data, 765); err != nil {
+		t.Fatalf("could not encode the NBT disconnect: %v", err)
+	}
+	value, err := datatypes.ReadNetworkNbt(data)
+	if err != nil {
+		t.Fatalf("could not read the NBT disconnect: %v", err)
+	}
+	if formatted, _ := datatypes.FormatSnbt(value); formatted != `{text:"hi",bold:1b,italic:0b,color:"#ff0000",insertion:"insert",extra:[{text:"!"}]}` {
+		t.Errorf("the NBT disconnect was encoded as %v", formatted)
+	}
+}
+
+func TestTextComponentDecoding(t *testing.T) {
+	expected := configuration.ChatValue{
+		Text:      "hi",
+		Bold:      "true",
+		Italic:    "false",
+		Color:     "#ff0000",
+		Insertion: "insert",
+		Extra:     []configuration.ChatComponentValue{{Text: "!"}},
+	}
+	for _, protocolVersion := range []int{764, 765} {
+		data := bytes.NewBuffer([]byte{})
+		(&DisconnectPacket{testChatValue}).Encode(data, protocolVersion)
+		disconnect := &DisconnectPacket{}
+		if err := disconnect.Decode(data, protocolVersion); err != nil || !reflect.DeepEqual(disconnect.Text, expected) {
+			t.Errorf("%v: decoded %#v (error: %v)", protocolVersion, disconnect.Text, err)
+		}
+	}
+	// plain strings are valid components in both encodings
+	for protocolVersion, encoded := range map[int]string{
+		764: "08225c753030343122",
+		765: "08000141",
+	} {
+		data, _ := hex.DecodeString(encoded)
+		disconnect := &DisconnectPacket{}
+		if err := disconnect.Decode(bytes.NewReader(data), protocolVersion); err != nil || disconnect.Text.Text != "A" {
+			t.Errorf("%v: decoded %#v (error: %v)", protocolVersion, disconnect.Text, err)
+		}
+	}
+}
+
+func TestTextColorFor(t *testing.T) {
+	for _, test := range []struct {
+		color           string
+		protocolVersion int
+		expected        string
+	}{
+		{"Gold", 47, "gold"},
+		{"reset", 47, "reset"},
+		{"#FFFF44", 47, "yellow"},
+		{"#101010", 754, "#101010"},
+		{"#101010", 578, "black"},
+		{"#12345", 754, ""},
+		{"#zzzzzz", 754, ""},
+		{"", 754, ""},
+	} {
+		if color := textColorFor(test.color, test.protocolVersion); color != test.expected {
+			t.Errorf("%v was converted to %q for %v instead of %q", test.color, color, test.protocolVersion, test.expected)
+		}
+	}
+}